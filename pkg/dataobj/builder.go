@@ -1,8 +1,10 @@
 package dataobj
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 )
 
 // A Builder builds data objects from a set of incoming log data. Log data is
@@ -75,3 +77,19 @@ func (b *Builder) Flush(output *bytes.Buffer) (int64, error) {
 func (b *Builder) Reset() {
 	b.encoder.Reset()
 }
+
+// FlushTo flushes all buffered data to w like [Builder.Flush], writing it in
+// chunks instead of requiring the whole object to be copied into a buffer.
+func (b *Builder) FlushTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	sz, err := b.encoder.Flush(bw)
+	if err != nil {
+		return sz, fmt.Errorf("building object: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return sz, fmt.Errorf("writing object: %w", err)
+	}
+
+	b.Reset()
+	return sz, nil
+}
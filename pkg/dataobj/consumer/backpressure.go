@@ -0,0 +1,106 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// flushBackpressure tracks the flushes in flight across all partitions, so
+// the consumer can pause fetching new records while object storage can't keep
+// up. A nil *flushBackpressure never pauses.
+type flushBackpressure struct {
+	limit int
+
+	mtx      sync.Mutex
+	inflight int
+	// drained is closed once inflight drops below limit again.
+	drained chan struct{}
+
+	paused        prometheus.Gauge
+	pausedSeconds prometheus.Counter
+}
+
+// newFlushBackpressure returns a flushBackpressure pausing at limit in-flight
+// flushes, or nil if limit is 0.
+func newFlushBackpressure(limit int, reg prometheus.Registerer) *flushBackpressure {
+	if limit <= 0 {
+		return nil
+	}
+	return &flushBackpressure{
+		limit: limit,
+		paused: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "loki_dataobj_consumer_paused",
+			Help: "Whether fetching records is paused because too many flushes are in flight (1 for paused, 0 for fetching).",
+		}),
+		pausedSeconds: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "loki_dataobj_consumer_paused_seconds_total",
+			Help: "Total time fetching records was paused because too many flushes were in flight in seconds.",
+		}),
+	}
+}
+
+// flushStarted records the start of a flush.
+func (b *flushBackpressure) flushStarted() {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.inflight++
+}
+
+// flushDone records the end of a flush, resuming fetching if enough flushes have drained.
+func (b *flushBackpressure) flushDone() {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.inflight--
+	if b.inflight < b.limit && b.drained != nil {
+		close(b.drained)
+		b.drained = nil
+	}
+}
+
+// wait blocks while the limit of in-flight flushes is reached or until ctx is done.
+func (b *flushBackpressure) wait(ctx context.Context) {
+	if b == nil {
+		return
+	}
+
+	var start time.Time
+	defer func() {
+		if !start.IsZero() {
+			b.paused.Set(0)
+			b.pausedSeconds.Add(time.Since(start).Seconds())
+		}
+	}()
+
+	for {
+		b.mtx.Lock()
+		if b.inflight < b.limit {
+			b.mtx.Unlock()
+			return
+		}
+		if b.drained == nil {
+			b.drained = make(chan struct{})
+		}
+		drained := b.drained
+		b.mtx.Unlock()
+
+		if start.IsZero() {
+			start = time.Now()
+			b.paused.Set(1)
+		}
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
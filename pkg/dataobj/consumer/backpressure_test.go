@@ -0,0 +1,63 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlushBackpressure(t *testing.T) {
+	require.Nil(t, newFlushBackpressure(0, prometheus.NewRegistry()))
+
+	b := newFlushBackpressure(2, prometheus.NewRegistry())
+	ctx := context.Background()
+
+	// Below the limit, fetching isn't paused.
+	b.flushStarted()
+	b.wait(ctx)
+	require.Equal(t, float64(0), testutil.ToFloat64(b.pausedSeconds))
+
+	b.flushStarted()
+	resumed := make(chan struct{})
+	go func() {
+		b.wait(ctx)
+		close(resumed)
+	}()
+
+	require.Eventually(t, func() bool { return testutil.ToFloat64(b.paused) == 1 }, time.Second, time.Millisecond)
+	select {
+	case <-resumed:
+		t.Fatal("expected fetching to be paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.flushDone()
+	select {
+	case <-resumed:
+	case <-time.After(time.Second):
+		t.Fatal("expected fetching to resume once flushes drained")
+	}
+	require.Equal(t, float64(0), testutil.ToFloat64(b.paused))
+	require.Greater(t, testutil.ToFloat64(b.pausedSeconds), float64(0))
+}
+
+func TestFlushBackpressureCancelled(t *testing.T) {
+	b := newFlushBackpressure(1, prometheus.NewRegistry())
+	b.flushStarted()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	b.wait(ctx)
+	require.Equal(t, float64(0), testutil.ToFloat64(b.paused))
+}
+
+func TestNilFlushBackpressure(t *testing.T) {
+	var b *flushBackpressure
+	b.flushStarted()
+	b.flushDone()
+	b.wait(context.Background())
+}
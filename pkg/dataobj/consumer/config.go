@@ -5,19 +5,31 @@ import (
 	"time"
 
 	"github.com/grafana/loki/v3/pkg/dataobj/consumer/logsobj"
+	"github.com/grafana/loki/v3/pkg/dataobj/metastore"
 	"github.com/grafana/loki/v3/pkg/dataobj/uploader"
 )
 
 type Config struct {
 	logsobj.BuilderConfig
-	UploaderConfig   uploader.Config `yaml:"uploader"`
-	IdleFlushTimeout time.Duration   `yaml:"idle_flush_timeout"`
+	UploaderConfig   uploader.Config         `yaml:"uploader"`
+	MetastoreMetrics metastore.MetricsConfig `yaml:"metastore_metrics"`
+	IdleFlushTimeout time.Duration           `yaml:"idle_flush_timeout"`
+	MaxFlushJitter   time.Duration           `yaml:"max_initial_flush_jitter"`
+
+	MaxInflightFlushes int `yaml:"max_inflight_flushes"`
+
+	DeduplicationWindow int `yaml:"deduplication_window"`
+
+	TransactionalCommits bool `yaml:"transactional_commits"`
 }
 
 func (cfg *Config) Validate() error {
 	if err := cfg.UploaderConfig.Validate(); err != nil {
 		return err
 	}
+	if err := cfg.MetastoreMetrics.Validate(); err != nil {
+		return err
+	}
 
 	return cfg.BuilderConfig.Validate()
 }
@@ -29,6 +41,11 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 func (cfg *Config) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
 	cfg.BuilderConfig.RegisterFlagsWithPrefix(prefix, f)
 	cfg.UploaderConfig.RegisterFlagsWithPrefix(prefix, f)
+	cfg.MetastoreMetrics.RegisterFlagsWithPrefix(prefix, f)
 
 	f.DurationVar(&cfg.IdleFlushTimeout, prefix+"idle-flush-timeout", 60*60*time.Second, "The maximum amount of time to wait in seconds before flushing an object that is no longer receiving new writes")
+	f.IntVar(&cfg.MaxInflightFlushes, prefix+"max-inflight-flushes", 0, "The maximum number of flushes in flight across all partitions. Fetching new records is paused at the limit until flushes complete, so the consumer doesn't fall further behind while object storage can't keep up. 0 disables the limit.")
+	f.IntVar(&cfg.DeduplicationWindow, prefix+"deduplication-window", 0, "The number of most recently consumed record offsets to remember per partition, so records delivered again within the window, e.g. when a consume cycle is retried, are skipped instead of being appended twice. The offsets are only kept in memory, so they are forgotten when the partition is reassigned or the consumer restarts, and records delivered again after that are not skipped. 0 disables deduplication.")
+	f.BoolVar(&cfg.TransactionalCommits, prefix+"transactional-commits", false, "Only commit the offset of a record once the data object it was appended to has been uploaded and added to the metastore, so a crash never loses committed records. Records appended after the last flush are consumed again after a crash. When disabled, the offset of the record which triggered a flush is committed after the flush. Either way, a failed flush commits nothing and rewinds the partition, so the records it lost are consumed again.")
+	f.DurationVar(&cfg.MaxFlushJitter, prefix+"max-initial-flush-jitter", 0, "The maximum random delay added to the first idle flush of each partition, to avoid partitions which start at the same time from flushing at the same time. 0 disables jitter.")
 }
@@ -0,0 +1,37 @@
+package consumer
+
+// recentOffsets is a bounded set of the most recently seen record offsets of
+// a partition, used to skip records which are delivered again, e.g. when a
+// consume cycle is retried. Once full, the oldest offset is forgotten for each
+// new one. The offsets are only kept in memory by the processor of the
+// partition, so they are lost when the partition is reassigned or the consumer
+// restarts: records delivered again after that are not skipped.
+type recentOffsets struct {
+	seen  map[int64]struct{}
+	order []int64 // ring buffer of the offsets in seen, oldest at next
+	next  int
+}
+
+func newRecentOffsets(size int) *recentOffsets {
+	return &recentOffsets{
+		seen:  make(map[int64]struct{}, size),
+		order: make([]int64, 0, size),
+	}
+}
+
+// add records offset as seen. It returns false if offset was already seen.
+func (r *recentOffsets) add(offset int64) bool {
+	if _, ok := r.seen[offset]; ok {
+		return false
+	}
+
+	if len(r.order) < cap(r.order) {
+		r.order = append(r.order, offset)
+	} else {
+		delete(r.seen, r.order[r.next])
+		r.order[r.next] = offset
+		r.next = (r.next + 1) % len(r.order)
+	}
+	r.seen[offset] = struct{}{}
+	return true
+}
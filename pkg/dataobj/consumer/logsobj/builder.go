@@ -8,6 +8,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"sort"
 	"time"
 
@@ -27,9 +28,13 @@ import (
 
 // ErrBuilderFull is returned by [Builder.Append] when the buffer is
 // full and needs to flush; call [Builder.Flush] to flush it.
+//
+// ErrInvalidLabels is returned by [Builder.Append] when the labels of the
+// stream cannot be parsed.
 var (
-	ErrBuilderFull  = errors.New("builder full")
-	ErrBuilderEmpty = errors.New("builder empty")
+	ErrBuilderFull   = errors.New("builder full")
+	ErrBuilderEmpty  = errors.New("builder empty")
+	ErrInvalidLabels = errors.New("failed to parse labels")
 )
 
 // BuilderConfig configures a [Builder].
@@ -126,6 +131,11 @@ type Builder struct {
 	streams *streams.Builder
 	logs    *logs.Builder
 
+	// logsSectionSizes are the estimated sizes of the logs sections appended since the last reset.
+	logsSectionSizes []int
+	// entryCount is the number of entries appended since the last reset.
+	entryCount int64
+
 	state builderState
 }
 
@@ -186,21 +196,31 @@ func (b *Builder) Append(stream logproto.Stream) error {
 	if err != nil {
 		return err
 	}
+	return b.append(ls, stream.Entries)
+}
+
+// AppendLabels is like [Builder.Append] for a stream whose labels are already
+// parsed, which avoids formatting and parsing them again. The builder retains
+// ls, so callers must not modify them afterwards.
+func (b *Builder) AppendLabels(ls labels.Labels, entries []logproto.Entry) error {
+	return b.append(ls, entries)
+}
 
+func (b *Builder) append(ls labels.Labels, entries []logproto.Entry) error {
 	// Check whether the buffer is full before a stream can be appended; this is
 	// tends to overestimate, but we may still go over our target size.
 	//
 	// Since this check only happens after the first call to Append,
 	// b.currentSizeEstimate will always be updated to reflect the size following
 	// the previous append.
-	if b.state != builderStateEmpty && b.currentSizeEstimate+labelsEstimate(ls)+streamSizeEstimate(stream) > int(b.cfg.TargetObjectSize) {
+	if b.state != builderStateEmpty && b.currentSizeEstimate+labelsEstimate(ls)+entriesSizeEstimate(entries) > int(b.cfg.TargetObjectSize) {
 		return ErrBuilderFull
 	}
 
 	timer := prometheus.NewTimer(b.metrics.appendTime)
 	defer timer.ObserveDuration()
 
-	for _, entry := range stream.Entries {
+	for _, entry := range entries {
 		sz := int64(len(entry.Line))
 		for _, md := range entry.StructuredMetadata {
 			sz += int64(len(md.Value))
@@ -214,13 +234,15 @@ func (b *Builder) Append(stream logproto.Stream) error {
 			Metadata:  convertMetadata(entry.StructuredMetadata),
 			Line:      []byte(entry.Line),
 		})
+		b.entryCount++
 
 		// If our logs section has gotten big enough, we want to flush it to the
 		// encoder and start a new section.
-		if b.logs.EstimatedSize() > int(b.cfg.TargetSectionSize) {
+		if size := b.logs.EstimatedSize(); size > int(b.cfg.TargetSectionSize) {
 			if err := b.builder.Append(b.logs); err != nil {
 				return err
 			}
+			b.logsSectionSizes = append(b.logsSectionSizes, size)
 		}
 	}
 
@@ -237,7 +259,7 @@ func (b *Builder) parseLabels(labelString string) (labels.Labels, error) {
 
 	labels, err := syntax.ParseLabels(labelString)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse labels: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidLabels, err)
 	}
 	b.labelCache.Add(labelString, labels)
 	return labels, nil
@@ -260,10 +282,10 @@ func labelsEstimate(ls labels.Labels) int {
 	return keysSize + valuesSize/2
 }
 
-// streamSizeEstimate estimates the size of a stream in bytes.
-func streamSizeEstimate(stream logproto.Stream) int {
+// entriesSizeEstimate estimates the size of the entries of a stream in bytes.
+func entriesSizeEstimate(entries []logproto.Entry) int {
 	var size int
-	for _, entry := range stream.Entries {
+	for _, entry := range entries {
 		// We only check the size of the line and metadata. Timestamps and IDs
 		// encode so well that they're unlikely to make a singificant impact on our
 		// size estimate.
@@ -301,6 +323,13 @@ func (b *Builder) estimatedSize() int {
 type FlushStats struct {
 	MinTimestamp time.Time
 	MaxTimestamp time.Time
+
+	// LogsSectionSizes are the estimated sizes in bytes of the logs sections of
+	// the flushed object, before encoding.
+	LogsSectionSizes []int
+
+	StreamCount int   // Number of streams in the flushed object.
+	EntryCount  int64 // Number of log entries in the flushed object.
 }
 
 // Flush flushes all buffered data to the buffer provided. Calling Flush can result
@@ -315,19 +344,17 @@ func (b *Builder) Flush(output *bytes.Buffer) (FlushStats, error) {
 	timer := prometheus.NewTimer(b.metrics.buildTime)
 	defer timer.ObserveDuration()
 
-	// Appending sections resets them, so we need to load the time range before
-	// appending.
-	minTime, maxTime := b.streams.TimeRange()
-
-	// Flush sections one more time in case they have data.
-	var flushErrors []error
-
-	flushErrors = append(flushErrors, b.builder.Append(b.streams))
-	flushErrors = append(flushErrors, b.builder.Append(b.logs))
-
-	if err := errors.Join(flushErrors...); err != nil {
-		b.metrics.flushFailures.Inc()
-		return FlushStats{}, fmt.Errorf("building object: %w", err)
+	streamCount := b.streams.StreamCount()
+	minTime, maxTime, err := b.appendSections()
+	if err != nil {
+		return FlushStats{}, err
+	}
+	stats := FlushStats{
+		MinTimestamp:     minTime,
+		MaxTimestamp:     maxTime,
+		LogsSectionSizes: b.logsSectionSizes,
+		StreamCount:      streamCount,
+		EntryCount:       b.entryCount,
 	}
 
 	sz, err := b.builder.Flush(output)
@@ -354,7 +381,65 @@ func (b *Builder) Flush(output *bytes.Buffer) (FlushStats, error) {
 	err = b.observeObject(context.Background(), obj)
 
 	b.Reset()
-	return FlushStats{MinTimestamp: minTime, MaxTimestamp: maxTime}, err
+	return stats, err
+}
+
+// FlushTo flushes all buffered data to w like [Builder.Flush], streaming the
+// encoded object instead of copying all of it into a buffer. As the object
+// can't be read back from w, it isn't observed in the object metrics.
+func (b *Builder) FlushTo(w io.Writer) (FlushStats, error) {
+	if b.state == builderStateEmpty {
+		return FlushStats{}, ErrBuilderEmpty
+	}
+
+	timer := prometheus.NewTimer(b.metrics.buildTime)
+	defer timer.ObserveDuration()
+
+	streamCount := b.streams.StreamCount()
+	minTime, maxTime, err := b.appendSections()
+	if err != nil {
+		return FlushStats{}, err
+	}
+	stats := FlushStats{
+		MinTimestamp:     minTime,
+		MaxTimestamp:     maxTime,
+		LogsSectionSizes: b.logsSectionSizes,
+		StreamCount:      streamCount,
+		EntryCount:       b.entryCount,
+	}
+
+	sz, err := b.builder.FlushTo(w)
+	if err != nil {
+		b.metrics.flushFailures.Inc()
+		return FlushStats{}, fmt.Errorf("building object: %w", err)
+	}
+	b.metrics.builtSize.Observe(float64(sz))
+
+	b.Reset()
+	return stats, nil
+}
+
+// appendSections appends the pending sections to the object builder and returns the time range of their data.
+func (b *Builder) appendSections() (time.Time, time.Time, error) {
+	// Appending sections resets them, so we need to load the time range before
+	// appending.
+	minTime, maxTime := b.streams.TimeRange()
+
+	// Flush sections one more time in case they have data.
+	var flushErrors []error
+
+	logsSize := b.logs.EstimatedSize()
+	flushErrors = append(flushErrors, b.builder.Append(b.streams))
+	flushErrors = append(flushErrors, b.builder.Append(b.logs))
+	if logsSize > 0 {
+		b.logsSectionSizes = append(b.logsSectionSizes, logsSize)
+	}
+
+	if err := errors.Join(flushErrors...); err != nil {
+		b.metrics.flushFailures.Inc()
+		return time.Time{}, time.Time{}, fmt.Errorf("building object: %w", err)
+	}
+	return minTime, maxTime, nil
 }
 
 func (b *Builder) observeObject(ctx context.Context, obj *dataobj.Object) error {
@@ -393,9 +478,22 @@ func (b *Builder) Reset() {
 
 	b.metrics.sizeEstimate.Set(0)
 	b.currentSizeEstimate = 0
+	// Flushed stats may still reference the previous sizes.
+	b.logsSectionSizes = nil
+	b.entryCount = 0
 	b.state = builderStateEmpty
 }
 
+// SetTargetSectionSize changes the target size of sections appended after the
+// call. It returns an error if size is invalid for the config of the builder.
+func (b *Builder) SetTargetSectionSize(size flagext.Bytes) error {
+	if size <= 0 || size > b.cfg.TargetObjectSize {
+		return errors.New("SectionSize must be greater than 0 and less than or equal to TargetObjectSize")
+	}
+	b.cfg.TargetSectionSize = size
+	return nil
+}
+
 // RegisterMetrics registers metrics about builder to report to reg. All
 // metrics will have a tenant label set to the tenant ID of the Builder.
 //
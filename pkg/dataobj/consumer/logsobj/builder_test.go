@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/stretchr/testify/require"
 
 	"github.com/grafana/loki/pkg/push"
@@ -141,3 +142,75 @@ func TestBuilder_Append(t *testing.T) {
 		require.NoError(t, err)
 	}
 }
+
+// TestBuilder_AppendLabels ensures that appending streams with parsed labels
+// builds the same object as appending them with their label strings.
+func TestBuilder_AppendLabels(t *testing.T) {
+	stream := logproto.Stream{
+		Labels:  `{cluster="test",app="foo"}`,
+		Entries: []push.Entry{{Timestamp: time.Unix(10, 0).UTC(), Line: "hello"}},
+	}
+
+	var expected, actual bytes.Buffer
+	builder, err := NewBuilder(testBuilderConfig)
+	require.NoError(t, err)
+	require.NoError(t, builder.Append(stream))
+	_, err = builder.Flush(&expected)
+	require.NoError(t, err)
+
+	builder, err = NewBuilder(testBuilderConfig)
+	require.NoError(t, err)
+	require.NoError(t, builder.AppendLabels(labels.FromStrings("app", "foo", "cluster", "test"), stream.Entries))
+	_, err = builder.Flush(&actual)
+	require.NoError(t, err)
+
+	require.Equal(t, expected.Bytes(), actual.Bytes())
+}
+
+func TestBuilder_SetTargetSectionSize(t *testing.T) {
+	builder, err := NewBuilder(testBuilderConfig)
+	require.NoError(t, err)
+
+	require.Error(t, builder.SetTargetSectionSize(0))
+	require.Error(t, builder.SetTargetSectionSize(testBuilderConfig.TargetObjectSize+1))
+	require.NoError(t, builder.SetTargetSectionSize(16*1024))
+
+	for i := 0; i < 64; i++ {
+		require.NoError(t, builder.Append(logproto.Stream{
+			Labels:  `{cluster="test",app="foo"}`,
+			Entries: []push.Entry{{Timestamp: time.Unix(int64(1000+i), 0).UTC(), Line: strings.Repeat("a", 1024)}},
+		}))
+	}
+
+	stats, err := builder.Flush(bytes.NewBuffer(nil))
+	require.NoError(t, err)
+	require.Greater(t, len(stats.LogsSectionSizes), 1, "expected data to be split into several sections")
+	for _, size := range stats.LogsSectionSizes[:len(stats.LogsSectionSizes)-1] {
+		require.Greater(t, size, 16*1024)
+	}
+}
+
+func TestBuilder_FlushStatsCounts(t *testing.T) {
+	builder, err := NewBuilder(testBuilderConfig)
+	require.NoError(t, err)
+
+	for _, stream := range []logproto.Stream{
+		{Labels: `{app="foo"}`, Entries: []push.Entry{{Timestamp: time.Unix(10, 0), Line: "a"}, {Timestamp: time.Unix(20, 0), Line: "b"}}},
+		{Labels: `{app="bar"}`, Entries: []push.Entry{{Timestamp: time.Unix(15, 0), Line: "c"}}},
+		{Labels: `{app="foo"}`, Entries: []push.Entry{{Timestamp: time.Unix(30, 0), Line: "d"}}},
+	} {
+		require.NoError(t, builder.Append(stream))
+	}
+
+	stats, err := builder.Flush(bytes.NewBuffer(nil))
+	require.NoError(t, err)
+	require.Equal(t, 2, stats.StreamCount)
+	require.Equal(t, int64(4), stats.EntryCount)
+
+	// Counts start over after a flush.
+	require.NoError(t, builder.Append(logproto.Stream{Labels: `{app="baz"}`, Entries: []push.Entry{{Timestamp: time.Unix(40, 0), Line: "e"}}}))
+	stats, err = builder.Flush(bytes.NewBuffer(nil))
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.StreamCount)
+	require.Equal(t, int64(1), stats.EntryCount)
+}
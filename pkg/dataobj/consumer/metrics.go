@@ -8,13 +8,22 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+type appendFailureReason string
+
+const (
+	appendFailureTooLarge      appendFailureReason = "too_large"
+	appendFailureInvalidLabels appendFailureReason = "invalid_labels"
+	appendFailureBuilderFull   appendFailureReason = "builder_full"
+	appendFailureOther         appendFailureReason = "other"
+)
+
 type partitionOffsetMetrics struct {
 	currentOffset prometheus.GaugeFunc
 	lastOffset    atomic.Int64
 
 	// Error counters
 	commitFailures prometheus.Counter
-	appendFailures prometheus.Counter
+	appendFailures *prometheus.CounterVec
 
 	// Request counters
 	commitsTotal prometheus.Counter
@@ -23,8 +32,32 @@ type partitionOffsetMetrics struct {
 	// Processing delay histogram
 	processingDelay prometheus.Histogram
 
+	// Number of streams appended per consumed batch of records
+	appendBatchSize prometheus.Histogram
+
+	// Age of the oldest record appended to the builder but not yet flushed
+	oldestBufferedAge       prometheus.GaugeFunc
+	oldestBufferedTimestamp atomic.Int64
+
+	// Estimated size of the data buffered in the builder
+	builderBytes prometheus.Gauge
+
 	// Data volume metrics
 	bytesProcessed prometheus.Counter
+
+	// Records skipped because they were already processed
+	duplicateRecords prometheus.Counter
+
+	// Time between writing a flushed object to the metastore and committing its records
+	commitFlushGap prometheus.Histogram
+
+	// Streams which failed to be written to the tee sink, and the time streams
+	// waited before being written to it
+	teeFailures *prometheus.CounterVec
+	teeLag      prometheus.Histogram
+
+	// unregistered is set once the metrics have been unregistered.
+	unregistered atomic.Bool
 }
 
 func newPartitionOffsetMetrics() *partitionOffsetMetrics {
@@ -33,10 +66,10 @@ func newPartitionOffsetMetrics() *partitionOffsetMetrics {
 			Name: "loki_dataobj_consumer_commit_failures_total",
 			Help: "Total number of commit failures",
 		}),
-		appendFailures: prometheus.NewCounter(prometheus.CounterOpts{
+		appendFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name: "loki_dataobj_consumer_append_failures_total",
 			Help: "Total number of append failures",
-		}),
+		}, []string{"reason"}),
 		appendsTotal: prometheus.NewCounter(prometheus.CounterOpts{
 			Name: "loki_dataobj_consumer_appends_total",
 			Help: "Total number of appends",
@@ -53,10 +86,46 @@ func newPartitionOffsetMetrics() *partitionOffsetMetrics {
 			NativeHistogramMaxBucketNumber:  100,
 			NativeHistogramMinResetDuration: 0,
 		}),
+		appendBatchSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:                            "loki_dataobj_consumer_append_batch_size",
+			Help:                            "Number of streams appended per consumed batch of records",
+			Buckets:                         prometheus.ExponentialBuckets(1, 2, 13),
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  100,
+			NativeHistogramMinResetDuration: 0,
+		}),
+		builderBytes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "loki_dataobj_consumer_builder_bytes",
+			Help: "Estimated size in bytes of the data buffered in the builder but not yet flushed",
+		}),
 		bytesProcessed: prometheus.NewCounter(prometheus.CounterOpts{
 			Name: "loki_dataobj_consumer_bytes_processed_total",
 			Help: "Total number of bytes processed from this partition",
 		}),
+		duplicateRecords: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "loki_dataobj_consumer_duplicate_records_total",
+			Help: "Total number of records skipped because a record with the same offset was processed recently",
+		}),
+		commitFlushGap: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:                            "loki_dataobj_consumer_commit_flush_gap_seconds",
+			Help:                            "Time between adding a flushed data object to the metastore and committing the offsets of its records in seconds",
+			Buckets:                         prometheus.DefBuckets,
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  100,
+			NativeHistogramMinResetDuration: 0,
+		}),
+		teeFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "loki_dataobj_consumer_tee_failures_total",
+			Help: "Total number of appended streams which failed to be written to the tee sink",
+		}, []string{"reason"}),
+		teeLag: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:                            "loki_dataobj_consumer_tee_lag_seconds",
+			Help:                            "Time between appending a stream and writing it to the tee sink in seconds",
+			Buckets:                         prometheus.DefBuckets,
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  100,
+			NativeHistogramMinResetDuration: 0,
+		}),
 	}
 
 	p.currentOffset = prometheus.NewGaugeFunc(
@@ -67,6 +136,14 @@ func newPartitionOffsetMetrics() *partitionOffsetMetrics {
 		p.getCurrentOffset,
 	)
 
+	p.oldestBufferedAge = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "loki_dataobj_consumer_oldest_buffered_age_seconds",
+			Help: "Age of the oldest record which has been buffered but not yet flushed, in seconds",
+		},
+		p.getOldestBufferedAge,
+	)
+
 	return p
 }
 
@@ -74,13 +151,28 @@ func (p *partitionOffsetMetrics) getCurrentOffset() float64 {
 	return float64(p.lastOffset.Load())
 }
 
+func (p *partitionOffsetMetrics) getOldestBufferedAge() float64 {
+	oldest := p.oldestBufferedTimestamp.Load()
+	if oldest == 0 {
+		return 0 // Nothing is buffered
+	}
+	return time.Since(time.Unix(0, oldest)).Seconds()
+}
+
 func (p *partitionOffsetMetrics) register(reg prometheus.Registerer) error {
 	collectors := []prometheus.Collector{
 		p.commitFailures,
 		p.appendFailures,
 		p.currentOffset,
 		p.processingDelay,
+		p.appendBatchSize,
+		p.oldestBufferedAge,
+		p.builderBytes,
 		p.bytesProcessed,
+		p.duplicateRecords,
+		p.commitFlushGap,
+		p.teeFailures,
+		p.teeLag,
 	}
 
 	for _, collector := range collectors {
@@ -93,13 +185,26 @@ func (p *partitionOffsetMetrics) register(reg prometheus.Registerer) error {
 	return nil
 }
 
+// unregister unregisters the metrics from reg. Only the first call has an effect, so a late
+// call for a revoked partition can't unregister the metrics of a processor it was reassigned to.
 func (p *partitionOffsetMetrics) unregister(reg prometheus.Registerer) {
+	if !p.unregistered.CompareAndSwap(false, true) {
+		return
+	}
+
 	collectors := []prometheus.Collector{
 		p.commitFailures,
 		p.appendFailures,
 		p.currentOffset,
 		p.processingDelay,
+		p.appendBatchSize,
+		p.oldestBufferedAge,
+		p.builderBytes,
 		p.bytesProcessed,
+		p.duplicateRecords,
+		p.commitFlushGap,
+		p.teeFailures,
+		p.teeLag,
 	}
 
 	for _, collector := range collectors {
@@ -115,8 +220,24 @@ func (p *partitionOffsetMetrics) incCommitFailures() {
 	p.commitFailures.Inc()
 }
 
-func (p *partitionOffsetMetrics) incAppendFailures() {
-	p.appendFailures.Inc()
+func (p *partitionOffsetMetrics) incAppendFailures(reason appendFailureReason) {
+	p.appendFailures.WithLabelValues(string(reason)).Inc()
+}
+
+func (p *partitionOffsetMetrics) incDuplicateRecords() {
+	p.duplicateRecords.Inc()
+}
+
+func (p *partitionOffsetMetrics) observeCommitFlushGap(gap time.Duration) {
+	p.commitFlushGap.Observe(gap.Seconds())
+}
+
+func (p *partitionOffsetMetrics) incTeeFailures(reason teeFailureReason) {
+	p.teeFailures.WithLabelValues(string(reason)).Inc()
+}
+
+func (p *partitionOffsetMetrics) observeTeeLag(lag time.Duration) {
+	p.teeLag.Observe(lag.Seconds())
 }
 
 func (p *partitionOffsetMetrics) incAppendsTotal() {
@@ -134,6 +255,36 @@ func (p *partitionOffsetMetrics) observeProcessingDelay(recordTimestamp time.Tim
 	}
 }
 
+func (p *partitionOffsetMetrics) observeAppendBatchSize(streams int) {
+	p.appendBatchSize.Observe(float64(streams))
+}
+
+// observeBufferedRecord tracks the timestamp of a record which has been buffered but not yet flushed.
+func (p *partitionOffsetMetrics) observeBufferedRecord(recordTimestamp time.Time) {
+	if recordTimestamp.IsZero() {
+		return
+	}
+	ts := recordTimestamp.UnixNano()
+	for {
+		oldest := p.oldestBufferedTimestamp.Load()
+		if oldest != 0 && oldest <= ts {
+			return
+		}
+		if p.oldestBufferedTimestamp.CompareAndSwap(oldest, ts) {
+			return
+		}
+	}
+}
+
+// resetOldestBuffered clears the oldest buffered record after all buffered records have been flushed.
+func (p *partitionOffsetMetrics) resetOldestBuffered() {
+	p.oldestBufferedTimestamp.Store(0)
+}
+
+func (p *partitionOffsetMetrics) setBuilderBytes(bytes int) {
+	p.builderBytes.Set(float64(bytes))
+}
+
 func (p *partitionOffsetMetrics) addBytesProcessed(bytes int64) {
 	p.bytesProcessed.Add(float64(bytes))
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"math/rand"
 	"strconv"
 	"sync"
 	"time"
@@ -19,20 +20,35 @@ import (
 	"github.com/grafana/loki/v3/pkg/dataobj/metastore"
 	"github.com/grafana/loki/v3/pkg/dataobj/uploader"
 	"github.com/grafana/loki/v3/pkg/kafka"
+	"github.com/grafana/loki/v3/pkg/logproto"
 )
 
+// committer commits the offsets of consumed records, and rewinds the partition
+// to consume records again after a failed flush.
+type committer interface {
+	CommitRecords(ctx context.Context, rs ...*kgo.Record) error
+	SetOffsets(setOffsets map[string]map[int32]kgo.EpochOffset)
+}
+
+// objectUploader uploads flushed data objects.
+type objectUploader interface {
+	Upload(ctx context.Context, object *bytes.Buffer) (string, error)
+	UnregisterMetrics(reg prometheus.Registerer)
+}
+
 type partitionProcessor struct {
 	// Kafka client and topic/partition info
-	client    *kgo.Client
+	client    committer
 	topic     string
 	partition int32
 	tenantID  []byte
 	// Processing pipeline
-	records          chan *kgo.Record
+	records          chan consumedRecord
 	builder          *logsobj.Builder
 	decoder          *kafka.Decoder
-	uploader         *uploader.Uploader
+	uploader         objectUploader
 	metastoreUpdater *metastore.Updater
+	metastoreReg     prometheus.Registerer
 
 	// Builder initialization
 	builderOnce sync.Once
@@ -44,25 +60,85 @@ type partitionProcessor struct {
 	idleFlushTimeout time.Duration
 	lastFlush        time.Time
 	lastModified     time.Time
+	// flushJitter delays the first idle flush so partitions started together
+	// don't flush together. It is cleared after the first flush.
+	flushJitter time.Duration
+
+	// recentOffsets are the offsets of the most recently processed records, if
+	// records are deduplicated.
+	recentOffsets *recentOffsets
+
+	// transactionalCommits only commits offsets of records once they have been
+	// added to the metastore. lastAppended is the last record appended to the
+	// builder since the last flush, and flushedRecord the last record of a
+	// successful flush which hasn't been committed yet.
+	transactionalCommits bool
+	lastAppended         *kgo.Record
+	flushedRecord        *kgo.Record
+	// metastoreWrittenAt is when the last flush was added to the metastore, if
+	// its records haven't been committed yet.
+	metastoreWrittenAt time.Time
+
+	// nextOffset is the offset of the first record which isn't committed, or
+	// -1 before the first record is processed. lastOffset is the offset of the
+	// last processed record. After a failed flush the partition is rewound to
+	// the first record which isn't persisted, and rewoundFrom is set to
+	// lastOffset: the records after it were queued before the rewind, so they
+	// are skipped until the rewound records are consumed again. It is -1
+	// otherwise.
+	nextOffset  int64
+	lastOffset  int64
+	rewoundFrom int64
+
+	// tee writes appended streams to a secondary sink, if configured.
+	tee *teeWriter
 
 	// Metrics
 	metrics *partitionOffsetMetrics
 
 	// Control and coordination
-	ctx    context.Context
-	cancel context.CancelFunc
-	wg     sync.WaitGroup
-	reg    prometheus.Registerer
-	logger log.Logger
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+	reg      prometheus.Registerer
+	logger   log.Logger
 
 	eventsProducerClient *kgo.Client
+	backpressure         *flushBackpressure
+}
+
+// processorOption configures optional dependencies of a partition processor.
+type processorOption func(*partitionProcessor)
+
+// withEventsProducer makes the processor emit an event to client for every
+// flushed object.
+func withEventsProducer(client *kgo.Client) processorOption {
+	return func(p *partitionProcessor) {
+		p.eventsProducerClient = client
+	}
+}
+
+// withBackpressure makes the processor report its flushes to backpressure.
+func withBackpressure(backpressure *flushBackpressure) processorOption {
+	return func(p *partitionProcessor) {
+		p.backpressure = backpressure
+	}
+}
+
+// withTeeSink makes the processor write appended streams to sink, if not nil.
+func withTeeSink(sink TeeSink) processorOption {
+	return func(p *partitionProcessor) {
+		if sink != nil {
+			p.tee = newTeeWriter(sink, string(p.tenantID), p.metrics, p.logger)
+		}
+	}
 }
 
 func newPartitionProcessor(
 	ctx context.Context,
 	client *kgo.Client,
-	builderCfg logsobj.BuilderConfig,
-	uploaderCfg uploader.Config,
+	cfg Config,
 	bucket objstore.Bucket,
 	tenantID string,
 	virtualShard int32,
@@ -71,14 +147,24 @@ func newPartitionProcessor(
 	logger log.Logger,
 	reg prometheus.Registerer,
 	bufPool *sync.Pool,
-	idleFlushTimeout time.Duration,
-	eventsProducerClient *kgo.Client,
+	opts ...processorOption,
 ) *partitionProcessor {
 	ctx, cancel := context.WithCancel(ctx)
 	decoder, err := kafka.NewDecoder()
 	if err != nil {
 		panic(err)
 	}
+	// Metastore metrics are labelled separately as their tenant label is
+	// configurable. They have no topic label, as the topic names the tenant.
+	metastoreLabels := prometheus.Labels{
+		"shard":     strconv.Itoa(int(virtualShard)),
+		"partition": strconv.Itoa(int(partition)),
+	}
+	if tenantLabel := cfg.MetastoreMetrics.TenantLabelValue(tenantID); tenantLabel != "" {
+		metastoreLabels["tenant"] = tenantLabel
+	}
+	metastoreReg := prometheus.WrapRegistererWith(metastoreLabels, reg)
+
 	reg = prometheus.WrapRegistererWith(prometheus.Labels{
 		"shard":     strconv.Itoa(int(virtualShard)),
 		"partition": strconv.Itoa(int(partition)),
@@ -91,85 +177,140 @@ func newPartitionProcessor(
 		level.Error(logger).Log("msg", "failed to register partition metrics", "err", err)
 	}
 
-	uploader := uploader.New(uploaderCfg, bucket, tenantID)
+	uploader := uploader.New(cfg.UploaderConfig, bucket, tenantID)
 	if err := uploader.RegisterMetrics(reg); err != nil {
 		level.Error(logger).Log("msg", "failed to register uploader metrics", "err", err)
 	}
 
 	metastoreUpdater := metastore.NewUpdater(bucket, tenantID, logger)
-	if err := metastoreUpdater.RegisterMetrics(reg); err != nil {
+	if err := metastoreUpdater.RegisterMetrics(metastoreReg); err != nil {
 		level.Error(logger).Log("msg", "failed to register metastore updater metrics", "err", err)
 	}
 
-	return &partitionProcessor{
+	logger = log.With(logger, "topic", topic, "partition", partition, "tenant", tenantID)
+
+	var flushJitter time.Duration
+	if cfg.MaxFlushJitter > 0 {
+		flushJitter = time.Duration(rand.Int63n(int64(cfg.MaxFlushJitter)))
+		level.Debug(logger).Log("msg", "applying initial flush jitter", "jitter", flushJitter)
+	}
+
+	var recent *recentOffsets
+	if cfg.DeduplicationWindow > 0 {
+		recent = newRecentOffsets(cfg.DeduplicationWindow)
+	}
+
+	p := &partitionProcessor{
 		client:               client,
-		logger:               log.With(logger, "topic", topic, "partition", partition, "tenant", tenantID),
+		logger:               logger,
 		topic:                topic,
 		partition:            partition,
-		records:              make(chan *kgo.Record, 1000),
+		records:              make(chan consumedRecord, 1000),
 		ctx:                  ctx,
 		cancel:               cancel,
 		decoder:              decoder,
 		reg:                  reg,
-		builderCfg:           builderCfg,
+		builderCfg:           cfg.BuilderConfig,
 		bucket:               bucket,
 		tenantID:             []byte(tenantID),
 		metrics:              metrics,
 		uploader:             uploader,
 		metastoreUpdater:     metastoreUpdater,
+		metastoreReg:         metastoreReg,
 		bufPool:              bufPool,
-		idleFlushTimeout:     idleFlushTimeout,
+		idleFlushTimeout:     cfg.IdleFlushTimeout,
+		flushJitter:          flushJitter,
 		lastFlush:            time.Now(),
 		lastModified:         time.Now(),
-		eventsProducerClient: eventsProducerClient,
+		recentOffsets:        recent,
+		transactionalCommits: cfg.TransactionalCommits,
+		nextOffset:           -1,
+		lastOffset:           -1,
+		rewoundFrom:          -1,
 	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
 }
 
 func (p *partitionProcessor) start() {
+	if p.tee != nil {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.tee.run(p.ctx)
+		}()
+	}
+
 	p.wg.Add(1)
 	go func() {
 		defer p.wg.Done()
 
 		level.Info(p.logger).Log("msg", "started partition processor")
+		// Streams appended from the current batch of records.
+		var appended int
 		for {
 			select {
 			case <-p.ctx.Done():
 				level.Info(p.logger).Log("msg", "stopping partition processor")
 				return
-			case record, ok := <-p.records:
+			case consumed, ok := <-p.records:
 				if !ok {
 					// Channel was closed
 					return
 				}
-				p.processRecord(record)
+				if p.processRecord(consumed.record) {
+					appended++
+				}
+				if consumed.lastInBatch {
+					p.metrics.observeAppendBatchSize(appended)
+					appended = 0
+				}
 
-			case <-time.After(p.idleFlushTimeout):
+			case <-time.After(p.idleFlushTimeout + p.flushJitter):
 				p.idleFlush()
 			}
 		}
 	}()
 }
 
+// stop stops the processor and unregisters its metrics. It is safe to call
+// more than once.
 func (p *partitionProcessor) stop() {
-	p.cancel()
-	p.wg.Wait()
-	if p.builder != nil {
-		p.builder.UnregisterMetrics(p.reg)
-	}
-	p.metrics.unregister(p.reg)
-	p.uploader.UnregisterMetrics(p.reg)
+	p.stopOnce.Do(func() {
+		p.cancel()
+		p.wg.Wait()
+		// Closing the updater writes buffered metastore updates and releases its memory.
+		if err := p.metastoreUpdater.Close(); err != nil {
+			level.Error(p.logger).Log("msg", "failed to close metastore updater", "err", err)
+		}
+		if p.builder != nil {
+			p.builder.UnregisterMetrics(p.reg)
+		}
+		p.metrics.unregister(p.reg)
+		p.uploader.UnregisterMetrics(p.reg)
+		p.metastoreUpdater.UnregisterMetrics(p.metastoreReg)
+	})
+}
+
+// consumedRecord is a record queued for processing. lastInBatch marks the last
+// record of a consumed batch, so the streams appended per batch can be observed.
+type consumedRecord struct {
+	record      *kgo.Record
+	lastInBatch bool
 }
 
 // Drops records from the channel if the processor is stopped.
 // Returns false if the processor is stopped, true otherwise.
 func (p *partitionProcessor) Append(records []*kgo.Record) bool {
-	for _, record := range records {
+	for i, record := range records {
 		select {
 		// must check per-record in order to not block on a full channel
 		// after receiver has been stopped.
 		case <-p.ctx.Done():
 			return false
-		case p.records <- record:
+		case p.records <- consumedRecord{record: record, lastInBatch: i == len(records)-1}:
 		}
 	}
 	return true
@@ -194,6 +335,9 @@ func (p *partitionProcessor) initBuilder() error {
 }
 
 func (p *partitionProcessor) flushStream(flushBuffer *bytes.Buffer) error {
+	p.backpressure.flushStarted()
+	defer p.backpressure.flushDone()
+
 	stats, err := p.builder.Flush(flushBuffer)
 	if err != nil {
 		level.Error(p.logger).Log("msg", "failed to flush builder", "err", err)
@@ -206,17 +350,31 @@ func (p *partitionProcessor) flushStream(flushBuffer *bytes.Buffer) error {
 		return err
 	}
 
-	if err := p.metastoreUpdater.Update(p.ctx, objectPath, stats.MinTimestamp, stats.MaxTimestamp); err != nil {
+	pathStats := metastore.PathStats{
+		SizeBytes:   int64(flushBuffer.Len()),
+		StreamCount: stats.StreamCount,
+		EntryCount:  stats.EntryCount,
+	}
+	if err := p.metastoreUpdater.UpdateWithStats(p.ctx, objectPath, stats.MinTimestamp, stats.MaxTimestamp, pathStats); err != nil {
 		level.Error(p.logger).Log("msg", "failed to update metastore", "err", err)
 		return err
 	}
 
+	p.metastoreWrittenAt = time.Now()
+	if p.lastAppended != nil {
+		p.flushedRecord = p.lastAppended
+		p.lastAppended = nil
+	}
+
 	if err := p.emitObjectWrittenEvent(objectPath); err != nil {
 		level.Error(p.logger).Log("msg", "failed to emit event", "err", err)
 		return err
 	}
 
 	p.lastFlush = time.Now()
+	p.flushJitter = 0
+	p.metrics.resetOldestBuffered()
+	p.metrics.setBuilderBytes(p.builder.GetEstimatedSize())
 
 	return nil
 }
@@ -251,39 +409,60 @@ func (p *partitionProcessor) emitObjectWrittenEvent(objectPath string) error {
 	return nil
 }
 
-func (p *partitionProcessor) processRecord(record *kgo.Record) {
+// processRecord appends the stream of record to the builder, flushing the
+// builder first if it is full. It returns whether the stream was appended.
+func (p *partitionProcessor) processRecord(record *kgo.Record) bool {
+	if p.rewoundFrom >= 0 {
+		if record.Offset > p.rewoundFrom {
+			// Queued before the partition was rewound, it is consumed again later.
+			return false
+		}
+		p.rewoundFrom = -1
+	}
+	if p.nextOffset < 0 {
+		p.nextOffset = record.Offset
+	}
+	p.lastOffset = record.Offset
+
 	// Update offset metric at the end of processing
 	defer p.metrics.updateOffset(record.Offset)
 
+	if p.recentOffsets != nil && !p.recentOffsets.add(record.Offset) {
+		level.Debug(p.logger).Log("msg", "skipping duplicate record", "offset", record.Offset)
+		p.metrics.incDuplicateRecords()
+		return false
+	}
+
 	// Observe processing delay
 	p.metrics.observeProcessingDelay(record.Timestamp)
 
 	// Initialize builder if this is the first record
 	if err := p.initBuilder(); err != nil {
 		level.Error(p.logger).Log("msg", "failed to initialize builder", "err", err)
-		return
+		return false
 	}
 
 	// todo: handle multi-tenant
 	if !bytes.Equal(record.Key, p.tenantID) {
 		level.Error(p.logger).Log("msg", "record key does not match tenant ID", "key", record.Key, "tenant_id", p.tenantID)
-		return
+		return false
 	}
 	stream, err := p.decoder.DecodeWithoutLabels(record.Value)
 	if err != nil {
 		level.Error(p.logger).Log("msg", "failed to decode record", "err", err)
-		return
+		return false
 	}
 
 	p.metrics.incAppendsTotal()
+	appended := true
 	if err := p.builder.Append(stream); err != nil {
 		if !errors.Is(err, logsobj.ErrBuilderFull) {
 			level.Error(p.logger).Log("msg", "failed to append stream", "err", err)
-			p.metrics.incAppendFailures()
-			return
+			p.metrics.incAppendFailures(classifyAppendFailure(err, false))
+			return false
 		}
 
-		func() {
+		flushed := func() bool {
 			flushBuffer := p.bufPool.Get().(*bytes.Buffer)
 			defer p.bufPool.Put(flushBuffer)
 
@@ -291,23 +470,62 @@ func (p *partitionProcessor) processRecord(record *kgo.Record) {
 
 			if err := p.flushStream(flushBuffer); err != nil {
 				level.Error(p.logger).Log("msg", "failed to flush stream", "err", err)
-				return
+				return false
 			}
+			return true
 		}()
+		if !flushed {
+			// The record is consumed again from the rewound partition.
+			p.rewind()
+			return false
+		}
 
-		if err := p.commitRecords(record); err != nil {
+		if err := p.commitFlush(record); err != nil {
 			level.Error(p.logger).Log("msg", "failed to commit records", "err", err)
-			return
+			return false
 		}
 
 		p.metrics.incAppendsTotal()
 		if err := p.builder.Append(stream); err != nil {
 			level.Error(p.logger).Log("msg", "failed to append stream after flushing", "err", err)
-			p.metrics.incAppendFailures()
+			p.metrics.incAppendFailures(classifyAppendFailure(err, true))
+			appended = false
+		} else {
+			p.lastAppended = record
+			p.metrics.observeBufferedRecord(record.Timestamp)
+			p.teeStream(stream)
 		}
+	} else {
+		p.lastAppended = record
+		p.metrics.observeBufferedRecord(record.Timestamp)
+		p.teeStream(stream)
 	}
+	p.metrics.setBuilderBytes(p.builder.GetEstimatedSize())
 
 	p.lastModified = time.Now()
+	return appended
+}
+
+// teeStream queues an appended stream to be written to the tee sink, if configured.
+func (p *partitionProcessor) teeStream(stream logproto.Stream) {
+	if p.tee != nil {
+		p.tee.enqueue(stream)
+	}
+}
+
+// classifyAppendFailure returns the reason a stream failed to be appended to the builder.
+// A full builder after a successful flush means the stream doesn't even fit into an empty builder.
+func classifyAppendFailure(err error, flushed bool) appendFailureReason {
+	switch {
+	case errors.Is(err, logsobj.ErrInvalidLabels):
+		return appendFailureInvalidLabels
+	case errors.Is(err, logsobj.ErrBuilderFull) && flushed:
+		return appendFailureTooLarge
+	case errors.Is(err, logsobj.ErrBuilderFull):
+		return appendFailureBuilderFull
+	default:
+		return appendFailureOther
+	}
 }
 
 func (p *partitionProcessor) commitRecords(record *kgo.Record) error {
@@ -323,6 +541,11 @@ func (p *partitionProcessor) commitRecords(record *kgo.Record) error {
 		p.metrics.incCommitsTotal()
 		err := p.client.CommitRecords(p.ctx, record)
 		if err == nil {
+			p.nextOffset = record.Offset + 1
+			if !p.metastoreWrittenAt.IsZero() {
+				p.metrics.observeCommitFlushGap(time.Since(p.metastoreWrittenAt))
+				p.metastoreWrittenAt = time.Time{}
+			}
 			return nil
 		}
 		level.Error(p.logger).Log("msg", "failed to commit records", "err", err)
@@ -333,6 +556,51 @@ func (p *partitionProcessor) commitRecords(record *kgo.Record) error {
 	return lastErr
 }
 
+// rewind discards the records buffered in the builder after a failed flush, and
+// rewinds the partition to the first record which isn't persisted, so they are
+// consumed again instead of being lost, and no offsets are committed past them.
+func (p *partitionProcessor) rewind() {
+	p.builder.Reset()
+	p.lastAppended = nil
+	p.metrics.resetOldestBuffered()
+	p.metrics.setBuilderBytes(p.builder.GetEstimatedSize())
+	if p.recentOffsets != nil {
+		// The rewound records must not be skipped as duplicates.
+		p.recentOffsets = newRecentOffsets(cap(p.recentOffsets.order))
+	}
+
+	offset := p.nextOffset
+	if p.flushedRecord != nil {
+		offset = max(offset, p.flushedRecord.Offset+1)
+	}
+	if offset < 0 {
+		return
+	}
+	level.Warn(p.logger).Log("msg", "rewinding partition after failed flush", "offset", offset)
+	p.client.SetOffsets(map[string]map[int32]kgo.EpochOffset{
+		p.topic: {p.partition: {Epoch: -1, Offset: offset}},
+	})
+	p.rewoundFrom = p.lastOffset
+}
+
+// commitFlush commits offsets after a successful flush triggered by appending
+// record failed with a full builder. With transactional commits, only the last
+// record added to the metastore by a flush is committed, if any. Otherwise,
+// record itself is committed.
+func (p *partitionProcessor) commitFlush(record *kgo.Record) error {
+	if !p.transactionalCommits {
+		return p.commitRecords(record)
+	}
+	if p.flushedRecord == nil {
+		return nil
+	}
+	if err := p.commitRecords(p.flushedRecord); err != nil {
+		return err
+	}
+	p.flushedRecord = nil
+	return nil
+}
+
 // idleFlush flushes the file if it has been idle for too long.
 // This is used to avoid holding on to memory for too long.
 // We compare the current time with the last flush time to determine if the builder has been idle.
@@ -341,7 +609,7 @@ func (p *partitionProcessor) idleFlush() {
 		return
 	}
 
-	if time.Since(p.lastModified) < p.idleFlushTimeout {
+	if time.Since(p.lastModified) < p.idleFlushTimeout+p.flushJitter {
 		return // Avoid checking too frequently
 	}
 
@@ -353,9 +621,20 @@ func (p *partitionProcessor) idleFlush() {
 
 		if err := p.flushStream(flushBuffer); err != nil {
 			level.Error(p.logger).Log("msg", "failed to flush stream", "err", err)
+			if !errors.Is(err, logsobj.ErrBuilderEmpty) {
+				p.rewind()
+			}
 			return
 		}
 
 		p.lastFlush = time.Now()
 	}()
+
+	// Without transactional commits, offsets are only committed once the
+	// builder is full.
+	if p.transactionalCommits {
+		if err := p.commitFlush(nil); err != nil {
+			level.Error(p.logger).Log("msg", "failed to commit records", "err", err)
+		}
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"strings"
 	"sync"
@@ -12,11 +13,14 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/require"
 	"github.com/thanos-io/objstore"
 	"github.com/twmb/franz-go/pkg/kgo"
 
 	"github.com/grafana/loki/v3/pkg/dataobj/consumer/logsobj"
+	"github.com/grafana/loki/v3/pkg/dataobj/metastore"
 	"github.com/grafana/loki/v3/pkg/dataobj/uploader"
 	"github.com/grafana/loki/v3/pkg/logproto"
 
@@ -155,8 +159,11 @@ func TestIdleFlush(t *testing.T) {
 			p := newPartitionProcessor(
 				context.Background(),
 				&kgo.Client{},
-				testBuilderConfig,
-				uploader.Config{},
+				Config{
+					BuilderConfig:    testBuilderConfig,
+					UploaderConfig:   uploader.Config{SHAPrefixSize: 2},
+					IdleFlushTimeout: tc.idleTimeout,
+				},
 				bucket,
 				"test-tenant",
 				0,
@@ -165,8 +172,6 @@ func TestIdleFlush(t *testing.T) {
 				log.NewNopLogger(),
 				prometheus.NewRegistry(),
 				bufPool,
-				tc.idleTimeout,
-				nil,
 			)
 
 			if tc.initBuilder {
@@ -190,10 +195,10 @@ func TestIdleFlush(t *testing.T) {
 			require.NoError(t, err)
 
 			// Send a record to the processor
-			p.records <- &kgo.Record{
+			require.True(t, p.Append([]*kgo.Record{{
 				Value: streamBytes,
 				Key:   []byte("test-tenant"),
-			}
+			}}))
 
 			// Wait for specified duration
 			time.Sleep(tc.sleepDuration)
@@ -225,8 +230,11 @@ func TestIdleFlushWithActiveProcessing(t *testing.T) {
 	p := newPartitionProcessor(
 		context.Background(),
 		&kgo.Client{},
-		testBuilderConfig,
-		uploader.Config{},
+		Config{
+			BuilderConfig:    testBuilderConfig,
+			UploaderConfig:   uploader.Config{SHAPrefixSize: 2},
+			IdleFlushTimeout: 200 * time.Millisecond,
+		},
 		bucket,
 		"test-tenant",
 		0,
@@ -235,8 +243,6 @@ func TestIdleFlushWithActiveProcessing(t *testing.T) {
 		log.NewNopLogger(),
 		prometheus.NewRegistry(),
 		bufPool,
-		200*time.Millisecond,
-		nil,
 	)
 
 	require.NoError(t, p.initBuilder())
@@ -257,10 +263,10 @@ func TestIdleFlushWithActiveProcessing(t *testing.T) {
 	require.NoError(t, err)
 
 	// Send a record to the processor
-	p.records <- &kgo.Record{
+	require.True(t, p.Append([]*kgo.Record{{
 		Value: streamBytes,
 		Key:   []byte("test-tenant"),
-	}
+	}}))
 
 	// Record initial flush time
 	initialFlushTime := p.lastFlush
@@ -287,8 +293,11 @@ func TestIdleFlushWithEmptyData(t *testing.T) {
 	p := newPartitionProcessor(
 		context.Background(),
 		&kgo.Client{},
-		testBuilderConfig,
-		uploader.Config{},
+		Config{
+			BuilderConfig:    testBuilderConfig,
+			UploaderConfig:   uploader.Config{SHAPrefixSize: 2},
+			IdleFlushTimeout: 200 * time.Millisecond,
+		},
 		bucket,
 		"test-tenant",
 		0,
@@ -297,8 +306,6 @@ func TestIdleFlushWithEmptyData(t *testing.T) {
 		log.NewNopLogger(),
 		prometheus.NewRegistry(),
 		bufPool,
-		200*time.Millisecond,
-		nil,
 	)
 
 	require.NoError(t, p.initBuilder())
@@ -316,3 +323,642 @@ func TestIdleFlushWithEmptyData(t *testing.T) {
 	// Verify that idle flush occurred
 	require.True(t, p.lastFlush.Equal(initialFlushTime), "expected no idle flush with empty data")
 }
+
+// TestIdleFlushWithJitter tests that the initial flush jitter delays only the
+// first idle flush of a partition.
+func TestIdleFlushWithJitter(t *testing.T) {
+	t.Parallel()
+	bucket := newMockBucket()
+	bufPool := &sync.Pool{
+		New: func() interface{} {
+			return bytes.NewBuffer(make([]byte, 0, 1024))
+		},
+	}
+
+	p := newPartitionProcessor(
+		context.Background(),
+		&kgo.Client{},
+		Config{
+			BuilderConfig:    testBuilderConfig,
+			UploaderConfig:   uploader.Config{SHAPrefixSize: 2},
+			IdleFlushTimeout: 100 * time.Millisecond,
+			MaxFlushJitter:   time.Hour,
+		},
+		bucket,
+		"test-tenant",
+		0,
+		"test-topic",
+		0,
+		log.NewNopLogger(),
+		prometheus.NewRegistry(),
+		bufPool,
+	)
+	require.Less(t, p.flushJitter, time.Hour)
+
+	// Use a fixed jitter to keep the test deterministic.
+	p.flushJitter = 500 * time.Millisecond
+	require.NoError(t, p.initBuilder())
+
+	stream := logproto.Stream{
+		Labels: `{cluster="test",app="foo"}`,
+		Entries: []push.Entry{{
+			Timestamp: time.Now().UTC(),
+			Line:      strings.Repeat("a", 1024),
+		}},
+	}
+	streamBytes, err := stream.Marshal()
+	require.NoError(t, err)
+
+	p.processRecord(&kgo.Record{Value: streamBytes, Key: []byte("test-tenant")})
+	initialFlushTime := p.lastFlush
+
+	// Past the idle timeout, but not past the jitter.
+	time.Sleep(200 * time.Millisecond)
+	p.idleFlush()
+	require.Equal(t, initialFlushTime, p.lastFlush, "expected jitter to delay the first flush")
+
+	time.Sleep(400 * time.Millisecond)
+	p.idleFlush()
+	require.True(t, p.lastFlush.After(initialFlushTime), "expected flush after jitter elapsed")
+	require.Zero(t, p.flushJitter, "expected jitter to be cleared after the first flush")
+}
+
+func TestOldestBufferedAge(t *testing.T) {
+	t.Parallel()
+	bucket := newMockBucket()
+	bufPool := &sync.Pool{
+		New: func() interface{} {
+			return bytes.NewBuffer(make([]byte, 0, 1024))
+		},
+	}
+
+	p := newPartitionProcessor(
+		context.Background(),
+		&kgo.Client{},
+		Config{
+			BuilderConfig:  testBuilderConfig,
+			UploaderConfig: uploader.Config{SHAPrefixSize: 2},
+		},
+		bucket,
+		"test-tenant",
+		0,
+		"test-topic",
+		0,
+		log.NewNopLogger(),
+		prometheus.NewRegistry(),
+		bufPool,
+	)
+	require.NoError(t, p.initBuilder())
+	require.Zero(t, p.metrics.getOldestBufferedAge(), "expected no age while nothing is buffered")
+
+	stream := logproto.Stream{
+		Labels: `{cluster="test",app="foo"}`,
+		Entries: []push.Entry{{
+			Timestamp: time.Now().UTC(),
+			Line:      strings.Repeat("a", 1024),
+		}},
+	}
+	streamBytes, err := stream.Marshal()
+	require.NoError(t, err)
+
+	now := time.Now()
+	p.processRecord(&kgo.Record{Value: streamBytes, Key: []byte("test-tenant"), Timestamp: now.Add(-time.Hour)})
+	p.processRecord(&kgo.Record{Value: streamBytes, Key: []byte("test-tenant"), Timestamp: now})
+	require.GreaterOrEqual(t, p.metrics.getOldestBufferedAge(), time.Hour.Seconds(), "expected age of the oldest record")
+
+	p.idleFlush()
+	require.Zero(t, p.metrics.getOldestBufferedAge(), "expected age to be cleared after flush")
+}
+
+func TestBuilderBytes(t *testing.T) {
+	t.Parallel()
+	bufPool := &sync.Pool{
+		New: func() interface{} {
+			return bytes.NewBuffer(make([]byte, 0, 1024))
+		},
+	}
+
+	p := newPartitionProcessor(
+		context.Background(),
+		&kgo.Client{},
+		Config{
+			BuilderConfig:  testBuilderConfig,
+			UploaderConfig: uploader.Config{SHAPrefixSize: 2},
+		},
+		newMockBucket(),
+		"test-tenant",
+		0,
+		"test-topic",
+		0,
+		log.NewNopLogger(),
+		prometheus.NewRegistry(),
+		bufPool,
+	)
+
+	stream := logproto.Stream{
+		Labels: `{cluster="test",app="foo"}`,
+		Entries: []push.Entry{{
+			Timestamp: time.Now().UTC(),
+			Line:      strings.Repeat("a", 1024),
+		}},
+	}
+	streamBytes, err := stream.Marshal()
+	require.NoError(t, err)
+
+	p.processRecord(&kgo.Record{Value: streamBytes, Key: []byte("test-tenant"), Timestamp: time.Now()})
+	buffered := testutil.ToFloat64(p.metrics.builderBytes)
+	require.Equal(t, float64(p.builder.GetEstimatedSize()), buffered)
+	require.Positive(t, buffered, "expected the appended record to be buffered")
+
+	p.processRecord(&kgo.Record{Value: streamBytes, Key: []byte("test-tenant"), Timestamp: time.Now()})
+	require.Greater(t, testutil.ToFloat64(p.metrics.builderBytes), buffered)
+
+	p.idleFlush()
+	require.Zero(t, testutil.ToFloat64(p.metrics.builderBytes), "expected no buffered bytes after flush")
+}
+
+func TestClassifyAppendFailure(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		flushed  bool
+		expected appendFailureReason
+	}{
+		{err: fmt.Errorf("%w: bad", logsobj.ErrInvalidLabels), expected: appendFailureInvalidLabels},
+		{err: logsobj.ErrBuilderFull, flushed: false, expected: appendFailureBuilderFull},
+		{err: logsobj.ErrBuilderFull, flushed: true, expected: appendFailureTooLarge},
+		{err: errors.New("something else"), expected: appendFailureOther},
+	} {
+		t.Run(string(tc.expected), func(t *testing.T) {
+			require.Equal(t, tc.expected, classifyAppendFailure(tc.err, tc.flushed))
+		})
+	}
+}
+
+func TestAppendFailureReason(t *testing.T) {
+	bufPool := &sync.Pool{
+		New: func() interface{} {
+			return bytes.NewBuffer(make([]byte, 0, 1024))
+		},
+	}
+	p := newPartitionProcessor(
+		context.Background(),
+		&kgo.Client{},
+		Config{
+			BuilderConfig:    testBuilderConfig,
+			UploaderConfig:   uploader.Config{SHAPrefixSize: 2},
+			IdleFlushTimeout: time.Hour,
+		},
+		newMockBucket(),
+		"test-tenant",
+		0,
+		"test-topic",
+		0,
+		log.NewNopLogger(),
+		prometheus.NewRegistry(),
+		bufPool,
+	)
+
+	stream := logproto.Stream{
+		Labels:  `{cluster="test",app=}`,
+		Entries: []push.Entry{{Timestamp: time.Now().UTC(), Line: "a"}},
+	}
+	streamBytes, err := stream.Marshal()
+	require.NoError(t, err)
+
+	p.processRecord(&kgo.Record{Value: streamBytes, Key: []byte("test-tenant")})
+	require.Equal(t, float64(1), testutil.ToFloat64(p.metrics.appendFailures.WithLabelValues(string(appendFailureInvalidLabels))))
+}
+
+func TestAppendBatchSize(t *testing.T) {
+	bufPool := &sync.Pool{
+		New: func() interface{} {
+			return bytes.NewBuffer(make([]byte, 0, 1024))
+		},
+	}
+	p := newPartitionProcessor(
+		context.Background(),
+		&kgo.Client{},
+		Config{
+			BuilderConfig:    testBuilderConfig,
+			UploaderConfig:   uploader.Config{SHAPrefixSize: 2},
+			IdleFlushTimeout: time.Hour,
+		},
+		newMockBucket(),
+		"test-tenant",
+		0,
+		"test-topic",
+		0,
+		log.NewNopLogger(),
+		prometheus.NewRegistry(),
+		bufPool,
+	)
+
+	p.start()
+	defer p.stop()
+
+	stream := logproto.Stream{
+		Labels:  `{cluster="test",app="foo"}`,
+		Entries: []push.Entry{{Timestamp: time.Now().UTC(), Line: "a"}},
+	}
+	streamBytes, err := stream.Marshal()
+	require.NoError(t, err)
+	valid := func() *kgo.Record { return &kgo.Record{Value: streamBytes, Key: []byte("test-tenant")} }
+
+	// Records which aren't appended, like records of other tenants, aren't counted.
+	require.True(t, p.Append([]*kgo.Record{valid(), {Key: []byte("other-tenant")}, valid()}))
+	require.True(t, p.Append([]*kgo.Record{{Key: []byte("other-tenant")}}))
+
+	metric := &dto.Metric{}
+	require.Eventually(t, func() bool {
+		require.NoError(t, p.metrics.appendBatchSize.Write(metric))
+		return metric.GetHistogram().GetSampleCount() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, float64(2), metric.GetHistogram().GetSampleSum())
+}
+
+func TestPartitionProcessorUnregistersMetrics(t *testing.T) {
+	bufPool := &sync.Pool{
+		New: func() interface{} {
+			return bytes.NewBuffer(make([]byte, 0, 1024))
+		},
+	}
+	reg := prometheus.NewRegistry()
+	newProcessor := func() *partitionProcessor {
+		p := newPartitionProcessor(
+			context.Background(),
+			&kgo.Client{},
+			Config{
+				BuilderConfig:    testBuilderConfig,
+				UploaderConfig:   uploader.Config{SHAPrefixSize: 2},
+				IdleFlushTimeout: time.Hour,
+			},
+			newMockBucket(),
+			"test-tenant",
+			0,
+			"test-topic",
+			0,
+			log.NewNopLogger(),
+			reg,
+			bufPool,
+		)
+		require.NoError(t, p.initBuilder())
+		return p
+	}
+	registered := func() int {
+		families, err := reg.Gather()
+		require.NoError(t, err)
+		return len(families)
+	}
+
+	// Simulate the partition being revoked and assigned again.
+	revoked := newProcessor()
+	require.NotZero(t, registered())
+	revoked.stop()
+	require.Zero(t, registered(), "expected no collectors after revocation")
+
+	assigned := newProcessor()
+	expected := registered()
+	require.NotZero(t, expected)
+
+	// Unregistering the revoked processor again must not affect the reassigned one.
+	revoked.metrics.unregister(revoked.reg)
+	require.Equal(t, expected, registered())
+
+	// Stopping the revoked processor again must not affect the reassigned one either.
+	revoked.stop()
+	require.Equal(t, expected, registered())
+
+	assigned.stop()
+	require.Zero(t, registered(), "expected no collectors after revocation")
+}
+
+func TestPartitionProcessorsShareMetastoreMetrics(t *testing.T) {
+	bufPool := &sync.Pool{
+		New: func() interface{} {
+			return bytes.NewBuffer(make([]byte, 0, 1024))
+		},
+	}
+	reg := prometheus.NewRegistry()
+	newProcessor := func(tenant string) *partitionProcessor {
+		return newPartitionProcessor(
+			context.Background(),
+			&kgo.Client{},
+			Config{
+				BuilderConfig:    testBuilderConfig,
+				UploaderConfig:   uploader.Config{SHAPrefixSize: 2},
+				MetastoreMetrics: metastore.MetricsConfig{TenantLabel: metastore.TenantLabelNone},
+				IdleFlushTimeout: time.Hour,
+			},
+			newMockBucket(),
+			tenant,
+			0,
+			"loki."+tenant+".0",
+			0,
+			log.NewNopLogger(),
+			reg,
+			bufPool,
+		)
+	}
+	metastoreSeries := func() int {
+		count, err := testutil.GatherAndCount(reg, "loki_dataobj_consumer_metastore_invalid_records_total")
+		require.NoError(t, err)
+		return count
+	}
+
+	// Without a tenant label, the metastore metrics of both tenants are the same series.
+	a, b := newProcessor("tenant-a"), newProcessor("tenant-b")
+	require.Equal(t, 1, metastoreSeries())
+
+	a.stop()
+	require.Equal(t, 1, metastoreSeries(), "expected the metastore metrics to stay registered while shared")
+	b.stop()
+	require.Zero(t, metastoreSeries())
+}
+
+func TestDeduplicateRecords(t *testing.T) {
+	t.Parallel()
+	bufPool := &sync.Pool{
+		New: func() interface{} {
+			return bytes.NewBuffer(make([]byte, 0, 1024))
+		},
+	}
+
+	p := newPartitionProcessor(
+		context.Background(),
+		&kgo.Client{},
+		Config{
+			BuilderConfig:       testBuilderConfig,
+			UploaderConfig:      uploader.Config{SHAPrefixSize: 2},
+			DeduplicationWindow: 2,
+		},
+		newMockBucket(),
+		"test-tenant",
+		0,
+		"test-topic",
+		0,
+		log.NewNopLogger(),
+		prometheus.NewRegistry(),
+		bufPool,
+	)
+
+	stream := logproto.Stream{
+		Labels: `{cluster="test",app="foo"}`,
+		Entries: []push.Entry{{
+			Timestamp: time.Now().UTC(),
+			Line:      strings.Repeat("a", 1024),
+		}},
+	}
+	streamBytes, err := stream.Marshal()
+	require.NoError(t, err)
+	record := func(offset int64) *kgo.Record {
+		return &kgo.Record{Value: streamBytes, Key: []byte("test-tenant"), Timestamp: time.Now(), Offset: offset}
+	}
+
+	p.processRecord(record(1))
+	buffered := p.builder.GetEstimatedSize()
+
+	// A record delivered again within the window is skipped.
+	p.processRecord(record(1))
+	require.Equal(t, buffered, p.builder.GetEstimatedSize())
+	require.Equal(t, float64(1), testutil.ToFloat64(p.metrics.duplicateRecords))
+
+	// Offsets which dropped out of the window are appended again.
+	p.processRecord(record(2))
+	p.processRecord(record(3))
+	p.processRecord(record(1))
+	require.Equal(t, float64(1), testutil.ToFloat64(p.metrics.duplicateRecords))
+	require.Equal(t, float64(4), testutil.ToFloat64(p.metrics.appendsTotal))
+}
+
+type recordingTeeSink struct {
+	mu      sync.Mutex
+	streams []logproto.Stream
+	err     error
+}
+
+func (s *recordingTeeSink) Append(_ context.Context, tenantID string, stream logproto.Stream) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tenantID != "test-tenant" {
+		return fmt.Errorf("unexpected tenant %s", tenantID)
+	}
+	s.streams = append(s.streams, stream)
+	return s.err
+}
+
+func (s *recordingTeeSink) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+func TestTeeSink(t *testing.T) {
+	t.Parallel()
+	bufPool := &sync.Pool{
+		New: func() interface{} {
+			return bytes.NewBuffer(make([]byte, 0, 1024))
+		},
+	}
+	newProcessor := func(sink TeeSink) *partitionProcessor {
+		return newPartitionProcessor(
+			context.Background(),
+			&kgo.Client{},
+			Config{
+				BuilderConfig:    testBuilderConfig,
+				UploaderConfig:   uploader.Config{SHAPrefixSize: 2},
+				IdleFlushTimeout: time.Hour,
+			},
+			newMockBucket(),
+			"test-tenant",
+			0,
+			"test-topic",
+			0,
+			log.NewNopLogger(),
+			prometheus.NewRegistry(),
+			bufPool,
+			withTeeSink(sink),
+		)
+	}
+
+	stream := logproto.Stream{
+		Labels: `{cluster="test",app="foo"}`,
+		Entries: []push.Entry{{
+			Timestamp: time.Now().UTC(),
+			Line:      strings.Repeat("a", 1024),
+		}},
+	}
+	streamBytes, err := stream.Marshal()
+	require.NoError(t, err)
+	records := []*kgo.Record{
+		{Value: streamBytes, Key: []byte("test-tenant"), Timestamp: time.Now()},
+		{Value: streamBytes, Key: []byte("test-tenant"), Timestamp: time.Now()},
+	}
+
+	t.Run("appended streams are teed", func(t *testing.T) {
+		sink := &recordingTeeSink{}
+		p := newProcessor(sink)
+		p.start()
+		defer p.stop()
+
+		require.True(t, p.Append(records))
+		require.Eventually(t, func() bool { return sink.len() == 2 }, time.Second, 10*time.Millisecond)
+		sink.mu.Lock()
+		require.Equal(t, stream, sink.streams[0])
+		sink.mu.Unlock()
+
+		metric := &dto.Metric{}
+		require.NoError(t, p.metrics.teeLag.Write(metric))
+		require.Equal(t, uint64(2), metric.GetHistogram().GetSampleCount())
+	})
+
+	t.Run("failures don't affect the primary builder", func(t *testing.T) {
+		sink := &recordingTeeSink{err: errors.New("sink unavailable")}
+		p := newProcessor(sink)
+		p.start()
+		defer p.stop()
+
+		require.True(t, p.Append(records))
+		require.Eventually(t, func() bool {
+			return testutil.ToFloat64(p.metrics.teeFailures.WithLabelValues(string(teeFailureError))) == 2
+		}, time.Second, 10*time.Millisecond)
+		require.Equal(t, float64(2), testutil.ToFloat64(p.metrics.appendsTotal))
+		require.Zero(t, testutil.CollectAndCount(p.metrics.appendFailures))
+	})
+
+	t.Run("streams are dropped once the queue is full", func(t *testing.T) {
+		sink := &recordingTeeSink{}
+		p := newProcessor(sink)
+		for range teeQueueSize + 1 {
+			p.tee.enqueue(stream)
+		}
+		require.Equal(t, float64(1), testutil.ToFloat64(p.metrics.teeFailures.WithLabelValues(string(teeFailureQueueFull))))
+		require.Zero(t, sink.len())
+	})
+}
+
+type recordingCommitter struct {
+	committed []*kgo.Record
+	rewound   []int64
+}
+
+func (c *recordingCommitter) CommitRecords(_ context.Context, rs ...*kgo.Record) error {
+	c.committed = append(c.committed, rs...)
+	return nil
+}
+
+func (c *recordingCommitter) SetOffsets(setOffsets map[string]map[int32]kgo.EpochOffset) {
+	c.rewound = append(c.rewound, setOffsets["test-topic"][0].Offset)
+}
+
+// failingUploader fails the next uploads while fail is set.
+type failingUploader struct {
+	objectUploader
+	fail bool
+}
+
+func (u *failingUploader) Upload(ctx context.Context, object *bytes.Buffer) (string, error) {
+	if u.fail {
+		return "", errors.New("upload failed")
+	}
+	return u.objectUploader.Upload(ctx, object)
+}
+
+func TestTransactionalCommits(t *testing.T) {
+	bufPool := &sync.Pool{
+		New: func() interface{} {
+			return bytes.NewBuffer(make([]byte, 0, 1024))
+		},
+	}
+	newProcessor := func(transactionalCommits bool) (*partitionProcessor, *recordingCommitter) {
+		p := newPartitionProcessor(
+			context.Background(),
+			&kgo.Client{},
+			Config{
+				BuilderConfig:        testBuilderConfig,
+				UploaderConfig:       uploader.Config{SHAPrefixSize: 2},
+				TransactionalCommits: transactionalCommits,
+			},
+			newMockBucket(),
+			"test-tenant",
+			0,
+			"test-topic",
+			0,
+			log.NewNopLogger(),
+			prometheus.NewRegistry(),
+			bufPool,
+		)
+		committer := &recordingCommitter{}
+		p.client = committer
+		return p, committer
+	}
+
+	stream := logproto.Stream{
+		Labels: `{cluster="test",app="foo"}`,
+		Entries: []push.Entry{{
+			Timestamp: time.Now().UTC(),
+			Line:      strings.Repeat("a", 1024),
+		}},
+	}
+	streamBytes, err := stream.Marshal()
+	require.NoError(t, err)
+	record := func(offset int64) *kgo.Record {
+		return &kgo.Record{Value: streamBytes, Key: []byte("test-tenant"), Timestamp: time.Now(), Offset: offset}
+	}
+
+	t.Run("commits the last flushed record once it is in the metastore", func(t *testing.T) {
+		p, committer := newProcessor(true)
+
+		p.processRecord(record(1))
+		p.processRecord(record(2))
+		require.Empty(t, committer.committed, "expected no commits before flushing")
+
+		p.idleFlush()
+		require.Len(t, committer.committed, 1)
+		require.Equal(t, int64(2), committer.committed[0].Offset)
+
+		metric := &dto.Metric{}
+		require.NoError(t, p.metrics.commitFlushGap.Write(metric))
+		require.Equal(t, uint64(1), metric.GetHistogram().GetSampleCount())
+
+		// Flushing again without new records doesn't commit again.
+		p.idleFlush()
+		require.Len(t, committer.committed, 1)
+	})
+
+	t.Run("rewinds the partition after a failed flush", func(t *testing.T) {
+		p, committer := newProcessor(true)
+		uploader := &failingUploader{objectUploader: p.uploader}
+		p.uploader = uploader
+
+		p.processRecord(record(1))
+		p.processRecord(record(2))
+		p.idleFlush()
+		require.Len(t, committer.committed, 1)
+
+		p.processRecord(record(3))
+		p.processRecord(record(4))
+		uploader.fail = true
+		p.idleFlush()
+		require.Len(t, committer.committed, 1, "expected no commits after a failed flush")
+		require.Equal(t, []int64{3}, committer.rewound)
+		require.Zero(t, p.builder.GetEstimatedSize())
+
+		// Records queued before the rewind are skipped until the rewound ones
+		// are consumed again.
+		require.False(t, p.processRecord(record(5)))
+		uploader.fail = false
+		require.True(t, p.processRecord(record(3)))
+		require.True(t, p.processRecord(record(4)))
+		p.idleFlush()
+		require.Len(t, committer.committed, 2)
+		require.Equal(t, int64(4), committer.committed[1].Offset)
+	})
+
+	t.Run("idle flushes don't commit by default", func(t *testing.T) {
+		p, committer := newProcessor(false)
+
+		p.processRecord(record(1))
+		p.idleFlush()
+		require.Empty(t, committer.committed)
+	})
+}
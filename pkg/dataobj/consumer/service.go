@@ -13,6 +13,7 @@ import (
 	"github.com/grafana/dskit/ring"
 	"github.com/grafana/dskit/services"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/thanos-io/objstore"
 	"github.com/twmb/franz-go/pkg/kgo"
 
@@ -43,10 +44,17 @@ type Service struct {
 	partitionMtx      sync.RWMutex
 	partitionHandlers map[string]map[int32]*partitionProcessor
 
-	bufPool *sync.Pool
+	bufPool      *sync.Pool
+	backpressure *flushBackpressure
+
+	// fetchWait is the time spent waiting on the broker for the next fetch.
+	fetchWait prometheus.Histogram
+
+	// tee receives a copy of every appended stream, if configured.
+	tee TeeSink
 }
 
-func New(kafkaCfg kafka.Config, cfg Config, topicPrefix string, bucket objstore.Bucket, instanceID string, partitionRing ring.PartitionRingReader, reg prometheus.Registerer, logger log.Logger) *Service {
+func New(kafkaCfg kafka.Config, cfg Config, topicPrefix string, bucket objstore.Bucket, instanceID string, partitionRing ring.PartitionRingReader, reg prometheus.Registerer, logger log.Logger, opts ...Option) *Service {
 	s := &Service{
 		logger:            log.With(logger, "component", groupName),
 		cfg:               cfg,
@@ -54,6 +62,15 @@ func New(kafkaCfg kafka.Config, cfg Config, topicPrefix string, bucket objstore.
 		codec:             distributor.TenantPrefixCodec(topicPrefix),
 		partitionHandlers: make(map[string]map[int32]*partitionProcessor),
 		reg:               reg,
+		backpressure:      newFlushBackpressure(cfg.MaxInflightFlushes, reg),
+		fetchWait: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Name:                            "loki_dataobj_consumer_fetch_wait_seconds",
+			Help:                            "Time spent waiting on the broker for the next batch of records in seconds",
+			Buckets:                         prometheus.DefBuckets,
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  100,
+			NativeHistogramMinResetDuration: 0,
+		}),
 		bufPool: &sync.Pool{
 			New: func() interface{} {
 				return bytes.NewBuffer(make([]byte, 0, cfg.BuilderConfig.TargetObjectSize))
@@ -61,6 +78,10 @@ func New(kafkaCfg kafka.Config, cfg Config, topicPrefix string, bucket objstore.
 		},
 	}
 
+	for _, o := range opts {
+		o(s)
+	}
+
 	consumerClient, err := consumer.NewGroupClient(
 		kafkaCfg,
 		partitionRing,
@@ -112,7 +133,8 @@ func (s *Service) handlePartitionsAssigned(ctx context.Context, client *kgo.Clie
 		}
 
 		for _, partition := range parts {
-			processor := newPartitionProcessor(ctx, client, s.cfg.BuilderConfig, s.cfg.UploaderConfig, s.bucket, tenant, virtualShard, topic, partition, s.logger, s.reg, s.bufPool, s.cfg.IdleFlushTimeout, s.eventsProducerClient)
+			processor := newPartitionProcessor(ctx, client, s.cfg, s.bucket, tenant, virtualShard, topic, partition, s.logger, s.reg, s.bufPool,
+				withEventsProducer(s.eventsProducerClient), withBackpressure(s.backpressure), withTeeSink(s.tee))
 			s.partitionHandlers[topic][partition] = processor
 			processor.start()
 		}
@@ -151,7 +173,12 @@ func (s *Service) handlePartitionsRevoked(partitions map[string][]int32) {
 
 func (s *Service) run(ctx context.Context) error {
 	for {
+		// Stop fetching while object storage can't keep up with flushes, so buffered records don't pile up.
+		s.backpressure.wait(ctx)
+
+		pollStart := time.Now()
 		fetches := s.client.PollRecords(ctx, -1)
+		s.fetchWait.Observe(time.Since(pollStart).Seconds())
 		if fetches.IsClientClosed() || ctx.Err() != nil {
 			return nil
 		}
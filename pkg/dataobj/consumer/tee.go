@@ -0,0 +1,98 @@
+package consumer
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+
+	"github.com/grafana/loki/v3/pkg/logproto"
+)
+
+// teeQueueSize is the number of streams buffered per partition for the
+// [TeeSink] before further streams are dropped.
+const teeQueueSize = 1000
+
+// TeeSink receives a copy of every stream appended by the consumer, e.g. to
+// build a shadow metastore in a new storage format and compare it with the
+// primary one during a migration.
+//
+// Teeing is best effort: streams are passed to the sink asynchronously after
+// they have been appended to the primary builder, and sink errors are logged
+// and counted without affecting the primary path. Streams are dropped if the
+// sink can't keep up.
+type TeeSink interface {
+	Append(ctx context.Context, tenantID string, stream logproto.Stream) error
+}
+
+// Option configures optional behaviour of the consumer [Service].
+type Option func(*Service)
+
+// WithTeeSink makes the consumer write every appended stream to sink as well.
+// Failures and the time streams wait before being written to sink are
+// exposed in metrics.
+func WithTeeSink(sink TeeSink) Option {
+	return func(s *Service) {
+		s.tee = sink
+	}
+}
+
+type teeFailureReason string
+
+const (
+	teeFailureError     teeFailureReason = "error"
+	teeFailureQueueFull teeFailureReason = "queue_full"
+)
+
+type teeStream struct {
+	stream   logproto.Stream
+	appended time.Time
+}
+
+// teeWriter writes the streams appended by a partition processor to a
+// [TeeSink] in the background.
+type teeWriter struct {
+	sink     TeeSink
+	tenantID string
+	queue    chan teeStream
+	metrics  *partitionOffsetMetrics
+	logger   log.Logger
+}
+
+func newTeeWriter(sink TeeSink, tenantID string, metrics *partitionOffsetMetrics, logger log.Logger) *teeWriter {
+	return &teeWriter{
+		sink:     sink,
+		tenantID: tenantID,
+		queue:    make(chan teeStream, teeQueueSize),
+		metrics:  metrics,
+		logger:   logger,
+	}
+}
+
+// enqueue queues stream to be written to the sink without blocking. The
+// stream is dropped if the queue is full.
+func (w *teeWriter) enqueue(stream logproto.Stream) {
+	select {
+	case w.queue <- teeStream{stream: stream, appended: time.Now()}:
+	default:
+		w.metrics.incTeeFailures(teeFailureQueueFull)
+	}
+}
+
+// run writes queued streams to the sink until ctx is canceled. Streams which
+// are still queued by then are dropped.
+func (w *teeWriter) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-w.queue:
+			w.metrics.observeTeeLag(time.Since(s.appended))
+			if err := w.sink.Append(ctx, w.tenantID, s.stream); err != nil {
+				level.Warn(w.logger).Log("msg", "failed to tee stream", "err", err)
+				w.metrics.incTeeFailures(teeFailureError)
+			}
+		}
+	}
+}
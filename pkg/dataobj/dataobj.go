@@ -142,3 +142,12 @@ func (o *Object) init(ctx context.Context) error {
 // Sections returns the list of sections available in the Object. The slice of
 // returned sections must not be mutated.
 func (o *Object) Sections() Sections { return o.sections }
+
+// SectionAt returns the section at index i of the slice returned by
+// [Object.Sections]. SectionAt returns an error if i is out of range.
+func (o *Object) SectionAt(i int) (*Section, error) {
+	if i < 0 || i >= len(o.sections) {
+		return nil, fmt.Errorf("section index %d out of range [0, %d)", i, len(o.sections))
+	}
+	return o.sections[i], nil
+}
@@ -0,0 +1,77 @@
+package metastore
+
+import (
+	"time"
+)
+
+const (
+	// defaultMaxBackoff is the backoff cap of windows without contention.
+	defaultMaxBackoff = 10 * time.Second
+	// adaptiveBackoffDecrease is how much the cap of a window decays after each clean write.
+	adaptiveBackoffDecrease = 5 * time.Second
+	// adaptiveBackoffIdleTimeout is how long the cap of a window which isn't written to is remembered.
+	adaptiveBackoffIdleTimeout = time.Hour
+)
+
+// WithAdaptiveBackoff makes the backoff cap of each metastore window adapt to
+// contention. Every update of a window which needed retries doubles its cap,
+// up to maxBackoff, and every clean update decreases it again. This
+// de-escalates contention on hot windows written by many consumers at once.
+func WithAdaptiveBackoff(maxBackoff time.Duration) UpdaterOption {
+	return func(u *Updater) {
+		u.windowBackoff = newWindowBackoff(defaultMaxBackoff, maxBackoff)
+	}
+}
+
+type windowBackoffCap struct {
+	limit   time.Duration
+	updated time.Time
+}
+
+// windowBackoff tracks the backoff cap of each metastore window using AIMD:
+// the cap is increased multiplicatively while writes conflict and decreased
+// additively while they succeed cleanly.
+type windowBackoff struct {
+	base, max time.Duration
+	caps      map[string]windowBackoffCap
+}
+
+func newWindowBackoff(base, maxBackoff time.Duration) *windowBackoff {
+	return &windowBackoff{
+		base: base,
+		max:  max(base, maxBackoff),
+		caps: make(map[string]windowBackoffCap),
+	}
+}
+
+// limit returns the current backoff cap of the window.
+func (w *windowBackoff) limit(path string) time.Duration {
+	if c, ok := w.caps[path]; ok {
+		return c.limit
+	}
+	return w.base
+}
+
+// observe adjusts the backoff cap of the window after an update, which
+// conflicted if it needed any retries.
+func (w *windowBackoff) observe(path string, conflicted bool, now time.Time) {
+	limit := w.limit(path)
+	if conflicted {
+		limit = min(2*limit, w.max)
+	} else {
+		limit -= adaptiveBackoffDecrease
+	}
+
+	if limit <= w.base {
+		delete(w.caps, path)
+	} else {
+		w.caps[path] = windowBackoffCap{limit: limit, updated: now}
+	}
+
+	// Forget windows which are no longer written to.
+	for p, c := range w.caps {
+		if now.Sub(c.updated) > adaptiveBackoffIdleTimeout {
+			delete(w.caps, p)
+		}
+	}
+}
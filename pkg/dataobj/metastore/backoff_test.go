@@ -0,0 +1,54 @@
+package metastore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestWindowBackoff(t *testing.T) {
+	now := time.Now()
+	w := newWindowBackoff(10*time.Second, time.Minute)
+	require.Equal(t, 10*time.Second, w.limit("hot"))
+
+	// Conflicts double the cap up to the maximum.
+	for _, expected := range []time.Duration{20 * time.Second, 40 * time.Second, time.Minute, time.Minute} {
+		w.observe("hot", true, now)
+		require.Equal(t, expected, w.limit("hot"))
+	}
+	require.Equal(t, 10*time.Second, w.limit("cold"), "expected other windows to be unaffected")
+
+	// Clean writes decay the cap back down to the base.
+	w.observe("hot", false, now)
+	require.Equal(t, 55*time.Second, w.limit("hot"))
+	for i := 0; i < 20; i++ {
+		w.observe("hot", false, now)
+	}
+	require.Equal(t, 10*time.Second, w.limit("hot"))
+	require.Empty(t, w.caps)
+
+	// Windows which are no longer written to are forgotten.
+	w.observe("old", true, now)
+	w.observe("hot", true, now.Add(2*adaptiveBackoffIdleTimeout))
+	require.NotContains(t, w.caps, "old")
+	require.Contains(t, w.caps, "hot")
+}
+
+func TestUpdateAdaptiveBackoff(t *testing.T) {
+	ctx := context.Background()
+	bucket := &lossyBucket{InMemBucket: objstore.NewInMemBucket(), drops: 1}
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithVerifyAfterWrite(), WithAdaptiveBackoff(time.Minute))
+
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	path := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+
+	require.NoError(t, m.Update(ctx, testObjectPath("first-dataobj-path"), now, now))
+	require.Equal(t, 2*defaultMaxBackoff, m.windowBackoff.limit(path), "expected the cap to grow after a conflict")
+
+	require.NoError(t, m.Update(ctx, testObjectPath("second-dataobj-path"), now, now))
+	require.Equal(t, 2*defaultMaxBackoff-adaptiveBackoffDecrease, m.windowBackoff.limit(path), "expected the cap to decay after a clean write")
+}
@@ -0,0 +1,93 @@
+package metastore
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// pendingWindow holds the entries buffered for a metastore window.
+type pendingWindow struct {
+	entries []PathEntry
+	// since is when the oldest entry was buffered.
+	since time.Time
+}
+
+// WithBufferedUpdates makes [Updater.Update] buffer the data objects of each
+// metastore window in memory and only write the window once maxEntries data
+// objects are buffered for it or the oldest of them has been buffered for
+// maxDelay, coalescing many updates of busy windows into a single write. A
+// maxEntries or maxDelay of 0 disables that threshold.
+//
+// Buffered data objects are only written by later calls to Update or by
+// [Updater.Flush], which must be called before the updater is discarded.
+// Data objects buffered when the process crashes aren't added to the
+// metastore.
+func WithBufferedUpdates(maxEntries int, maxDelay time.Duration) UpdaterOption {
+	return func(u *Updater) {
+		u.bufferMaxEntries = maxEntries
+		u.bufferMaxDelay = maxDelay
+		u.pending = make(map[string]*pendingWindow)
+	}
+}
+
+// buffering returns true if updates are buffered.
+func (m *Updater) buffering() bool {
+	return m.pending != nil
+}
+
+// bufferEntry buffers entry for all windows it overlaps and writes the windows which are due.
+func (m *Updater) bufferEntry(ctx context.Context, entry PathEntry) error {
+	now := time.Now()
+	for metastorePath := range iterStorePaths(m.layout, m.tenantID, entry.MinTimestamp, entry.MaxTimestamp, m.windowSize) {
+		window, ok := m.pending[metastorePath]
+		if !ok {
+			window = &pendingWindow{since: now}
+			m.pending[metastorePath] = window
+		}
+		window.entries = append(window.entries, entry)
+	}
+	return m.flushPending(ctx, func(window *pendingWindow) bool {
+		return (m.bufferMaxEntries > 0 && len(window.entries) >= m.bufferMaxEntries) ||
+			(m.bufferMaxDelay > 0 && now.Sub(window.since) >= m.bufferMaxDelay)
+	})
+}
+
+// Flush writes all data objects buffered by [WithBufferedUpdates]. It is a
+// no-op if updates aren't buffered.
+func (m *Updater) Flush(ctx context.Context) error {
+	if !m.buffering() || len(m.pending) == 0 {
+		return nil
+	}
+	if err := m.initBuilder(); err != nil {
+		return err
+	}
+	m.acquireBuffer()
+	defer m.releaseBuffer()
+
+	return m.flushPending(ctx, func(*pendingWindow) bool { return true })
+}
+
+// flushPending writes the pending windows for which due returns true. Windows
+// which fail to be written stay pending, so they are retried by the next flush.
+func (m *Updater) flushPending(ctx context.Context, due func(*pendingWindow) bool) error {
+	var paths []string
+	for metastorePath, window := range m.pending {
+		if due(window) {
+			paths = append(paths, metastorePath)
+		}
+	}
+	slices.Sort(paths)
+
+	var err error
+	for _, metastorePath := range paths {
+		if windowErr := m.updateWindow(ctx, metastorePath, m.pending[metastorePath].entries); windowErr != nil {
+			err = errors.Wrapf(windowErr, "writing buffered updates of %s", metastorePath)
+			continue
+		}
+		delete(m.pending, metastorePath)
+	}
+	return err
+}
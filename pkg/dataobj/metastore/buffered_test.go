@@ -0,0 +1,73 @@
+package metastore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+// countingBucket counts the writes made via GetAndReplace.
+type countingBucket struct {
+	*objstore.InMemBucket
+	writes int
+}
+
+func (b *countingBucket) GetAndReplace(ctx context.Context, name string, f func(io.Reader) (io.Reader, error)) error {
+	b.writes++
+	return b.InMemBucket.GetAndReplace(ctx, name, f)
+}
+
+func TestBufferedUpdates(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	window := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+
+	t.Run("flushes after max entries", func(t *testing.T) {
+		bucket := &countingBucket{InMemBucket: objstore.NewInMemBucket()}
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithBufferedUpdates(3, 0))
+
+		var paths []string
+		for i := 0; i < 5; i++ {
+			paths = append(paths, testObjectPath(fmt.Sprintf("object-%d", i)))
+			require.NoError(t, m.Update(ctx, paths[i], now, now))
+		}
+		require.Equal(t, 1, bucket.writes)
+		require.NoError(t, m.verifyWrite(ctx, window, paths[:3]...))
+
+		require.NoError(t, m.Flush(ctx))
+		require.Equal(t, 2, bucket.writes)
+		require.NoError(t, m.verifyWrite(ctx, window, paths...))
+
+		// Nothing is pending anymore.
+		require.NoError(t, m.Flush(ctx))
+		require.Equal(t, 2, bucket.writes)
+	})
+
+	t.Run("flushes after max delay", func(t *testing.T) {
+		bucket := &countingBucket{InMemBucket: objstore.NewInMemBucket()}
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithBufferedUpdates(0, time.Hour))
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+		require.Zero(t, bucket.writes)
+
+		m.pending[window].since = time.Now().Add(-time.Hour)
+		require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+		require.Equal(t, 1, bucket.writes)
+		require.NoError(t, m.verifyWrite(ctx, window, testObjectPath("a"), testObjectPath("b")))
+	})
+
+	t.Run("flush is a no-op without buffering", func(t *testing.T) {
+		bucket := &countingBucket{InMemBucket: objstore.NewInMemBucket()}
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger())
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+		require.NoError(t, m.Flush(ctx))
+		require.Equal(t, 1, bucket.writes)
+	})
+}
@@ -0,0 +1,117 @@
+package metastore
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/loki/v3/pkg/compression"
+	"github.com/grafana/loki/v3/pkg/dataobj"
+)
+
+var (
+	// gzipMagic is the header every gzip stream starts with.
+	gzipMagic = []byte{0x1f, 0x8b}
+	// zstdMagic is the header every zstd frame starts with.
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// WithCompression makes the [Updater] compress the metastore objects it
+// writes with codec, which must be [compression.GZIP] or [compression.Zstd].
+// Objects are left uncompressed for any other codec. Both codecs start their
+// output with a magic header, by which readers detect compressed objects, so
+// the [Updater], [ObjectMetastore] and [Querier] read compressed and
+// uncompressed objects alike. Readers must be updated before enabling
+// compression. The ratio of the uncompressed to the compressed size of
+// objects is exposed in a metric.
+//
+// Compressed objects are read and written entirely in memory, which suits cold
+// windows that are rarely read, so [WithStreamingFlush] doesn't apply to them.
+func WithCompression(codec compression.Codec) UpdaterOption {
+	return func(u *Updater) {
+		switch codec {
+		case compression.GZIP, compression.Zstd:
+			u.compression = codec
+		default:
+			u.compression = compression.None
+		}
+	}
+}
+
+// compress compresses the metastore object read from r with the codec of the
+// [Updater], if any, and observes the achieved compression ratio.
+func (m *Updater) compress(r io.Reader) (io.Reader, error) {
+	if m.compression == compression.None {
+		return r, nil
+	}
+
+	var compressed bytes.Buffer
+	pool := compression.GetWriterPool(m.compression)
+	writer := pool.GetWriter(&compressed)
+	defer pool.PutWriter(writer)
+
+	size, err := io.Copy(writer, r)
+	if err != nil {
+		return nil, errors.Wrap(err, "compressing metastore object")
+	}
+	if err := writer.Close(); err != nil {
+		return nil, errors.Wrap(err, "compressing metastore object")
+	}
+	if compressed.Len() > 0 {
+		m.metrics.observeCompressionRatio(float64(size) / float64(compressed.Len()))
+	}
+	return &compressed, nil
+}
+
+// objectCompression returns the codec the metastore object data is compressed
+// with, detected by its magic header, or [compression.None].
+func objectCompression(data []byte) compression.Codec {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return compression.GZIP
+	case bytes.HasPrefix(data, zstdMagic):
+		return compression.Zstd
+	default:
+		return compression.None
+	}
+}
+
+// decompressObject replaces the contents of buf with their decompressed form
+// if they are compressed with gzip or zstd. Metastore objects are written
+// compressed with [WithCompression], and external tools may have written
+// compressed ones.
+func decompressObject(buf *bytes.Buffer) error {
+	codec := objectCompression(buf.Bytes())
+	if codec == compression.None {
+		return nil
+	}
+
+	pool := compression.GetReaderPool(codec)
+	reader, err := pool.GetReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return err
+	}
+	defer pool.PutReader(reader)
+
+	var decompressed bytes.Buffer
+	if _, err := decompressed.ReadFrom(reader); err != nil {
+		return err
+	}
+
+	buf.Reset()
+	_, err = buf.Write(decompressed.Bytes())
+	return err
+}
+
+// openObject decompresses the metastore object in buf and opens it.
+func openObject(buf *bytes.Buffer) (*dataobj.Object, error) {
+	if err := decompressObject(buf); err != nil {
+		return nil, errors.Wrap(err, "decompressing metastore object")
+	}
+	object, err := dataobj.FromReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		return nil, errors.Wrap(err, "opening metastore object")
+	}
+	return object, nil
+}
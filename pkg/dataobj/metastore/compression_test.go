@@ -0,0 +1,67 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/user"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/loki/v3/pkg/compression"
+)
+
+func TestUpdateWithCompression(t *testing.T) {
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	ctx := user.InjectOrgID(context.Background(), tenantID)
+	path := WindowPath(tenantID, now)
+
+	for _, tc := range []struct {
+		codec compression.Codec
+		magic []byte
+	}{
+		{codec: compression.Zstd, magic: zstdMagic},
+		{codec: compression.GZIP, magic: gzipMagic},
+	} {
+		t.Run(tc.codec.String(), func(t *testing.T) {
+			bucket := objstore.NewInMemBucket()
+			m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithCompression(tc.codec), WithVerifyAfterWrite())
+
+			require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+			require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+			require.True(t, bytes.HasPrefix(bucket.Objects()[path], tc.magic), "expected a compressed object")
+			require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("a"), testObjectPath("b")))
+
+			metric := &dto.Metric{}
+			require.NoError(t, m.metrics.compressionRatio.Write(metric))
+			require.Equal(t, uint64(2), metric.GetHistogram().GetSampleCount())
+			require.Greater(t, metric.GetHistogram().GetSampleSum(), float64(2), "expected objects to shrink")
+
+			objects, err := NewObjectMetastore(bucket).DataObjects(ctx, now, now)
+			require.NoError(t, err)
+			require.ElementsMatch(t, []string{testObjectPath("a"), testObjectPath("b")}, objects)
+
+			paths, _, err := NewQuerier(bucket, log.NewNopLogger()).DataObjPathsPage(ctx, tenantID, now, 0, 10)
+			require.NoError(t, err)
+			require.ElementsMatch(t, []string{testObjectPath("a"), testObjectPath("b")}, paths)
+
+			// Uncompressed updaters read compressed objects and write them uncompressed.
+			require.NoError(t, NewUpdater(bucket, tenantID, log.NewNopLogger()).Update(ctx, testObjectPath("c"), now, now))
+			require.False(t, bytes.HasPrefix(bucket.Objects()[path], tc.magic))
+			require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("a"), testObjectPath("b"), testObjectPath("c")))
+		})
+	}
+
+	t.Run("other codecs leave objects uncompressed", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithCompression(compression.Snappy))
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+		object := bucket.Objects()[path]
+		require.False(t, bytes.HasPrefix(object, zstdMagic) || bytes.HasPrefix(object, gzipMagic))
+	})
+}
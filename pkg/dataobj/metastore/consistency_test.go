@@ -0,0 +1,156 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/backoff"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+var errNotVisible = errors.New("eventually consistent bucket: object not visible yet")
+
+// delayedWrite is a version of an object written to an eventuallyConsistentBucket.
+type delayedWrite struct {
+	data    []byte
+	written time.Time
+}
+
+// eventuallyConsistentBucket is an in-memory bucket whose writes only become
+// visible to reads after a delay, like object stores without read-after-write
+// consistency. Until then, reads return the newest version which is visible,
+// or a not found error. The delays of Get and of the read made by
+// GetAndReplace are configured separately. Objects returns the newest version
+// of every object.
+type eventuallyConsistentBucket struct {
+	*objstore.InMemBucket
+	getDelay, replaceDelay time.Duration
+
+	mtx      sync.Mutex
+	versions map[string][]delayedWrite
+}
+
+func newEventuallyConsistentBucket(getDelay, replaceDelay time.Duration) *eventuallyConsistentBucket {
+	return &eventuallyConsistentBucket{
+		InMemBucket:  objstore.NewInMemBucket(),
+		getDelay:     getDelay,
+		replaceDelay: replaceDelay,
+		versions:     make(map[string][]delayedWrite),
+	}
+}
+
+// visible returns the newest version of name written at least delay ago.
+func (b *eventuallyConsistentBucket) visible(name string, delay time.Duration) ([]byte, bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	versions := b.versions[name]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if time.Since(versions[i].written) >= delay {
+			return versions[i].data, true
+		}
+	}
+	return nil, false
+}
+
+func (b *eventuallyConsistentBucket) write(ctx context.Context, name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	b.mtx.Lock()
+	b.versions[name] = append(b.versions[name], delayedWrite{data: data, written: time.Now()})
+	b.mtx.Unlock()
+	return b.InMemBucket.Upload(ctx, name, bytes.NewReader(data))
+}
+
+func (b *eventuallyConsistentBucket) Get(_ context.Context, name string) (io.ReadCloser, error) {
+	data, ok := b.visible(name, b.getDelay)
+	if !ok {
+		return nil, errNotVisible
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (b *eventuallyConsistentBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	return b.write(ctx, name, r)
+}
+
+func (b *eventuallyConsistentBucket) GetAndReplace(ctx context.Context, name string, f func(io.Reader) (io.Reader, error)) error {
+	var existing io.Reader
+	if data, ok := b.visible(name, b.replaceDelay); ok {
+		existing = bytes.NewReader(data)
+	}
+	r, err := f(existing)
+	if err != nil {
+		return err
+	}
+	return b.write(ctx, name, r)
+}
+
+func (b *eventuallyConsistentBucket) IsObjNotFoundErr(err error) bool {
+	return errors.Is(err, errNotVisible) || b.InMemBucket.IsObjNotFoundErr(err)
+}
+
+func TestEventuallyConsistentBucket(t *testing.T) {
+	ctx := context.Background()
+	bucket := newEventuallyConsistentBucket(50*time.Millisecond, 0)
+
+	require.NoError(t, bucket.Upload(ctx, "object", bytes.NewReader([]byte("v1"))))
+	_, err := bucket.Get(ctx, "object")
+	require.True(t, bucket.IsObjNotFoundErr(err))
+
+	// GetAndReplace reads without delay.
+	require.NoError(t, bucket.GetAndReplace(ctx, "object", func(existing io.Reader) (io.Reader, error) {
+		data, err := io.ReadAll(existing)
+		require.NoError(t, err)
+		require.Equal(t, "v1", string(data))
+		return bytes.NewReader([]byte("v2")), nil
+	}))
+
+	time.Sleep(50 * time.Millisecond)
+	r, err := bucket.Get(ctx, "object")
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "v2", string(data))
+}
+
+func TestUpdateVerifyAfterWriteEventuallyConsistent(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name                   string
+		getDelay, replaceDelay time.Duration
+	}{
+		{name: "stale reads", getDelay: 30 * time.Millisecond},
+		{name: "stale reads and replaces", getDelay: 30 * time.Millisecond, replaceDelay: 30 * time.Millisecond},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			bucket := newEventuallyConsistentBucket(tc.getDelay, tc.replaceDelay)
+			m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithVerifyAfterWrite())
+			m.backoff = backoff.New(context.TODO(), backoff.Config{
+				MinBackoff: 50 * time.Millisecond,
+				MaxBackoff: 100 * time.Millisecond,
+				MaxRetries: 5,
+			})
+
+			require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+			require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+			require.NotZero(t, testutil.ToFloat64(m.metrics.verificationFailures), "expected stale reads to fail verification")
+
+			time.Sleep(max(tc.getDelay, tc.replaceDelay))
+			require.NoError(t, m.verifyWrite(ctx, metastorePath(tenantID, now.Truncate(metastoreWindowSize)), testObjectPath("a"), testObjectPath("b")))
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package metastore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/grafana/loki/v3/pkg/dataobj"
+	"github.com/grafana/loki/v3/pkg/dataobj/sections/streams"
+)
+
+// DumpOption configures optional behaviour of [Dump] and [DumpSection].
+type DumpOption func(*dumpOptions)
+
+type dumpOptions struct {
+	decode Transform
+}
+
+// WithDumpDecodeTransform makes [Dump] and [DumpSection] apply decode to the
+// metastore object before decoding it, see [WithTransforms].
+func WithDumpDecodeTransform(decode Transform) DumpOption {
+	return func(o *dumpOptions) {
+		o.decode = decode
+	}
+}
+
+// Dump decodes the encoded metastore object data and writes its records to w
+// as a human-readable table, one record per line. The start and end of each
+// record are formatted as RFC3339; labels other than the path, start and end
+// are listed last. data may be gzip or zstd compressed.
+func Dump(w io.Writer, data []byte, opts ...DumpOption) error {
+	return dump(w, data, opts, func(object *dataobj.Object, f func(streams.Stream) error) error {
+		return replayStreams(context.Background(), object, 1, f)
+	})
+}
+
+// DumpSection is like [Dump], but only writes the records of the section at
+// index i of the object, as numbered by [dataobj.Object.Sections]. It returns
+// an error if that section isn't a streams section.
+func DumpSection(w io.Writer, data []byte, i int, opts ...DumpOption) error {
+	return dump(w, data, opts, func(object *dataobj.Object, f func(streams.Stream) error) error {
+		section, err := object.SectionAt(i)
+		if err != nil {
+			return err
+		}
+		return readStreamsSection(context.Background(), section, f)
+	})
+}
+
+// dump writes the records of the metastore object data which read passes to its callback to w.
+func dump(w io.Writer, data []byte, opts []DumpOption, read func(*dataobj.Object, func(streams.Stream) error) error) error {
+	var o dumpOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Decode into a copy so data isn't overwritten.
+	buf, err := decodeBytes(o.decode, data)
+	if err != nil {
+		return err
+	}
+	object, err := openObject(buf)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tSTART\tEND\tLABELS")
+	err = read(object, func(stream streams.Stream) error {
+		var extra []string
+		stream.Labels.Range(func(l labels.Label) {
+			switch l.Name {
+			case labelNamePath, labelNameStart, labelNameEnd:
+			default:
+				extra = append(extra, l.Name+"="+strconv.Quote(l.Value))
+			}
+		})
+		_, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+			stream.Labels.Get(labelNamePath),
+			formatTimestampLabel(stream.Labels.Get(labelNameStart)),
+			formatTimestampLabel(stream.Labels.Get(labelNameEnd)),
+			strings.Join(extra, ", "),
+		)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "reading metastore object")
+	}
+	return tw.Flush()
+}
+
+// formatTimestampLabel formats the value of a start or end label as RFC3339,
+// returning values which aren't timestamps as is.
+func formatTimestampLabel(value string) string {
+	nanos, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return value
+	}
+	return time.Unix(0, nanos).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,78 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/loki/v3/pkg/dataobj"
+	"github.com/grafana/loki/v3/pkg/dataobj/sections/streams"
+)
+
+func TestDump(t *testing.T) {
+	ctx := context.Background()
+	bucket := objstore.NewInMemBucket()
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger())
+
+	start := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	end := start.Add(30 * time.Minute)
+	require.NoError(t, m.Update(ctx, testObjectPath("a"), start, end))
+
+	var buf bytes.Buffer
+	data := bucket.Objects()[metastorePath(tenantID, start.Truncate(metastoreWindowSize))]
+	require.NoError(t, Dump(&buf, data))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	require.Equal(t, []string{"PATH", "START", "END", "LABELS"}, strings.Fields(lines[0]))
+	require.Equal(t, []string{testObjectPath("a"), "2025-01-01T15:00:00Z", "2025-01-01T15:30:00Z"}, strings.Fields(lines[1]))
+}
+
+func TestDumpSection(t *testing.T) {
+	ctx := context.Background()
+	bucket := objstore.NewInMemBucket()
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger())
+
+	start := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	require.NoError(t, m.Update(ctx, testObjectPath("a"), start, start))
+	data := bucket.Objects()[metastorePath(tenantID, start.Truncate(metastoreWindowSize))]
+
+	object, err := dataobj.FromReaderAt(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	streamsIndex, logsIndex := -1, -1
+	for i, section := range object.Sections() {
+		if streams.CheckSection(section) {
+			streamsIndex = i
+		} else {
+			logsIndex = i
+		}
+	}
+	require.NotEqual(t, -1, streamsIndex)
+	require.NotEqual(t, -1, logsIndex)
+
+	_, err = streams.OpenAt(ctx, object, streamsIndex)
+	require.NoError(t, err)
+	_, err = streams.OpenAt(ctx, object, logsIndex)
+	require.Error(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, DumpSection(&buf, data, streamsIndex))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	require.Equal(t, testObjectPath("a"), strings.Fields(lines[1])[0])
+
+	require.Error(t, DumpSection(io.Discard, data, logsIndex))
+	require.ErrorContains(t, DumpSection(io.Discard, data, len(object.Sections())), "out of range")
+}
+
+func TestFormatTimestampLabel(t *testing.T) {
+	require.Equal(t, "2025-01-01T15:00:00Z", formatTimestampLabel("1735743600000000000"))
+	require.Equal(t, "not-a-timestamp", formatTimestampLabel("not-a-timestamp"))
+}
@@ -0,0 +1,180 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+)
+
+// JournalOperation is the kind of mutation of a metastore object recorded in a [Journal].
+type JournalOperation string
+
+const (
+	// JournalOperationAdd records a dataobj path added to a metastore object.
+	JournalOperationAdd JournalOperation = "add"
+	// JournalOperationRemove records a metastore object deleted by retention,
+	// or a dataobj path removed from a metastore object by [Updater.Remove].
+	JournalOperationRemove JournalOperation = "remove"
+	// JournalOperationUpgrade records a metastore object rewritten with the current encoding.
+	JournalOperationUpgrade JournalOperation = "upgrade"
+)
+
+// JournalRecord describes a single mutation of a metastore object.
+type JournalRecord struct {
+	Time      time.Time        `json:"time"`
+	Tenant    string           `json:"tenant"`
+	Operation JournalOperation `json:"operation"`
+	Metastore string           `json:"metastore"`
+	Window    time.Time        `json:"window"`
+
+	// Path, MinTimestamp and MaxTimestamp describe the added dataobj. Path is
+	// also set for removed dataobjs.
+	Path         string    `json:"path,omitempty"`
+	MinTimestamp time.Time `json:"min_timestamp,omitzero"`
+	MaxTimestamp time.Time `json:"max_timestamp,omitzero"`
+
+	// Size is the size of the metastore object after the mutation in bytes.
+	Size int64 `json:"size"`
+}
+
+// Journal records the mutations of metastore objects made by an [Updater],
+// e.g. as an audit trail. Records are passed to the journal after their
+// mutation succeeded, with all records of a single write at once.
+type Journal interface {
+	Record(ctx context.Context, records []JournalRecord) error
+}
+
+// nopJournal is the [Journal] of updaters without [WithJournal].
+type nopJournal struct{}
+
+func (nopJournal) Record(context.Context, []JournalRecord) error { return nil }
+
+// WithJournal makes the [Updater] record every mutation of metastore objects
+// in journal: dataobj paths added by updates, objects deleted by retention and
+// objects rewritten by upgrades. Failing to record a mutation doesn't fail it;
+// failures are logged and counted in a metric.
+func WithJournal(journal Journal) UpdaterOption {
+	return func(u *Updater) {
+		u.journal = journal
+	}
+}
+
+// recordJournal passes records to the journal, logging and counting failures.
+func (m *Updater) recordJournal(ctx context.Context, records []JournalRecord) {
+	if err := m.journal.Record(ctx, records); err != nil {
+		level.Warn(m.logger).Log("msg", "failed to record metastore mutations in journal", "err", err, "records", len(records))
+		m.metrics.incJournalFailures()
+	}
+}
+
+// journalRecord returns a record of operation on the metastore object at metastorePath.
+func (m *Updater) journalRecord(operation JournalOperation, metastorePath string, size int64) JournalRecord {
+	window, _ := m.layout.parseWindow(m.tenantID, metastorePath)
+	return JournalRecord{
+		Time:      time.Now().UTC(),
+		Tenant:    m.tenantID,
+		Operation: operation,
+		Metastore: metastorePath,
+		Window:    window,
+		Size:      size,
+	}
+}
+
+// measure returns r, storing its size in size once it is known. Readers of
+// known size are returned as is, so uploads can still determine their size.
+func measure(r io.Reader, size *int64) io.Reader {
+	if n, err := objstore.TryToGetSize(r); err == nil {
+		*size = n
+		return r
+	}
+	*size = 0
+	return &measuringReader{r: r, size: size}
+}
+
+// measuringReader adds the number of bytes read from r to size.
+type measuringReader struct {
+	r    io.Reader
+	size *int64
+}
+
+func (r *measuringReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	*r.size += int64(n)
+	return n, err
+}
+
+// BucketJournal is a [Journal] which writes records as JSON lines to objects
+// in a bucket, one per batch of records of a tenant and UTC day. Objects are
+// only ever created, never appended to, so concurrent updaters of a tenant
+// don't lose records, and recording a batch costs a single upload however
+// large the journal grows. The objects of a day are named by the time of
+// their first record, so listing them returns them in order.
+type BucketJournal struct {
+	bucket objstore.Bucket
+}
+
+// NewBucketJournal returns a [BucketJournal] writing to bucket, which may be
+// the bucket of the metastore. Journal objects are kept outside of the
+// metastore directory, so they are never mistaken for metastore objects.
+func NewBucketJournal(bucket objstore.Bucket) *BucketJournal {
+	return &BucketJournal{bucket: bucket}
+}
+
+// journalDir returns the directory of the journal objects of the tenant for the day of t.
+func journalDir(tenantID string, t time.Time) string {
+	return tenantDir(tenantID) + "metastore-journal/" + t.UTC().Format(time.DateOnly) + "/"
+}
+
+// journalPath returns the path of a new journal object of the tenant for
+// records starting at t. The random suffix keeps objects of concurrent
+// updaters apart.
+func journalPath(tenantID string, t time.Time) string {
+	return fmt.Sprintf("%s%d-%08x.jsonl", journalDir(tenantID, t), t.UnixNano(), rand.Uint32())
+}
+
+// Record implements [Journal].
+func (j *BucketJournal) Record(ctx context.Context, records []JournalRecord) error {
+	// Group records by day, keeping their order.
+	var (
+		dirs    []string
+		byDir   = make(map[string][]JournalRecord)
+		lastErr error
+	)
+	for _, record := range records {
+		dir := journalDir(record.Tenant, record.Time)
+		if _, ok := byDir[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], record)
+	}
+
+	for _, dir := range dirs {
+		if err := j.write(ctx, byDir[dir]); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// write writes records to a new journal object.
+func (j *BucketJournal) write(ctx context.Context, records []JournalRecord) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return errors.Wrap(err, "encoding journal record")
+		}
+	}
+	if err := j.bucket.Upload(ctx, journalPath(records[0].Tenant, records[0].Time), &buf); err != nil {
+		return errors.Wrap(err, "uploading journal object")
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package metastore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+// readJournal returns the records of all journal objects of the tenant in bucket.
+func readJournal(t *testing.T, bucket *objstore.InMemBucket) []JournalRecord {
+	t.Helper()
+
+	var records []JournalRecord
+	for path, data := range bucket.Objects() {
+		if !strings.HasSuffix(path, ".jsonl") {
+			continue
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			var record JournalRecord
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+			require.True(t, strings.HasPrefix(path, journalDir(tenantID, record.Time)), "expected %s in the journal directory of its day", path)
+			records = append(records, record)
+		}
+		require.NoError(t, scanner.Err())
+	}
+	slices.SortStableFunc(records, func(a, b JournalRecord) int { return a.Time.Compare(b.Time) })
+	return records
+}
+
+type failingJournal struct{}
+
+func (failingJournal) Record(context.Context, []JournalRecord) error {
+	return errors.New("journal unavailable")
+}
+
+func TestJournal(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	window := now.Truncate(metastoreWindowSize)
+	path := metastorePath(tenantID, window)
+
+	t.Run("records updates and retention", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithJournal(NewBucketJournal(bucket)))
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now.Add(time.Minute)))
+		deleted, err := m.EnforceRetention(ctx, window.Add(metastoreWindowSize))
+		require.NoError(t, err)
+		require.Equal(t, 1, deleted)
+
+		records := readJournal(t, bucket)
+		require.Len(t, records, 2)
+
+		added := records[0]
+		require.Equal(t, JournalOperationAdd, added.Operation)
+		require.Equal(t, tenantID, added.Tenant)
+		require.Equal(t, path, added.Metastore)
+		require.True(t, window.Equal(added.Window))
+		require.Equal(t, testObjectPath("a"), added.Path)
+		require.True(t, now.Equal(added.MinTimestamp))
+		require.True(t, now.Add(time.Minute).Equal(added.MaxTimestamp))
+		require.Positive(t, added.Size)
+
+		removed := records[1]
+		require.Equal(t, JournalOperationRemove, removed.Operation)
+		require.Equal(t, path, removed.Metastore)
+		require.Empty(t, removed.Path)
+		require.Zero(t, removed.Size)
+	})
+
+	t.Run("records the size of the written object", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithJournal(NewBucketJournal(bucket)), WithStreamingFlush())
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+		records := readJournal(t, bucket)
+		require.Len(t, records, 1)
+		require.Equal(t, int64(len(bucket.Objects()[path])), records[0].Size)
+	})
+
+	t.Run("writes each batch of records to its own object", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		journal := NewBucketJournal(bucket)
+		first := JournalRecord{Time: now, Tenant: tenantID, Operation: JournalOperationAdd, Metastore: path}
+		require.NoError(t, journal.Record(ctx, []JournalRecord{first}))
+		written := maps.Clone(bucket.Objects())
+
+		second := first
+		second.Time = now.Add(time.Second)
+		require.NoError(t, journal.Record(ctx, []JournalRecord{second, second}))
+
+		// Earlier objects are left as is.
+		require.Len(t, bucket.Objects(), 2)
+		for path, data := range written {
+			require.Equal(t, data, bucket.Objects()[path])
+		}
+		require.Len(t, readJournal(t, bucket), 3)
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger())
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+		require.Empty(t, readJournal(t, bucket))
+	})
+
+	t.Run("failures don't fail updates", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithJournal(failingJournal{}))
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+		require.Equal(t, float64(1), testutil.ToFloat64(m.metrics.journalFailures))
+		require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("a")))
+	})
+}
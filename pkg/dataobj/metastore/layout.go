@@ -0,0 +1,87 @@
+package metastore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/thanos-io/objstore"
+)
+
+// PathLayout determines the paths of metastore objects within the metastore
+// directory of a tenant. Readers only find objects written with their own
+// layout, so the layouts can't be mixed in one bucket: all updaters, readers
+// and queriers of a bucket must use the same layout, and switching layouts
+// requires moving the existing objects.
+type PathLayout int
+
+const (
+	// FlatPathLayout stores all metastore objects of a tenant directly in its
+	// metastore directory, e.g. metastore/2024-06-01T12:00:00Z.store. It is the
+	// default layout.
+	FlatPathLayout PathLayout = iota
+
+	// DatePathLayout partitions metastore objects of a tenant by the UTC date
+	// of their window, e.g. metastore/2024/06/01/2024-06-01T12:00:00Z.store, so
+	// bucket lifecycle rules can match objects by date prefix.
+	DatePathLayout
+)
+
+// datePrefixFormat is the format of the directories of [DatePathLayout].
+const datePrefixFormat = "2006/01/02/"
+
+// WithPathLayout makes the [Updater] write and list metastore objects with
+// layout instead of [FlatPathLayout]. Readers of the bucket must use the same
+// layout.
+func WithPathLayout(layout PathLayout) UpdaterOption {
+	return func(u *Updater) {
+		u.layout = layout
+	}
+}
+
+// path returns the path of the metastore object of the tenant for the window starting at window.
+func (l PathLayout) path(tenantID string, window time.Time) string {
+	if l == DatePathLayout {
+		return fmt.Sprintf("%s%s%s.store", metastoreDir(tenantID), window.Format(datePrefixFormat), window.Format(time.RFC3339))
+	}
+	return metastorePath(tenantID, window)
+}
+
+// parseWindow returns the start of the window encoded in a metastore path.
+func (l PathLayout) parseWindow(tenantID, path string) (time.Time, error) {
+	if l != DatePathLayout {
+		return parseMetastoreWindow(tenantID, path)
+	}
+
+	name, ok := strings.CutPrefix(path, metastoreDir(tenantID))
+	if !ok {
+		return time.Time{}, fmt.Errorf("path %s is not a metastore of tenant %s", path, tenantID)
+	}
+	if len(name) < len(datePrefixFormat) {
+		return time.Time{}, fmt.Errorf("path %s is not a date-partitioned metastore object", path)
+	}
+	datePrefix, name := name[:len(datePrefixFormat)], name[len(datePrefixFormat):]
+	name, ok = strings.CutSuffix(name, ".store")
+	if !ok {
+		return time.Time{}, fmt.Errorf("path %s is not a metastore object", path)
+	}
+	window, err := time.Parse(time.RFC3339, name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if window.Format(datePrefixFormat) != datePrefix {
+		return time.Time{}, fmt.Errorf("path %s is not in the directory of the date of its window", path)
+	}
+	return window, nil
+}
+
+// iter calls f with the path of every object in the metastore directory of
+// the tenant, including the date directories of [DatePathLayout].
+func (l PathLayout) iter(ctx context.Context, bucket objstore.Bucket, tenantID string, f func(path string) error) error {
+	var opts []objstore.IterOption
+	if l == DatePathLayout {
+		opts = append(opts, objstore.WithRecursiveIter())
+	}
+	return bucket.Iter(ctx, metastoreDir(tenantID), f, opts...)
+}
@@ -0,0 +1,96 @@
+package metastore
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/user"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestPathLayout(t *testing.T) {
+	window := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		layout PathLayout
+		path   string
+	}{
+		{layout: FlatPathLayout, path: "tenant-" + tenantID + "/metastore/2024-06-01T12:00:00Z.store"},
+		{layout: DatePathLayout, path: "tenant-" + tenantID + "/metastore/2024/06/01/2024-06-01T12:00:00Z.store"},
+	} {
+		require.Equal(t, tc.path, tc.layout.path(tenantID, window))
+
+		parsed, err := tc.layout.parseWindow(tenantID, tc.path)
+		require.NoError(t, err)
+		require.True(t, window.Equal(parsed))
+	}
+
+	for _, path := range []string{
+		"tenant-" + tenantID + "/metastore/2024-06-01T12:00:00Z.store",
+		"tenant-" + tenantID + "/metastore/2024/06/02/2024-06-01T12:00:00Z.store",
+		"tenant-" + tenantID + "/metastore/2024/06/01/2024-06-01T12:00:00Z.store" + stagingSuffix,
+		"tenant-other/metastore/2024/06/01/2024-06-01T12:00:00Z.store",
+	} {
+		_, err := DatePathLayout.parseWindow(tenantID, path)
+		require.Error(t, err, path)
+	}
+	_, err := FlatPathLayout.parseWindow(tenantID, DatePathLayout.path(tenantID, window))
+	require.Error(t, err)
+}
+
+func TestDatePathLayout(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), tenantID)
+	now := time.Date(2024, 6, 1, 15, 0, 0, 0, time.UTC)
+	first, _ := WindowFor(now)
+	second := first.Add(metastoreWindowSize)
+
+	bucket := objstore.NewInMemBucket()
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithPathLayout(DatePathLayout))
+	require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now.Add(metastoreWindowSize)))
+
+	paths := slices.Sorted(maps.Keys(bucket.Objects()))
+	require.Equal(t, []string{
+		"tenant-" + tenantID + "/metastore/2024/06/01/2024-06-01T12:00:00Z.store",
+		"tenant-" + tenantID + "/metastore/2024/06/02/2024-06-02T00:00:00Z.store",
+	}, paths)
+
+	t.Run("read by the object metastore", func(t *testing.T) {
+		objects, err := NewObjectMetastore(bucket, WithObjectMetastorePathLayout(DatePathLayout)).DataObjects(ctx, now, now.Add(metastoreWindowSize))
+		require.NoError(t, err)
+		require.Equal(t, []string{testObjectPath("a")}, objects)
+
+		objects, err = NewObjectMetastore(bucket).DataObjects(ctx, now, now.Add(metastoreWindowSize))
+		require.NoError(t, err)
+		require.Empty(t, objects)
+	})
+
+	t.Run("read by the querier", func(t *testing.T) {
+		q := NewQuerier(bucket, log.NewNopLogger(), WithQuerierPathLayout(DatePathLayout))
+		windows, err := q.Windows(ctx, tenantID)
+		require.NoError(t, err)
+		require.Equal(t, []time.Time{first, second}, windows)
+
+		objects, _, err := q.DataObjPathsPage(ctx, tenantID, second, 0, 10)
+		require.NoError(t, err)
+		require.Equal(t, []string{testObjectPath("a")}, objects)
+	})
+
+	t.Run("tenants are listed", func(t *testing.T) {
+		tenants, err := ListTenants(ctx, bucket)
+		require.NoError(t, err)
+		require.Equal(t, []string{tenantID}, tenants)
+	})
+
+	t.Run("retention", func(t *testing.T) {
+		deleted, err := m.EnforceRetention(ctx, second)
+		require.NoError(t, err)
+		require.Equal(t, 1, deleted)
+		require.NotContains(t, bucket.Objects(), DatePathLayout.path(tenantID, first))
+		require.Contains(t, bucket.Objects(), DatePathLayout.path(tenantID, second))
+	})
+}
@@ -0,0 +1,167 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+)
+
+// Manifest lists the metastore windows of a tenant which contain data, so
+// they can be discovered without listing the bucket.
+//
+// Windows are always written before the manifest is updated, so the manifest
+// may miss windows after a crash but never lists windows which were never
+// written. [Updater.ReconcileManifest] brings it back in sync with the bucket.
+type Manifest struct {
+	Windows []ManifestWindow `json:"windows"`
+}
+
+// ManifestWindow is a metastore window listed in a [Manifest].
+type ManifestWindow struct {
+	Start        time.Time `json:"start"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// WithManifest makes the [Updater] maintain a [Manifest] of the metastore
+// windows of its tenant, which the [Querier] uses to discover windows.
+func WithManifest() UpdaterOption {
+	return func(u *Updater) {
+		u.manifest = true
+	}
+}
+
+// manifestRefreshInterval is how often the [Updater] refreshes the last
+// modification of a window in the manifest when writing the window.
+const manifestRefreshInterval = 15 * time.Minute
+
+// ManifestUpdateFailures returns the number of manifest updates which failed
+// since the [Updater] was created or the manifest was last reconciled. Windows
+// whose update failed may be missing from the manifest until their next write,
+// so callers can reconcile the manifest only when this isn't zero.
+func (m *Updater) ManifestUpdateFailures() int {
+	return m.manifestFailures
+}
+
+// manifestPath returns the path of the manifest of the tenant. It is kept
+// outside of the metastore directory so listing windows doesn't return it.
+func manifestPath(tenantID string) string {
+	return tenantDir(tenantID) + "metastore-manifest.json"
+}
+
+// addToManifest records that the window starting at window was modified at modified.
+func (m *Updater) addToManifest(ctx context.Context, window, modified time.Time) error {
+	return m.replaceManifest(ctx, func(manifest *Manifest) {
+		idx := slices.IndexFunc(manifest.Windows, func(w ManifestWindow) bool { return w.Start.Equal(window) })
+		if idx >= 0 {
+			manifest.Windows[idx].LastModified = modified
+			return
+		}
+		manifest.Windows = append(manifest.Windows, ManifestWindow{Start: window, LastModified: modified})
+	})
+}
+
+// removeFromManifest removes the windows starting at windows from the manifest.
+func (m *Updater) removeFromManifest(ctx context.Context, windows []time.Time) error {
+	for _, window := range windows {
+		delete(m.manifestRefreshed, window)
+	}
+	return m.replaceManifest(ctx, func(manifest *Manifest) {
+		manifest.Windows = slices.DeleteFunc(manifest.Windows, func(w ManifestWindow) bool {
+			return slices.ContainsFunc(windows, w.Start.Equal)
+		})
+	})
+}
+
+// ReconcileManifest rewrites the manifest of the tenant with the windows found
+// in the bucket, repairing windows missed by a crash between writing a window
+// and updating the manifest, or windows removed outside of the [Updater].
+func (m *Updater) ReconcileManifest(ctx context.Context) error {
+	started := time.Now()
+
+	var paths []string
+	err := m.layout.iter(ctx, m.bucket, m.tenantID, func(path string) error {
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "listing metastore objects")
+	}
+
+	listed := make([]ManifestWindow, 0, len(paths))
+	for _, path := range paths {
+		window, err := m.layout.parseWindow(m.tenantID, path)
+		if err != nil {
+			level.Warn(m.logger).Log("msg", "skipping unexpected object in metastore directory", "path", path, "err", err)
+			continue
+		}
+		modified := started
+		if attrs, err := m.bucket.Attributes(ctx, path); err == nil {
+			modified = attrs.LastModified
+		}
+		listed = append(listed, ManifestWindow{Start: window, LastModified: modified})
+	}
+
+	err = m.replaceManifest(ctx, func(manifest *Manifest) {
+		for _, w := range manifest.Windows {
+			idx := slices.IndexFunc(listed, func(l ManifestWindow) bool { return l.Start.Equal(w.Start) })
+			switch {
+			case idx >= 0:
+				// Prefer the recorded time, as not all buckets report modification times.
+				listed[idx].LastModified = w.LastModified
+			case w.LastModified.After(started):
+				// Written after listing, so it wasn't listed yet.
+				listed = append(listed, w)
+			}
+		}
+		manifest.Windows = listed
+	})
+	if err != nil {
+		return err
+	}
+	m.manifestFailures = 0
+	return nil
+}
+
+// replaceManifest applies f to the manifest of the tenant and writes the result back atomically.
+func (m *Updater) replaceManifest(ctx context.Context, f func(*Manifest)) error {
+	return m.bucket.GetAndReplace(ctx, manifestPath(m.tenantID), func(existing io.Reader) (io.Reader, error) {
+		var manifest Manifest
+		if existing != nil {
+			if err := json.NewDecoder(existing).Decode(&manifest); err != nil {
+				return nil, errors.Wrap(err, "decoding manifest")
+			}
+		}
+
+		f(&manifest)
+		slices.SortFunc(manifest.Windows, func(a, b ManifestWindow) int { return a.Start.Compare(b.Start) })
+
+		data, err := json.Marshal(manifest)
+		if err != nil {
+			return nil, errors.Wrap(err, "encoding manifest")
+		}
+		return bytes.NewReader(data), nil
+	})
+}
+
+// readManifest reads the manifest of the tenant.
+func readManifest(ctx context.Context, bucket objstore.Bucket, tenantID string) (Manifest, error) {
+	var manifest Manifest
+
+	reader, err := bucket.Get(ctx, manifestPath(tenantID))
+	if err != nil {
+		return manifest, err
+	}
+	defer reader.Close()
+
+	if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+		return manifest, errors.Wrap(err, "decoding manifest")
+	}
+	return manifest, nil
+}
@@ -0,0 +1,147 @@
+package metastore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func manifestWindows(t *testing.T, bucket objstore.Bucket) []time.Time {
+	t.Helper()
+	manifest, err := readManifest(context.Background(), bucket, tenantID)
+	require.NoError(t, err)
+
+	var windows []time.Time
+	for _, w := range manifest.Windows {
+		windows = append(windows, w.Start.UTC())
+	}
+	return windows
+}
+
+func TestManifest(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	window := now.Truncate(metastoreWindowSize)
+	previous := window.Add(-metastoreWindowSize)
+
+	t.Run("update adds windows", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithManifest())
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), previous, now))
+		require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+		require.Equal(t, []time.Time{previous, window}, manifestWindows(t, bucket))
+	})
+
+	t.Run("writes of listed windows only refresh them occasionally", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithManifest())
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+		before := bucket.Objects()[manifestPath(tenantID)]
+		require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+		require.Equal(t, before, bucket.Objects()[manifestPath(tenantID)])
+
+		m.manifestRefreshed[window] = m.manifestRefreshed[window].Add(-manifestRefreshInterval)
+		require.NoError(t, m.Update(ctx, testObjectPath("c"), now, now))
+		require.NotEqual(t, before, bucket.Objects()[manifestPath(tenantID)])
+	})
+
+	t.Run("failed updates are counted and retried", func(t *testing.T) {
+		bucket := &failingManifestBucket{InMemBucket: objstore.NewInMemBucket(), fail: true}
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithManifest())
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+		require.NotContains(t, bucket.Objects(), manifestPath(tenantID))
+		require.Equal(t, 1, m.ManifestUpdateFailures())
+
+		// The window is added on its next write.
+		bucket.fail = false
+		require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+		require.Equal(t, []time.Time{window}, manifestWindows(t, bucket))
+
+		require.NoError(t, m.ReconcileManifest(ctx))
+		require.Zero(t, m.ManifestUpdateFailures())
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger())
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+		require.NotContains(t, bucket.Objects(), manifestPath(tenantID))
+	})
+
+	t.Run("reconcile repairs missed and removed windows", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithManifest())
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+		// Simulate a crash between writing a window and updating the manifest.
+		require.NoError(t, NewUpdater(bucket, tenantID, log.NewNopLogger()).Update(ctx, testObjectPath("b"), previous, previous))
+		// A window removed outside of the updater.
+		stale := window.Add(-2 * metastoreWindowSize)
+		require.NoError(t, m.addToManifest(ctx, stale, now.Add(-time.Hour)))
+		require.Equal(t, []time.Time{stale, window}, manifestWindows(t, bucket))
+
+		require.NoError(t, m.ReconcileManifest(ctx))
+		require.Equal(t, []time.Time{previous, window}, manifestWindows(t, bucket))
+	})
+
+	t.Run("retention removes windows", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithManifest())
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), previous, now))
+		deleted, err := m.EnforceRetention(ctx, window)
+		require.NoError(t, err)
+		require.Equal(t, 1, deleted)
+		require.Equal(t, []time.Time{window}, manifestWindows(t, bucket))
+	})
+}
+
+// failingManifestBucket fails updates of the manifest while fail is set.
+type failingManifestBucket struct {
+	*objstore.InMemBucket
+	fail bool
+}
+
+func (b *failingManifestBucket) GetAndReplace(ctx context.Context, name string, f func(io.Reader) (io.Reader, error)) error {
+	if b.fail && name == manifestPath(tenantID) {
+		return errors.New("manifest unavailable")
+	}
+	return b.InMemBucket.GetAndReplace(ctx, name, f)
+}
+
+func TestQuerierWindows(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	window := now.Truncate(metastoreWindowSize)
+	previous := window.Add(-metastoreWindowSize)
+
+	for _, tc := range []struct {
+		name string
+		opts []UpdaterOption
+	}{
+		{name: "with manifest", opts: []UpdaterOption{WithManifest()}},
+		{name: "without manifest"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			bucket := objstore.NewInMemBucket()
+			m := NewUpdater(bucket, tenantID, log.NewNopLogger(), tc.opts...)
+			require.NoError(t, m.Update(ctx, testObjectPath("a"), previous, now))
+
+			windows, err := NewQuerier(bucket, log.NewNopLogger()).Windows(ctx, tenantID)
+			require.NoError(t, err)
+			require.Len(t, windows, 2)
+			require.True(t, windows[0].Equal(previous))
+			require.True(t, windows[1].Equal(window))
+		})
+	}
+}
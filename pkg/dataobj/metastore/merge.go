@@ -0,0 +1,81 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/loki/v3/pkg/dataobj/consumer/logsobj"
+	"github.com/grafana/loki/v3/pkg/dataobj/sections/streams"
+	"github.com/grafana/loki/v3/pkg/logproto"
+)
+
+// Merge combines the entries of the encoded metastore objects dst and srcs
+// into a single encoded metastore object. Entries present in more than one
+// object are only kept once. dst may be empty, in which case only srcs are
+// merged. Compressed objects are decompressed, and the merged object is
+// written uncompressed.
+//
+// Merge operates purely on byte slices so it can be used by offline tools,
+// for example when re-sharding metastore windows.
+func Merge(ctx context.Context, dst []byte, srcs ...[]byte) ([]byte, error) {
+	return MergeWithTransforms(ctx, nil, nil, dst, srcs...)
+}
+
+// MergeWithTransforms is like [Merge] for metastore objects written with
+// [WithTransforms]: decode is applied to dst and srcs before merging them, and
+// encode to the merged object. A nil transform leaves objects as is.
+func MergeWithTransforms(ctx context.Context, decode, encode Transform, dst []byte, srcs ...[]byte) ([]byte, error) {
+	builder, err := logsobj.NewBuilder(metastoreBuilderCfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating metastore builder")
+	}
+
+	seen := make(map[string]struct{})
+	for i, data := range append([][]byte{dst}, srcs...) {
+		if len(data) == 0 {
+			continue
+		}
+
+		// Decode into a copy so data isn't overwritten.
+		buf, err := decodeBytes(decode, data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "metastore object %d", i)
+		}
+		object, err := openObject(buf)
+		if err != nil {
+			return nil, errors.Wrapf(err, "metastore object %d", i)
+		}
+
+		err = replayStreams(ctx, object, 1, func(stream streams.Stream) error {
+			// Label order isn't guaranteed to match across objects.
+			sort.Sort(stream.Labels)
+			ls := stream.Labels.String()
+			if _, ok := seen[ls]; ok {
+				return nil
+			}
+			seen[ls] = struct{}{}
+
+			return builder.Append(logproto.Stream{Labels: ls, Entries: replayedEntries})
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading metastore object %d", i)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := builder.Flush(&buf); err != nil {
+		return nil, errors.Wrap(err, "flushing metastore builder")
+	}
+	if encode == nil {
+		return buf.Bytes(), nil
+	}
+	encoded, err := encodeWith(encode, &buf)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(encoded)
+}
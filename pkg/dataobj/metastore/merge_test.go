@@ -0,0 +1,172 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/loki/v3/pkg/dataobj"
+	"github.com/grafana/loki/v3/pkg/dataobj/sections/streams"
+)
+
+func TestMerge(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+
+	// writeObject returns an encoded metastore object referencing the given paths.
+	writeObject := func(paths ...string) []byte {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger())
+		for _, path := range paths {
+			require.NoError(t, m.Update(ctx, testObjectPath(path), now, now))
+		}
+		objects := bucket.Objects()
+		require.Len(t, objects, 1)
+		for _, data := range objects {
+			return data
+		}
+		return nil
+	}
+
+	readPaths := func(data []byte) []string {
+		object, err := dataobj.FromReaderAt(bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+
+		var paths []string
+		err = replayStreams(ctx, object, 1, func(stream streams.Stream) error {
+			paths = append(paths, strings.TrimPrefix(stream.Labels.Get(labelNamePath), testObjectPath("")))
+			return nil
+		})
+		require.NoError(t, err)
+		return paths
+	}
+
+	merged, err := Merge(ctx, writeObject("a", "b"), writeObject("b", "c"), nil, writeObject("d"))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"a", "b", "c", "d"}, readPaths(merged))
+
+	merged, err = Merge(ctx, nil, writeObject("a"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, readPaths(merged))
+
+	_, err = Merge(ctx, nil)
+	require.Error(t, err)
+}
+
+func TestReplayStreamsParallel(t *testing.T) {
+	ctx := context.Background()
+
+	// Build an object with several streams sections, as produced by merges.
+	var expected []string
+	builder := dataobj.NewBuilder()
+	for section := 0; section < 4; section++ {
+		sb := streams.NewBuilder(nil, 1024)
+		for i := 0; i < 250; i++ {
+			ls := labels.FromStrings(labelNamePath, fmt.Sprintf("section-%d/object-%03d", section, i))
+			sb.Record(ls, time.Unix(0, int64(i)), 1)
+			expected = append(expected, ls.String())
+		}
+		require.NoError(t, builder.Append(sb))
+	}
+	var buf bytes.Buffer
+	_, err := builder.Flush(&buf)
+	require.NoError(t, err)
+
+	object, err := dataobj.FromReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	for _, parallelism := range []int{1, 2, 8} {
+		t.Run(fmt.Sprintf("parallelism=%d", parallelism), func(t *testing.T) {
+			var actual []string
+			err := replayStreams(ctx, object, parallelism, func(stream streams.Stream) error {
+				actual = append(actual, stream.Labels.String())
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestReplayStreamsCancelled(t *testing.T) {
+	sb := streams.NewBuilder(nil, 1024)
+	for i := 0; i < 1000; i++ {
+		sb.Record(labels.FromStrings(labelNamePath, fmt.Sprintf("object-%03d", i)), time.Unix(0, int64(i)), 1)
+	}
+	builder := dataobj.NewBuilder()
+	require.NoError(t, builder.Append(sb))
+	var buf bytes.Buffer
+	_, err := builder.Flush(&buf)
+	require.NoError(t, err)
+
+	object, err := dataobj.FromReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var replayed int
+	err = replayStreams(ctx, object, 1, func(streams.Stream) error {
+		replayed++
+		cancel()
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, replayed, 1000)
+}
+
+// deadlineReaderAt fails reads once ctx is done, like an object store read
+// past the deadline.
+type deadlineReaderAt struct {
+	ctx context.Context
+	r   io.ReaderAt
+}
+
+func (r deadlineReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.ReadAt(p, off)
+}
+
+func TestReplayStreamsDeadline(t *testing.T) {
+	builder := dataobj.NewBuilder()
+	for section := 0; section < 2; section++ {
+		sb := streams.NewBuilder(nil, 1024)
+		for i := 0; i < 250; i++ {
+			sb.Record(labels.FromStrings(labelNamePath, fmt.Sprintf("section-%d/object-%03d", section, i)), time.Unix(0, int64(i)), 1)
+		}
+		require.NoError(t, builder.Append(sb))
+	}
+	var buf bytes.Buffer
+	_, err := builder.Flush(&buf)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	object, err := dataobj.FromReaderAt(deadlineReaderAt{ctx: ctx, r: bytes.NewReader(buf.Bytes())}, int64(buf.Len()))
+	require.NoError(t, err)
+
+	var replayed int
+	err = replayStreams(ctx, object, 1, func(streams.Stream) error {
+		replayed++
+		if replayed == 250 {
+			// The deadline expires once the first section is replayed, so
+			// reading the second one fails.
+			<-ctx.Done()
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 250, replayed)
+}
@@ -1,12 +1,17 @@
 package metastore
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"io"
 	"strconv"
 	"testing"
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/stretchr/testify/require"
 
@@ -15,9 +20,18 @@ import (
 
 	"github.com/grafana/dskit/user"
 
+	"github.com/grafana/loki/v3/pkg/dataobj"
 	"github.com/grafana/loki/v3/pkg/dataobj/consumer/logsobj"
+	"github.com/grafana/loki/v3/pkg/dataobj/sections/streams"
+	"github.com/grafana/loki/v3/pkg/logproto"
+	"github.com/grafana/loki/v3/pkg/logql/syntax"
 )
 
+// testObjectPath returns the path of a data object of the test tenant.
+func testObjectPath(name string) string {
+	return tenantDir(tenantID) + "objects/" + name
+}
+
 func BenchmarkWriteMetastores(t *testing.B) {
 	ctx := context.Background()
 	bucket := objstore.NewInMemBucket()
@@ -48,13 +62,94 @@ func BenchmarkWriteMetastores(t *testing.B) {
 	for i := 0; i < t.N; i++ {
 		// Test writing metastores
 		stats := flushStats[i%len(flushStats)]
-		err := m.Update(ctx, "path", stats.MinTimestamp, stats.MaxTimestamp)
+		err := m.Update(ctx, testObjectPath("path"), stats.MinTimestamp, stats.MaxTimestamp)
 		require.NoError(t, err)
 	}
 
 	require.Len(t, bucket.Objects(), 1)
 }
 
+// BenchmarkSectionStripeMergeLimit reads the metastore window of a
+// high-cardinality tenant built with different stripe merge limits, reporting
+// the number of sections of the object along with the read latency. The
+// builder uses small pages, buffers and sections, so the window is split into
+// several sections like a large window is with the default sizes.
+func BenchmarkSectionStripeMergeLimit(b *testing.B) {
+	const objects = 10000
+
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+
+	for _, limit := range []int{2, 4, 8, 16} {
+		b.Run("limit="+strconv.Itoa(limit), func(b *testing.B) {
+			bucket := objstore.NewInMemBucket()
+			m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithSectionStripeMergeLimit(limit), WithBufferedUpdates(0, 0))
+			m.builderCfg.TargetPageSize = 1024
+			m.builderCfg.BufferSize = 2 * 1024
+			m.builderCfg.TargetSectionSize = 4 * 1024
+			for i := range objects {
+				require.NoError(b, m.Update(ctx, testObjectPath(strconv.Itoa(i)), now, now))
+			}
+			require.NoError(b, m.Flush(ctx))
+
+			data := bucket.Objects()[metastorePath(tenantID, now.Truncate(metastoreWindowSize))]
+			object, err := dataobj.FromReaderAt(bytes.NewReader(data), int64(len(data)))
+			require.NoError(b, err)
+			sections := len(object.Sections())
+			require.Greater(b, sections, 1, "expected the window to be split into several sections")
+
+			querier := NewQuerier(bucket, log.NewNopLogger())
+			b.ResetTimer()
+			for b.Loop() {
+				paths, _, err := querier.DataObjPathsPage(ctx, tenantID, now, 0, objects)
+				require.NoError(b, err)
+				require.Len(b, paths, objects)
+			}
+			b.ReportMetric(float64(sections), "sections")
+		})
+	}
+}
+
+// BenchmarkReadFromExisting replays the metastore window of a high-cardinality
+// tenant into the builder, as done by every update of the window.
+func BenchmarkReadFromExisting(b *testing.B) {
+	const objects = 10000
+
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+
+	bucket := objstore.NewInMemBucket()
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithBufferedUpdates(0, 0))
+	for i := range objects {
+		require.NoError(b, m.Update(ctx, testObjectPath(strconv.Itoa(i)), now, now))
+	}
+	require.NoError(b, m.Flush(ctx))
+
+	data := bucket.Objects()[metastorePath(tenantID, now.Truncate(metastoreWindowSize))]
+	object, err := dataobj.FromReaderAt(bytes.NewReader(data), int64(len(data)))
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		m.metastoreBuilder.Reset()
+		require.NoError(b, m.readFromExisting(ctx, object))
+	}
+}
+
+func TestWithSectionStripeMergeLimit(t *testing.T) {
+	m := NewUpdater(objstore.NewInMemBucket(), tenantID, log.NewNopLogger())
+	require.Equal(t, metastoreBuilderCfg.SectionStripeMergeLimit, m.builderCfg.SectionStripeMergeLimit)
+
+	m = NewUpdater(objstore.NewInMemBucket(), tenantID, log.NewNopLogger(), WithSectionStripeMergeLimit(8))
+	require.Equal(t, 8, m.builderCfg.SectionStripeMergeLimit)
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	require.NoError(t, m.Update(context.Background(), testObjectPath("a"), now, now))
+
+	// Limits the builder can't use are raised to the minimum.
+	m = NewUpdater(objstore.NewInMemBucket(), tenantID, log.NewNopLogger(), WithSectionStripeMergeLimit(1))
+	require.Equal(t, 2, m.builderCfg.SectionStripeMergeLimit)
+}
+
 func TestWriteMetastores(t *testing.T) {
 	ctx := context.Background()
 	bucket := objstore.NewInMemBucket()
@@ -80,7 +175,7 @@ func TestWriteMetastores(t *testing.T) {
 	require.Len(t, bucket.Objects(), 0)
 
 	// Test writing metastores
-	err := m.Update(ctx, "test-dataobj-path", flushStats.MinTimestamp, flushStats.MaxTimestamp)
+	err := m.Update(ctx, testObjectPath("test-dataobj-path"), flushStats.MinTimestamp, flushStats.MaxTimestamp)
 	require.NoError(t, err)
 
 	require.Len(t, bucket.Objects(), 1)
@@ -94,7 +189,7 @@ func TestWriteMetastores(t *testing.T) {
 		MaxTimestamp: now,
 	}
 
-	err = m.Update(ctx, "different-dataobj-path", flushResult2.MinTimestamp, flushResult2.MaxTimestamp)
+	err = m.Update(ctx, testObjectPath("different-dataobj-path"), flushResult2.MinTimestamp, flushResult2.MaxTimestamp)
 	require.NoError(t, err)
 
 	require.Len(t, bucket.Objects(), 1)
@@ -103,6 +198,333 @@ func TestWriteMetastores(t *testing.T) {
 	}
 }
 
+// lossyBucket silently discards the first drops writes made via GetAndReplace.
+type lossyBucket struct {
+	*objstore.InMemBucket
+	drops int
+}
+
+func (b *lossyBucket) GetAndReplace(ctx context.Context, name string, f func(io.Reader) (io.Reader, error)) error {
+	if b.drops == 0 {
+		return b.InMemBucket.GetAndReplace(ctx, name, f)
+	}
+	b.drops--
+
+	var existing io.Reader
+	if r, err := b.Get(ctx, name); err == nil {
+		defer r.Close()
+		existing = r
+	}
+	_, err := f(existing)
+	return err
+}
+
+func TestWriteMetastoresVerifyAfterWrite(t *testing.T) {
+	ctx := context.Background()
+	bucket := &lossyBucket{InMemBucket: objstore.NewInMemBucket(), drops: 2}
+
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithVerifyAfterWrite())
+	m.backoff = backoff.New(context.TODO(), backoff.Config{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 100 * time.Millisecond,
+		MaxRetries: 5,
+	})
+
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	err := m.Update(ctx, testObjectPath("test-dataobj-path"), now.Add(-1*time.Hour), now)
+	require.NoError(t, err)
+
+	require.Len(t, bucket.Objects(), 1)
+	require.Equal(t, float64(2), testutil.ToFloat64(m.metrics.verificationFailures))
+	require.NoError(t, m.verifyWrite(ctx, metastorePath(tenantID, now.Truncate(metastoreWindowSize)), testObjectPath("test-dataobj-path")))
+}
+
+func TestWriteMetastoresGzippedExisting(t *testing.T) {
+	ctx := context.Background()
+	bucket := objstore.NewInMemBucket()
+
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger())
+
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	path := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+	require.NoError(t, m.Update(ctx, testObjectPath("first-dataobj-path"), now.Add(-1*time.Hour), now))
+
+	// Replace the object with a gzipped copy, as an external tool would write it.
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	_, err := gw.Write(bucket.Objects()[path])
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	require.NoError(t, bucket.Upload(ctx, path, &compressed))
+
+	require.NoError(t, m.Update(ctx, testObjectPath("second-dataobj-path"), now.Add(-1*time.Hour), now))
+
+	// The updated object is written uncompressed and contains both entries.
+	require.False(t, bytes.HasPrefix(bucket.Objects()[path], gzipMagic))
+	require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("first-dataobj-path")))
+	require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("second-dataobj-path")))
+}
+
+func TestUpdateRejectsInvalidPaths(t *testing.T) {
+	ctx := context.Background()
+	bucket := objstore.NewInMemBucket()
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger())
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+
+	for _, path := range []string{
+		"",
+		"/tenant-test-tenant/objects/abc",
+		"tenant-test-tenant/objects/../../tenant-other/objects/abc",
+		"tenant-test-tenant/../tenant-other/objects/abc",
+		"tenant-test-tenant/objects/./abc",
+		"tenant-test-tenant//objects/abc",
+		"tenant-test-tenant/objects/abc/",
+		"../tenant-test-tenant/objects/abc",
+		"tenant-other/objects/abc",
+		"tenant-test-tenant-2/objects/abc",
+		"objects/abc",
+	} {
+		t.Run(path, func(t *testing.T) {
+			err := m.Update(ctx, path, now, now)
+			require.ErrorContains(t, err, "invalid dataobj path")
+		})
+	}
+	require.Empty(t, bucket.Objects())
+
+	require.NoError(t, m.Update(ctx, testObjectPath("abc"), now, now))
+}
+
+func TestUpdateReleaseBuffers(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+
+	before := retainedBufferBytes.Load()
+	retaining := NewUpdater(objstore.NewInMemBucket(), tenantID, log.NewNopLogger())
+	require.NoError(t, retaining.Update(ctx, testObjectPath("path"), now.Add(-time.Hour), now))
+	require.GreaterOrEqual(t, retaining.retainedBytes, int64(metastoreBuilderCfg.TargetObjectSize))
+	require.Equal(t, before+retaining.retainedBytes, retainedBufferBytes.Load())
+
+	releasing := NewUpdater(objstore.NewInMemBucket(), tenantID, log.NewNopLogger(), WithReleaseBuffers())
+	for i := 0; i < 2; i++ {
+		require.NoError(t, releasing.Update(ctx, testObjectPath("path"+strconv.Itoa(i)), now.Add(-time.Hour), now))
+		require.Nil(t, releasing.buf)
+		require.Zero(t, releasing.retainedBytes)
+	}
+	require.NoError(t, releasing.verifyWrite(ctx, metastorePath(tenantID, now.Truncate(metastoreWindowSize)), testObjectPath("path0"), testObjectPath("path1")))
+	require.Equal(t, before+retaining.retainedBytes, retainedBufferBytes.Load())
+}
+
+func TestAppendStreamCapsEntries(t *testing.T) {
+	m := NewUpdater(objstore.NewInMemBucket(), tenantID, log.NewNopLogger())
+	require.NoError(t, m.initBuilder())
+
+	stream := logproto.Stream{
+		Labels:  labels.FromStrings(labelNamePath, testObjectPath("path")).String(),
+		Entries: make([]logproto.Entry, maxStreamEntries+10),
+	}
+	require.NoError(t, m.appendStream(stream))
+	require.Equal(t, float64(10), testutil.ToFloat64(m.metrics.truncatedEntries))
+
+	capped, truncated := capStreamEntries(stream)
+	require.Len(t, capped.Entries, maxStreamEntries)
+	require.Equal(t, 10, truncated)
+
+	capped, truncated = capStreamEntries(logproto.Stream{Entries: []logproto.Entry{{Line: ""}}})
+	require.Len(t, capped.Entries, 1)
+	require.Zero(t, truncated)
+}
+
+// providerBucket reports a different provider and records the readers passed to GetAndReplace.
+type providerBucket struct {
+	*objstore.InMemBucket
+	provider objstore.ObjProvider
+	readers  []io.Reader
+}
+
+func (b *providerBucket) Provider() objstore.ObjProvider { return b.provider }
+
+func (b *providerBucket) GetAndReplace(ctx context.Context, name string, f func(io.Reader) (io.Reader, error)) error {
+	return b.InMemBucket.GetAndReplace(ctx, name, func(existing io.Reader) (io.Reader, error) {
+		r, err := f(existing)
+		b.readers = append(b.readers, r)
+		return r, err
+	})
+}
+
+func TestUpdateStreamingFlush(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	window := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+
+	for _, tc := range []struct {
+		provider  objstore.ObjProvider
+		streaming bool
+	}{
+		{provider: objstore.MEMORY, streaming: true},
+		{provider: objstore.BOS, streaming: false},
+	} {
+		t.Run(string(tc.provider), func(t *testing.T) {
+			bucket := &providerBucket{InMemBucket: objstore.NewInMemBucket(), provider: tc.provider}
+			m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithStreamingFlush())
+
+			require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+			require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+			require.NoError(t, m.verifyWrite(ctx, window, testObjectPath("a"), testObjectPath("b")))
+
+			for _, r := range bucket.readers {
+				_, buffered := r.(*bytes.Buffer)
+				require.Equal(t, !tc.streaming, buffered)
+			}
+		})
+	}
+}
+
+func TestUpdaterActiveBuilders(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+
+	before := activeBuilders.Load()
+	m := NewUpdater(objstore.NewInMemBucket(), tenantID, log.NewNopLogger())
+	require.Equal(t, before, activeBuilders.Load(), "builders are only initialized on the first update")
+
+	require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+	require.Equal(t, before+1, activeBuilders.Load())
+
+	require.NoError(t, m.Close())
+	require.NoError(t, m.Close())
+	require.Equal(t, before, activeBuilders.Load())
+
+	// Updating again initializes a new builder.
+	require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+	require.Equal(t, before+1, activeBuilders.Load())
+	require.NoError(t, m.Close())
+}
+
+func TestUpdaterClose(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	path := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+
+	before := retainedBufferBytes.Load()
+	bucket := objstore.NewInMemBucket()
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithBufferedUpdates(10, 0))
+	require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+	require.Empty(t, bucket.Objects())
+
+	// Close writes buffered updates and releases the builder and buffer.
+	require.NoError(t, m.Close())
+	require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("a")))
+	require.Nil(t, m.metastoreBuilder)
+	require.Nil(t, m.buf)
+	require.Equal(t, before, retainedBufferBytes.Load())
+
+	require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+	require.NoError(t, m.Close())
+	require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("a"), testObjectPath("b")))
+	require.Equal(t, before, retainedBufferBytes.Load())
+}
+
+func TestUpdateValidatesExistingSchema(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	path := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+
+	// Write an object with one valid record and one without an end timestamp, as an older schema would.
+	builder, err := logsobj.NewBuilder(metastoreBuilderCfg)
+	require.NoError(t, err)
+	for _, lbs := range []string{
+		`{__start__="1", __end__="2", __path__="` + testObjectPath("valid") + `"}`,
+		`{__start__="1", __path__="` + testObjectPath("invalid") + `"}`,
+	} {
+		require.NoError(t, builder.Append(logproto.Stream{Labels: lbs, Entries: []logproto.Entry{{Line: ""}}}))
+	}
+	var existing bytes.Buffer
+	_, err = builder.Flush(&existing)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name        string
+		opts        []UpdaterOption
+		keepInvalid bool
+	}{
+		{name: "carry forward", keepInvalid: true},
+		{name: "drop", opts: []UpdaterOption{WithDropInvalidRecords()}, keepInvalid: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			bucket := objstore.NewInMemBucket()
+			require.NoError(t, bucket.Upload(ctx, path, bytes.NewReader(existing.Bytes())))
+
+			m := NewUpdater(bucket, tenantID, log.NewNopLogger(), tc.opts...)
+			require.NoError(t, m.Update(ctx, testObjectPath("new"), now.Add(-time.Hour), now))
+
+			require.Equal(t, float64(1), testutil.ToFloat64(m.metrics.invalidRecords))
+			require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("valid"), testObjectPath("new")))
+			if tc.keepInvalid {
+				require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("invalid")))
+			} else {
+				require.Error(t, m.verifyWrite(ctx, path, testObjectPath("invalid")))
+			}
+		})
+	}
+}
+
+func TestUpdateValidatesExistingLabels(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	path := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+
+	// The logs builder rejects invalid labels, so write the streams section directly as a corrupt object would.
+	streamsBuilder := streams.NewBuilder(streams.NewMetrics(), int(metastoreBuilderCfg.TargetPageSize))
+	for _, path := range []string{testObjectPath("valid"), testObjectPath("invalid") + "\xff"} {
+		streamsBuilder.Record(labels.FromStrings(labelNameStart, "1", labelNameEnd, "2", labelNamePath, path), now, 0)
+	}
+	builder := dataobj.NewBuilder()
+	require.NoError(t, builder.Append(streamsBuilder))
+	var existing bytes.Buffer
+	_, err := builder.Flush(&existing)
+	require.NoError(t, err)
+
+	bucket := objstore.NewInMemBucket()
+	require.NoError(t, bucket.Upload(ctx, path, bytes.NewReader(existing.Bytes())))
+
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithLabelValidation())
+	require.NoError(t, m.Update(ctx, testObjectPath("new"), now.Add(-time.Hour), now))
+
+	require.Equal(t, float64(1), testutil.ToFloat64(m.metrics.invalidLabels))
+	require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("valid"), testObjectPath("new")))
+	require.Error(t, m.verifyWrite(ctx, path, testObjectPath("invalid")+"\xff"))
+}
+
+func TestValidateLabels(t *testing.T) {
+	require.NoError(t, validateLabels(labels.FromStrings(labelNamePath, testObjectPath("path"))))
+	require.Error(t, validateLabels(labels.FromStrings("", "value")))
+	require.Error(t, validateLabels(labels.FromStrings("name\xff", "value")))
+	require.Error(t, validateLabels(labels.FromStrings(labelNamePath, "\xff")))
+}
+
+func TestValidateSchema(t *testing.T) {
+	for _, tc := range []struct {
+		labels string
+		valid  bool
+	}{
+		{labels: `{__start__="1", __end__="2", __path__="path"}`, valid: true},
+		{labels: `{__start__="1", __path__="path"}`},
+		{labels: `{__start__="1", __end__="yesterday", __path__="path"}`},
+		{labels: `{__start__="1", __end__="2"}`},
+		{labels: `{__begin__="1", __end__="2", __path__="path"}`},
+	} {
+		t.Run(tc.labels, func(t *testing.T) {
+			lbs, err := syntax.ParseLabels(tc.labels)
+			require.NoError(t, err)
+			if tc.valid {
+				require.NoError(t, validateSchema(lbs))
+			} else {
+				require.Error(t, validateSchema(lbs))
+			}
+		})
+	}
+}
+
 func TestIter(t *testing.T) {
 	tenantID := "TEST"
 	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
@@ -175,7 +597,7 @@ func TestIter(t *testing.T) {
 		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
-			iter := iterStorePaths(tenantID, tc.start, tc.end)
+			iter := iterStorePaths(FlatPathLayout, tenantID, tc.start, tc.end, metastoreWindowSize)
 			actual := []string{}
 			for store := range iter {
 				actual = append(actual, store)
@@ -209,32 +631,32 @@ func TestDataObjectsPaths(t *testing.T) {
 		endTime   time.Time
 	}{
 		{
-			path:      "path1",
+			path:      testObjectPath("path1"),
 			startTime: now.Add(-1 * time.Hour),
 			endTime:   now,
 		},
 		{
-			path:      "path2",
+			path:      testObjectPath("path2"),
 			startTime: now.Add(-30 * time.Minute),
 			endTime:   now,
 		},
 		{
-			path:      "path3",
+			path:      testObjectPath("path3"),
 			startTime: now.Add(-13 * time.Hour), // Previous 12h window
 			endTime:   now.Add(-12 * time.Hour),
 		},
 		{
-			path:      "path4",
+			path:      testObjectPath("path4"),
 			startTime: now.Add(-14 * time.Hour), // Previous 12h window
 			endTime:   now.Add(-13 * time.Hour),
 		},
 		{
-			path:      "path5",
+			path:      testObjectPath("path5"),
 			startTime: now.Add(-25 * time.Hour), // Two windows back
 			endTime:   now.Add(-24 * time.Hour),
 		},
 		{
-			path:      "path6",
+			path:      testObjectPath("path6"),
 			startTime: now.Add(-36 * time.Hour), // Three windows back
 			endTime:   now.Add(-35 * time.Hour),
 		},
@@ -251,41 +673,41 @@ func TestDataObjectsPaths(t *testing.T) {
 		paths, err := ms.DataObjects(ctx, now.Add(-1*time.Hour), now)
 		require.NoError(t, err)
 		require.Len(t, paths, 2)
-		require.Contains(t, paths, "path1")
-		require.Contains(t, paths, "path2")
+		require.Contains(t, paths, testObjectPath("path1"))
+		require.Contains(t, paths, testObjectPath("path2"))
 	})
 
 	t.Run("finds objects across two 12h windows", func(t *testing.T) {
 		paths, err := ms.DataObjects(ctx, now.Add(-14*time.Hour), now)
 		require.NoError(t, err)
 		require.Len(t, paths, 4)
-		require.Contains(t, paths, "path1")
-		require.Contains(t, paths, "path2")
-		require.Contains(t, paths, "path3")
-		require.Contains(t, paths, "path4")
+		require.Contains(t, paths, testObjectPath("path1"))
+		require.Contains(t, paths, testObjectPath("path2"))
+		require.Contains(t, paths, testObjectPath("path3"))
+		require.Contains(t, paths, testObjectPath("path4"))
 	})
 
 	t.Run("finds objects across three 12h windows", func(t *testing.T) {
 		paths, err := ms.DataObjects(ctx, now.Add(-25*time.Hour), now)
 		require.NoError(t, err)
 		require.Len(t, paths, 5)
-		require.Contains(t, paths, "path1")
-		require.Contains(t, paths, "path2")
-		require.Contains(t, paths, "path3")
-		require.Contains(t, paths, "path4")
-		require.Contains(t, paths, "path5")
+		require.Contains(t, paths, testObjectPath("path1"))
+		require.Contains(t, paths, testObjectPath("path2"))
+		require.Contains(t, paths, testObjectPath("path3"))
+		require.Contains(t, paths, testObjectPath("path4"))
+		require.Contains(t, paths, testObjectPath("path5"))
 	})
 
 	t.Run("finds all objects across all windows", func(t *testing.T) {
 		paths, err := ms.DataObjects(ctx, now.Add(-36*time.Hour), now)
 		require.NoError(t, err)
 		require.Len(t, paths, 6)
-		require.Contains(t, paths, "path1")
-		require.Contains(t, paths, "path2")
-		require.Contains(t, paths, "path3")
-		require.Contains(t, paths, "path4")
-		require.Contains(t, paths, "path5")
-		require.Contains(t, paths, "path6")
+		require.Contains(t, paths, testObjectPath("path1"))
+		require.Contains(t, paths, testObjectPath("path2"))
+		require.Contains(t, paths, testObjectPath("path3"))
+		require.Contains(t, paths, testObjectPath("path4"))
+		require.Contains(t, paths, testObjectPath("path5"))
+		require.Contains(t, paths, testObjectPath("path6"))
 	})
 
 	t.Run("returns empty list when no objects in range", func(t *testing.T) {
@@ -299,11 +721,11 @@ func TestDataObjectsPaths(t *testing.T) {
 		paths, err := ms.DataObjects(ctx, now.Add(-30*time.Hour), now)
 		require.NoError(t, err)
 		require.Len(t, paths, 5) // Should exclude path6 which is before -30h
-		require.Contains(t, paths, "path1")
-		require.Contains(t, paths, "path2")
-		require.Contains(t, paths, "path3")
-		require.Contains(t, paths, "path4")
-		require.Contains(t, paths, "path5")
+		require.Contains(t, paths, testObjectPath("path1"))
+		require.Contains(t, paths, testObjectPath("path2"))
+		require.Contains(t, paths, testObjectPath("path3"))
+		require.Contains(t, paths, testObjectPath("path4"))
+		require.Contains(t, paths, testObjectPath("path5"))
 	})
 }
 
@@ -421,3 +843,149 @@ func TestObjectOverlapsRange(t *testing.T) {
 		})
 	}
 }
+
+// waitingBucket waits before every GetAndReplace, like a store serializing concurrent writers.
+type waitingBucket struct {
+	*objstore.InMemBucket
+	wait time.Duration
+}
+
+func (b *waitingBucket) GetAndReplace(ctx context.Context, name string, f func(io.Reader) (io.Reader, error)) error {
+	time.Sleep(b.wait)
+	return b.InMemBucket.GetAndReplace(ctx, name, f)
+}
+
+func TestUpdateObservesGetAndReplace(t *testing.T) {
+	bucket := &waitingBucket{InMemBucket: objstore.NewInMemBucket(), wait: 20 * time.Millisecond}
+	// Encoding is slow, but happens in the callback and isn't attributed to the store.
+	slowEncode := func(r io.Reader) (io.Reader, error) {
+		time.Sleep(200 * time.Millisecond)
+		return r, nil
+	}
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithTransforms(nil, slowEncode))
+
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	require.NoError(t, m.Update(context.Background(), testObjectPath("a"), now, now))
+
+	metric := &dto.Metric{}
+	require.NoError(t, m.metrics.getAndReplaceTime.Write(metric))
+	require.Equal(t, uint64(1), metric.GetHistogram().GetSampleCount())
+	require.GreaterOrEqual(t, metric.GetHistogram().GetSampleSum(), bucket.wait.Seconds())
+	require.Less(t, metric.GetHistogram().GetSampleSum(), 0.2)
+}
+
+func TestUpdateObservesSectionsPerObject(t *testing.T) {
+	m := NewUpdater(objstore.NewInMemBucket(), tenantID, log.NewNopLogger())
+
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, m.Update(context.Background(), testObjectPath(name), now, now))
+	}
+
+	// Only updates of existing objects replay sections.
+	metric := &dto.Metric{}
+	require.NoError(t, m.metrics.sectionsPerObject.Write(metric))
+	require.Equal(t, uint64(2), metric.GetHistogram().GetSampleCount())
+	require.Equal(t, float64(2), metric.GetHistogram().GetSampleSum())
+}
+
+func TestUpdateCountsOperations(t *testing.T) {
+	m := NewUpdater(objstore.NewInMemBucket(), tenantID, log.NewNopLogger())
+
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, m.Update(context.Background(), testObjectPath(name), now, now))
+	}
+	// The next window gets a new object.
+	require.NoError(t, m.Update(context.Background(), testObjectPath("d"), now.Add(metastoreWindowSize), now.Add(metastoreWindowSize)))
+
+	require.Equal(t, float64(2), testutil.ToFloat64(m.metrics.operations.WithLabelValues(string(operationCreate))))
+	require.Equal(t, float64(2), testutil.ToFloat64(m.metrics.operations.WithLabelValues(string(operationUpdate))))
+}
+
+// recordingBucket records the object store operations made through it.
+type recordingBucket struct {
+	objstore.Bucket
+	name string
+	ops  *[]string
+}
+
+func (b recordingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	*b.ops = append(*b.ops, b.name+" get")
+	return b.Bucket.Get(ctx, name)
+}
+
+func (b recordingBucket) GetAndReplace(ctx context.Context, name string, f func(io.Reader) (io.Reader, error)) error {
+	*b.ops = append(*b.ops, b.name+" get_and_replace")
+	return b.Bucket.GetAndReplace(ctx, name, f)
+}
+
+func TestUpdateWithBucketMiddleware(t *testing.T) {
+	var ops []string
+	record := func(name string) BucketMiddleware {
+		return func(bucket objstore.Bucket) objstore.Bucket {
+			return recordingBucket{Bucket: bucket, name: name, ops: &ops}
+		}
+	}
+
+	m := NewUpdater(objstore.NewInMemBucket(), tenantID, log.NewNopLogger(),
+		WithBucketMiddleware(record("inner")),
+		WithBucketMiddleware(record("outer")),
+		WithVerifyAfterWrite(),
+	)
+
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	require.NoError(t, m.Update(context.Background(), testObjectPath("a"), now, now))
+	require.Equal(t, []string{
+		"outer get_and_replace", "inner get_and_replace",
+		"outer get", "inner get",
+	}, ops)
+}
+
+func TestUpdateBatch(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	first, _ := WindowFor(now)
+	second := first.Add(metastoreWindowSize)
+
+	var ops []string
+	bucket := objstore.NewInMemBucket()
+	m := NewUpdater(recordingBucket{Bucket: bucket, name: "bucket", ops: &ops}, tenantID, log.NewNopLogger())
+	require.NoError(t, m.Update(ctx, testObjectPath("existing"), now, now))
+	ops = nil
+
+	require.NoError(t, m.UpdateBatch(ctx, []PathEntry{
+		{Path: testObjectPath("a"), MinTimestamp: now, MaxTimestamp: now},
+		{Path: testObjectPath("b"), MinTimestamp: now, MaxTimestamp: now.Add(metastoreWindowSize)},
+		{Path: testObjectPath("c"), MinTimestamp: now.Add(metastoreWindowSize), MaxTimestamp: now.Add(metastoreWindowSize)},
+	}))
+
+	// Each window is written once, with all of its entries.
+	require.Equal(t, []string{"bucket get_and_replace", "bucket get_and_replace"}, ops)
+	require.NoError(t, m.verifyWrite(ctx, metastorePath(tenantID, first), testObjectPath("existing"), testObjectPath("a"), testObjectPath("b")))
+	require.NoError(t, m.verifyWrite(ctx, metastorePath(tenantID, second), testObjectPath("b"), testObjectPath("c")))
+
+	// The replay and encoding timers fire once per window written; only the first window existed.
+	metric := &dto.Metric{}
+	require.NoError(t, m.metrics.metastoreReplayTime.Write(metric))
+	require.Equal(t, uint64(1), metric.GetHistogram().GetSampleCount())
+	metric = &dto.Metric{}
+	require.NoError(t, m.metrics.metastoreEncodingTime.Write(metric))
+	require.Equal(t, uint64(3), metric.GetHistogram().GetSampleCount())
+
+	t.Run("invalid entries fail the batch", func(t *testing.T) {
+		ops = nil
+		err := m.UpdateBatch(ctx, []PathEntry{
+			{Path: testObjectPath("d"), MinTimestamp: now, MaxTimestamp: now},
+			{Path: "../other/objects/e", MinTimestamp: now, MaxTimestamp: now},
+		})
+		require.Error(t, err)
+		require.Empty(t, ops)
+	})
+
+	t.Run("empty batch", func(t *testing.T) {
+		ops = nil
+		require.NoError(t, m.UpdateBatch(ctx, nil))
+		require.Empty(t, ops)
+	})
+}
@@ -1,9 +1,12 @@
 package metastore
 
 import (
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
 )
 
 type status string
@@ -11,13 +14,54 @@ type status string
 const (
 	statusSuccess status = "success"
 	statusFailure status = "failure"
+
+	upgradeStatusUpgraded status = "upgraded"
+	upgradeStatusSkipped  status = "skipped"
+)
+
+type operation string
+
+const (
+	operationCreate operation = "create"
+	operationUpdate operation = "update"
+	operationRemove operation = "remove"
 )
 
+// retainedBufferBytes is the total capacity of the buffers retained by all updaters between updates.
+var retainedBufferBytes atomic.Int64
+
+// activeBuilders is the number of updaters holding an initialized builder.
+var activeBuilders atomic.Int64
+
 type metastoreMetrics struct {
 	metastoreProcessingTime prometheus.Histogram
 	metastoreReplayTime     prometheus.Histogram
 	metastoreEncodingTime   prometheus.Histogram
+	getAndReplaceTime       prometheus.Histogram
+	getAndReplaceCallback   prometheus.Histogram
+	speculativeEncodes      *prometheus.CounterVec
 	metastoreWriteFailures  *prometheus.CounterVec
+	verificationFailures    prometheus.Counter
+	invalidRecords          prometheus.Counter
+	invalidLabels           prometheus.Counter
+	manifestUpdateFailures  prometheus.Counter
+	journalFailures         prometheus.Counter
+	truncatedEntries        prometheus.Counter
+	bytesRead               prometheus.Counter
+	bytesWritten            prometheus.Counter
+	backoffCap              prometheus.Histogram
+	upgrades                *prometheus.CounterVec
+	operations              *prometheus.CounterVec
+	batchEntries            prometheus.Histogram
+	sectionsPerObject       prometheus.Histogram
+	retainedBufferBytes     prometheus.GaugeFunc
+	activeBuilders          prometheus.GaugeFunc
+	targetSectionSize       prometheus.Gauge
+	windowSize              prometheus.Gauge
+	stagedWrites            prometheus.Counter
+	windowLimitReached      prometheus.Counter
+	writeRateLimited        prometheus.Counter
+	compressionRatio        prometheus.Histogram
 }
 
 func newMetastoreMetrics() *metastoreMetrics {
@@ -38,6 +82,26 @@ func newMetastoreMetrics() *metastoreMetrics {
 			NativeHistogramMaxBucketNumber:  100,
 			NativeHistogramMinResetDuration: 0,
 		}),
+		getAndReplaceTime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:                            "loki_metastore_getandreplace_duration_seconds",
+			Help:                            "Time spent in the object store's GetAndReplace of metastore objects in seconds, excluding replaying and encoding",
+			Buckets:                         prometheus.DefBuckets,
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  100,
+			NativeHistogramMinResetDuration: 0,
+		}),
+		getAndReplaceCallback: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:                            "loki_metastore_getandreplace_callback_duration_seconds",
+			Help:                            "Time spent in the callback of the object store's GetAndReplace of metastore objects in seconds, i.e. replaying and encoding",
+			Buckets:                         prometheus.DefBuckets,
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  100,
+			NativeHistogramMinResetDuration: 0,
+		}),
+		speculativeEncodes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "loki_dataobj_consumer_metastore_speculative_encodes_total",
+			Help: "Total number of metastore objects encoded before GetAndReplace, by whether the object was unchanged when it was written",
+		}, []string{"result"}),
 		metastoreProcessingTime: prometheus.NewHistogram(prometheus.HistogramOpts{
 			Name:                            "loki_dataobj_consumer_metastore_processing_seconds",
 			Help:                            "Total time taken to update all metastores for a flushed dataobj in seconds",
@@ -50,39 +114,229 @@ func newMetastoreMetrics() *metastoreMetrics {
 			Name: "loki_dataobj_consumer_metastore_writes_total",
 			Help: "Total number of metastore writes",
 		}, []string{"status"}),
+		verificationFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "loki_dataobj_consumer_metastore_verification_failures_total",
+			Help: "Total number of metastore writes which could not be verified by reading them back",
+		}),
+		invalidRecords: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "loki_dataobj_consumer_metastore_invalid_records_total",
+			Help: "Total number of records of existing metastore objects which failed schema validation when replayed",
+		}),
+		invalidLabels: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "loki_dataobj_consumer_metastore_invalid_labels_total",
+			Help: "Total number of records with invalid labels skipped while replaying existing metastore objects",
+		}),
+		manifestUpdateFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "loki_dataobj_consumer_metastore_manifest_update_failures_total",
+			Help: "Total number of metastore windows which were written but could not be added to the tenant manifest",
+		}),
+		journalFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "loki_dataobj_consumer_metastore_journal_failures_total",
+			Help: "Total number of writes of metastore objects whose mutations could not be recorded in the journal",
+		}),
+		truncatedEntries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "loki_dataobj_consumer_metastore_truncated_entries_total",
+			Help: "Total number of entries dropped from metastore streams exceeding the per-stream entry limit",
+		}),
+		bytesRead: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "loki_metastore_bytes_read_total",
+			Help: "Total number of bytes of metastore objects read from object storage",
+		}),
+		bytesWritten: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "loki_metastore_bytes_written_total",
+			Help: "Total number of bytes of metastore objects written to object storage",
+		}),
+		upgrades: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "loki_dataobj_consumer_metastore_upgrades_total",
+			Help: "Total number of metastore objects checked for an encoding upgrade, by whether they were upgraded or already current",
+		}, []string{"status"}),
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "loki_metastore_operations_total",
+			Help: "Total number of metastore objects written on update, by whether a new object was created or an existing one updated",
+		}, []string{"op"}),
+		batchEntries: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:                            "loki_dataobj_consumer_metastore_batch_entries",
+			Help:                            "Number of flushed dataobjs coalesced into a single batch of metastore updates",
+			Buckets:                         prometheus.ExponentialBuckets(1, 2, 10),
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  100,
+			NativeHistogramMinResetDuration: 0,
+		}),
+		sectionsPerObject: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:                            "loki_metastore_sections_per_object",
+			Help:                            "Number of streams sections of existing metastore objects replayed on update; a rising number means sections need merging",
+			Buckets:                         prometheus.ExponentialBuckets(1, 2, 10),
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  100,
+			NativeHistogramMinResetDuration: 0,
+		}),
+		retainedBufferBytes: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "loki_dataobj_consumer_metastore_retained_buffer_bytes",
+			Help: "Total capacity of the buffers retained between updates across all metastore updaters in bytes",
+		}, func() float64 {
+			return float64(retainedBufferBytes.Load())
+		}),
+		activeBuilders: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "loki_metastore_active_builders",
+			Help: "Number of metastore updaters holding an initialized builder across all tenants",
+		}, func() float64 {
+			return float64(activeBuilders.Load())
+		}),
+		targetSectionSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "loki_dataobj_consumer_metastore_target_section_size_bytes",
+			Help: "Current target size of the logs sections of metastore objects in bytes, if it is adaptive",
+		}),
+		windowSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "loki_dataobj_consumer_metastore_window_size_seconds",
+			Help: "Duration of the windows metastore objects are sharded by in seconds",
+		}),
+		stagedWrites: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "loki_dataobj_consumer_metastore_staged_writes_total",
+			Help: "Total number of metastore objects written by uploading them to a staging key and renaming them onto their path",
+		}),
+		windowLimitReached: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "loki_metastore_window_limit_reached_total",
+			Help: "Total number of dataobjs rejected because they would create metastore windows beyond the limit of windows per tenant",
+		}),
+		writeRateLimited: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "loki_metastore_write_rate_limited_total",
+			Help: "Total number of metastore updates rejected because the tenant exceeded its metastore write rate",
+		}),
+		compressionRatio: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:                            "loki_dataobj_consumer_metastore_compression_ratio",
+			Help:                            "Ratio of the uncompressed to the compressed size of compressed metastore objects",
+			Buckets:                         []float64{1, 1.5, 2, 3, 4, 6, 8, 12, 16},
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  100,
+			NativeHistogramMinResetDuration: 0,
+		}),
+		backoffCap: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:                            "loki_dataobj_consumer_metastore_backoff_cap_seconds",
+			Help:                            "Backoff cap used for retries when updating a metastore window in seconds",
+			Buckets:                         prometheus.ExponentialBuckets(10, 2, 6),
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  100,
+			NativeHistogramMinResetDuration: 0,
+		}),
 	}
 
 	return metrics
 }
 
+// register registers the metrics with reg. Metrics which are already registered with the same labels,
+// e.g. by an updater for another tenant when the tenant label is aggregated, are shared with it instead.
 func (p *metastoreMetrics) register(reg prometheus.Registerer) error {
-	collectors := []prometheus.Collector{
-		p.metastoreReplayTime,
-		p.metastoreEncodingTime,
-		p.metastoreProcessingTime,
-		p.metastoreWriteFailures,
+	for _, err := range []error{
+		registerOrShare(reg, &p.metastoreReplayTime),
+		registerOrShare(reg, &p.metastoreEncodingTime),
+		registerOrShare(reg, &p.getAndReplaceTime),
+		registerOrShare(reg, &p.getAndReplaceCallback),
+		registerOrShare(reg, &p.speculativeEncodes),
+		registerOrShare(reg, &p.metastoreProcessingTime),
+		registerOrShare(reg, &p.metastoreWriteFailures),
+		registerOrShare(reg, &p.verificationFailures),
+		registerOrShare(reg, &p.invalidRecords),
+		registerOrShare(reg, &p.invalidLabels),
+		registerOrShare(reg, &p.manifestUpdateFailures),
+		registerOrShare(reg, &p.journalFailures),
+		registerOrShare(reg, &p.truncatedEntries),
+		registerOrShare(reg, &p.bytesRead),
+		registerOrShare(reg, &p.bytesWritten),
+		registerOrShare(reg, &p.backoffCap),
+		registerOrShare(reg, &p.upgrades),
+		registerOrShare(reg, &p.operations),
+		registerOrShare(reg, &p.batchEntries),
+		registerOrShare(reg, &p.sectionsPerObject),
+		registerOrShare(reg, &p.retainedBufferBytes),
+		registerOrShare(reg, &p.activeBuilders),
+		registerOrShare(reg, &p.targetSectionSize),
+		registerOrShare(reg, &p.windowSize),
+		registerOrShare(reg, &p.stagedWrites),
+		registerOrShare(reg, &p.windowLimitReached),
+		registerOrShare(reg, &p.writeRateLimited),
+		registerOrShare(reg, &p.compressionRatio),
+	} {
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	for _, collector := range collectors {
-		if err := reg.Register(collector); err != nil {
-			if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
-				return err
-			}
+// sharedCollectors counts the updaters using each collector registered by
+// registerOrShare, so it stays registered until the last of them unregisters
+// its metrics.
+var sharedCollectors = struct {
+	sync.Mutex
+	refs map[prometheus.Collector]int
+}{refs: make(map[prometheus.Collector]int)}
+
+// registerOrShare registers c with reg, replacing it with the existing collector if an equal one is already registered.
+func registerOrShare[T prometheus.Collector](reg prometheus.Registerer, c *T) error {
+	err := reg.Register(*c)
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		existing, ok := are.ExistingCollector.(T)
+		if !ok {
+			return nil
 		}
+		*c = existing
+	} else if err != nil {
+		return err
 	}
+
+	sharedCollectors.Lock()
+	defer sharedCollectors.Unlock()
+	sharedCollectors.refs[*c]++
 	return nil
 }
 
+// unregisterShared unregisters c from reg, unless other updaters still share it.
+func unregisterShared(reg prometheus.Registerer, c prometheus.Collector) {
+	sharedCollectors.Lock()
+	defer sharedCollectors.Unlock()
+	if refs := sharedCollectors.refs[c]; refs > 1 {
+		sharedCollectors.refs[c] = refs - 1
+		return
+	}
+	delete(sharedCollectors.refs, c)
+	reg.Unregister(c)
+}
+
 func (p *metastoreMetrics) unregister(reg prometheus.Registerer) {
 	collectors := []prometheus.Collector{
 		p.metastoreReplayTime,
 		p.metastoreEncodingTime,
+		p.getAndReplaceTime,
+		p.getAndReplaceCallback,
+		p.speculativeEncodes,
 		p.metastoreProcessingTime,
 		p.metastoreWriteFailures,
+		p.verificationFailures,
+		p.invalidRecords,
+		p.invalidLabels,
+		p.manifestUpdateFailures,
+		p.journalFailures,
+		p.truncatedEntries,
+		p.bytesRead,
+		p.bytesWritten,
+		p.backoffCap,
+		p.upgrades,
+		p.operations,
+		p.batchEntries,
+		p.sectionsPerObject,
+		p.retainedBufferBytes,
+		p.activeBuilders,
+		p.targetSectionSize,
+		p.windowSize,
+		p.stagedWrites,
+		p.windowLimitReached,
+		p.writeRateLimited,
+		p.compressionRatio,
 	}
 
 	for _, collector := range collectors {
-		reg.Unregister(collector)
+		unregisterShared(reg, collector)
 	}
 }
 
@@ -90,6 +344,58 @@ func (p *metastoreMetrics) incMetastoreWrites(status status) {
 	p.metastoreWriteFailures.WithLabelValues(string(status)).Inc()
 }
 
+func (p *metastoreMetrics) incVerificationFailures() {
+	p.verificationFailures.Inc()
+}
+
+func (p *metastoreMetrics) incInvalidRecords() {
+	p.invalidRecords.Inc()
+}
+
+func (p *metastoreMetrics) incInvalidLabels() {
+	p.invalidLabels.Inc()
+}
+
+func (p *metastoreMetrics) incManifestUpdateFailures() {
+	p.manifestUpdateFailures.Inc()
+}
+
+func (p *metastoreMetrics) incJournalFailures() {
+	p.journalFailures.Inc()
+}
+
+func (p *metastoreMetrics) incStagedWrites() {
+	p.stagedWrites.Inc()
+}
+
+func (p *metastoreMetrics) incWindowLimitReached() {
+	p.windowLimitReached.Inc()
+}
+
+func (p *metastoreMetrics) incWriteRateLimited() {
+	p.writeRateLimited.Inc()
+}
+
+func (p *metastoreMetrics) observeCompressionRatio(ratio float64) {
+	p.compressionRatio.Observe(ratio)
+}
+
+func (p *metastoreMetrics) addTruncatedEntries(n int) {
+	p.truncatedEntries.Add(float64(n))
+}
+
+func (p *metastoreMetrics) incUpgrades(status status) {
+	p.upgrades.WithLabelValues(string(status)).Inc()
+}
+
+func (p *metastoreMetrics) incOperations(op operation) {
+	p.operations.WithLabelValues(string(op)).Inc()
+}
+
+func (p *metastoreMetrics) observeBackoffCap(limit time.Duration) {
+	p.backoffCap.Observe(limit.Seconds())
+}
+
 func (p *metastoreMetrics) observeMetastoreReplay(recordTimestamp time.Time) {
 	if !recordTimestamp.IsZero() { // Only observe if timestamp is valid
 		p.metastoreReplayTime.Observe(time.Since(recordTimestamp).Seconds())
@@ -102,8 +408,71 @@ func (p *metastoreMetrics) observeMetastoreEncoding(recordTimestamp time.Time) {
 	}
 }
 
+// observeGetAndReplace observes the time spent in GetAndReplace outside of its callback,
+// i.e. reading the existing object, waiting for concurrent writers and writing the new one.
+func (p *metastoreMetrics) observeGetAndReplace(d time.Duration) {
+	p.getAndReplaceTime.Observe(d.Seconds())
+}
+
+// observeGetAndReplaceCallback observes the time spent in the callback of GetAndReplace,
+// during which some backends lock the object.
+func (p *metastoreMetrics) observeGetAndReplaceCallback(d time.Duration) {
+	p.getAndReplaceCallback.Observe(d.Seconds())
+}
+
+func (p *metastoreMetrics) incSpeculativeEncodes(unchanged bool) {
+	result := "changed"
+	if unchanged {
+		result = "unchanged"
+	}
+	p.speculativeEncodes.WithLabelValues(result).Inc()
+}
+
 func (p *metastoreMetrics) observeMetastoreProcessing(recordTimestamp time.Time) {
 	if !recordTimestamp.IsZero() { // Only observe if timestamp is valid
 		p.metastoreProcessingTime.Observe(time.Since(recordTimestamp).Seconds())
 	}
 }
+
+func (p *metastoreMetrics) observeBatchEntries(n int) {
+	p.batchEntries.Observe(float64(n))
+}
+
+func (p *metastoreMetrics) observeSectionsPerObject(n int) {
+	p.sectionsPerObject.Observe(float64(n))
+}
+
+type querierMetrics struct {
+	objectCacheHits   prometheus.Counter
+	objectCacheMisses prometheus.Counter
+}
+
+func newQuerierMetrics() *querierMetrics {
+	return &querierMetrics{
+		objectCacheHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "loki_metastore_querier_object_cache_hits_total",
+			Help: "Total number of metastore objects read by the querier whose decoded streams were found in the object cache",
+		}),
+		objectCacheMisses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "loki_metastore_querier_object_cache_misses_total",
+			Help: "Total number of metastore objects read by the querier which were missing from the object cache or had changed since they were cached",
+		}),
+	}
+}
+
+func (p *querierMetrics) register(reg prometheus.Registerer) error {
+	for _, err := range []error{
+		registerOrShare(reg, &p.objectCacheHits),
+		registerOrShare(reg, &p.objectCacheMisses),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *querierMetrics) unregister(reg prometheus.Registerer) {
+	reg.Unregister(p.objectCacheHits)
+	reg.Unregister(p.objectCacheMisses)
+}
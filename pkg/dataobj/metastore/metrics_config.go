@@ -0,0 +1,59 @@
+package metastore
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+
+	"github.com/grafana/dskit/flagext"
+)
+
+const (
+	// TenantLabelAll labels metastore metrics with the tenant.
+	TenantLabelAll = "all"
+	// TenantLabelAllowList labels metastore metrics with the tenant for allow-listed tenants and
+	// with [OtherTenantLabel] for all other tenants.
+	TenantLabelAllowList = "allow-list"
+	// TenantLabelNone aggregates metastore metrics across tenants.
+	TenantLabelNone = "none"
+
+	// OtherTenantLabel is the tenant label of tenants which aren't allow-listed.
+	OtherTenantLabel = "other"
+)
+
+// MetricsConfig controls the cardinality of the tenant label of metastore metrics.
+type MetricsConfig struct {
+	TenantLabel     string                 `yaml:"tenant_label"`
+	TenantAllowList flagext.StringSliceCSV `yaml:"tenant_allow_list"`
+}
+
+// RegisterFlagsWithPrefix registers flags with the given prefix.
+func (cfg *MetricsConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.StringVar(&cfg.TenantLabel, prefix+"metastore-metrics.tenant-label", TenantLabelAll, fmt.Sprintf("How metastore metrics are labelled by tenant. One of %q to label all tenants, %q to only label the tenants of the allow list and label all others as %q, or %q to aggregate metrics across tenants.", TenantLabelAll, TenantLabelAllowList, OtherTenantLabel, TenantLabelNone))
+	f.Var(&cfg.TenantAllowList, prefix+"metastore-metrics.tenant-allow-list", "Comma-separated list of tenants to label metastore metrics with when the tenant label is "+TenantLabelAllowList+".")
+}
+
+func (cfg *MetricsConfig) Validate() error {
+	switch cfg.TenantLabel {
+	case TenantLabelAll, TenantLabelAllowList, TenantLabelNone:
+		return nil
+	default:
+		return fmt.Errorf("invalid metastore metrics tenant label %q, must be one of %q, %q or %q", cfg.TenantLabel, TenantLabelAll, TenantLabelAllowList, TenantLabelNone)
+	}
+}
+
+// TenantLabelValue returns the value to label metastore metrics of tenantID with, or an empty
+// string if metrics are aggregated across tenants.
+func (cfg *MetricsConfig) TenantLabelValue(tenantID string) string {
+	switch cfg.TenantLabel {
+	case TenantLabelNone:
+		return ""
+	case TenantLabelAllowList:
+		if slices.Contains(cfg.TenantAllowList, tenantID) {
+			return tenantID
+		}
+		return OtherTenantLabel
+	default:
+		return tenantID
+	}
+}
@@ -0,0 +1,56 @@
+package metastore
+
+import (
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestMetricsConfigTenantLabelValue(t *testing.T) {
+	all := MetricsConfig{TenantLabel: TenantLabelAll}
+	require.Equal(t, "tenant-a", all.TenantLabelValue("tenant-a"))
+
+	none := MetricsConfig{TenantLabel: TenantLabelNone}
+	require.Equal(t, "", none.TenantLabelValue("tenant-a"))
+
+	allowList := MetricsConfig{TenantLabel: TenantLabelAllowList, TenantAllowList: []string{"tenant-a"}}
+	require.Equal(t, "tenant-a", allowList.TenantLabelValue("tenant-a"))
+	require.Equal(t, OtherTenantLabel, allowList.TenantLabelValue("tenant-b"))
+
+	require.NoError(t, allowList.Validate())
+	require.Error(t, (&MetricsConfig{TenantLabel: "some"}).Validate())
+}
+
+func TestUpdatersShareMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	other := prometheus.WrapRegistererWith(prometheus.Labels{"tenant": OtherTenantLabel}, reg)
+
+	var updaters []*Updater
+	for _, tenant := range []string{"tenant-a", "tenant-b"} {
+		u := NewUpdater(objstore.NewInMemBucket(), tenant, log.NewNopLogger())
+		require.NoError(t, u.RegisterMetrics(other))
+		updaters = append(updaters, u)
+	}
+
+	// Both updaters write to the registered metric rather than only the first one.
+	for _, u := range updaters {
+		u.metrics.incInvalidRecords()
+	}
+	require.Equal(t, float64(2), testutil.ToFloat64(updaters[0].metrics.invalidRecords))
+	require.Same(t, updaters[0].metrics.invalidRecords, updaters[1].metrics.invalidRecords)
+
+	// Shared metrics stay registered until the last updater unregisters them.
+	updaters[0].UnregisterMetrics(other)
+	count, err := testutil.GatherAndCount(reg, "loki_dataobj_consumer_metastore_invalid_records_total")
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	updaters[1].UnregisterMetrics(other)
+	count, err = testutil.GatherAndCount(reg, "loki_dataobj_consumer_metastore_invalid_records_total")
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
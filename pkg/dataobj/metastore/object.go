@@ -10,6 +10,7 @@ import (
 	"slices"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,36 +24,124 @@ import (
 )
 
 const (
+	// metastoreWindowSize is the default duration of the windows metastore
+	// objects are sharded by.
 	metastoreWindowSize = 12 * time.Hour
 )
 
 type ObjectMetastore struct {
 	bucket      objstore.Bucket
 	parallelism int
+	layout      PathLayout
+	windowSize  time.Duration
+	decode      Transform
+	tombstones  bool
+}
+
+// ObjectMetastoreOption configures optional behaviour of an [ObjectMetastore].
+type ObjectMetastoreOption func(*ObjectMetastore)
+
+// WithObjectMetastorePathLayout makes the [ObjectMetastore] read metastore
+// objects stored with layout instead of [FlatPathLayout]. It must match the
+// layout of the updaters writing to the bucket.
+func WithObjectMetastorePathLayout(layout PathLayout) ObjectMetastoreOption {
+	return func(m *ObjectMetastore) {
+		m.layout = layout
+	}
+}
+
+// WithObjectMetastoreDecodeTransform makes the [ObjectMetastore] apply decode
+// to every metastore object it reads. It must match the decode transform of
+// the updaters writing to the bucket, see [WithTransforms].
+func WithObjectMetastoreDecodeTransform(decode Transform) ObjectMetastoreOption {
+	return func(m *ObjectMetastore) {
+		m.decode = decode
+	}
+}
+
+// WithObjectMetastoreWindowSize makes the [ObjectMetastore] read metastore
+// objects sharded by windows of size instead of 12h. It must match the window
+// size of the updaters writing to the bucket. Invalid sizes, see
+// [ValidateWindowSize], are ignored.
+func WithObjectMetastoreWindowSize(size time.Duration) ObjectMetastoreOption {
+	return func(m *ObjectMetastore) {
+		if ValidateWindowSize(size) == nil {
+			m.windowSize = size
+		}
+	}
+}
+
+// tenantDir returns the directory holding all objects of the tenant.
+func tenantDir(tenantID string) string {
+	return tenantDirPrefix + tenantID + "/"
+}
+
+func metastoreDir(tenantID string) string {
+	return tenantDir(tenantID) + "metastore/"
 }
 
 func metastorePath(tenantID string, window time.Time) string {
-	return fmt.Sprintf("tenant-%s/metastore/%s.store", tenantID, window.Format(time.RFC3339))
+	return fmt.Sprintf("%s%s.store", metastoreDir(tenantID), window.Format(time.RFC3339))
+}
+
+// parseMetastoreWindow returns the start of the window encoded in a metastore path.
+func parseMetastoreWindow(tenantID, path string) (time.Time, error) {
+	name, ok := strings.CutPrefix(path, metastoreDir(tenantID))
+	if !ok {
+		return time.Time{}, fmt.Errorf("path %s is not a metastore of tenant %s", path, tenantID)
+	}
+	name, ok = strings.CutSuffix(name, ".store")
+	if !ok {
+		return time.Time{}, fmt.Errorf("path %s is not a metastore object", path)
+	}
+	return time.Parse(time.RFC3339, name)
 }
 
-func iterStorePaths(tenantID string, start, end time.Time) iter.Seq[string] {
-	minMetastoreWindow := start.Truncate(metastoreWindowSize).UTC()
-	maxMetastoreWindow := end.Truncate(metastoreWindowSize).UTC()
+// WindowFor returns the bounds of the metastore window containing t with the
+// default window size of 12h. Windows are aligned to UTC regardless of the
+// location of t, and t is always within [start, end).
+func WindowFor(t time.Time) (start, end time.Time) {
+	return windowFor(t, metastoreWindowSize)
+}
+
+// windowFor returns the bounds of the metastore window of windowSize containing t, like [WindowFor].
+func windowFor(t time.Time, windowSize time.Duration) (start, end time.Time) {
+	start = t.Truncate(windowSize).UTC()
+	return start, start.Add(windowSize)
+}
+
+// WindowPath returns the path of the metastore object of the tenant holding
+// the window containing t with [FlatPathLayout] and the default window size.
+func WindowPath(tenantID string, t time.Time) string {
+	start, _ := WindowFor(t)
+	return metastorePath(tenantID, start)
+}
+
+// iterStorePaths returns the paths of the metastore objects of the tenant
+// whose windows of windowSize overlap the time range from start to end.
+func iterStorePaths(layout PathLayout, tenantID string, start, end time.Time, windowSize time.Duration) iter.Seq[string] {
+	minMetastoreWindow, _ := windowFor(start, windowSize)
+	maxMetastoreWindow, _ := windowFor(end, windowSize)
 
 	return func(yield func(t string) bool) {
-		for metastoreWindow := minMetastoreWindow; !metastoreWindow.After(maxMetastoreWindow); metastoreWindow = metastoreWindow.Add(metastoreWindowSize) {
-			if !yield(metastorePath(tenantID, metastoreWindow)) {
+		for metastoreWindow := minMetastoreWindow; !metastoreWindow.After(maxMetastoreWindow); metastoreWindow = metastoreWindow.Add(windowSize) {
+			if !yield(layout.path(tenantID, metastoreWindow)) {
 				return
 			}
 		}
 	}
 }
 
-func NewObjectMetastore(bucket objstore.Bucket) *ObjectMetastore {
-	return &ObjectMetastore{
+func NewObjectMetastore(bucket objstore.Bucket, opts ...ObjectMetastoreOption) *ObjectMetastore {
+	m := &ObjectMetastore{
 		bucket:      bucket,
 		parallelism: 64,
+		windowSize:  metastoreWindowSize,
+	}
+	for _, o := range opts {
+		o(m)
 	}
+	return m
 }
 
 func (m *ObjectMetastore) Streams(ctx context.Context, start, end time.Time, matchers ...*labels.Matcher) ([]*labels.Labels, error) {
@@ -62,12 +151,12 @@ func (m *ObjectMetastore) Streams(ctx context.Context, start, end time.Time, mat
 	}
 	// Get all metastore paths for the time range
 	var storePaths []string
-	for path := range iterStorePaths(tenantID, start, end) {
+	for path := range iterStorePaths(m.layout, tenantID, start, end, m.windowSize) {
 		storePaths = append(storePaths, path)
 	}
 
 	// List objects from all stores concurrently
-	paths, err := m.listObjectsFromStores(ctx, storePaths, start, end)
+	paths, err := m.listObjectsFromStores(ctx, tenantID, storePaths, start, end)
 	if err != nil {
 		return nil, err
 	}
@@ -85,12 +174,12 @@ func (m *ObjectMetastore) StreamIDs(ctx context.Context, start, end time.Time, m
 
 	// Get all metastore paths for the time range
 	var storePaths []string
-	for path := range iterStorePaths(tenantID, start, end) {
+	for path := range iterStorePaths(m.layout, tenantID, start, end, m.windowSize) {
 		storePaths = append(storePaths, path)
 	}
 
 	// List objects from all stores concurrently
-	paths, err := m.listObjectsFromStores(ctx, storePaths, start, end)
+	paths, err := m.listObjectsFromStores(ctx, tenantID, storePaths, start, end)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -119,12 +208,12 @@ func (m *ObjectMetastore) DataObjects(ctx context.Context, start, end time.Time,
 
 	// Get all metastore paths for the time range
 	var storePaths []string
-	for path := range iterStorePaths(tenantID, start, end) {
+	for path := range iterStorePaths(m.layout, tenantID, start, end, m.windowSize) {
 		storePaths = append(storePaths, path)
 	}
 
 	// List objects from all stores concurrently
-	return m.listObjectsFromStores(ctx, storePaths, start, end)
+	return m.listObjectsFromStores(ctx, tenantID, storePaths, start, end)
 }
 
 func (m *ObjectMetastore) Labels(ctx context.Context, start, end time.Time, matchers ...*labels.Matcher) ([]string, error) {
@@ -234,14 +323,14 @@ func predicateFromMatchers(start, end time.Time, matchers ...*labels.Matcher) st
 }
 
 // listObjectsFromStores concurrently lists objects from multiple metastore files
-func (m *ObjectMetastore) listObjectsFromStores(ctx context.Context, storePaths []string, start, end time.Time) ([]string, error) {
+func (m *ObjectMetastore) listObjectsFromStores(ctx context.Context, tenantID string, storePaths []string, start, end time.Time) ([]string, error) {
 	objects := make([][]string, len(storePaths))
 	g, ctx := errgroup.WithContext(ctx)
 
 	for i, path := range storePaths {
 		g.Go(func() error {
 			var err error
-			objects[i], err = m.listObjects(ctx, path, start, end)
+			objects[i], err = m.listObjects(ctx, tenantID, path, start, end)
 			// If the metastore object is not found, it means it's outside of any existing window
 			// and we can safely ignore it.
 			if err != nil && !m.bucket.IsObjNotFoundErr(err) {
@@ -339,25 +428,36 @@ func addLabels(mtx *sync.Mutex, streams map[uint64][]*labels.Labels, newLabels *
 	streams[key] = append(streams[key], newLabels)
 }
 
-func (m *ObjectMetastore) listObjects(ctx context.Context, path string, start, end time.Time) ([]string, error) {
+func (m *ObjectMetastore) listObjects(ctx context.Context, tenantID, path string, start, end time.Time) ([]string, error) {
 	var buf bytes.Buffer
 	objectReader, err := m.bucket.Get(ctx, path)
 	if err != nil {
 		return nil, err
 	}
-	n, err := buf.ReadFrom(objectReader)
+	defer objectReader.Close()
+	decoded, err := decodeWith(m.decode, objectReader)
+	if err != nil {
+		return nil, err
+	}
+	_, err = buf.ReadFrom(decoded)
 	if err != nil {
 		return nil, fmt.Errorf("reading metastore object: %w", err)
 	}
-	object, err := dataobj.FromReaderAt(bytes.NewReader(buf.Bytes()), n)
+	object, err := openObject(&buf)
 	if err != nil {
-		return nil, fmt.Errorf("getting object from reader: %w", err)
+		return nil, err
+	}
+	var tombstoned map[string]struct{}
+	if m.tombstones {
+		if tombstoned, err = readTombstones(ctx, m.bucket, tenantID, path); err != nil {
+			return nil, err
+		}
 	}
 	var objectPaths []string
 
 	err = forEachStream(ctx, object, nil, func(stream streams.Stream) {
 		ok, objPath := objectOverlapsRange(stream.Labels, start, end)
-		if ok {
+		if _, tombstone := tombstoned[objPath]; ok && !tombstone {
 			objectPaths = append(objectPaths, objPath)
 		}
 	})
@@ -274,3 +274,69 @@ func newTestDataBuilder(t *testing.T, tenantID string) *testDataBuilder {
 		uploader: uploader,
 	}
 }
+
+func TestWindowFor(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name          string
+		t             time.Time
+		expectedStart time.Time
+	}{
+		{
+			name:          "start of window",
+			t:             time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+			expectedStart: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:          "end of window",
+			t:             time.Date(2025, 1, 1, 11, 59, 59, 999999999, time.UTC),
+			expectedStart: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:          "year boundary",
+			t:             time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC),
+			expectedStart: time.Date(2024, 12, 31, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:          "fixed offset",
+			t:             time.Date(2025, 1, 1, 1, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60)),
+			expectedStart: time.Date(2024, 12, 31, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			// 2025-03-09 02:00 EST is skipped; 03:30 EDT is 07:30 UTC.
+			name:          "daylight saving start",
+			t:             time.Date(2025, 3, 9, 3, 30, 0, 0, newYork),
+			expectedStart: time.Date(2025, 3, 9, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			// 2025-11-02 01:30 occurs twice; Go picks the first (EDT), which is 05:30 UTC.
+			name:          "daylight saving end",
+			t:             time.Date(2025, 11, 2, 1, 30, 0, 0, newYork),
+			expectedStart: time.Date(2025, 11, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			// 20:00 EST is 01:00 UTC the next day.
+			name:          "local day differs from UTC day",
+			t:             time.Date(2025, 1, 1, 20, 0, 0, 0, newYork),
+			expectedStart: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			start, end := WindowFor(tc.t)
+			require.Equal(t, tc.expectedStart, start)
+			require.Equal(t, tc.expectedStart.Add(metastoreWindowSize), end)
+			require.False(t, tc.t.Before(start))
+			require.True(t, tc.t.Before(end))
+
+			path := WindowPath(tenantID, tc.t)
+			require.Equal(t, metastorePath(tenantID, tc.expectedStart), path)
+			for storePath := range iterStorePaths(FlatPathLayout, tenantID, tc.t, tc.t, metastoreWindowSize) {
+				require.Equal(t, path, storePath)
+			}
+		})
+	}
+}
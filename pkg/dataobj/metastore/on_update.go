@@ -0,0 +1,45 @@
+package metastore
+
+import "time"
+
+// UpdateEvent describes a dataobj added to a metastore object by an [Updater].
+type UpdateEvent struct {
+	Tenant    string
+	Window    time.Time // Start of the metastore window.
+	Metastore string    // Path of the metastore object.
+
+	Path         string // Path of the added dataobj.
+	MinTimestamp time.Time
+	MaxTimestamp time.Time
+}
+
+// WithOnUpdate makes the [Updater] call onUpdate for every dataobj added to a
+// metastore object once the write succeeded, e.g. to let external catalogs
+// learn about new data objects without listing the bucket. A dataobj spanning
+// several windows is reported once per window.
+//
+// onUpdate is called synchronously from the update, so it must return
+// quickly; callbacks doing I/O should hand events off to a goroutine.
+func WithOnUpdate(onUpdate func(UpdateEvent)) UpdaterOption {
+	return func(u *Updater) {
+		u.onUpdate = onUpdate
+	}
+}
+
+// notifyUpdate calls the update callback for entries added to the metastore object at metastorePath, if set.
+func (m *Updater) notifyUpdate(metastorePath string, entries []PathEntry) {
+	if m.onUpdate == nil {
+		return
+	}
+	window, _ := m.layout.parseWindow(m.tenantID, metastorePath)
+	for _, entry := range entries {
+		m.onUpdate(UpdateEvent{
+			Tenant:       m.tenantID,
+			Window:       window,
+			Metastore:    metastorePath,
+			Path:         entry.Path,
+			MinTimestamp: entry.MinTimestamp,
+			MaxTimestamp: entry.MaxTimestamp,
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package metastore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestWithOnUpdate(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	end := start.Add(metastoreWindowSize)
+
+	var events []UpdateEvent
+	m := NewUpdater(objstore.NewInMemBucket(), tenantID, log.NewNopLogger(), WithOnUpdate(func(e UpdateEvent) {
+		events = append(events, e)
+	}))
+	require.NoError(t, m.Update(ctx, testObjectPath("a"), start, end))
+
+	var expected []UpdateEvent
+	for path := range iterStorePaths(FlatPathLayout, tenantID, start, end, metastoreWindowSize) {
+		window, err := parseMetastoreWindow(tenantID, path)
+		require.NoError(t, err)
+		expected = append(expected, UpdateEvent{
+			Tenant:       tenantID,
+			Window:       window,
+			Metastore:    path,
+			Path:         testObjectPath("a"),
+			MinTimestamp: start,
+			MaxTimestamp: end,
+		})
+	}
+	require.Len(t, expected, 2)
+	require.Equal(t, expected, events)
+}
@@ -0,0 +1,68 @@
+package metastore
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+const (
+	labelNameSize    = "__size__"
+	labelNameStreams = "__streams__"
+	labelNameEntries = "__entries__"
+)
+
+// PathStats is optional metadata about a dataobj stored in its metastore
+// records, so readers can estimate the work a dataobj represents without
+// opening it. Zero fields are unknown and aren't stored.
+type PathStats struct {
+	SizeBytes   int64 // Size of the encoded dataobj in bytes.
+	StreamCount int   // Number of streams in the dataobj.
+	EntryCount  int64 // Number of log entries in the dataobj.
+}
+
+// appendLabels appends a label for every known field of s to lbs.
+func (s PathStats) appendLabels(lbs []labels.Label) []labels.Label {
+	if s.SizeBytes > 0 {
+		lbs = append(lbs, labels.Label{Name: labelNameSize, Value: strconv.FormatInt(s.SizeBytes, 10)})
+	}
+	if s.StreamCount > 0 {
+		lbs = append(lbs, labels.Label{Name: labelNameStreams, Value: strconv.Itoa(s.StreamCount)})
+	}
+	if s.EntryCount > 0 {
+		lbs = append(lbs, labels.Label{Name: labelNameEntries, Value: strconv.FormatInt(s.EntryCount, 10)})
+	}
+	return lbs
+}
+
+// parsePathStats parses the stats of a metastore record. Records written
+// without stats, or before they were stored, have zero stats.
+func parsePathStats(lbs labels.Labels) (PathStats, error) {
+	var stats PathStats
+	for _, field := range []struct {
+		name  string
+		value *int64
+	}{
+		{labelNameSize, &stats.SizeBytes},
+		{labelNameEntries, &stats.EntryCount},
+	} {
+		value := lbs.Get(field.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			return PathStats{}, errors.Errorf("invalid %s label %q", field.name, value)
+		}
+		*field.value = parsed
+	}
+	if value := lbs.Get(labelNameStreams); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return PathStats{}, errors.Errorf("invalid %s label %q", labelNameStreams, value)
+		}
+		stats.StreamCount = parsed
+	}
+	return stats, nil
+}
@@ -0,0 +1,78 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/loki/v3/pkg/dataobj"
+	"github.com/grafana/loki/v3/pkg/dataobj/sections/streams"
+)
+
+func TestUpdateWithStats(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	window, _ := WindowFor(now)
+	stats := PathStats{SizeBytes: 1 << 20, StreamCount: 12, EntryCount: 3400}
+
+	bucket := objstore.NewInMemBucket()
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger())
+	require.NoError(t, m.UpdateWithStats(ctx, testObjectPath("a"), now, now, stats))
+	// Replaying the window to add another path keeps the stats of the first.
+	require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+	require.NoError(t, m.UpdateBatch(ctx, []PathEntry{
+		{Path: testObjectPath("c"), MinTimestamp: now, MaxTimestamp: now, Stats: PathStats{StreamCount: 1}},
+	}))
+
+	records := readRecords(t, bucket, metastorePath(tenantID, window))
+	require.Equal(t, map[string]PathStats{
+		testObjectPath("a"): stats,
+		testObjectPath("b"): {},
+		testObjectPath("c"): {StreamCount: 1},
+	}, records)
+}
+
+func TestParsePathStats(t *testing.T) {
+	stats, err := parsePathStats(labels.FromStrings(labelNameSize, "10", labelNameStreams, "2", labelNameEntries, "30"))
+	require.NoError(t, err)
+	require.Equal(t, PathStats{SizeBytes: 10, StreamCount: 2, EntryCount: 30}, stats)
+
+	stats, err = parsePathStats(labels.FromStrings(labelNamePath, "path"))
+	require.NoError(t, err)
+	require.Zero(t, stats)
+
+	_, err = parsePathStats(labels.FromStrings(labelNameSize, "big"))
+	require.Error(t, err)
+	_, err = parsePathStats(labels.FromStrings(labelNameStreams, "-1"))
+	require.Error(t, err)
+}
+
+// readRecords returns the stats of the records of the metastore object at path by their dataobj path.
+func readRecords(t *testing.T, bucket objstore.Bucket, path string) map[string]PathStats {
+	t.Helper()
+
+	reader, err := bucket.Get(context.Background(), path)
+	require.NoError(t, err)
+	defer reader.Close()
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(reader)
+	require.NoError(t, err)
+	require.NoError(t, decompressObject(&buf))
+
+	object, err := dataobj.FromReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	records := make(map[string]PathStats)
+	require.NoError(t, replayStreams(context.Background(), object, 1, func(stream streams.Stream) error {
+		record, err := parseRecord(stream.Labels)
+		require.NoError(t, err)
+		records[record.Path] = record.Stats
+		return nil
+	}))
+	return records
+}
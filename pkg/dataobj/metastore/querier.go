@@ -0,0 +1,443 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/loki/v3/pkg/dataobj"
+	"github.com/grafana/loki/v3/pkg/dataobj/sections/streams"
+)
+
+// Querier reads the metastore objects of any tenant. Unlike [ObjectMetastore],
+// which reads the tenant from the request context, it is intended for tooling
+// and maintenance tasks which inspect metastores directly.
+type Querier struct {
+	bucket  objstore.Bucket
+	logger  log.Logger
+	metrics *querierMetrics
+	layout  PathLayout
+	// windowSize is the size of the windows metastore objects are sharded by.
+	windowSize time.Duration
+	decode     Transform
+	tombstones bool
+
+	// objects caches the labels of the streams of metastore objects by path, if enabled.
+	objects *lru.Cache[string, cachedObject]
+}
+
+// QuerierOption configures optional behaviour of a [Querier].
+type QuerierOption func(*Querier)
+
+// WithObjectCache makes the [Querier] cache the decoded streams of up to size
+// metastore objects. Before reusing a cached object, its attributes are read
+// to check it hasn't changed since, which avoids downloading and decoding
+// objects read repeatedly, e.g. while a user explores the same windows. Objects
+// are read without caching if the bucket can't report their attributes. Cache
+// hits and misses are counted in metrics.
+func WithObjectCache(size int) QuerierOption {
+	return func(q *Querier) {
+		q.objects, _ = lru.New[string, cachedObject](size)
+	}
+}
+
+// WithQuerierPathLayout makes the [Querier] read metastore objects stored
+// with layout instead of [FlatPathLayout]. It must match the layout of the
+// updaters writing to the bucket.
+func WithQuerierPathLayout(layout PathLayout) QuerierOption {
+	return func(q *Querier) {
+		q.layout = layout
+	}
+}
+
+// WithQuerierDecodeTransform makes the [Querier] apply decode to every
+// metastore object it reads. It must match the decode transform of the
+// updaters writing to the bucket, see [WithTransforms].
+func WithQuerierDecodeTransform(decode Transform) QuerierOption {
+	return func(q *Querier) {
+		q.decode = decode
+	}
+}
+
+// WithQuerierWindowSize makes the [Querier] read metastore objects sharded by
+// windows of size instead of 12h. It must match the window size of the
+// updaters writing to the bucket. Invalid sizes, see [ValidateWindowSize], are
+// logged and ignored.
+func WithQuerierWindowSize(size time.Duration) QuerierOption {
+	return func(q *Querier) {
+		if err := ValidateWindowSize(size); err != nil {
+			level.Warn(q.logger).Log("msg", "ignoring invalid metastore window size", "err", err)
+			return
+		}
+		q.windowSize = size
+	}
+}
+
+// objectVersion identifies a version of an object. Buckets don't expose ETags,
+// so the size and modification time of an object stand in for it.
+type objectVersion struct {
+	size         int64
+	lastModified time.Time
+}
+
+func (v objectVersion) equal(o objectVersion) bool {
+	return v.size == o.size && v.lastModified.Equal(o.lastModified)
+}
+
+type cachedObject struct {
+	version objectVersion
+	streams []labels.Labels
+}
+
+func NewQuerier(bucket objstore.Bucket, logger log.Logger, opts ...QuerierOption) *Querier {
+	q := &Querier{
+		bucket:     bucket,
+		logger:     logger,
+		metrics:    newQuerierMetrics(),
+		windowSize: metastoreWindowSize,
+	}
+	for _, o := range opts {
+		o(q)
+	}
+	return q
+}
+
+func (q *Querier) RegisterMetrics(reg prometheus.Registerer) error {
+	return q.metrics.register(reg)
+}
+
+func (q *Querier) UnregisterMetrics(reg prometheus.Registerer) {
+	q.metrics.unregister(reg)
+}
+
+// DataObjPathsPage returns up to limit dataobj paths of the metastore window
+// containing window, skipping the first offset ones. Paths are returned in the
+// order they are stored in. hasMore reports whether there are paths after the
+// returned page. Tombstoned paths, see [WithQuerierTombstones], are skipped.
+// Reading stops as soon as the page is complete, so previewing a large window
+// doesn't require decoding all of it.
+func (q *Querier) DataObjPathsPage(ctx context.Context, tenantID string, window time.Time, offset, limit int) (paths []string, hasMore bool, err error) {
+	if offset < 0 || limit < 0 {
+		return nil, false, fmt.Errorf("invalid page: offset %d and limit %d must not be negative", offset, limit)
+	}
+
+	path := q.layout.path(tenantID, window.Truncate(q.windowSize).UTC())
+	tombstoned, err := q.readTombstones(ctx, tenantID, path)
+	if err != nil {
+		return nil, false, err
+	}
+	if q.objects != nil {
+		streams, err := q.readStreams(ctx, path)
+		if q.bucket.IsObjNotFoundErr(err) {
+			return nil, false, nil
+		} else if err != nil {
+			return nil, false, err
+		}
+		if len(tombstoned) > 0 {
+			streams = slices.DeleteFunc(slices.Clone(streams), func(lbs labels.Labels) bool {
+				_, ok := tombstoned[lbs.Get(labelNamePath)]
+				return ok
+			})
+		}
+		if offset >= len(streams) {
+			return nil, false, nil
+		}
+		page := streams[offset:min(offset+limit, len(streams))]
+		for _, lbs := range page {
+			paths = append(paths, lbs.Get(labelNamePath))
+		}
+		return paths, offset+limit < len(streams), nil
+	}
+
+	object, err := q.readObject(ctx, path)
+	if q.bucket.IsObjNotFoundErr(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	var n int
+	err = replayStreams(ctx, object, 1, func(stream streams.Stream) error {
+		if _, ok := tombstoned[stream.Labels.Get(labelNamePath)]; ok {
+			return nil
+		}
+		switch {
+		case n >= offset+limit:
+			hasMore = true
+			return errStopIter
+		case n >= offset:
+			paths = append(paths, stream.Labels.Get(labelNamePath))
+		}
+		n++
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopIter) {
+		return nil, false, err
+	}
+	return paths, hasMore, nil
+}
+
+// Paths returns the dataobj paths of the tenant whose time range overlaps the
+// range from start to end, inclusive, read from the metastore windows
+// covering the range. Paths are deduplicated across windows and sorted by the
+// start of their time range, then by path. Records which can't be parsed are
+// logged and skipped.
+func (q *Querier) Paths(ctx context.Context, tenantID string, start, end time.Time) ([]string, error) {
+	records, err := q.overlappingRecords(ctx, tenantID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := slices.Collect(maps.Keys(records))
+	slices.SortFunc(paths, func(a, b string) int {
+		if c := records[a].MinTimestamp.Compare(records[b].MinTimestamp); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	return paths, nil
+}
+
+// ReferencedBytes returns the total size of the dataobjs of the tenant whose
+// time range overlaps the range from start to end, inclusive, as stored in
+// their metastore records. Every dataobj is counted once, even if it spans
+// several windows. Dataobjs added without a size, see [PathStats], count as
+// zero bytes, so the result is a lower bound of the referenced storage.
+func (q *Querier) ReferencedBytes(ctx context.Context, tenantID string, start, end time.Time) (int64, error) {
+	records, err := q.overlappingRecords(ctx, tenantID, start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, record := range records {
+		total += record.Stats.SizeBytes
+	}
+	return total, nil
+}
+
+// overlappingRecords returns the records of the tenant overlapping the range
+// from start to end, inclusive, by dataobj path. For paths in several windows,
+// the record with the earliest start is returned. Tombstoned paths, see
+// [WithQuerierTombstones], are left out. Records which can't be parsed are
+// logged and skipped.
+func (q *Querier) overlappingRecords(ctx context.Context, tenantID string, start, end time.Time) (map[string]PathEntry, error) {
+	records := make(map[string]PathEntry)
+	for path := range iterStorePaths(q.layout, tenantID, start, end, q.windowSize) {
+		tombstoned, err := q.readTombstones(ctx, tenantID, path)
+		if err != nil {
+			return nil, err
+		}
+		err = q.forEachRecord(ctx, path, func(lbs labels.Labels) {
+			if _, ok := tombstoned[lbs.Get(labelNamePath)]; ok {
+				return
+			}
+			record, err := parseRecord(lbs)
+			if err != nil {
+				level.Warn(q.logger).Log("msg", "skipping malformed metastore record", "metastore", path, "labels", lbs.String(), "err", err)
+				return
+			}
+			if record.MaxTimestamp.Before(start) || record.MinTimestamp.After(end) {
+				return
+			}
+			if existing, ok := records[record.Path]; !ok || record.MinTimestamp.Before(existing.MinTimestamp) {
+				records[record.Path] = record
+			}
+		})
+		if q.bucket.IsObjNotFoundErr(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("reading metastore object %s: %w", path, err)
+		}
+	}
+	return records, nil
+}
+
+// forEachRecord calls f with the labels of every record of the metastore
+// object at path, from the object cache if enabled.
+func (q *Querier) forEachRecord(ctx context.Context, path string, f func(labels.Labels)) error {
+	if q.objects != nil {
+		streams, err := q.readStreams(ctx, path)
+		if err != nil {
+			return err
+		}
+		for _, lbs := range streams {
+			f(lbs)
+		}
+		return nil
+	}
+
+	object, err := q.readObject(ctx, path)
+	if err != nil {
+		return err
+	}
+	return replayStreams(ctx, object, 1, func(stream streams.Stream) error {
+		f(stream.Labels)
+		return nil
+	})
+}
+
+// parseRecord parses the dataobj path, time range and stats of a metastore record.
+func parseRecord(lbs labels.Labels) (PathEntry, error) {
+	if err := validateSchema(lbs); err != nil {
+		return PathEntry{}, err
+	}
+	// validateSchema checked the timestamps can be parsed.
+	start, _ := strconv.ParseInt(lbs.Get(labelNameStart), 10, 64)
+	end, _ := strconv.ParseInt(lbs.Get(labelNameEnd), 10, 64)
+	stats, err := parsePathStats(lbs)
+	if err != nil {
+		return PathEntry{}, err
+	}
+	return PathEntry{
+		Path:         lbs.Get(labelNamePath),
+		MinTimestamp: time.Unix(0, start).UTC(),
+		MaxTimestamp: time.Unix(0, end).UTC(),
+		Stats:        stats,
+	}, nil
+}
+
+// LabelNames returns the distinct label names of the records of the
+// metastore window containing window, sorted. Besides the path, start and end
+// of every record, these include any labels added by richer encodings. Names
+// are read from the metadata of the streams sections, which lists the label
+// names of each section, so no records are decoded.
+func (q *Querier) LabelNames(ctx context.Context, tenantID string, window time.Time) ([]string, error) {
+	path := q.layout.path(tenantID, window.Truncate(q.windowSize).UTC())
+	object, err := q.readObject(ctx, path)
+	if q.bucket.IsObjNotFoundErr(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return objectLabelNames(ctx, object)
+}
+
+// objectLabelNames returns the distinct label names of the records of object,
+// sorted, read from the metadata of its streams sections.
+func objectLabelNames(ctx context.Context, object *dataobj.Object) ([]string, error) {
+	var names []string
+	for _, section := range object.Sections() {
+		if !streams.CheckSection(section) {
+			continue
+		}
+		sec, err := streams.Open(ctx, section)
+		if err != nil {
+			return nil, fmt.Errorf("opening section: %w", err)
+		}
+		sectionNames, err := streams.LabelNames(ctx, sec)
+		if err != nil {
+			return nil, fmt.Errorf("reading label names: %w", err)
+		}
+		for _, name := range sectionNames {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// Windows returns the start of every metastore window of the tenant, in
+// order. Windows are read from the tenant's [Manifest] if there is one, and
+// found by listing the bucket otherwise.
+func (q *Querier) Windows(ctx context.Context, tenantID string) ([]time.Time, error) {
+	manifest, err := readManifest(ctx, q.bucket, tenantID)
+	if err == nil {
+		windows := make([]time.Time, 0, len(manifest.Windows))
+		for _, w := range manifest.Windows {
+			windows = append(windows, w.Start)
+		}
+		return windows, nil
+	} else if !q.bucket.IsObjNotFoundErr(err) {
+		return nil, err
+	}
+
+	var windows []time.Time
+	err = q.layout.iter(ctx, q.bucket, tenantID, func(path string) error {
+		window, err := q.layout.parseWindow(tenantID, path)
+		if err != nil {
+			level.Warn(q.logger).Log("msg", "skipping unexpected object in metastore directory", "path", path, "err", err)
+			return nil
+		}
+		windows = append(windows, window)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing metastore objects: %w", err)
+	}
+	slices.SortFunc(windows, time.Time.Compare)
+	return windows, nil
+}
+
+// readStreams returns the labels of all streams of the metastore object at
+// path, from the object cache if the object hasn't changed since it was cached.
+func (q *Querier) readStreams(ctx context.Context, path string) ([]labels.Labels, error) {
+	var (
+		version      objectVersion
+		versionKnown bool
+	)
+	if attrs, err := q.bucket.Attributes(ctx, path); err == nil {
+		version = objectVersion{size: attrs.Size, lastModified: attrs.LastModified}
+		versionKnown = true
+		if cached, ok := q.objects.Get(path); ok && cached.version.equal(version) {
+			q.metrics.objectCacheHits.Inc()
+			return cached.streams, nil
+		}
+	}
+	q.metrics.objectCacheMisses.Inc()
+
+	object, err := q.readObject(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	var result []labels.Labels
+	err = replayStreams(ctx, object, 1, func(stream streams.Stream) error {
+		result = append(result, stream.Labels.Copy())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A concurrent update may have changed the object since its attributes were
+	// read, in which case the next read sees a newer version and reads it again.
+	if versionKnown {
+		q.objects.Add(path, cachedObject{version: version, streams: result})
+	}
+	return result, nil
+}
+
+// readObject reads the metastore object at path into memory.
+func (q *Querier) readObject(ctx context.Context, path string) (*dataobj.Object, error) {
+	reader, err := q.bucket.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	decoded, err := decodeWith(q.decode, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(decoded); err != nil {
+		return nil, fmt.Errorf("reading metastore object: %w", err)
+	}
+	return openObject(&buf)
+}
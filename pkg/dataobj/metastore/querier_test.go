@@ -0,0 +1,227 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/loki/v3/pkg/dataobj/consumer/logsobj"
+	"github.com/grafana/loki/v3/pkg/logproto"
+)
+
+func TestQuerierDataObjPathsPage(t *testing.T) {
+	ctx := context.Background()
+	bucket := objstore.NewInMemBucket()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger())
+	var all []string
+	for i := 0; i < 5; i++ {
+		path := testObjectPath(fmt.Sprintf("object-%d", i))
+		require.NoError(t, m.Update(ctx, path, now, now))
+		all = append(all, path)
+	}
+
+	q := NewQuerier(bucket, log.NewNopLogger())
+	for _, tc := range []struct {
+		offset, limit int
+		expected      []string
+		hasMore       bool
+	}{
+		{offset: 0, limit: 2, expected: all[:2], hasMore: true},
+		{offset: 2, limit: 2, expected: all[2:4], hasMore: true},
+		{offset: 4, limit: 2, expected: all[4:], hasMore: false},
+		{offset: 0, limit: 5, expected: all, hasMore: false},
+		{offset: 5, limit: 2, expected: nil, hasMore: false},
+		{offset: 1, limit: 0, expected: nil, hasMore: true},
+	} {
+		t.Run(fmt.Sprintf("offset=%d,limit=%d", tc.offset, tc.limit), func(t *testing.T) {
+			paths, hasMore, err := q.DataObjPathsPage(ctx, tenantID, now, tc.offset, tc.limit)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, paths)
+			require.Equal(t, tc.hasMore, hasMore)
+		})
+	}
+
+	t.Run("missing window", func(t *testing.T) {
+		paths, hasMore, err := q.DataObjPathsPage(ctx, tenantID, now.Add(-metastoreWindowSize), 0, 10)
+		require.NoError(t, err)
+		require.Empty(t, paths)
+		require.False(t, hasMore)
+	})
+
+	t.Run("invalid page", func(t *testing.T) {
+		_, _, err := q.DataObjPathsPage(ctx, tenantID, now, -1, 10)
+		require.Error(t, err)
+	})
+}
+
+func TestQuerierPaths(t *testing.T) {
+	ctx := context.Background()
+	bucket := objstore.NewInMemBucket()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger())
+	// Spans two windows, so it is in both objects.
+	require.NoError(t, m.Update(ctx, testObjectPath("spanning"), now.Add(-time.Hour), now.Add(metastoreWindowSize)))
+	require.NoError(t, m.Update(ctx, testObjectPath("early"), now.Add(-2*time.Hour), now.Add(-90*time.Minute)))
+	require.NoError(t, m.Update(ctx, testObjectPath("late"), now.Add(time.Hour), now.Add(2*time.Hour)))
+	require.NoError(t, m.Update(ctx, testObjectPath("same-start"), now.Add(-time.Hour), now))
+
+	// A malformed record in the next window is skipped.
+	next := now.Truncate(metastoreWindowSize).Add(metastoreWindowSize)
+	builder, err := logsobj.NewBuilder(metastoreBuilderCfg)
+	require.NoError(t, err)
+	for _, lbs := range []string{
+		fmt.Sprintf(`{__start__="%d", __end__="%d", __path__="%s"}`, next.UnixNano(), next.UnixNano(), testObjectPath("next")),
+		`{__start__="invalid", __end__="2", __path__="` + testObjectPath("malformed") + `"}`,
+	} {
+		require.NoError(t, builder.Append(logproto.Stream{Labels: lbs, Entries: []logproto.Entry{{Line: ""}}}))
+	}
+	var existing bytes.Buffer
+	_, err = builder.Flush(&existing)
+	require.NoError(t, err)
+	require.NoError(t, bucket.Upload(ctx, metastorePath(tenantID, next), bytes.NewReader(existing.Bytes())))
+
+	for _, opts := range [][]QuerierOption{nil, {WithObjectCache(10)}} {
+		q := NewQuerier(bucket, log.NewNopLogger(), opts...)
+
+		paths, err := q.Paths(ctx, tenantID, now.Add(-2*time.Hour), now.Add(metastoreWindowSize))
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			testObjectPath("early"),
+			testObjectPath("same-start"),
+			testObjectPath("spanning"),
+			testObjectPath("late"),
+			testObjectPath("next"),
+		}, paths)
+
+		// Records of the window which don't overlap the range are skipped.
+		paths, err = q.Paths(ctx, tenantID, now.Add(30*time.Minute), now.Add(90*time.Minute))
+		require.NoError(t, err)
+		require.Equal(t, []string{testObjectPath("spanning"), testObjectPath("late")}, paths)
+
+		// Missing windows are skipped.
+		paths, err = q.Paths(ctx, tenantID, now.Add(-48*time.Hour), now.Add(-47*time.Hour))
+		require.NoError(t, err)
+		require.Empty(t, paths)
+	}
+}
+
+func TestQuerierReferencedBytes(t *testing.T) {
+	ctx := context.Background()
+	bucket := objstore.NewInMemBucket()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger())
+	// Spans two windows, but is only counted once.
+	require.NoError(t, m.UpdateWithStats(ctx, testObjectPath("spanning"), now, now.Add(metastoreWindowSize), PathStats{SizeBytes: 100}))
+	require.NoError(t, m.UpdateWithStats(ctx, testObjectPath("sized"), now, now, PathStats{SizeBytes: 50, StreamCount: 3}))
+	require.NoError(t, m.Update(ctx, testObjectPath("unsized"), now, now))
+	require.NoError(t, m.UpdateWithStats(ctx, testObjectPath("outside"), now.Add(-48*time.Hour), now.Add(-47*time.Hour), PathStats{SizeBytes: 1000}))
+
+	q := NewQuerier(bucket, log.NewNopLogger())
+	total, err := q.ReferencedBytes(ctx, tenantID, now, now.Add(metastoreWindowSize))
+	require.NoError(t, err)
+	require.Equal(t, int64(150), total)
+
+	total, err = q.ReferencedBytes(ctx, tenantID, now.Add(metastoreWindowSize), now.Add(metastoreWindowSize))
+	require.NoError(t, err)
+	require.Equal(t, int64(100), total)
+
+	total, err = q.ReferencedBytes(ctx, tenantID, now.Add(-24*time.Hour), now.Add(-23*time.Hour))
+	require.NoError(t, err)
+	require.Zero(t, total)
+}
+
+func TestQuerierLabelNames(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	path := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+
+	// Write an object with a record with an extra label, as a richer encoding would.
+	builder, err := logsobj.NewBuilder(metastoreBuilderCfg)
+	require.NoError(t, err)
+	for _, lbs := range []string{
+		`{__start__="1", __end__="2", __path__="` + testObjectPath("a") + `"}`,
+		`{__start__="1", __end__="2", __path__="` + testObjectPath("b") + `", __size__="10"}`,
+	} {
+		require.NoError(t, builder.Append(logproto.Stream{Labels: lbs, Entries: []logproto.Entry{{Line: ""}}}))
+	}
+	var object bytes.Buffer
+	_, err = builder.Flush(&object)
+	require.NoError(t, err)
+
+	bucket := objstore.NewInMemBucket()
+	require.NoError(t, bucket.Upload(ctx, path, bytes.NewReader(object.Bytes())))
+
+	q := NewQuerier(bucket, log.NewNopLogger())
+	names, err := q.LabelNames(ctx, tenantID, now)
+	require.NoError(t, err)
+	require.Equal(t, []string{labelNameEnd, labelNamePath, "__size__", labelNameStart}, names)
+
+	names, err = q.LabelNames(ctx, tenantID, now.Add(-metastoreWindowSize))
+	require.NoError(t, err)
+	require.Empty(t, names)
+}
+
+// getCountingBucket counts the objects read with Get.
+type getCountingBucket struct {
+	*objstore.InMemBucket
+	gets int
+}
+
+func (b *getCountingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	b.gets++
+	return b.InMemBucket.Get(ctx, name)
+}
+
+func TestQuerierObjectCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	path := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+
+	bucket := &getCountingBucket{InMemBucket: objstore.NewInMemBucket()}
+	m := NewUpdater(bucket.InMemBucket, tenantID, log.NewNopLogger())
+	// Uploading records the attributes of the object, unlike GetAndReplace in memory.
+	update := func(name string) {
+		require.NoError(t, m.Update(ctx, testObjectPath(name), now, now))
+		require.NoError(t, bucket.Upload(ctx, path, bytes.NewReader(bucket.Objects()[path])))
+	}
+	update("a")
+	update("b")
+
+	q := NewQuerier(bucket, log.NewNopLogger(), WithObjectCache(10))
+	for i := 0; i < 3; i++ {
+		paths, hasMore, err := q.DataObjPathsPage(ctx, tenantID, now, 0, 1)
+		require.NoError(t, err)
+		require.Equal(t, []string{testObjectPath("a")}, paths)
+		require.True(t, hasMore)
+	}
+	require.Equal(t, 1, bucket.gets, "unchanged objects must be read once")
+	require.Equal(t, float64(2), testutil.ToFloat64(q.metrics.objectCacheHits))
+	require.Equal(t, float64(1), testutil.ToFloat64(q.metrics.objectCacheMisses))
+
+	// Changed objects are read again.
+	update("c")
+	paths, hasMore, err := q.DataObjPathsPage(ctx, tenantID, now, 1, 5)
+	require.NoError(t, err)
+	require.Equal(t, []string{testObjectPath("b"), testObjectPath("c")}, paths)
+	require.False(t, hasMore)
+	require.Equal(t, 2, bucket.gets)
+	require.Equal(t, float64(2), testutil.ToFloat64(q.metrics.objectCacheMisses))
+
+	// Missing windows are empty.
+	paths, hasMore, err = q.DataObjPathsPage(ctx, tenantID, now.Add(-24*time.Hour), 0, 5)
+	require.NoError(t, err)
+	require.Empty(t, paths)
+	require.False(t, hasMore)
+}
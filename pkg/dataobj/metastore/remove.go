@@ -0,0 +1,257 @@
+package metastore
+
+import (
+	"context"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/grafana/loki/v3/pkg/dataobj/consumer/logsobj"
+)
+
+var (
+	// errNothingToRemove is returned by the GetAndReplace callback of a
+	// removal to leave metastore objects without records of the removed path
+	// as is.
+	errNothingToRemove = errors.New("no records to remove")
+
+	// errObjectEmptied is returned by the GetAndReplace callback of a
+	// removal which left the object without records or tombstones, to delete
+	// the object instead of replacing it.
+	errObjectEmptied = errors.New("object left empty")
+
+	// errObjectChanged is returned when an object changed between being read
+	// and being deleted.
+	errObjectChanged = errors.New("object changed since it was read")
+)
+
+// Remove removes dataobjPath from the metastore objects of the windows
+// overlapping minTimestamp to maxTimestamp, e.g. once the dataobj has been
+// compacted away or deleted. Windows which don't exist or have no records of
+// dataobjPath are left as is. Each window is retried on failure like in
+// [Updater.Update].
+//
+// Metastore objects left without records are deleted, and their windows
+// removed from the manifest. An object is only deleted if it didn't change
+// since it was replayed, see [Updater.deleteUnchanged], and is replayed again
+// otherwise. With [WithBufferedUpdates], buffered entries of
+// dataobjPath are dropped too. With [WithTombstones], the records are kept and a
+// tombstone of dataobjPath is added instead.
+func (m *Updater) Remove(ctx context.Context, dataobjPath string, minTimestamp, maxTimestamp time.Time) error {
+	if err := validateDataobjPath(m.tenantID, dataobjPath); err != nil {
+		return err
+	}
+	if m.buffering() {
+		m.removePending(dataobjPath)
+	}
+
+	if err := m.initBuilder(); err != nil {
+		return err
+	}
+	m.acquireBuffer()
+	defer m.releaseBuffer()
+
+	var err error
+	for metastorePath := range iterStorePaths(m.layout, m.tenantID, minTimestamp, maxTimestamp, m.windowSize) {
+		err = m.removeFromWindow(ctx, metastorePath, dataobjPath)
+	}
+	return err
+}
+
+// removeFromWindow removes the records of dataobjPath from the metastore
+// object at metastorePath, or tombstones them with [WithTombstones].
+func (m *Updater) removeFromWindow(ctx context.Context, metastorePath, dataobjPath string) error {
+	if m.tombstones {
+		err := m.tombstoneWindow(ctx, metastorePath, dataobjPath)
+		switch {
+		case errors.Is(err, errNothingToRemove):
+			level.Debug(m.logger).Log("msg", "no records to tombstone in metastore", "metastore", metastorePath, "path", dataobjPath)
+			return nil
+		case err != nil:
+			return err
+		}
+		level.Info(m.logger).Log("msg", "successfully tombstoned dataobj in metastore", "metastore", metastorePath, "path", dataobjPath)
+		return nil
+	}
+
+	deleted, size, err := m.rewriteWindow(ctx, metastorePath, func(existing io.Reader) (int, error) {
+		kept, removed, err := m.replayExisting(ctx, existing, func(lbs labels.Labels) bool {
+			return lbs.Get(labelNamePath) == dataobjPath
+		})
+		if err == nil && removed == 0 {
+			err = errNothingToRemove
+		}
+		return kept, err
+	})
+	switch {
+	case errors.Is(err, errNothingToRemove):
+		level.Debug(m.logger).Log("msg", "no records to remove from metastore", "metastore", metastorePath, "path", dataobjPath)
+		return nil
+	case err != nil:
+		return err
+	case deleted:
+		level.Info(m.logger).Log("msg", "deleted metastore object after removing its last dataobj", "metastore", metastorePath, "path", dataobjPath)
+	default:
+		level.Info(m.logger).Log("msg", "successfully removed dataobj from metastore", "metastore", metastorePath, "path", dataobjPath)
+	}
+	record := m.journalRecord(JournalOperationRemove, metastorePath, size)
+	record.Path = dataobjPath
+	m.recordJournal(ctx, []JournalRecord{record})
+	return nil
+}
+
+// rewriteWindow replaces the metastore object at metastorePath with the
+// records replay replays from it into the metastore builder, retrying on
+// failure. replay returns the number of records it kept, or
+// errNothingToRemove to leave the object as is, which is returned without
+// retrying. Objects left without records are deleted. It returns whether the
+// object was deleted and its size after the write.
+func (m *Updater) rewriteWindow(ctx context.Context, metastorePath string, replay func(existing io.Reader) (int, error)) (deleted bool, size int64, err error) {
+	b := m.backoffFor(metastorePath)
+	var conflicted bool
+	for b.Ongoing() {
+		var (
+			flushStats  logsobj.FlushStats
+			callbackDur time.Duration
+			read        = xxhash.New()
+		)
+		deleted, size = false, 0
+		getAndReplaceStart := time.Now()
+		err = m.bucket.GetAndReplace(ctx, metastorePath, func(existing io.Reader) (io.Reader, error) {
+			callbackStart := time.Now()
+			defer func() { callbackDur += time.Since(callbackStart) }()
+
+			if existing == nil {
+				return nil, errNothingToRemove
+			}
+			existing = io.TeeReader(existing, read)
+			kept, err := replay(existing)
+			if err != nil {
+				return nil, err
+			}
+			m.metrics.incOperations(operationRemove)
+			if kept == 0 {
+				// Hash the rest of the object too, so it is compared whole.
+				if _, err := io.Copy(io.Discard, existing); err != nil {
+					return nil, errors.Wrap(err, "reading metastore object")
+				}
+				return nil, errObjectEmptied
+			}
+
+			m.buf.Reset()
+			encodingDuration := prometheus.NewTimer(m.metrics.metastoreEncodingTime)
+			stats, err := m.metastoreBuilder.Flush(m.buf)
+			if err != nil {
+				return nil, errors.Wrap(err, "flushing metastore builder")
+			}
+			flushStats = stats
+			encodingDuration.ObserveDuration()
+			return m.writeEncoded(ctx, metastorePath, m.buf, &size)
+		})
+		m.metrics.observeGetAndReplaceCallback(callbackDur)
+		m.metrics.observeGetAndReplace(time.Since(getAndReplaceStart) - callbackDur)
+
+		if errors.Is(err, errStagedWrite) {
+			err = nil
+		}
+		if errors.Is(err, errObjectEmptied) {
+			if err = m.deleteUnchanged(ctx, metastorePath, read.Sum64()); err == nil {
+				deleted = true
+			}
+		}
+		if errors.Is(err, errNothingToRemove) {
+			break
+		}
+		if err == nil {
+			if !deleted {
+				m.observeFlush(flushStats)
+			}
+			m.metrics.incMetastoreWrites(statusSuccess)
+			break
+		}
+		level.Error(m.logger).Log("msg", "failed to rewrite metastore object", "err", err, "metastore", metastorePath)
+		m.metrics.incMetastoreWrites(statusFailure)
+		conflicted = true
+		b.Wait()
+	}
+	if m.windowBackoff != nil {
+		m.windowBackoff.observe(metastorePath, conflicted, time.Now())
+	}
+	m.metastoreBuilder.Reset()
+	return deleted, size, err
+}
+
+// deleteUnchanged deletes the metastore object at metastorePath, which was
+// left without records, like [Updater.deleteIfUnchanged]. Deleted windows are
+// forgotten by [WithMaxTenantWindows] and removed from the manifest; manifest
+// failures don't fail the removal, like in [Updater.updateManifest].
+func (m *Updater) deleteUnchanged(ctx context.Context, metastorePath string, read uint64) error {
+	if err := m.deleteIfUnchanged(ctx, metastorePath, read); err != nil {
+		return err
+	}
+	m.forgetTenantWindow(metastorePath)
+	if m.manifest {
+		m.removeWindowFromManifest(ctx, metastorePath)
+	}
+	return nil
+}
+
+// deleteIfUnchanged deletes the object at path unless its content changed
+// from the content with the hash read, and returns errObjectChanged
+// otherwise. Buckets can't delete objects conditionally, so a write of
+// another updater between the check and the delete is still lost, but the
+// window for it is one read instead of the whole replay. Objects deleted in
+// the meantime return errNothingToRemove.
+func (m *Updater) deleteIfUnchanged(ctx context.Context, path string, read uint64) error {
+	reader, err := m.bucket.Get(ctx, path)
+	if m.bucket.IsObjNotFoundErr(err) {
+		return errNothingToRemove
+	} else if err != nil {
+		return errors.Wrap(err, "reading object")
+	}
+	current := xxhash.New()
+	_, err = io.Copy(current, reader)
+	reader.Close()
+	if err != nil {
+		return errors.Wrap(err, "reading object")
+	}
+	if current.Sum64() != read {
+		return errObjectChanged
+	}
+	if err := m.bucket.Delete(ctx, path); err != nil && !m.bucket.IsObjNotFoundErr(err) {
+		return errors.Wrap(err, "deleting object")
+	}
+	return nil
+}
+
+// removeWindowFromManifest removes the window of the deleted metastore object
+// at metastorePath from the manifest.
+func (m *Updater) removeWindowFromManifest(ctx context.Context, metastorePath string) {
+	window, err := m.layout.parseWindow(m.tenantID, metastorePath)
+	if err == nil {
+		err = m.removeFromManifest(ctx, []time.Time{window})
+	}
+	if err != nil {
+		m.manifestUpdateFailed(metastorePath, err)
+		return
+	}
+	delete(m.manifestRefreshed, window)
+}
+
+// removePending drops the buffered entries of dataobjPath, and windows left without entries.
+func (m *Updater) removePending(dataobjPath string) {
+	for metastorePath, window := range m.pending {
+		window.entries = slices.DeleteFunc(window.entries, func(entry PathEntry) bool {
+			return entry.Path == dataobjPath
+		})
+		if len(window.entries) == 0 {
+			delete(m.pending, metastorePath)
+		}
+	}
+}
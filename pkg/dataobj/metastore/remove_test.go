@@ -0,0 +1,136 @@
+package metastore
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestRemove(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	first, _ := WindowFor(now)
+	second := first.Add(metastoreWindowSize)
+
+	bucket := objstore.NewInMemBucket()
+	journalBucket := objstore.NewInMemBucket()
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithManifest(), WithJournal(NewBucketJournal(journalBucket)))
+	require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+	require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now.Add(metastoreWindowSize)))
+
+	t.Run("removes the records of the path", func(t *testing.T) {
+		require.NoError(t, m.Remove(ctx, testObjectPath("b"), now, now.Add(metastoreWindowSize)))
+
+		require.NoError(t, m.verifyWrite(ctx, metastorePath(tenantID, first), testObjectPath("a")))
+		require.Error(t, m.verifyWrite(ctx, metastorePath(tenantID, first), testObjectPath("b")))
+		require.Equal(t, float64(2), testutil.ToFloat64(m.metrics.operations.WithLabelValues(string(operationRemove))))
+	})
+
+	t.Run("deletes objects left without records", func(t *testing.T) {
+		require.NotContains(t, bucket.Objects(), metastorePath(tenantID, second))
+
+		manifest, err := readManifest(ctx, bucket, tenantID)
+		require.NoError(t, err)
+		require.Len(t, manifest.Windows, 1)
+		require.Equal(t, first, manifest.Windows[0].Start)
+
+		require.NoError(t, m.Remove(ctx, testObjectPath("a"), now, now))
+		require.NotContains(t, bucket.Objects(), metastorePath(tenantID, first))
+
+		manifest, err = readManifest(ctx, bucket, tenantID)
+		require.NoError(t, err)
+		require.Empty(t, manifest.Windows)
+
+		paths, err := NewQuerier(bucket, log.NewNopLogger()).Paths(ctx, tenantID, now, now.Add(metastoreWindowSize))
+		require.NoError(t, err)
+		require.Empty(t, paths)
+
+		report, err := SelfTest(ctx, bucket, tenantID)
+		require.NoError(t, err)
+		require.Zero(t, report.Objects)
+	})
+
+	t.Run("records removals in the journal", func(t *testing.T) {
+		var removed []JournalRecord
+		for _, record := range readJournal(t, journalBucket) {
+			if record.Operation == JournalOperationRemove {
+				removed = append(removed, record)
+			}
+		}
+		require.Len(t, removed, 3)
+		for _, record := range removed[:2] {
+			require.Equal(t, testObjectPath("b"), record.Path)
+		}
+		require.Equal(t, testObjectPath("a"), removed[2].Path)
+		require.Zero(t, removed[2].Size, "expected the deleted object to have no size")
+	})
+
+	t.Run("missing windows and paths are left as is", func(t *testing.T) {
+		require.NoError(t, m.Update(ctx, testObjectPath("c"), now, now))
+		before := bucket.Objects()[metastorePath(tenantID, first)]
+
+		require.NoError(t, m.Remove(ctx, testObjectPath("missing"), now, now.Add(2*metastoreWindowSize)))
+		require.Equal(t, before, bucket.Objects()[metastorePath(tenantID, first)])
+	})
+
+	t.Run("invalid path", func(t *testing.T) {
+		require.Error(t, m.Remove(ctx, "../other/objects/a", now, now))
+	})
+}
+
+func TestRemoveBuffered(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	path := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+
+	bucket := objstore.NewInMemBucket()
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithBufferedUpdates(10, 0))
+	require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+	require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+
+	require.NoError(t, m.Remove(ctx, testObjectPath("b"), now, now))
+	require.NoError(t, m.Flush(ctx))
+	require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("a")))
+	require.Error(t, m.verifyWrite(ctx, path, testObjectPath("b")))
+}
+
+func TestRemoveConcurrentUpdate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	path := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+
+	bucket := objstore.NewInMemBucket()
+	remover := NewUpdater(bucket, tenantID, log.NewNopLogger())
+	require.NoError(t, remover.Update(ctx, testObjectPath("a"), now, now))
+
+	// Another updater adds a path to the window right after the removal read
+	// the window and found it left without records, before it is deleted.
+	other := NewUpdater(bucket, tenantID, log.NewNopLogger())
+	remover.bucket = &interleavingBucket{Bucket: bucket, after: func() {
+		require.NoError(t, other.Update(ctx, testObjectPath("b"), now, now))
+	}}
+
+	require.NoError(t, remover.Remove(ctx, testObjectPath("a"), now, now))
+	require.NoError(t, other.verifyWrite(ctx, path, testObjectPath("b")))
+	require.Error(t, other.verifyWrite(ctx, path, testObjectPath("a")))
+}
+
+// interleavingBucket calls after once the first GetAndReplace returned.
+type interleavingBucket struct {
+	objstore.Bucket
+	after func()
+	once  sync.Once
+}
+
+func (b *interleavingBucket) GetAndReplace(ctx context.Context, name string, f func(io.Reader) (io.Reader, error)) error {
+	err := b.Bucket.GetAndReplace(ctx, name, f)
+	b.once.Do(b.after)
+	return err
+}
@@ -0,0 +1,92 @@
+package metastore
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// RetentionProvider returns the retention period of a tenant. A period of
+// zero or less means the tenant has no specific retention configured.
+type RetentionProvider func(tenantID string) time.Duration
+
+// WithRetentionProvider configures per-tenant retention periods. When the
+// provider returns a positive period for the tenant of the [Updater], it takes
+// precedence over the cutoff passed to [Updater.EnforceRetention].
+func WithRetentionProvider(p RetentionProvider) UpdaterOption {
+	return func(u *Updater) {
+		u.retention = p
+	}
+}
+
+// EnforceRetention deletes all metastore objects of the tenant whose window
+// ends at or before the cutoff. The cutoff is olderThan, unless a
+// [RetentionProvider] configures a retention period for the tenant. It returns
+// the number of deleted objects.
+func (m *Updater) EnforceRetention(ctx context.Context, olderThan time.Time) (int, error) {
+	cutoff := m.retentionCutoff(olderThan)
+
+	// Collect the paths first; deleting while iterating is not safe for all
+	// bucket implementations.
+	var expired []string
+	err := m.layout.iter(ctx, m.bucket, m.tenantID, func(path string) error {
+		window, err := m.layout.parseWindow(m.tenantID, path)
+		if err != nil {
+			level.Warn(m.logger).Log("msg", "skipping unexpected object in metastore directory", "path", path, "err", err)
+			return nil
+		}
+		if !window.Add(m.windowSize).After(cutoff) {
+			expired = append(expired, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "listing metastore objects")
+	}
+
+	var deleted int
+	var deletedWindows []time.Time
+	var records []JournalRecord
+	defer func() {
+		if len(records) > 0 {
+			m.recordJournal(ctx, records)
+		}
+	}()
+	for _, path := range expired {
+		if err := m.bucket.Delete(ctx, path); err != nil && !m.bucket.IsObjNotFoundErr(err) {
+			return deleted, errors.Wrapf(err, "deleting metastore object %s", path)
+		}
+		deleted++
+		if m.tombstones {
+			if err := m.bucket.Delete(ctx, tombstonesPath(m.tenantID, path)); err != nil && !m.bucket.IsObjNotFoundErr(err) {
+				level.Warn(m.logger).Log("msg", "failed to delete tombstones of expired metastore object", "metastore", path, "err", err)
+			}
+		}
+		m.forgetTenantWindow(path)
+		records = append(records, m.journalRecord(JournalOperationRemove, path, 0))
+		if window, err := m.layout.parseWindow(m.tenantID, path); err == nil {
+			deletedWindows = append(deletedWindows, window)
+		}
+	}
+
+	if m.manifest && len(deletedWindows) > 0 {
+		if err := m.removeFromManifest(ctx, deletedWindows); err != nil {
+			return deleted, errors.Wrap(err, "removing deleted windows from manifest")
+		}
+	}
+
+	level.Info(m.logger).Log("msg", "enforced metastore retention", "cutoff", cutoff, "deleted", deleted)
+	return deleted, nil
+}
+
+func (m *Updater) retentionCutoff(olderThan time.Time) time.Time {
+	if m.retention == nil {
+		return olderThan
+	}
+	if period := m.retention(m.tenantID); period > 0 {
+		return time.Now().Add(-period)
+	}
+	return olderThan
+}
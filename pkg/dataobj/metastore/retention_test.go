@@ -0,0 +1,77 @@
+package metastore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestEnforceRetention(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(metastoreWindowSize)
+
+	setup := func(t *testing.T, opts ...UpdaterOption) (*Updater, *objstore.InMemBucket) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), opts...)
+
+		// One object for each of the last four windows.
+		for i := 0; i < 4; i++ {
+			start := now.Add(-time.Duration(i) * metastoreWindowSize)
+			require.NoError(t, m.Update(ctx, testObjectPath("path"), start, start.Add(time.Minute)))
+		}
+		// Objects of other tenants must never be touched.
+		other := NewUpdater(bucket, "other-tenant", log.NewNopLogger())
+		require.NoError(t, other.Update(ctx, tenantDir("other-tenant")+"objects/path", now.Add(-48*time.Hour), now.Add(-48*time.Hour)))
+
+		require.Len(t, bucket.Objects(), 5)
+		return m, bucket
+	}
+
+	t.Run("deletes windows ending before the cutoff", func(t *testing.T) {
+		m, bucket := setup(t)
+
+		deleted, err := m.EnforceRetention(ctx, now.Add(-metastoreWindowSize))
+		require.NoError(t, err)
+		require.Equal(t, 2, deleted)
+
+		objects := bucket.Objects()
+		require.Len(t, objects, 3)
+		require.Contains(t, objects, metastorePath(tenantID, now))
+		require.Contains(t, objects, metastorePath(tenantID, now.Add(-metastoreWindowSize)))
+	})
+
+	t.Run("retention provider overrides cutoff", func(t *testing.T) {
+		// A period of one window puts the cutoff within the window before the
+		// current one, whatever the time of day: the two oldest windows are
+		// expired and the two newest aren't.
+		m, bucket := setup(t, WithRetentionProvider(func(tenant string) time.Duration {
+			if tenant == tenantID {
+				return metastoreWindowSize
+			}
+			return 0
+		}))
+
+		deleted, err := m.EnforceRetention(ctx, time.Time{})
+		require.NoError(t, err)
+		require.Equal(t, 2, deleted)
+
+		objects := bucket.Objects()
+		require.Len(t, objects, 3)
+		require.Contains(t, objects, metastorePath(tenantID, now))
+		require.Contains(t, objects, metastorePath(tenantID, now.Add(-metastoreWindowSize)))
+		require.Contains(t, objects, metastorePath("other-tenant", now.Add(-48*time.Hour).Truncate(metastoreWindowSize)))
+	})
+
+	t.Run("no expired windows", func(t *testing.T) {
+		m, bucket := setup(t)
+
+		deleted, err := m.EnforceRetention(ctx, now.Add(-72*time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, 0, deleted)
+		require.Len(t, bucket.Objects(), 5)
+	})
+}
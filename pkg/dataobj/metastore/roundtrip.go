@@ -0,0 +1,52 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/loki/v3/pkg/dataobj"
+	"github.com/grafana/loki/v3/pkg/dataobj/consumer/logsobj"
+	"github.com/grafana/loki/v3/pkg/dataobj/sections/streams"
+	"github.com/grafana/loki/v3/pkg/logproto"
+)
+
+// RoundTrip encodes streams into a metastore object the same way the
+// [Updater] does and decodes them again the same way existing metastore
+// objects are read. It returns the decoded streams in the order they are
+// stored, so callers can check that the metastore preserves label sets
+// exactly.
+func RoundTrip(input []logproto.Stream) ([]streams.Stream, error) {
+	builder, err := logsobj.NewBuilder(metastoreBuilderCfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating metastore builder")
+	}
+	for _, stream := range input {
+		if err := builder.Append(stream); err != nil {
+			return nil, errors.Wrap(err, "appending stream")
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := builder.Flush(&buf); err != nil {
+		return nil, errors.Wrap(err, "flushing metastore builder")
+	}
+
+	object, err := dataobj.FromReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		return nil, errors.Wrap(err, "opening metastore object")
+	}
+
+	var output []streams.Stream
+	err = replayStreams(context.Background(), object, 1, func(stream streams.Stream) error {
+		// The reader reuses the labels of its buffer between reads.
+		stream.Labels = stream.Labels.Copy()
+		output = append(output, stream)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "reading metastore object")
+	}
+	return output, nil
+}
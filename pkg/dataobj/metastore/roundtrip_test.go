@@ -0,0 +1,56 @@
+package metastore
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/logproto"
+)
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add("__path__", "path/to/object", "__start__", "1735743600000000000")
+	f.Add("quoted", `a "quoted" value`, `name "with" quotes`, `\"`)
+	f.Add("newline", "line\nbreak", "name\nwith\nnewlines", "\r\n\t")
+	f.Add("braces", `{a="b", c="d"}`, "unicode_é", "✓ ✗  ")
+	f.Add("backslash", `trailing\`, `\x00`, "\x00")
+
+	f.Fuzz(func(t *testing.T, name1, value1, name2, value2 string) {
+		if name1 == name2 {
+			t.Skip()
+		}
+		// Empty values are equivalent to absent labels and dropped by the builder.
+		lbs := labels.FromStrings(name1, value1, name2, value2)
+		if validateLabels(lbs) != nil || value1 == "" || value2 == "" {
+			t.Skip()
+		}
+
+		decoded, err := RoundTrip([]logproto.Stream{{
+			Labels:  lbs.String(),
+			Entries: []logproto.Entry{{Line: ""}},
+		}})
+		require.NoError(t, err)
+		require.Len(t, decoded, 1)
+		require.Equal(t, lbs, decoded[0].Labels)
+	})
+}
+
+func TestRoundTrip(t *testing.T) {
+	input := []labels.Labels{
+		labels.FromStrings(labelNamePath, "tenant/objects/a", labelNameStart, "1", labelNameEnd, "2"),
+		labels.FromStrings(labelNamePath, "tenant/objects/b", "quoted", `say "hi"`, "multi\nline", "a\nb"),
+	}
+
+	var streams []logproto.Stream
+	for _, lbs := range input {
+		streams = append(streams, logproto.Stream{Labels: lbs.String(), Entries: []logproto.Entry{{Line: ""}}})
+	}
+
+	decoded, err := RoundTrip(streams)
+	require.NoError(t, err)
+	require.Len(t, decoded, len(input))
+	for i, stream := range decoded {
+		require.Equal(t, input[i], stream.Labels)
+	}
+}
@@ -0,0 +1,159 @@
+package metastore
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// runCoalesceWindow is how long [Updater.Run] waits for more entries after receiving one.
+	runCoalesceWindow = 100 * time.Millisecond
+	// runMaxBatchSize is the maximum number of entries [Updater.Run] coalesces into one batch.
+	runMaxBatchSize = 1000
+)
+
+// PathEntry is a flushed data object to add to the metastore.
+type PathEntry struct {
+	Path         string
+	MinTimestamp time.Time
+	MaxTimestamp time.Time
+	Stats        PathStats // Optional; stored with the records of Path.
+}
+
+// Run adds the data objects received from in to the metastore until in is
+// closed or ctx is cancelled. Entries received shortly after each other are
+// coalesced, so all entries of a batch targeting the same metastore window are
+// added with a single write instead of one write per entry.
+//
+// Run doesn't receive from in while writing a batch, so a slow object store
+// pushes back on senders. Invalid entries are logged and dropped. Run returns
+// the error of a window which couldn't be written after retrying, or the error
+// of ctx if it is cancelled while writing a batch, leaving the remaining
+// windows of the batch unwritten.
+func (m *Updater) Run(ctx context.Context, in <-chan PathEntry) error {
+	if err := m.initBuilder(); err != nil {
+		return err
+	}
+
+	for {
+		batch, open := nextBatch(ctx, in)
+		if len(batch) > 0 {
+			if err := m.updateBatch(ctx, batch); err != nil {
+				return err
+			}
+		}
+		if !open {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// nextBatch blocks until an entry is received from in and then collects
+// further entries for up to runCoalesceWindow. It returns false once in is
+// closed.
+func nextBatch(ctx context.Context, in <-chan PathEntry) ([]PathEntry, bool) {
+	var batch []PathEntry
+	select {
+	case <-ctx.Done():
+		return nil, true
+	case entry, ok := <-in:
+		if !ok {
+			return nil, false
+		}
+		batch = append(batch, entry)
+	}
+
+	timer := time.NewTimer(runCoalesceWindow)
+	defer timer.Stop()
+
+	for len(batch) < runMaxBatchSize {
+		select {
+		case <-ctx.Done():
+			return batch, true
+		case <-timer.C:
+			return batch, true
+		case entry, ok := <-in:
+			if !ok {
+				return batch, false
+			}
+			batch = append(batch, entry)
+		}
+	}
+	return batch, true
+}
+
+// updateBatch adds the entries of batch to the metastore, with one write per
+// metastore window. It stops at the first window which couldn't be written.
+func (m *Updater) updateBatch(ctx context.Context, batch []PathEntry) error {
+	m.acquireBuffer()
+	defer m.releaseBuffer()
+
+	processingTime := prometheus.NewTimer(m.metrics.metastoreProcessingTime)
+	defer processingTime.ObserveDuration()
+
+	m.metrics.observeBatchEntries(len(batch))
+
+	valid := make([]PathEntry, 0, len(batch))
+	pending := make(map[string]struct{})
+	for _, entry := range batch {
+		if err := validateDataobjPath(m.tenantID, entry.Path); err != nil {
+			level.Error(m.logger).Log("msg", "dropping metastore entry", "err", err)
+			continue
+		}
+		if err := m.checkWindows(entry.MinTimestamp, entry.MaxTimestamp); err != nil {
+			level.Error(m.logger).Log("msg", "dropping metastore entry", "err", err, "path", entry.Path)
+			continue
+		}
+		if err := m.checkTenantWindows(ctx, entry.MinTimestamp, entry.MaxTimestamp, pending); err != nil {
+			level.Error(m.logger).Log("msg", "dropping metastore entry", "err", err, "path", entry.Path)
+			continue
+		}
+		valid = append(valid, entry)
+	}
+
+	paths, windows := m.groupByWindow(valid)
+	for _, metastorePath := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := m.updateWindow(ctx, metastorePath, windows[metastorePath]); err != nil {
+			return errors.Wrapf(err, "updating metastore %s", metastorePath)
+		}
+	}
+	return nil
+}
+
+// groupByWindow groups entries by the paths of the metastore windows they
+// overlap. The window paths are returned sorted.
+func (m *Updater) groupByWindow(entries []PathEntry) ([]string, map[string][]PathEntry) {
+	windows := make(map[string][]PathEntry)
+	for _, entry := range entries {
+		for metastorePath := range iterStorePaths(m.layout, m.tenantID, entry.MinTimestamp, entry.MaxTimestamp, m.windowSize) {
+			windows[metastorePath] = append(windows[metastorePath], entry)
+		}
+	}
+
+	paths := make([]string, 0, len(windows))
+	for metastorePath := range windows {
+		paths = append(paths, metastorePath)
+	}
+	slices.Sort(paths)
+	return paths, windows
+}
+
+// entryPaths returns the data object paths of entries.
+func entryPaths(entries []PathEntry) []string {
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+	return paths
+}
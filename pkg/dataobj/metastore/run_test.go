@@ -0,0 +1,89 @@
+package metastore
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestRunCoalescesUpdates(t *testing.T) {
+	ctx := context.Background()
+	bucket := objstore.NewInMemBucket()
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger())
+
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	entries := []PathEntry{
+		{Path: testObjectPath("first"), MinTimestamp: now.Add(-time.Hour), MaxTimestamp: now},
+		{Path: testObjectPath("second"), MinTimestamp: now.Add(-2 * time.Hour), MaxTimestamp: now},
+		{Path: "../other-tenant/objects/third", MinTimestamp: now.Add(-time.Hour), MaxTimestamp: now},
+		{Path: testObjectPath("fourth"), MinTimestamp: now.Add(-metastoreWindowSize), MaxTimestamp: now},
+	}
+
+	in := make(chan PathEntry, len(entries))
+	for _, entry := range entries {
+		in <- entry
+	}
+	close(in)
+	require.NoError(t, m.Run(ctx, in))
+
+	currentWindow := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+	previousWindow := metastorePath(tenantID, now.Add(-metastoreWindowSize).Truncate(metastoreWindowSize))
+	require.Len(t, bucket.Objects(), 2)
+	require.NoError(t, m.verifyWrite(ctx, currentWindow, testObjectPath("first"), testObjectPath("second"), testObjectPath("fourth")))
+	require.NoError(t, m.verifyWrite(ctx, previousWindow, testObjectPath("fourth")))
+	require.Error(t, m.verifyWrite(ctx, currentWindow, "../other-tenant/objects/third"))
+
+	// One write per window rather than one per entry and window.
+	require.Equal(t, float64(2), testutil.ToFloat64(m.metrics.metastoreWriteFailures.WithLabelValues(string(statusSuccess))))
+}
+
+func TestRunStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := NewUpdater(objstore.NewInMemBucket(), tenantID, log.NewNopLogger())
+
+	done := make(chan error)
+	go func() {
+		done <- m.Run(ctx, make(chan PathEntry))
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+}
+
+// cancellingBucket cancels a context once it replaced an object.
+type cancellingBucket struct {
+	objstore.Bucket
+	cancel context.CancelFunc
+}
+
+func (b cancellingBucket) GetAndReplace(ctx context.Context, name string, f func(io.Reader) (io.Reader, error)) error {
+	defer b.cancel()
+	return b.Bucket.GetAndReplace(ctx, name, f)
+}
+
+func TestRunReturnsErrorOfUnwrittenBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bucket := objstore.NewInMemBucket()
+	m := NewUpdater(cancellingBucket{Bucket: bucket, cancel: cancel}, tenantID, log.NewNopLogger())
+
+	// The entry spans two windows, and ctx is cancelled once the first one is written.
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	in := make(chan PathEntry, 1)
+	in <- PathEntry{Path: testObjectPath("first"), MinTimestamp: now.Add(-metastoreWindowSize), MaxTimestamp: now}
+	close(in)
+
+	require.ErrorIs(t, m.Run(ctx, in), context.Canceled)
+	require.Len(t, bucket.Objects(), 1)
+}
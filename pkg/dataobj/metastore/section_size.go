@@ -0,0 +1,83 @@
+package metastore
+
+import (
+	"github.com/grafana/dskit/flagext"
+
+	"github.com/grafana/loki/v3/pkg/dataobj/consumer/logsobj"
+)
+
+const (
+	// sectionFillLow and sectionFillHigh bound the fill ratio of logs sections
+	// within which the adaptive target section size is left unchanged.
+	sectionFillLow  = 0.5
+	sectionFillHigh = 0.9
+	// sectionSizeStep is the factor the adaptive target section size is changed by.
+	sectionSizeStep = 1.25
+)
+
+// WithAdaptiveSectionSize makes the [Updater] tune the target size of the
+// logs sections of metastore objects between minSize and maxSize bytes. After
+// every flush, the target shrinks if the sections were on average filled to
+// less than half of it, as with tenants with few streams, and grows if they
+// were filled to at least 90%, as with tenants with many streams, which would
+// otherwise be spread over many sections. The current target is exposed as a
+// metric.
+func WithAdaptiveSectionSize(minSize, maxSize int) UpdaterOption {
+	return func(u *Updater) {
+		maxSize = min(maxSize, int(metastoreBuilderCfg.TargetObjectSize))
+		u.sectionSize = &adaptiveSectionSize{
+			min:    max(minSize, 1),
+			max:    maxSize,
+			target: min(max(int(metastoreBuilderCfg.TargetSectionSize), minSize), maxSize),
+		}
+	}
+}
+
+// adaptiveSectionSize tracks the target section size of an updater.
+type adaptiveSectionSize struct {
+	min, max int
+	target   int
+}
+
+// observe adjusts the target to the fill of the logs sections of a flushed
+// object and returns true if it changed.
+func (a *adaptiveSectionSize) observe(sectionSizes []int) bool {
+	if len(sectionSizes) == 0 {
+		return false
+	}
+
+	var total int
+	for _, size := range sectionSizes {
+		total += size
+	}
+	fill := float64(total) / float64(len(sectionSizes)*a.target)
+
+	previous := a.target
+	switch {
+	case fill < sectionFillLow:
+		a.target = max(int(float64(a.target)/sectionSizeStep), a.min)
+	case fill >= sectionFillHigh:
+		a.target = min(int(float64(a.target)*sectionSizeStep), a.max)
+	}
+	return a.target != previous
+}
+
+// observeFlush adapts the target section size of the builder to the stats of a flush, if enabled.
+func (m *Updater) observeFlush(stats logsobj.FlushStats) {
+	if m.sectionSize == nil || !m.sectionSize.observe(stats.LogsSectionSizes) {
+		return
+	}
+	m.applySectionSize()
+}
+
+// applySectionSize sets the adaptive target section size on the builder.
+func (m *Updater) applySectionSize() {
+	if m.sectionSize == nil {
+		return
+	}
+	m.metrics.targetSectionSize.Set(float64(m.sectionSize.target))
+	if m.metastoreBuilder != nil {
+		// The target is always within the bounds of the builder config.
+		_ = m.metastoreBuilder.SetTargetSectionSize(flagext.Bytes(m.sectionSize.target))
+	}
+}
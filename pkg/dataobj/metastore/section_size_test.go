@@ -0,0 +1,66 @@
+package metastore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestAdaptiveSectionSizeObserve(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		sizes    []int
+		expected int
+	}{
+		{name: "no sections", expected: 1000},
+		{name: "underfilled shrinks", sizes: []int{100}, expected: 800},
+		{name: "filled within bounds", sizes: []int{1000, 400}, expected: 1000},
+		{name: "filled grows", sizes: []int{1000, 1000, 900}, expected: 1250},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := &adaptiveSectionSize{min: 100, max: 2000, target: 1000}
+			require.Equal(t, tc.expected != 1000, a.observe(tc.sizes))
+			require.Equal(t, tc.expected, a.target)
+		})
+	}
+
+	t.Run("shrinks to min", func(t *testing.T) {
+		a := &adaptiveSectionSize{min: 900, max: 1100, target: 1000}
+		require.True(t, a.observe([]int{1}))
+		require.Equal(t, 900, a.target)
+	})
+
+	t.Run("grows to max", func(t *testing.T) {
+		a := &adaptiveSectionSize{min: 900, max: 1100, target: 1000}
+		require.True(t, a.observe([]int{1000}))
+		require.Equal(t, 1100, a.target)
+	})
+}
+
+func TestUpdateWithAdaptiveSectionSize(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+
+	m := NewUpdater(objstore.NewInMemBucket(), tenantID, log.NewNopLogger(), WithAdaptiveSectionSize(1024, 1<<30))
+	initial := int(metastoreBuilderCfg.TargetSectionSize)
+
+	// A few small updates barely fill a section, so the target shrinks.
+	require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+	require.Less(t, m.sectionSize.target, initial)
+	require.Equal(t, float64(m.sectionSize.target), testutil.ToFloat64(m.metrics.targetSectionSize))
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+	}
+	require.Equal(t, 1024, m.sectionSize.target)
+
+	// The target is kept when the builder is released and initialized again.
+	require.NoError(t, m.Close())
+	require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+	require.Equal(t, float64(m.sectionSize.target), testutil.ToFloat64(m.metrics.targetSectionSize))
+}
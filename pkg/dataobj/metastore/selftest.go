@@ -0,0 +1,305 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/loki/v3/pkg/dataobj/sections/streams"
+)
+
+// maxSelfTestSamples is the number of failures of each kind kept as samples in a [Report].
+const maxSelfTestSamples = 10
+
+// FailureKind is the kind of a problem found by [SelfTest].
+type FailureKind string
+
+const (
+	// FailureDecode is a metastore object which can't be decompressed or decoded.
+	FailureDecode FailureKind = "decode"
+	// FailureSchema is a record with invalid labels, a missing or unparseable
+	// start or end, or an invalid dataobj path.
+	FailureSchema FailureKind = "schema"
+	// FailureDangling is a record of a dataobj which doesn't exist in the bucket.
+	FailureDangling FailureKind = "dangling"
+	// FailureConsistency is an object or record which doesn't match the layout
+	// of the metastore: an unexpected object in the metastore directory, a
+	// record outside of the window of its object, or a window missing from or
+	// listed by the manifest without an object.
+	FailureConsistency FailureKind = "consistency"
+)
+
+// Failure is a problem found by [SelfTest].
+type Failure struct {
+	Kind FailureKind
+	// Path is the path of the metastore object or manifest with the problem.
+	Path string
+	// DataobjPath is the dataobj path of the record with the problem, if any.
+	DataobjPath string
+	Err         string
+}
+
+// Report is the result of a [SelfTest] of the metastore of a tenant.
+type Report struct {
+	Objects int // Number of metastore objects checked.
+	Records int // Number of records in the objects which could be decoded.
+
+	// Failures counts the problems found by their kind.
+	Failures map[FailureKind]int
+	// Samples are the first problems found of each kind, in the order they
+	// were found.
+	Samples []Failure
+}
+
+// Healthy returns true if no problems were found.
+func (r Report) Healthy() bool {
+	return len(r.Failures) == 0
+}
+
+func (r *Report) add(f Failure) {
+	if r.Failures[f.Kind] < maxSelfTestSamples {
+		r.Samples = append(r.Samples, f)
+	}
+	r.Failures[f.Kind]++
+}
+
+// SelfTestOption configures optional behaviour of [SelfTest].
+type SelfTestOption func(*selfTest)
+
+// WithSelfTestPathLayout makes [SelfTest] read metastore objects stored with
+// layout instead of [FlatPathLayout].
+func WithSelfTestPathLayout(layout PathLayout) SelfTestOption {
+	return func(t *selfTest) {
+		t.layout = layout
+	}
+}
+
+// WithSelfTestDecodeTransform makes [SelfTest] apply decode to every metastore
+// object it reads, see [WithTransforms].
+func WithSelfTestDecodeTransform(decode Transform) SelfTestOption {
+	return func(t *selfTest) {
+		t.decode = decode
+	}
+}
+
+// WithSelfTestWindowSize makes [SelfTest] check records against windows of
+// size instead of 12h. Invalid sizes, see [ValidateWindowSize], are ignored.
+func WithSelfTestWindowSize(size time.Duration) SelfTestOption {
+	return func(t *selfTest) {
+		if ValidateWindowSize(size) == nil {
+			t.windowSize = size
+		}
+	}
+}
+
+type selfTest struct {
+	bucket     objstore.Bucket
+	tenantID   string
+	layout     PathLayout
+	windowSize time.Duration
+	decode     Transform
+	tombstones bool
+
+	report Report
+	// exists caches whether the dataobjs referenced by records exist, as a
+	// dataobj is referenced by every window it overlaps.
+	exists map[string]bool
+}
+
+// SelfTest reads every metastore object of the tenant in one pass and reports
+// objects which can't be decoded, records which violate the schema, records
+// of dataobjs which don't exist in the bucket, and objects or records which
+// are inconsistent with their window or the manifest of the tenant.
+//
+// Problems are counted in the returned [Report] instead of failing the test,
+// so a single run assesses the whole metastore. SelfTest only returns an error
+// if the bucket can't be read. Objects encoded with [WithTransforms] can't be
+// decoded.
+func SelfTest(ctx context.Context, bucket objstore.Bucket, tenantID string, opts ...SelfTestOption) (Report, error) {
+	t := &selfTest{
+		bucket:     bucket,
+		tenantID:   tenantID,
+		windowSize: metastoreWindowSize,
+		report:     Report{Failures: make(map[FailureKind]int)},
+		exists:     make(map[string]bool),
+	}
+	for _, o := range opts {
+		o(t)
+	}
+
+	windows := make(map[time.Time]struct{})
+	var paths []string // Listed in order, unlike windows.
+	err := t.layout.iter(ctx, bucket, tenantID, func(path string) error {
+		window, err := t.layout.parseWindow(tenantID, path)
+		if err != nil {
+			// Staged objects are left behind by interrupted staged writes.
+			if !strings.HasSuffix(path, stagingSuffix) {
+				t.report.add(Failure{Kind: FailureConsistency, Path: path, Err: err.Error()})
+			}
+			return nil
+		}
+		windows[window] = struct{}{}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return Report{}, errors.Wrap(err, "listing metastore objects")
+	}
+
+	for _, path := range paths {
+		if err := t.checkObject(ctx, path); err != nil {
+			return Report{}, err
+		}
+	}
+
+	t.checkManifest(ctx, paths, windows)
+	return t.report, nil
+}
+
+// checkObject checks the metastore object at path and its records.
+func (t *selfTest) checkObject(ctx context.Context, path string) error {
+	reader, err := t.bucket.Get(ctx, path)
+	if t.bucket.IsObjNotFoundErr(err) {
+		return nil // Deleted since it was listed, e.g. by retention.
+	} else if err != nil {
+		return errors.Wrapf(err, "reading metastore object %s", path)
+	}
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(reader)
+	reader.Close()
+	if err != nil {
+		return errors.Wrapf(err, "reading metastore object %s", path)
+	}
+	t.report.Objects++
+
+	decoded, err := decodeBytes(t.decode, buf.Bytes())
+	if err != nil {
+		t.report.add(Failure{Kind: FailureDecode, Path: path, Err: err.Error()})
+		return nil
+	}
+	object, err := openObject(decoded)
+	if err != nil {
+		t.report.add(Failure{Kind: FailureDecode, Path: path, Err: err.Error()})
+		return nil
+	}
+
+	var tombstoned map[string]struct{}
+	if t.tombstones {
+		if tombstoned, err = readTombstones(ctx, t.bucket, t.tenantID, path); err != nil {
+			t.report.add(Failure{Kind: FailureDecode, Path: path, Err: err.Error()})
+			return nil
+		}
+	}
+
+	window, _ := t.layout.parseWindow(t.tenantID, path)
+	var records []Failure
+	err = replayStreams(ctx, object, 1, func(stream streams.Stream) error {
+		dataobjPath := stream.Labels.Get(labelNamePath)
+		if failure, ok := t.checkRecord(window, stream); !ok {
+			failure.Path, failure.DataobjPath = path, dataobjPath
+			records = append(records, failure)
+			return nil
+		}
+		records = append(records, Failure{DataobjPath: dataobjPath})
+		return nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		t.report.add(Failure{Kind: FailureDecode, Path: path, Err: errors.Wrap(err, "reading metastore object").Error()})
+		return nil
+	}
+
+	// Records are only counted and checked for dangling references once the
+	// whole object could be decoded. Tombstoned dataobjs may already be
+	// deleted, so they aren't checked.
+	t.report.Records += len(records)
+	for _, record := range records {
+		if record.Kind != "" {
+			t.report.add(record)
+			continue
+		}
+		if _, ok := tombstoned[record.DataobjPath]; ok {
+			continue
+		}
+		exists, err := t.dataobjExists(ctx, record.DataobjPath)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			t.report.add(Failure{Kind: FailureDangling, Path: path, DataobjPath: record.DataobjPath, Err: "dataobj not found"})
+		}
+	}
+	return nil
+}
+
+// checkRecord checks the labels of a record of the window starting at window.
+// It returns the kind and error of the first problem found, if any.
+func (t *selfTest) checkRecord(window time.Time, stream streams.Stream) (Failure, bool) {
+	if err := validateLabels(stream.Labels); err != nil {
+		return Failure{Kind: FailureSchema, Err: err.Error()}, false
+	}
+	record, err := parseRecord(stream.Labels)
+	if err != nil {
+		return Failure{Kind: FailureSchema, Err: err.Error()}, false
+	}
+	if err := validateDataobjPath(t.tenantID, record.Path); err != nil {
+		return Failure{Kind: FailureSchema, Err: err.Error()}, false
+	}
+
+	switch {
+	case record.MinTimestamp.After(record.MaxTimestamp):
+		return Failure{Kind: FailureSchema, Err: fmt.Sprintf("start %s is after end %s",
+			record.MinTimestamp.Format(time.RFC3339Nano), record.MaxTimestamp.Format(time.RFC3339Nano))}, false
+	case record.MaxTimestamp.Before(window) || !record.MinTimestamp.Before(window.Add(t.windowSize)):
+		return Failure{Kind: FailureConsistency, Err: fmt.Sprintf("time range %s to %s is outside of the window %s",
+			record.MinTimestamp.Format(time.RFC3339), record.MaxTimestamp.Format(time.RFC3339), window.Format(time.RFC3339))}, false
+	}
+	return Failure{}, true
+}
+
+// dataobjExists returns true if the dataobj at dataobjPath exists in the bucket.
+func (t *selfTest) dataobjExists(ctx context.Context, dataobjPath string) (bool, error) {
+	if exists, ok := t.exists[dataobjPath]; ok {
+		return exists, nil
+	}
+	exists, err := t.bucket.Exists(ctx, dataobjPath)
+	if err != nil {
+		return false, errors.Wrapf(err, "checking dataobj %s exists", dataobjPath)
+	}
+	t.exists[dataobjPath] = exists
+	return exists, nil
+}
+
+// checkManifest checks the manifest of the tenant, if any, lists exactly the
+// windows of the metastore objects at paths.
+func (t *selfTest) checkManifest(ctx context.Context, paths []string, windows map[time.Time]struct{}) {
+	manifest, err := readManifest(ctx, t.bucket, t.tenantID)
+	if t.bucket.IsObjNotFoundErr(err) {
+		return
+	} else if err != nil {
+		t.report.add(Failure{Kind: FailureDecode, Path: manifestPath(t.tenantID), Err: err.Error()})
+		return
+	}
+
+	listed := make(map[time.Time]struct{}, len(manifest.Windows))
+	for _, w := range manifest.Windows {
+		listed[w.Start.UTC()] = struct{}{}
+		if _, ok := windows[w.Start.UTC()]; !ok {
+			t.report.add(Failure{Kind: FailureConsistency, Path: manifestPath(t.tenantID),
+				Err: fmt.Sprintf("manifest lists window %s without a metastore object", w.Start.UTC().Format(time.RFC3339))})
+		}
+	}
+	for _, path := range paths {
+		window, _ := t.layout.parseWindow(t.tenantID, path)
+		if _, ok := listed[window]; !ok {
+			t.report.add(Failure{Kind: FailureConsistency, Path: path, Err: "window is missing from the manifest"})
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/loki/v3/pkg/dataobj"
+	"github.com/grafana/loki/v3/pkg/dataobj/sections/streams"
+)
+
+func TestSelfTest(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	window, _ := WindowFor(now)
+
+	t.Run("healthy", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		require.NoError(t, bucket.Upload(ctx, testObjectPath("a"), bytes.NewReader(nil)))
+
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithManifest())
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now.Add(metastoreWindowSize)))
+
+		report, err := SelfTest(ctx, bucket, tenantID)
+		require.NoError(t, err)
+		require.True(t, report.Healthy(), report.Samples)
+		require.Equal(t, 2, report.Objects)
+		require.Equal(t, 2, report.Records)
+	})
+
+	t.Run("problems", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		require.NoError(t, bucket.Upload(ctx, testObjectPath("a"), bytes.NewReader(nil)))
+
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithManifest())
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+		require.NoError(t, m.Update(ctx, testObjectPath("dangling"), now, now))
+
+		// A window with invalid records, which isn't in the manifest.
+		next := window.Add(metastoreWindowSize)
+		uploadRecords(t, bucket, metastorePath(tenantID, next),
+			labels.FromStrings(labelNameStart, "1", labelNamePath, testObjectPath("a")),
+			labels.FromStrings(labelNameStart, "1", labelNameEnd, "2", labelNamePath, testObjectPath("a")),
+		)
+		require.NoError(t, bucket.Upload(ctx, metastorePath(tenantID, next.Add(metastoreWindowSize)), bytes.NewReader([]byte("corrupt"))))
+		require.NoError(t, bucket.Upload(ctx, metastoreDir(tenantID)+"unexpected", bytes.NewReader(nil)))
+		require.NoError(t, bucket.Upload(ctx, metastorePath(tenantID, window)+stagingSuffix, bytes.NewReader(nil)))
+
+		report, err := SelfTest(ctx, bucket, tenantID)
+		require.NoError(t, err)
+		require.False(t, report.Healthy())
+		require.Equal(t, 3, report.Objects)
+		require.Equal(t, 4, report.Records)
+		require.Equal(t, map[FailureKind]int{
+			FailureDecode:      1,
+			FailureSchema:      1,
+			FailureDangling:    1,
+			FailureConsistency: 4, // The unexpected object, the record outside of its window and two windows missing from the manifest.
+		}, report.Failures)
+		require.Len(t, report.Samples, 7)
+		require.Contains(t, report.Samples, Failure{
+			Kind:        FailureDangling,
+			Path:        metastorePath(tenantID, window),
+			DataobjPath: testObjectPath("dangling"),
+			Err:         "dataobj not found",
+		})
+	})
+
+	t.Run("samples are capped", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger())
+		for i := range maxSelfTestSamples + 5 {
+			require.NoError(t, m.Update(ctx, testObjectPath(string(rune('a'+i))), now, now))
+		}
+
+		report, err := SelfTest(ctx, bucket, tenantID)
+		require.NoError(t, err)
+		require.Equal(t, maxSelfTestSamples+5, report.Failures[FailureDangling])
+		require.Len(t, report.Samples, maxSelfTestSamples)
+	})
+
+	t.Run("date path layout", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		require.NoError(t, bucket.Upload(ctx, testObjectPath("a"), bytes.NewReader(nil)))
+
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithPathLayout(DatePathLayout))
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+
+		report, err := SelfTest(ctx, bucket, tenantID, WithSelfTestPathLayout(DatePathLayout))
+		require.NoError(t, err)
+		require.True(t, report.Healthy(), report.Samples)
+		require.Equal(t, 1, report.Objects)
+	})
+}
+
+// uploadRecords writes a metastore object with a record for each of records to path.
+func uploadRecords(t *testing.T, bucket objstore.Bucket, path string, records ...labels.Labels) {
+	t.Helper()
+
+	streamsBuilder := streams.NewBuilder(streams.NewMetrics(), int(metastoreBuilderCfg.TargetPageSize))
+	for _, lbs := range records {
+		streamsBuilder.Record(lbs, time.Unix(0, 0), 0)
+	}
+	builder := dataobj.NewBuilder()
+	require.NoError(t, builder.Append(streamsBuilder))
+	var buf bytes.Buffer
+	_, err := builder.Flush(&buf)
+	require.NoError(t, err)
+	require.NoError(t, bucket.Upload(context.Background(), path, bytes.NewReader(buf.Bytes())))
+}
@@ -0,0 +1,89 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/loki/v3/pkg/dataobj/consumer/logsobj"
+)
+
+// WithSpeculativeEncode makes [Updater.Update] read, replay and encode the
+// updated metastore object before calling GetAndReplace. Its callback then
+// only checks that the existing object is still the one which was read before
+// returning the encoded object, which minimizes the time spent in the
+// callback while backends may hold a lock on the object. If the object
+// changed in between, e.g. because of a concurrent writer, the callback
+// replays and encodes it again.
+//
+// This costs an extra read of every metastore object written, and objects
+// encoded ahead of time are never flushed with [WithStreamingFlush]. Whether
+// objects were still unchanged is counted in a metric.
+func WithSpeculativeEncode() UpdaterOption {
+	return func(u *Updater) {
+		u.speculativeEncode = true
+	}
+}
+
+// speculativeWrite is a metastore object encoded before GetAndReplace.
+type speculativeWrite struct {
+	// existing is the version of the object the write was encoded from, or
+	// nil if the object didn't exist.
+	existing []byte
+	// object is the compressed new version of the object.
+	object io.Reader
+	stats  logsobj.FlushStats
+}
+
+// prepareSpeculativeWrite reads the metastore object at metastorePath and
+// encodes its new version with entries appended.
+func (m *Updater) prepareSpeculativeWrite(ctx context.Context, metastorePath string, entries []PathEntry) (*speculativeWrite, error) {
+	var (
+		w        speculativeWrite
+		existing io.Reader
+	)
+	reader, err := m.bucket.Get(ctx, metastorePath)
+	if err != nil && !m.bucket.IsObjNotFoundErr(err) {
+		return nil, errors.Wrap(err, "reading metastore object")
+	} else if err == nil {
+		w.existing, err = io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "reading metastore object")
+		}
+		existing = bytes.NewReader(w.existing)
+	}
+
+	encodingDuration, err := m.buildUpdate(ctx, existing, entries)
+	if err != nil {
+		return nil, err
+	}
+	m.buf.Reset()
+	w.stats, err = m.metastoreBuilder.Flush(m.buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "flushing metastore builder")
+	}
+	encodingDuration.ObserveDuration()
+
+	w.object, err = m.compress(m.buf)
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// matches reads existing, the version of the object passed to the
+// GetAndReplace callback, and reports whether it is the version the write was
+// encoded from. If it isn't, the returned reader reads existing again.
+func (w *speculativeWrite) matches(existing io.Reader) (bool, io.Reader, error) {
+	if existing == nil {
+		return w.existing == nil, nil, nil
+	}
+	raw, err := io.ReadAll(existing)
+	if err != nil {
+		return false, nil, errors.Wrap(err, "reading existing metastore version")
+	}
+	return w.existing != nil && bytes.Equal(raw, w.existing), bytes.NewReader(raw), nil
+}
@@ -0,0 +1,78 @@
+package metastore
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/loki/v3/pkg/compression"
+)
+
+// beforeReplaceBucket calls beforeReplace once before the next GetAndReplace.
+type beforeReplaceBucket struct {
+	objstore.Bucket
+	beforeReplace func()
+}
+
+func (b *beforeReplaceBucket) GetAndReplace(ctx context.Context, name string, f func(io.Reader) (io.Reader, error)) error {
+	if b.beforeReplace != nil {
+		beforeReplace := b.beforeReplace
+		b.beforeReplace = nil
+		beforeReplace()
+	}
+	return b.Bucket.GetAndReplace(ctx, name, f)
+}
+
+func TestSpeculativeEncode(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	path := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+
+	t.Run("unchanged", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithSpeculativeEncode())
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+		require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+
+		require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("a"), testObjectPath("b")))
+		require.Equal(t, float64(2), testutil.ToFloat64(m.metrics.speculativeEncodes.WithLabelValues("unchanged")))
+
+		var callback dto.Metric
+		require.NoError(t, m.metrics.getAndReplaceCallback.Write(&callback))
+		require.Equal(t, uint64(2), callback.GetHistogram().GetSampleCount())
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		bucket := &beforeReplaceBucket{Bucket: objstore.NewInMemBucket()}
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithSpeculativeEncode())
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+
+		// Another updater changes the object after it was encoded ahead of time.
+		bucket.beforeReplace = func() {
+			other := NewUpdater(bucket.Bucket, tenantID, log.NewNopLogger())
+			require.NoError(t, other.Update(ctx, testObjectPath("concurrent"), now, now))
+		}
+		require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+
+		require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("a"), testObjectPath("concurrent"), testObjectPath("b")))
+		require.Equal(t, float64(1), testutil.ToFloat64(m.metrics.speculativeEncodes.WithLabelValues("unchanged")))
+		require.Equal(t, float64(1), testutil.ToFloat64(m.metrics.speculativeEncodes.WithLabelValues("changed")))
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithSpeculativeEncode(), WithCompression(compression.Zstd))
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+		require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+
+		require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("a"), testObjectPath("b")))
+		require.Equal(t, float64(2), testutil.ToFloat64(m.metrics.speculativeEncodes.WithLabelValues("unchanged")))
+	})
+}
@@ -0,0 +1,99 @@
+package metastore
+
+import (
+	"context"
+	"io"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+)
+
+// stagingSuffix is appended to the path of a metastore object to get the key it is staged at.
+const stagingSuffix = ".staging"
+
+// errStagedWrite is returned from the GetAndReplace callback once the new
+// object has been staged and renamed onto its path, so GetAndReplace doesn't
+// write it again.
+var errStagedWrite = errors.New("metastore object was written by renaming its staged copy")
+
+// Renamer is implemented by buckets which can atomically replace an object
+// with another one, e.g. with a rename on a filesystem.
+type Renamer interface {
+	Rename(ctx context.Context, from, to string) error
+}
+
+// WithStagedWrites makes the [Updater] upload new versions of metastore
+// objects to a staging key and rename them onto their path once the upload
+// has succeeded, so readers never observe a partially written object. The
+// rename happens while GetAndReplace holds the object, so concurrent updates
+// are still detected. Staging only applies to buckets implementing [Renamer]
+// whose provider overwrites objects in place, like the filesystem; it is a
+// no-op for object stores which replace objects atomically. Staged writes are
+// counted in a metric.
+//
+// None of the objstore buckets implement [Renamer], so this is a no-op unless
+// the bucket passed to [NewUpdater] is a renaming bucket itself: wrappers,
+// including the ones of [WithBucketMiddleware], hide it.
+func WithStagedWrites() UpdaterOption {
+	return func(u *Updater) {
+		u.stagedWrites = true
+	}
+}
+
+// atomicOverwrite returns false for providers whose readers can observe an object while it is overwritten.
+func atomicOverwrite(provider objstore.ObjProvider) bool {
+	return provider != objstore.FILESYSTEM
+}
+
+// renamer returns the bucket as a [Renamer] if new metastore objects should be staged before writing them.
+func (m *Updater) renamer() (Renamer, bool) {
+	if !m.stagedWrites || atomicOverwrite(m.bucket.Provider()) {
+		return nil, false
+	}
+	r, ok := m.bucket.(Renamer)
+	return r, ok
+}
+
+// writeEncoded compresses and encodes the new version of the metastore object at
+// metastorePath for GetAndReplace to write, or stages and writes it itself if
+// staged writes apply. The size of the encoded object is stored in size once
+// it has been written.
+func (m *Updater) writeEncoded(ctx context.Context, metastorePath string, object io.Reader, size *int64) (io.Reader, error) {
+	object, err := m.compress(object)
+	if err != nil {
+		return nil, err
+	}
+	return m.writeCompressed(ctx, metastorePath, object, size)
+}
+
+// writeCompressed is like [Updater.writeEncoded] for an object which is already compressed.
+func (m *Updater) writeCompressed(ctx context.Context, metastorePath string, object io.Reader, size *int64) (io.Reader, error) {
+	encoded, err := m.encode(object)
+	if err != nil {
+		return nil, err
+	}
+	encoded = measure(encoded, size)
+	if renamer, ok := m.renamer(); ok {
+		return nil, m.stageWrite(ctx, renamer, metastorePath, encoded)
+	}
+	return encoded, nil
+}
+
+// stageWrite uploads the new version of the metastore object at metastorePath
+// to its staging key and renames it onto metastorePath. It returns
+// errStagedWrite if the object was written.
+func (m *Updater) stageWrite(ctx context.Context, renamer Renamer, metastorePath string, object io.Reader) error {
+	stagingPath := metastorePath + stagingSuffix
+	if err := m.bucket.Upload(ctx, stagingPath, object); err != nil {
+		return errors.Wrap(err, "uploading staged metastore object")
+	}
+	if err := renamer.Rename(ctx, stagingPath, metastorePath); err != nil {
+		if deleteErr := m.bucket.Delete(ctx, stagingPath); deleteErr != nil {
+			level.Warn(m.logger).Log("msg", "failed to delete staged metastore object", "err", deleteErr, "path", stagingPath)
+		}
+		return errors.Wrap(err, "renaming staged metastore object")
+	}
+	m.metrics.incStagedWrites()
+	return errStagedWrite
+}
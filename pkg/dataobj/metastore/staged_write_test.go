@@ -0,0 +1,86 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/loki/v3/pkg/compression"
+)
+
+// renamingBucket is an in-memory bucket posing as a filesystem, which
+// overwrites objects in place, and implementing Rename. Like the filesystem, it
+// allows writes to other objects during GetAndReplace.
+type renamingBucket struct {
+	*objstore.InMemBucket
+	renames []string
+}
+
+func (b *renamingBucket) GetAndReplace(ctx context.Context, name string, f func(io.Reader) (io.Reader, error)) error {
+	var existing io.Reader
+	if data, ok := b.Objects()[name]; ok {
+		existing = bytes.NewReader(data)
+	}
+	r, err := f(existing)
+	if err != nil {
+		return err
+	}
+	return b.Upload(ctx, name, r)
+}
+
+func (b *renamingBucket) Provider() objstore.ObjProvider { return objstore.FILESYSTEM }
+
+func (b *renamingBucket) Rename(ctx context.Context, from, to string) error {
+	data := b.Objects()[from]
+	if err := b.Upload(ctx, to, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	b.renames = append(b.renames, from+"->"+to)
+	return b.Delete(ctx, from)
+}
+
+func TestUpdateWithStagedWrites(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	path := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+
+	t.Run("overwriting in place", func(t *testing.T) {
+		bucket := &renamingBucket{InMemBucket: objstore.NewInMemBucket()}
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithStagedWrites())
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+		require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+		require.Equal(t, []string{path + stagingSuffix + "->" + path, path + stagingSuffix + "->" + path}, bucket.renames)
+		require.Equal(t, float64(2), testutil.ToFloat64(m.metrics.stagedWrites))
+
+		require.NotContains(t, bucket.Objects(), path+stagingSuffix)
+		require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("a"), testObjectPath("b")))
+	})
+
+	t.Run("upgrading in place", func(t *testing.T) {
+		bucket := &renamingBucket{InMemBucket: objstore.NewInMemBucket()}
+		require.NoError(t, NewUpdater(bucket, tenantID, log.NewNopLogger()).Update(ctx, testObjectPath("a"), now, now))
+
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithStagedWrites(), WithCompression(compression.GZIP))
+		require.NoError(t, m.Upgrade(ctx, tenantID, now))
+		require.Equal(t, []string{path + stagingSuffix + "->" + path}, bucket.renames)
+		require.Equal(t, float64(1), testutil.ToFloat64(m.metrics.stagedWrites))
+		require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("a")))
+	})
+
+	t.Run("overwriting atomically", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithStagedWrites())
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+		require.Zero(t, testutil.ToFloat64(m.metrics.stagedWrites))
+		require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("a")))
+	})
+}
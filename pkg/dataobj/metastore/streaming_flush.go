@@ -0,0 +1,70 @@
+package metastore
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/loki/v3/pkg/dataobj/consumer/logsobj"
+)
+
+// errFlushAborted is returned to the flush goroutine when the upload finished without consuming the whole object.
+var errFlushAborted = errors.New("metastore upload finished before the object was fully streamed")
+
+// WithStreamingFlush makes the [Updater] stream encoded metastore objects into
+// the upload instead of buffering the whole object before uploading it, which
+// avoids holding two copies of large objects in memory. Backends which need to
+// know the content length upfront fall back to buffered flushes, and so do
+// objects compressed with [WithCompression], as they are compressed in memory
+// before the upload: the two options are mutually exclusive.
+func WithStreamingFlush() UpdaterOption {
+	return func(u *Updater) {
+		u.streamingFlush = true
+	}
+}
+
+// requiresContentLength returns true for providers which fail uploads of readers of unknown size.
+func requiresContentLength(provider objstore.ObjProvider) bool {
+	switch provider {
+	case objstore.ALIYUNOSS, objstore.BOS:
+		return true
+	default:
+		return false
+	}
+}
+
+// streamingFlush is a metastore object being flushed by a goroutine while it is read.
+type streamingFlush struct {
+	*io.PipeReader
+	done chan struct{}
+	// stats are the stats of the flush, set once done is closed.
+	stats logsobj.FlushStats
+}
+
+// startStreamingFlush starts flushing the metastore builder into the returned reader,
+// observing encodingDuration once done. [streamingFlush.close] must be called
+// before the builder is used again.
+func (m *Updater) startStreamingFlush(encodingDuration *prometheus.Timer) *streamingFlush {
+	pr, pw := io.Pipe()
+	f := &streamingFlush{PipeReader: pr, done: make(chan struct{})}
+	go func() {
+		defer close(f.done)
+		defer encodingDuration.ObserveDuration()
+		stats, err := m.metastoreBuilder.FlushTo(pw)
+		if err != nil {
+			_ = pw.CloseWithError(errors.Wrap(err, "flushing metastore builder"))
+			return
+		}
+		f.stats = stats
+		_ = pw.Close()
+	}()
+	return f
+}
+
+// close aborts the flush if it is still being read and waits for it to finish.
+func (f *streamingFlush) close() {
+	_ = f.CloseWithError(errFlushAborted)
+	<-f.done
+}
@@ -0,0 +1,134 @@
+package metastore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// ErrWindowLimitReached is returned by [Updater.Update] with
+// [WithMaxTenantWindows] for a dataobj which would create new metastore
+// windows beyond the maximum number of windows of the tenant.
+type ErrWindowLimitReached struct {
+	Windows int // Number of windows of the tenant, including the new ones.
+	Max     int // Maximum number of windows allowed.
+}
+
+func (e *ErrWindowLimitReached) Error() string {
+	return fmt.Sprintf("dataobj would create metastore windows beyond the limit of %d windows per tenant (%d windows)", e.Max, e.Windows)
+}
+
+// WithMaxTenantWindows makes [Updater.Update] reject data objects which would
+// create new metastore windows once the tenant has maxWindows windows, with
+// [ErrWindowLimitReached]. Data objects are still added to existing windows.
+// [Updater.Run] logs and drops rejected data objects, which are counted in a
+// metric. A maxWindows of 0 disables the limit.
+//
+// The windows of the tenant are listed before creating new windows, so
+// updates of existing windows don't list the bucket. Concurrent updaters of
+// the tenant can still exceed the limit by the windows they create at once,
+// and so can updates buffered with [WithBufferedUpdates], as new windows only
+// count towards the limit once they are written.
+func WithMaxTenantWindows(maxWindows int) UpdaterOption {
+	return func(u *Updater) {
+		u.maxTenantWindows = maxWindows
+	}
+}
+
+// checkTenantWindows returns an [ErrWindowLimitReached] if the time range from
+// start to end creates new windows beyond the limit of the tenant. Windows are
+// only tracked as windows of the tenant once they have been written. If
+// pending is not nil, it holds the new windows of other entries written
+// together with this one, which count towards the limit, and the new windows
+// of the time range are added to it.
+func (m *Updater) checkTenantWindows(ctx context.Context, start, end time.Time, pending map[string]struct{}) error {
+	if m.maxTenantWindows <= 0 {
+		return nil
+	}
+
+	listed := false
+	if m.tenantWindows == nil {
+		if err := m.listTenantWindows(ctx); err != nil {
+			level.Warn(m.logger).Log("msg", "failed to list metastore windows, not enforcing window limit", "err", err)
+			return nil
+		}
+		listed = true
+	}
+
+	newWindows := m.newWindows(start, end)
+	if len(newWindows) > 0 && !listed {
+		// List the windows again before creating new ones, as windows may
+		// have been created by other updaters or deleted by retention.
+		if err := m.listTenantWindows(ctx); err != nil {
+			level.Warn(m.logger).Log("msg", "failed to list metastore windows, not enforcing window limit", "err", err)
+			return nil
+		}
+		newWindows = m.newWindows(start, end)
+	}
+	if len(newWindows) == 0 {
+		return nil
+	}
+
+	created := make(map[string]struct{}, len(pending)+len(newWindows))
+	for metastorePath := range pending {
+		if _, ok := m.tenantWindows[metastorePath]; !ok {
+			created[metastorePath] = struct{}{}
+		}
+	}
+	for _, metastorePath := range newWindows {
+		created[metastorePath] = struct{}{}
+	}
+	if windows := len(m.tenantWindows) + len(created); windows > m.maxTenantWindows {
+		m.metrics.incWindowLimitReached()
+		return &ErrWindowLimitReached{Windows: windows, Max: m.maxTenantWindows}
+	}
+
+	if pending != nil {
+		for _, metastorePath := range newWindows {
+			pending[metastorePath] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// trackTenantWindow tracks the window at metastorePath as a window of the tenant once it has been written.
+func (m *Updater) trackTenantWindow(metastorePath string) {
+	if m.tenantWindows != nil {
+		m.tenantWindows[metastorePath] = struct{}{}
+	}
+}
+
+// newWindows returns the paths of the windows from start to end which aren't windows of the tenant yet.
+func (m *Updater) newWindows(start, end time.Time) []string {
+	var paths []string
+	for metastorePath := range iterStorePaths(m.layout, m.tenantID, start, end, m.windowSize) {
+		if _, ok := m.tenantWindows[metastorePath]; !ok {
+			paths = append(paths, metastorePath)
+		}
+	}
+	return paths
+}
+
+// listTenantWindows replaces the tracked windows of the tenant with the metastore objects in the bucket.
+func (m *Updater) listTenantWindows(ctx context.Context) error {
+	windows := make(map[string]struct{})
+	err := m.layout.iter(ctx, m.bucket, m.tenantID, func(path string) error {
+		if _, err := m.layout.parseWindow(m.tenantID, path); err == nil {
+			windows[path] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "listing metastore objects")
+	}
+	m.tenantWindows = windows
+	return nil
+}
+
+// forgetTenantWindow stops tracking the window at metastorePath, e.g. once it has been deleted.
+func (m *Updater) forgetTenantWindow(metastorePath string) {
+	delete(m.tenantWindows, metastorePath)
+}
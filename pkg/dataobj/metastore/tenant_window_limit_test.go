@@ -0,0 +1,99 @@
+package metastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestUpdateWithMaxTenantWindows(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	next := start.Add(metastoreWindowSize)
+
+	t.Run("rejects new windows beyond the limit", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithMaxTenantWindows(2))
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), start, next))
+		require.Len(t, bucket.Objects(), 2)
+
+		err := m.Update(ctx, testObjectPath("b"), next, next.Add(metastoreWindowSize))
+		var limitReached *ErrWindowLimitReached
+		require.True(t, errors.As(err, &limitReached))
+		require.Equal(t, 3, limitReached.Windows)
+		require.Equal(t, 2, limitReached.Max)
+		require.Len(t, bucket.Objects(), 2, "expected no windows to be written")
+		require.Equal(t, float64(1), testutil.ToFloat64(m.metrics.windowLimitReached))
+
+		// Existing windows are still updated.
+		require.NoError(t, m.Update(ctx, testObjectPath("c"), next, next))
+		require.NoError(t, m.verifyWrite(ctx, WindowPath(tenantID, next), testObjectPath("a"), testObjectPath("c")))
+	})
+
+	t.Run("counts windows created by other updaters", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithMaxTenantWindows(2))
+		other := NewUpdater(bucket, tenantID, log.NewNopLogger())
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), start, start))
+		require.NoError(t, other.Update(ctx, testObjectPath("b"), next, next))
+
+		err := m.Update(ctx, testObjectPath("c"), next.Add(metastoreWindowSize), next.Add(metastoreWindowSize))
+		require.ErrorAs(t, err, new(*ErrWindowLimitReached))
+	})
+
+	t.Run("doesn't count windows of rejected batches", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithMaxTenantWindows(2))
+		other := NewUpdater(bucket, tenantID, log.NewNopLogger())
+		third := next.Add(metastoreWindowSize)
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), start, start))
+		// The second entry rejects the batch, so the window of the first one isn't written.
+		err := m.UpdateBatch(ctx, []PathEntry{
+			{Path: testObjectPath("b"), MinTimestamp: next, MaxTimestamp: next},
+			{Path: testObjectPath("c"), MinTimestamp: third, MaxTimestamp: third},
+		})
+		require.ErrorAs(t, err, new(*ErrWindowLimitReached))
+		require.Len(t, bucket.Objects(), 1)
+
+		// The window of the rejected entry is still new, so the window created
+		// in the meantime is counted before creating it.
+		require.NoError(t, other.Update(ctx, testObjectPath("d"), third, third))
+		err = m.Update(ctx, testObjectPath("b"), next, next)
+		require.ErrorAs(t, err, new(*ErrWindowLimitReached))
+		require.Len(t, bucket.Objects(), 2)
+	})
+
+	t.Run("frees windows deleted by retention", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithMaxTenantWindows(1))
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), start, start))
+		deleted, err := m.EnforceRetention(ctx, next)
+		require.NoError(t, err)
+		require.Equal(t, 1, deleted)
+
+		require.NoError(t, m.Update(ctx, testObjectPath("b"), next, next))
+		require.Zero(t, testutil.ToFloat64(m.metrics.windowLimitReached))
+	})
+
+	t.Run("frees windows emptied by remove", func(t *testing.T) {
+		bucket := objstore.NewInMemBucket()
+		m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithMaxTenantWindows(1))
+
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), start, start))
+		require.NoError(t, m.Remove(ctx, testObjectPath("a"), start, start))
+		require.Empty(t, bucket.Objects())
+
+		require.NoError(t, m.Update(ctx, testObjectPath("b"), next, next))
+		require.Zero(t, testutil.ToFloat64(m.metrics.windowLimitReached))
+	})
+}
@@ -0,0 +1,58 @@
+package metastore
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/thanos-io/objstore"
+)
+
+const tenantDirPrefix = "tenant-"
+
+// errStopIter is used to stop iterating a bucket early.
+var errStopIter = errors.New("stop iterating")
+
+// ListTenants returns the IDs of all tenants which have a metastore directory in the bucket.
+func ListTenants(ctx context.Context, bucket objstore.Bucket) ([]string, error) {
+	var tenants []string
+	err := bucket.Iter(ctx, "", func(dir string) error {
+		tenantID, ok := strings.CutPrefix(dir, tenantDirPrefix)
+		if !ok {
+			return nil
+		}
+		tenantID, ok = strings.CutSuffix(tenantID, objstore.DirDelim)
+		if !ok || tenantID == "" {
+			return nil // Not a directory.
+		}
+
+		found, err := hasMetastoreDir(ctx, bucket, tenantID)
+		if err != nil {
+			return err
+		}
+		if found {
+			tenants = append(tenants, tenantID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
+
+// hasMetastoreDir returns true if the tenant directory contains a metastore directory.
+func hasMetastoreDir(ctx context.Context, bucket objstore.Bucket, tenantID string) (bool, error) {
+	var found bool
+	err := bucket.Iter(ctx, tenantDir(tenantID), func(path string) error {
+		if path == metastoreDir(tenantID) {
+			found = true
+			return errStopIter
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopIter) {
+		return false, err
+	}
+	return found, nil
+}
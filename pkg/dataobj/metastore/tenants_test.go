@@ -0,0 +1,31 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestListTenants(t *testing.T) {
+	ctx := context.Background()
+	bucket := objstore.NewInMemBucket()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+
+	for _, tenant := range []string{"tenant2", "tenant1", "tenant3"} {
+		m := NewUpdater(bucket, tenant, log.NewNopLogger())
+		require.NoError(t, m.Update(ctx, tenantDir(tenant)+"objects/path", now, now))
+	}
+	// Tenants without metastore objects and unrelated objects are ignored.
+	require.NoError(t, bucket.Upload(ctx, "tenant-no-metastore/objects/abc", bytes.NewReader([]byte("data"))))
+	require.NoError(t, bucket.Upload(ctx, "other/metastore/abc", bytes.NewReader([]byte("data"))))
+	require.NoError(t, bucket.Upload(ctx, "tenant-file", bytes.NewReader([]byte("data"))))
+
+	tenants, err := ListTenants(ctx, bucket)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"tenant1", "tenant2", "tenant3"}, tenants)
+}
@@ -0,0 +1,294 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/thanos-io/objstore"
+)
+
+// WithTombstones makes [Updater.Remove] tombstone the removed dataobj in a
+// tombstones object next to every window instead of rewriting the windows, so
+// a removal only appends the path of the dataobj to a small JSON object.
+// Readers configured with [WithQuerierTombstones],
+// [WithObjectMetastoreTombstones] or [WithSelfTestTombstones] exclude
+// tombstoned dataobjs, so these disappear from reads right away, while their
+// records stay in the window until [Updater.CompactTombstones] drops them.
+// [Querier.TombstoneCounts] reports the tombstones of every window, to decide
+// which windows to compact. Updating a window with a tombstoned dataobj
+// clears its tombstone.
+//
+// Other readers, including those of older versions, keep returning
+// tombstoned dataobjs until the tombstones are compacted.
+func WithTombstones() UpdaterOption {
+	return func(u *Updater) {
+		u.tombstones = true
+	}
+}
+
+// WithQuerierTombstones makes the [Querier] exclude dataobjs tombstoned by
+// updaters with [WithTombstones]. Reading a window reads its tombstones too,
+// which costs a request per window.
+func WithQuerierTombstones() QuerierOption {
+	return func(q *Querier) {
+		q.tombstones = true
+	}
+}
+
+// WithObjectMetastoreTombstones makes the [ObjectMetastore] exclude dataobjs
+// tombstoned by updaters with [WithTombstones], like [WithQuerierTombstones].
+func WithObjectMetastoreTombstones() ObjectMetastoreOption {
+	return func(m *ObjectMetastore) {
+		m.tombstones = true
+	}
+}
+
+// WithSelfTestTombstones makes [SelfTest] skip the dangling reference check
+// of dataobjs tombstoned by updaters with [WithTombstones], as these may
+// already be deleted.
+func WithSelfTestTombstones() SelfTestOption {
+	return func(t *selfTest) {
+		t.tombstones = true
+	}
+}
+
+// windowTombstones is the tombstones object of a metastore window.
+type windowTombstones struct {
+	Paths []string `json:"paths"`
+}
+
+// tombstonesPath returns the path of the tombstones object of the metastore
+// object of the tenant at metastorePath. It is kept outside of the metastore
+// directory so listing windows doesn't return it.
+func tombstonesPath(tenantID, metastorePath string) string {
+	name := strings.TrimPrefix(metastorePath, metastoreDir(tenantID))
+	return tenantDir(tenantID) + "metastore-tombstones/" + strings.TrimSuffix(name, ".store") + ".json"
+}
+
+// readTombstones returns the dataobj paths tombstoned in the metastore object
+// of the tenant at metastorePath. Windows without a tombstones object have no
+// tombstones.
+func readTombstones(ctx context.Context, bucket objstore.Bucket, tenantID, metastorePath string) (map[string]struct{}, error) {
+	reader, err := bucket.Get(ctx, tombstonesPath(tenantID, metastorePath))
+	if bucket.IsObjNotFoundErr(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading tombstones of metastore object %s: %w", metastorePath, err)
+	}
+	defer reader.Close()
+
+	var tombstones windowTombstones
+	if err := json.NewDecoder(reader).Decode(&tombstones); err != nil {
+		return nil, fmt.Errorf("decoding tombstones of metastore object %s: %w", metastorePath, err)
+	}
+	tombstoned := make(map[string]struct{}, len(tombstones.Paths))
+	for _, path := range tombstones.Paths {
+		tombstoned[path] = struct{}{}
+	}
+	return tombstoned, nil
+}
+
+// tombstoneWindow tombstones dataobjPath in the metastore object at
+// metastorePath. It returns errNothingToRemove if the object doesn't exist or
+// dataobjPath is already tombstoned.
+func (m *Updater) tombstoneWindow(ctx context.Context, metastorePath, dataobjPath string) error {
+	exists, err := m.bucket.Exists(ctx, metastorePath)
+	if err != nil {
+		return errors.Wrap(err, "checking metastore object")
+	}
+	if !exists {
+		return errNothingToRemove
+	}
+	m.metrics.incOperations(operationRemove)
+	return m.replaceTombstones(ctx, metastorePath, func(paths []string) ([]string, bool) {
+		if slices.Contains(paths, dataobjPath) {
+			return paths, false
+		}
+		return append(paths, dataobjPath), true
+	})
+}
+
+// clearTombstones clears the tombstones of the dataobjs of entries in the
+// metastore object at metastorePath, as they are added to it again.
+func (m *Updater) clearTombstones(ctx context.Context, metastorePath string, entries []PathEntry) error {
+	added := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		added[entry.Path] = struct{}{}
+	}
+	err := m.dropTombstones(ctx, metastorePath, added)
+	if errors.Is(err, errNothingToRemove) {
+		return nil
+	}
+	return err
+}
+
+// dropTombstones drops the tombstones of paths from the metastore object at
+// metastorePath. It returns errNothingToRemove if none of paths are
+// tombstoned.
+func (m *Updater) dropTombstones(ctx context.Context, metastorePath string, paths map[string]struct{}) error {
+	return m.replaceTombstones(ctx, metastorePath, func(tombstoned []string) ([]string, bool) {
+		n := len(tombstoned)
+		tombstoned = slices.DeleteFunc(tombstoned, func(path string) bool {
+			_, ok := paths[path]
+			return ok
+		})
+		return tombstoned, len(tombstoned) != n
+	})
+}
+
+// replaceTombstones applies f to the tombstoned paths of the metastore object
+// at metastorePath and writes the result back atomically. f reports whether it
+// changed the paths, and errNothingToRemove is returned if it didn't.
+// Tombstones objects left without paths are deleted, see
+// [Updater.deleteIfUnchanged], and f is applied again if they changed in the
+// meantime.
+func (m *Updater) replaceTombstones(ctx context.Context, metastorePath string, f func(paths []string) ([]string, bool)) error {
+	path := tombstonesPath(m.tenantID, metastorePath)
+	for {
+		read := xxhash.New()
+		err := m.bucket.GetAndReplace(ctx, path, func(existing io.Reader) (io.Reader, error) {
+			var tombstones windowTombstones
+			if existing != nil {
+				existing = io.TeeReader(existing, read)
+				if err := json.NewDecoder(existing).Decode(&tombstones); err != nil {
+					return nil, errors.Wrap(err, "decoding tombstones")
+				}
+				// Hash the rest of the object too, so it is compared whole.
+				if _, err := io.Copy(io.Discard, existing); err != nil {
+					return nil, errors.Wrap(err, "reading tombstones")
+				}
+			}
+
+			paths, changed := f(tombstones.Paths)
+			if !changed {
+				return nil, errNothingToRemove
+			}
+			if len(paths) == 0 {
+				return nil, errObjectEmptied
+			}
+			tombstones.Paths = paths
+			data, err := json.Marshal(tombstones)
+			if err != nil {
+				return nil, errors.Wrap(err, "encoding tombstones")
+			}
+			return bytes.NewReader(data), nil
+		})
+		if errors.Is(err, errObjectEmptied) {
+			err = m.deleteIfUnchanged(ctx, path, read.Sum64())
+		}
+		if !errors.Is(err, errObjectChanged) {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// CompactTombstones drops the records of the dataobjs tombstoned in the
+// metastore windows overlapping start to end, and then their tombstones, see
+// [WithTombstones]. Windows without tombstones are left as is, and windows
+// left without records are deleted like in [Updater.Remove]. Each window is
+// retried on failure like in [Updater.Update]. It returns the number of
+// tombstones dropped.
+func (m *Updater) CompactTombstones(ctx context.Context, start, end time.Time) (int, error) {
+	if err := m.initBuilder(); err != nil {
+		return 0, err
+	}
+	m.acquireBuffer()
+	defer m.releaseBuffer()
+
+	var compacted int
+	for metastorePath := range iterStorePaths(m.layout, m.tenantID, start, end, m.windowSize) {
+		n, err := m.compactWindow(ctx, metastorePath)
+		if err != nil {
+			return compacted, err
+		}
+		compacted += n
+	}
+	return compacted, nil
+}
+
+// compactWindow drops the records of the dataobjs tombstoned in the metastore
+// object at metastorePath, and then the tombstones. It returns the number of
+// tombstones dropped.
+func (m *Updater) compactWindow(ctx context.Context, metastorePath string) (int, error) {
+	tombstoned, err := readTombstones(ctx, m.bucket, m.tenantID, metastorePath)
+	if err != nil {
+		return 0, err
+	}
+	if len(tombstoned) == 0 {
+		return 0, nil
+	}
+
+	_, size, err := m.rewriteWindow(ctx, metastorePath, func(existing io.Reader) (int, error) {
+		kept, removed, err := m.replayExisting(ctx, existing, func(lbs labels.Labels) bool {
+			_, ok := tombstoned[lbs.Get(labelNamePath)]
+			return ok
+		})
+		if err == nil && removed == 0 {
+			err = errNothingToRemove
+		}
+		return kept, err
+	})
+	rewritten := err == nil
+	if err != nil && !errors.Is(err, errNothingToRemove) {
+		return 0, err
+	}
+
+	// Tombstones added since they were read are kept for the next compaction.
+	if err := m.dropTombstones(ctx, metastorePath, tombstoned); err != nil && !errors.Is(err, errNothingToRemove) {
+		return 0, errors.Wrap(err, "dropping compacted tombstones")
+	}
+
+	level.Info(m.logger).Log("msg", "compacted metastore tombstones", "metastore", metastorePath, "tombstones", len(tombstoned))
+	if rewritten {
+		paths := slices.Sorted(maps.Keys(tombstoned))
+		records := make([]JournalRecord, 0, len(paths))
+		for _, path := range paths {
+			record := m.journalRecord(JournalOperationRemove, metastorePath, size)
+			record.Path = path
+			records = append(records, record)
+		}
+		m.recordJournal(ctx, records)
+	}
+	return len(tombstoned), nil
+}
+
+// readTombstones returns the dataobj paths tombstoned in the metastore object
+// of the tenant at path, if the [Querier] reads tombstones.
+func (q *Querier) readTombstones(ctx context.Context, tenantID, path string) (map[string]struct{}, error) {
+	if !q.tombstones {
+		return nil, nil
+	}
+	return readTombstones(ctx, q.bucket, tenantID, path)
+}
+
+// TombstoneCounts returns the number of tombstones of every metastore window
+// of the tenant overlapping start to end, by the start of the window, see
+// [WithTombstones]. Windows without tombstones are left out.
+func (q *Querier) TombstoneCounts(ctx context.Context, tenantID string, start, end time.Time) (map[time.Time]int, error) {
+	counts := make(map[time.Time]int)
+	for path := range iterStorePaths(q.layout, tenantID, start, end, q.windowSize) {
+		tombstoned, err := readTombstones(ctx, q.bucket, tenantID, path)
+		if err != nil {
+			return nil, err
+		}
+		if len(tombstoned) > 0 {
+			window, _ := q.layout.parseWindow(tenantID, path)
+			counts[window] = len(tombstoned)
+		}
+	}
+	return counts, nil
+}
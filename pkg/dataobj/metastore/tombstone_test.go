@@ -0,0 +1,176 @@
+package metastore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/user"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestTombstones(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), tenantID)
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	first, _ := WindowFor(now)
+	second := first.Add(metastoreWindowSize)
+
+	bucket := objstore.NewInMemBucket()
+	journalBucket := objstore.NewInMemBucket()
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithTombstones(), WithJournal(NewBucketJournal(journalBucket)))
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, m.Update(ctx, testObjectPath(name), now, now))
+	}
+	require.NoError(t, m.Update(ctx, testObjectPath("d"), now, now.Add(metastoreWindowSize)))
+	for _, path := range []string{testObjectPath("a"), testObjectPath("b"), testObjectPath("c"), testObjectPath("d")} {
+		require.NoError(t, bucket.Upload(ctx, path, strings.NewReader("")))
+	}
+
+	t.Run("tombstones the path without rewriting windows", func(t *testing.T) {
+		before := bucket.Objects()
+		require.NoError(t, m.Remove(ctx, testObjectPath("b"), now, now))
+		require.NoError(t, m.Remove(ctx, testObjectPath("d"), now, now.Add(metastoreWindowSize)))
+
+		for _, window := range []time.Time{first, second} {
+			require.Equal(t, before[metastorePath(tenantID, window)], bucket.Objects()[metastorePath(tenantID, window)])
+		}
+		require.Equal(t, float64(3), testutil.ToFloat64(m.metrics.operations.WithLabelValues(string(operationRemove))))
+		for _, record := range readJournal(t, journalBucket) {
+			require.NotEqual(t, JournalOperationRemove, record.Operation, "expected no windows to be mutated")
+		}
+
+		counts, err := NewQuerier(bucket, log.NewNopLogger()).TombstoneCounts(ctx, tenantID, now, now.Add(metastoreWindowSize))
+		require.NoError(t, err)
+		require.Equal(t, map[time.Time]int{first: 2, second: 1}, counts)
+	})
+
+	t.Run("paths already tombstoned are left as is", func(t *testing.T) {
+		before := bucket.Objects()[tombstonesPath(tenantID, metastorePath(tenantID, first))]
+		require.NoError(t, m.Remove(ctx, testObjectPath("b"), now, now))
+		require.Equal(t, before, bucket.Objects()[tombstonesPath(tenantID, metastorePath(tenantID, first))])
+	})
+
+	t.Run("missing windows aren't tombstoned", func(t *testing.T) {
+		third := second.Add(metastoreWindowSize)
+		require.NoError(t, m.Remove(ctx, testObjectPath("a"), third, third))
+		require.NotContains(t, bucket.Objects(), tombstonesPath(tenantID, metastorePath(tenantID, third)))
+	})
+
+	t.Run("readers exclude tombstoned paths", func(t *testing.T) {
+		live := []string{testObjectPath("a"), testObjectPath("c")}
+
+		for _, opts := range [][]QuerierOption{nil, {WithObjectCache(10)}} {
+			q := NewQuerier(bucket, log.NewNopLogger(), append(opts, WithQuerierTombstones())...)
+			paths, err := q.Paths(ctx, tenantID, now, now.Add(metastoreWindowSize))
+			require.NoError(t, err)
+			require.ElementsMatch(t, live, paths)
+
+			paths, hasMore, err := q.DataObjPathsPage(ctx, tenantID, now, 0, 1)
+			require.NoError(t, err)
+			require.Equal(t, live[:1], paths)
+			require.True(t, hasMore)
+
+			paths, hasMore, err = q.DataObjPathsPage(ctx, tenantID, now, 1, 10)
+			require.NoError(t, err)
+			require.Equal(t, live[1:], paths)
+			require.False(t, hasMore)
+		}
+
+		objects, err := NewObjectMetastore(bucket, WithObjectMetastoreTombstones()).DataObjects(ctx, now, now.Add(metastoreWindowSize))
+		require.NoError(t, err)
+		require.ElementsMatch(t, live, objects)
+
+		// Readers which don't read tombstones return tombstoned paths until
+		// they are compacted.
+		paths, err := NewQuerier(bucket, log.NewNopLogger()).Paths(ctx, tenantID, now, now.Add(metastoreWindowSize))
+		require.NoError(t, err)
+		require.Len(t, paths, 4)
+	})
+
+	t.Run("self test doesn't report deleted tombstoned dataobjs", func(t *testing.T) {
+		require.NoError(t, bucket.Delete(ctx, testObjectPath("b")))
+		require.NoError(t, bucket.Delete(ctx, testObjectPath("d")))
+
+		report, err := SelfTest(ctx, bucket, tenantID, WithSelfTestTombstones())
+		require.NoError(t, err)
+		require.Empty(t, report.Failures)
+		require.Equal(t, 5, report.Records)
+	})
+
+	t.Run("compaction drops tombstoned records", func(t *testing.T) {
+		compacted, err := m.CompactTombstones(ctx, now, now.Add(metastoreWindowSize))
+		require.NoError(t, err)
+		require.Equal(t, 3, compacted)
+
+		require.NoError(t, m.verifyWrite(ctx, metastorePath(tenantID, first), testObjectPath("a"), testObjectPath("c")))
+		require.Error(t, m.verifyWrite(ctx, metastorePath(tenantID, first), testObjectPath("b")))
+		require.Error(t, m.verifyWrite(ctx, metastorePath(tenantID, first), testObjectPath("d")))
+		// The second window is left without records, so it is deleted.
+		require.NotContains(t, bucket.Objects(), metastorePath(tenantID, second))
+		for _, window := range []time.Time{first, second} {
+			require.NotContains(t, bucket.Objects(), tombstonesPath(tenantID, metastorePath(tenantID, window)))
+		}
+
+		counts, err := NewQuerier(bucket, log.NewNopLogger()).TombstoneCounts(ctx, tenantID, now, now.Add(metastoreWindowSize))
+		require.NoError(t, err)
+		require.Empty(t, counts)
+
+		var removed []string
+		for _, record := range readJournal(t, journalBucket) {
+			if record.Operation == JournalOperationRemove {
+				removed = append(removed, fmt.Sprintf("%s %s", record.Metastore, record.Path))
+			}
+		}
+		require.ElementsMatch(t, []string{
+			fmt.Sprintf("%s %s", metastorePath(tenantID, first), testObjectPath("b")),
+			fmt.Sprintf("%s %s", metastorePath(tenantID, first), testObjectPath("d")),
+			fmt.Sprintf("%s %s", metastorePath(tenantID, second), testObjectPath("d")),
+		}, removed)
+	})
+
+	t.Run("windows without tombstones are left as is", func(t *testing.T) {
+		before := bucket.Objects()[metastorePath(tenantID, first)]
+		compacted, err := m.CompactTombstones(ctx, now, now.Add(metastoreWindowSize))
+		require.NoError(t, err)
+		require.Zero(t, compacted)
+		require.Equal(t, before, bucket.Objects()[metastorePath(tenantID, first)])
+	})
+
+	t.Run("updates clear the tombstones of re-added paths", func(t *testing.T) {
+		require.NoError(t, m.Remove(ctx, testObjectPath("c"), now, now))
+		require.NoError(t, m.Update(ctx, testObjectPath("c"), now, now))
+
+		paths, err := NewQuerier(bucket, log.NewNopLogger(), WithQuerierTombstones()).Paths(ctx, tenantID, now, now)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{testObjectPath("a"), testObjectPath("c")}, paths)
+		require.NotContains(t, bucket.Objects(), tombstonesPath(tenantID, metastorePath(tenantID, first)))
+
+		compacted, err := m.CompactTombstones(ctx, now, now)
+		require.NoError(t, err)
+		require.Zero(t, compacted)
+		require.NoError(t, m.verifyWrite(ctx, metastorePath(tenantID, first), testObjectPath("c")))
+	})
+}
+
+func TestEnforceRetentionDeletesTombstones(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	path := WindowPath(tenantID, now)
+
+	bucket := objstore.NewInMemBucket()
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithTombstones())
+	require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+	require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+	require.NoError(t, m.Remove(ctx, testObjectPath("b"), now, now))
+	require.Contains(t, bucket.Objects(), tombstonesPath(tenantID, path))
+
+	deleted, err := m.EnforceRetention(ctx, now.Add(metastoreWindowSize))
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+	require.Empty(t, bucket.Objects())
+}
@@ -0,0 +1,104 @@
+package metastore
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thanos-io/objstore"
+)
+
+// Transform transforms the bytes of a metastore object, e.g. to decrypt or
+// encrypt objects stored encrypted at the application layer.
+type Transform func(io.Reader) (io.Reader, error)
+
+// WithTransforms makes the [Updater] apply decode to every metastore object it
+// reads before decoding it as a data object, and encode to every metastore
+// object it writes before uploading it. A nil transform leaves objects as is.
+//
+// Every reader of the bucket needs the same decode transform, see
+// [WithObjectMetastoreDecodeTransform], [WithQuerierDecodeTransform],
+// [WithSelfTestDecodeTransform], [WithDumpDecodeTransform] and
+// [MergeWithTransforms].
+func WithTransforms(decode, encode Transform) UpdaterOption {
+	return func(u *Updater) {
+		u.decodeTransform = decode
+		u.encodeTransform = encode
+	}
+}
+
+// decode applies the decode transform to a metastore object read from the
+// bucket. The bytes read from the bucket are counted as they are consumed.
+func (m *Updater) decode(r io.Reader) (io.Reader, error) {
+	return decodeWith(m.decodeTransform, &countingReader{r: r, counter: m.metrics.bytesRead})
+}
+
+// decodeWith applies decode, if any, to a metastore object read from the bucket.
+func decodeWith(decode Transform, r io.Reader) (io.Reader, error) {
+	if decode == nil {
+		return r, nil
+	}
+	decoded, err := decode(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding metastore object")
+	}
+	return decoded, nil
+}
+
+// decodeBytes returns a buffer holding the metastore object data decoded with
+// decode, if any. The buffer never shares memory with data.
+func decodeBytes(decode Transform, data []byte) (*bytes.Buffer, error) {
+	if decode == nil {
+		return bytes.NewBuffer(bytes.Clone(data)), nil
+	}
+	decoded, err := decodeWith(decode, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(decoded); err != nil {
+		return nil, errors.Wrap(err, "decoding metastore object")
+	}
+	return &buf, nil
+}
+
+// encodeWith applies encode, if any, to a metastore object written to the bucket.
+func encodeWith(encode Transform, r io.Reader) (io.Reader, error) {
+	if encode == nil {
+		return r, nil
+	}
+	encoded, err := encode(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding metastore object")
+	}
+	return encoded, nil
+}
+
+// encode applies the encode transform to a metastore object written to the
+// bucket and counts the bytes written.
+func (m *Updater) encode(r io.Reader) (io.Reader, error) {
+	r, err := encodeWith(m.encodeTransform, r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Readers of known size are returned as is, so uploads can still determine their size.
+	if size, err := objstore.TryToGetSize(r); err == nil {
+		m.metrics.bytesWritten.Add(float64(size))
+		return r, nil
+	}
+	return &countingReader{r: r, counter: m.metrics.bytesWritten}, nil
+}
+
+// countingReader adds the number of bytes read from r to counter.
+type countingReader struct {
+	r       io.Reader
+	counter prometheus.Counter
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.counter.Add(float64(n))
+	return n, err
+}
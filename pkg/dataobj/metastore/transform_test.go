@@ -0,0 +1,143 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/user"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/loki/v3/pkg/compression"
+	"github.com/grafana/loki/v3/pkg/dataobj"
+)
+
+// xorTransform flips all bits, standing in for encryption and decryption.
+func xorTransform(r io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := range data {
+		data[i] ^= 0xff
+	}
+	return bytes.NewReader(data), nil
+}
+
+func TestUpdateTransforms(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	path := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+
+	bucket := objstore.NewInMemBucket()
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithTransforms(xorTransform, xorTransform))
+	require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+	require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+
+	// The stored object is only readable once decoded.
+	stored := bucket.Objects()[path]
+	_, err := dataobj.FromReaderAt(bytes.NewReader(stored), int64(len(stored)))
+	require.Error(t, err)
+	decoded, err := xorTransform(bytes.NewReader(stored))
+	require.NoError(t, err)
+	plain, err := io.ReadAll(decoded)
+	require.NoError(t, err)
+	_, err = dataobj.FromReaderAt(bytes.NewReader(plain), int64(len(plain)))
+	require.NoError(t, err)
+
+	require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("a"), testObjectPath("b")))
+
+	require.NoError(t, m.Upgrade(ctx, tenantID, now))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.metrics.upgrades.WithLabelValues(string(upgradeStatusSkipped))))
+}
+
+func TestUpdateCountsBytes(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	path := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+
+	for _, tc := range []struct {
+		name string
+		opts []UpdaterOption
+	}{
+		{name: "buffered"},
+		{name: "streaming", opts: []UpdaterOption{WithStreamingFlush()}},
+		{name: "transformed", opts: []UpdaterOption{WithTransforms(xorTransform, xorTransform)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			bucket := objstore.NewInMemBucket()
+			m := NewUpdater(bucket, tenantID, log.NewNopLogger(), tc.opts...)
+
+			require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+			first := len(bucket.Objects()[path])
+			require.Zero(t, testutil.ToFloat64(m.metrics.bytesRead))
+			require.Equal(t, float64(first), testutil.ToFloat64(m.metrics.bytesWritten))
+
+			require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+			second := len(bucket.Objects()[path])
+			require.Equal(t, float64(first), testutil.ToFloat64(m.metrics.bytesRead))
+			require.Equal(t, float64(first+second), testutil.ToFloat64(m.metrics.bytesWritten))
+		})
+	}
+}
+
+func TestReadTransformed(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), tenantID)
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	path := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+
+	bucket := objstore.NewInMemBucket()
+	require.NoError(t, bucket.Upload(ctx, testObjectPath("a"), bytes.NewReader(nil)))
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithTransforms(xorTransform, xorTransform), WithCompression(compression.GZIP))
+	require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now))
+
+	t.Run("object metastore", func(t *testing.T) {
+		_, err := NewObjectMetastore(bucket).DataObjects(ctx, now, now)
+		require.Error(t, err)
+
+		paths, err := NewObjectMetastore(bucket, WithObjectMetastoreDecodeTransform(xorTransform)).DataObjects(ctx, now, now)
+		require.NoError(t, err)
+		require.Equal(t, []string{testObjectPath("a")}, paths)
+	})
+
+	t.Run("querier", func(t *testing.T) {
+		for _, opts := range [][]QuerierOption{nil, {WithObjectCache(10)}} {
+			q := NewQuerier(bucket, log.NewNopLogger(), append(opts, WithQuerierDecodeTransform(xorTransform))...)
+			paths, err := q.Paths(ctx, tenantID, now, now)
+			require.NoError(t, err)
+			require.Equal(t, []string{testObjectPath("a")}, paths)
+		}
+	})
+
+	t.Run("self test", func(t *testing.T) {
+		report, err := SelfTest(ctx, bucket, tenantID)
+		require.NoError(t, err)
+		require.Equal(t, 1, report.Failures[FailureDecode])
+
+		report, err = SelfTest(ctx, bucket, tenantID, WithSelfTestDecodeTransform(xorTransform))
+		require.NoError(t, err)
+		require.True(t, report.Healthy(), report.Samples)
+		require.Equal(t, 1, report.Records)
+	})
+
+	t.Run("dump", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, Dump(&out, bucket.Objects()[path], WithDumpDecodeTransform(xorTransform)))
+		require.Contains(t, out.String(), testObjectPath("a"))
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		other := objstore.NewInMemBucket()
+		require.NoError(t, NewUpdater(other, tenantID, log.NewNopLogger(), WithTransforms(xorTransform, xorTransform)).Update(ctx, testObjectPath("b"), now, now))
+
+		merged, err := MergeWithTransforms(ctx, xorTransform, xorTransform, bucket.Objects()[path], other.Objects()[path])
+		require.NoError(t, err)
+		require.NoError(t, bucket.Upload(ctx, path, bytes.NewReader(merged)))
+		require.NoError(t, m.verifyWrite(ctx, path, testObjectPath("a"), testObjectPath("b")))
+	})
+}
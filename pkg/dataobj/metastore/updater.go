@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"path"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -15,7 +19,10 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/thanos-io/objstore"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 
+	"github.com/grafana/loki/v3/pkg/compression"
 	"github.com/grafana/loki/v3/pkg/dataobj"
 	"github.com/grafana/loki/v3/pkg/dataobj/consumer/logsobj"
 	"github.com/grafana/loki/v3/pkg/dataobj/sections/streams"
@@ -26,6 +33,14 @@ const (
 	labelNameStart = "__start__"
 	labelNameEnd   = "__end__"
 	labelNamePath  = "__path__"
+
+	// maxStreamEntries is the maximum number of entries appended to the
+	// metastore builder for a single stream. Metastore records have a single
+	// entry today; the cap protects the builder against malformed input.
+	// Records replayed from existing objects or merged only keep their labels
+	// and are appended with replayedEntries, so only streams appended with
+	// appendStream can exceed it.
+	maxStreamEntries = 1024
 )
 
 // Define our own builder config because metastore objects are significantly smaller.
@@ -40,6 +55,7 @@ var metastoreBuilderCfg = logsobj.BuilderConfig{
 
 type Updater struct {
 	metastoreBuilder *logsobj.Builder
+	builderCfg       logsobj.BuilderConfig
 	tenantID         string
 	metrics          *metastoreMetrics
 	bucket           objstore.Bucket
@@ -47,27 +63,158 @@ type Updater struct {
 	backoff          *backoff.Backoff
 	buf              *bytes.Buffer
 
+	retention          RetentionProvider
+	journal            Journal
+	layout             PathLayout
+	windowSize         time.Duration
+	onUpdate           func(UpdateEvent)
+	verifyAfterWrite   bool
+	dropInvalidRecords bool
+	validateLabels     bool
+	releaseBuffers     bool
+	manifest           bool
+	manifestRefreshed  map[time.Time]time.Time // Last manifest update of each window.
+	manifestFailures   int                     // Manifest updates failed since the last reconcile.
+	tombstones         bool
+	streamingFlush     bool
+	stagedWrites       bool
+	speculativeEncode  bool
+	compression        compression.Codec
+	decodeTransform    Transform
+	encodeTransform    Transform
+	windowBackoff      *windowBackoff
+	sectionSize        *adaptiveSectionSize
+
+	// retainedBytes is the capacity of buf accounted for in retainedBufferBytes.
+	retainedBytes int64
+
+	replayParallelism int
+	maxWindows        int
+
+	// tenantWindows are the metastore windows of the tenant, if the number of windows is limited.
+	tenantWindows    map[string]struct{}
+	maxTenantWindows int
+
+	// writeLimiter limits the rate of metastore writes of the tenant, if configured.
+	writeLimiter *rate.Limiter
+
+	// pending are the entries buffered by window, if updates are buffered.
+	pending          map[string]*pendingWindow
+	bufferMaxEntries int
+	bufferMaxDelay   time.Duration
+
 	builderOnce sync.Once
 }
 
-func NewUpdater(bucket objstore.Bucket, tenantID string, logger log.Logger) *Updater {
+// UpdaterOption configures optional behaviour of an [Updater].
+type UpdaterOption func(*Updater)
+
+// WithVerifyAfterWrite makes [Updater.Update] read back every metastore object
+// it writes and check the new entry is present. If it isn't, the update of that
+// object is retried. This protects against object stores which silently lose
+// writes, at the cost of an extra read per write.
+func WithVerifyAfterWrite() UpdaterOption {
+	return func(u *Updater) {
+		u.verifyAfterWrite = true
+	}
+}
+
+// WithDropInvalidRecords makes [Updater.Update] drop records of existing
+// metastore objects which fail schema validation instead of carrying them
+// forward into the updated object. Invalid records are counted either way.
+func WithDropInvalidRecords() UpdaterOption {
+	return func(u *Updater) {
+		u.dropInvalidRecords = true
+	}
+}
+
+// WithLabelValidation makes [Updater.Update] check the labels of every record
+// replayed from existing metastore objects for empty names and invalid UTF-8,
+// and skip records with invalid labels instead of carrying them forward into
+// the updated object. Skipped records are counted.
+func WithLabelValidation() UpdaterOption {
+	return func(u *Updater) {
+		u.validateLabels = true
+	}
+}
+
+// WithReleaseBuffers makes the [Updater] release its buffer for metastore
+// objects after every update instead of retaining it for the next one. This
+// lowers the idle memory of updaters which are only updated occasionally, at
+// the cost of growing the buffer again on the next update.
+func WithReleaseBuffers() UpdaterOption {
+	return func(u *Updater) {
+		u.releaseBuffers = true
+	}
+}
+
+// WithReplayParallelism sets how many streams sections of an existing
+// metastore object are decoded concurrently when replaying it. The default of 1
+// decodes sections serially.
+func WithReplayParallelism(parallelism int) UpdaterOption {
+	return func(u *Updater) {
+		u.replayParallelism = parallelism
+	}
+}
+
+// WithSectionStripeMergeLimit sets the number of stripes the metastore builder
+// merges into a section at once, which defaults to 2. Tenants with many small
+// streams can merge more stripes at once, at the cost of more memory while
+// flushing. Limits below 2 are raised to 2.
+func WithSectionStripeMergeLimit(limit int) UpdaterOption {
+	return func(u *Updater) {
+		u.builderCfg.SectionStripeMergeLimit = max(limit, 2)
+	}
+}
+
+// BucketMiddleware decorates the bucket of an [Updater], e.g. to rate limit or
+// instrument its object store operations.
+type BucketMiddleware func(objstore.Bucket) objstore.Bucket
+
+// WithBucketMiddleware makes the [Updater] perform all of its object store
+// operations, including Get, Upload and GetAndReplace, through the bucket
+// returned by middleware. Middlewares are applied in order, so the last one
+// sees operations first. This is equivalent to passing a decorated bucket to
+// [NewUpdater], which works with any [objstore.Bucket] decorator, but keeps
+// the decoration with the options of the updater.
+func WithBucketMiddleware(middleware BucketMiddleware) UpdaterOption {
+	return func(u *Updater) {
+		u.bucket = middleware(u.bucket)
+	}
+}
+
+func NewUpdater(bucket objstore.Bucket, tenantID string, logger log.Logger, opts ...UpdaterOption) *Updater {
 	metrics := newMetastoreMetrics()
 
-	return &Updater{
-		bucket:   bucket,
-		metrics:  metrics,
-		logger:   logger,
-		tenantID: tenantID,
+	u := &Updater{
+		bucket:     bucket,
+		builderCfg: metastoreBuilderCfg,
+		metrics:    metrics,
+		logger:     logger,
+		tenantID:   tenantID,
 		backoff: backoff.New(context.TODO(), backoff.Config{
 			MinBackoff: 50 * time.Millisecond,
-			MaxBackoff: 10 * time.Second,
+			MaxBackoff: defaultMaxBackoff,
 		}),
-		builderOnce: sync.Once{},
+		journal:           nopJournal{},
+		builderOnce:       sync.Once{},
+		replayParallelism: 1,
+		windowSize:        metastoreWindowSize,
 	}
+
+	for _, o := range opts {
+		o(u)
+	}
+
+	return u
 }
 
 func (m *Updater) RegisterMetrics(reg prometheus.Registerer) error {
-	return m.metrics.register(reg)
+	if err := m.metrics.register(reg); err != nil {
+		return err
+	}
+	m.metrics.windowSize.Set(m.windowSize.Seconds())
+	return nil
 }
 
 func (m *Updater) UnregisterMetrics(reg prometheus.Registerer) {
@@ -77,130 +224,661 @@ func (m *Updater) UnregisterMetrics(reg prometheus.Registerer) {
 func (m *Updater) initBuilder() error {
 	var initErr error
 	m.builderOnce.Do(func() {
-		metastoreBuilder, err := logsobj.NewBuilder(metastoreBuilderCfg)
+		metastoreBuilder, err := logsobj.NewBuilder(m.builderCfg)
 		if err != nil {
 			initErr = err
 			return
 		}
-		m.buf = bytes.NewBuffer(make([]byte, 0, metastoreBuilderCfg.TargetObjectSize))
+		if !m.releaseBuffers {
+			m.buf = bytes.NewBuffer(make([]byte, 0, metastoreBuilderCfg.TargetObjectSize))
+		}
 		m.metastoreBuilder = metastoreBuilder
+		m.applySectionSize()
+		activeBuilders.Inc()
 	})
 	return initErr
 }
 
+// Close writes the updates buffered by [WithBufferedUpdates] and releases the
+// builder and buffer of the updater, e.g. once its tenant goes idle or its
+// partition is revoked. The updater can still be used after Close; the next
+// update initializes a new builder. The builder and buffer are released even
+// if writing buffered updates fails; those updates stay buffered.
+func (m *Updater) Close() error {
+	err := m.Flush(context.Background())
+
+	m.buf = nil
+	retainedBufferBytes.Sub(m.retainedBytes)
+	m.retainedBytes = 0
+
+	if m.metastoreBuilder != nil {
+		m.metastoreBuilder = nil
+		activeBuilders.Dec()
+	}
+	m.builderOnce = sync.Once{}
+	return err
+}
+
+// acquireBuffer allocates the buffer for metastore objects if it was released after the last update.
+func (m *Updater) acquireBuffer() {
+	if m.buf == nil {
+		m.buf = new(bytes.Buffer)
+	}
+}
+
+// releaseBuffer releases the buffer for metastore objects if [WithReleaseBuffers] is set and
+// accounts for the memory it retains otherwise.
+func (m *Updater) releaseBuffer() {
+	if m.releaseBuffers {
+		m.buf = nil
+	}
+
+	var retained int64
+	if m.buf != nil {
+		retained = int64(m.buf.Cap())
+	}
+	retainedBufferBytes.Add(retained - m.retainedBytes)
+	m.retainedBytes = retained
+}
+
 // Update adds provided dataobj path to the metastore. Flush stats are used to determine the stored metadata about this dataobj.
+// With [WithBufferedUpdates], the path is buffered and may only be written by a later call or [Updater.Flush].
 func (m *Updater) Update(ctx context.Context, dataobjPath string, minTimestamp, maxTimestamp time.Time) error {
+	return m.UpdateWithStats(ctx, dataobjPath, minTimestamp, maxTimestamp, PathStats{})
+}
+
+// UpdateWithStats adds provided dataobj path to the metastore like [Updater.Update], storing stats with its records.
+func (m *Updater) UpdateWithStats(ctx context.Context, dataobjPath string, minTimestamp, maxTimestamp time.Time, stats PathStats) error {
 	var err error
 	processingTime := prometheus.NewTimer(m.metrics.metastoreProcessingTime)
 	defer processingTime.ObserveDuration()
 
+	if err := validateDataobjPath(m.tenantID, dataobjPath); err != nil {
+		return err
+	}
+	if err := m.checkWindows(minTimestamp, maxTimestamp); err != nil {
+		return err
+	}
+	if err := m.checkWriteRate(); err != nil {
+		return err
+	}
+	if err := m.checkTenantWindows(ctx, minTimestamp, maxTimestamp, nil); err != nil {
+		return err
+	}
+
 	// Initialize builder if this is the first call for this partition
 	if err := m.initBuilder(); err != nil {
 		return err
 	}
+	m.acquireBuffer()
+	defer m.releaseBuffer()
 
 	// Work our way through the metastore objects window by window, updating & creating them as needed.
 	// Each one handles its own retries in order to keep making progress in the event of a failure.
-	for metastorePath := range iterStorePaths(m.tenantID, minTimestamp, maxTimestamp) {
-		m.backoff.Reset()
-		for m.backoff.Ongoing() {
-			err = m.bucket.GetAndReplace(ctx, metastorePath, func(existing io.Reader) (io.Reader, error) {
-				m.buf.Reset()
-				if existing != nil {
-					level.Debug(m.logger).Log("msg", "found existing metastore, updating", "path", metastorePath)
-					_, err := io.Copy(m.buf, existing)
-					if err != nil {
-						return nil, errors.Wrap(err, "copying to local buffer")
-					}
-				} else {
-					level.Debug(m.logger).Log("msg", "no existing metastore found, creating new one", "path", metastorePath)
-				}
+	entries := []PathEntry{{Path: dataobjPath, MinTimestamp: minTimestamp, MaxTimestamp: maxTimestamp, Stats: stats}}
+	if m.buffering() {
+		return m.bufferEntry(ctx, entries[0])
+	}
+	for metastorePath := range iterStorePaths(m.layout, m.tenantID, minTimestamp, maxTimestamp, m.windowSize) {
+		err = m.updateWindow(ctx, metastorePath, entries)
+	}
+	return err
+}
 
-				m.metastoreBuilder.Reset()
-
-				if m.buf.Len() > 0 {
-					replayDuration := prometheus.NewTimer(m.metrics.metastoreReplayTime)
-					object, err := dataobj.FromReaderAt(bytes.NewReader(m.buf.Bytes()), int64(m.buf.Len()))
-					if err != nil {
-						return nil, errors.Wrap(err, "creating object from buffer")
-					}
-					if err := m.readFromExisting(ctx, object); err != nil {
-						return nil, errors.Wrap(err, "reading existing metastore version")
-					}
-					replayDuration.ObserveDuration()
-				}
+// UpdateBatch adds the dataobjs of entries to the metastore, like calling
+// [Updater.Update] for each of them, but reads, replays and writes each
+// metastore window overlapped by any of the entries only once, with all of
+// its entries. The entries are checked before any window is written, so an
+// invalid or rejected entry fails the whole batch. Windows which fail to be
+// written after retrying don't stop the others from being written; the error
+// of the last of them is returned.
+// With [WithBufferedUpdates], the entries are buffered like with Update.
+func (m *Updater) UpdateBatch(ctx context.Context, entries []PathEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	processingTime := prometheus.NewTimer(m.metrics.metastoreProcessingTime)
+	defer processingTime.ObserveDuration()
 
-				encodingDuration := prometheus.NewTimer(m.metrics.metastoreEncodingTime)
-
-				ls := labels.New(
-					labels.Label{Name: labelNameStart, Value: strconv.FormatInt(minTimestamp.UnixNano(), 10)},
-					labels.Label{Name: labelNameEnd, Value: strconv.FormatInt(maxTimestamp.UnixNano(), 10)},
-					labels.Label{Name: labelNamePath, Value: dataobjPath},
-				)
-				err := m.metastoreBuilder.Append(logproto.Stream{
-					Labels:  ls.String(),
-					Entries: []logproto.Entry{{Line: ""}},
-				})
-				if err != nil {
-					return nil, errors.Wrap(err, "appending internal metadata stream")
-				}
+	for _, entry := range entries {
+		if err := validateDataobjPath(m.tenantID, entry.Path); err != nil {
+			return err
+		}
+		if err := m.checkWindows(entry.MinTimestamp, entry.MaxTimestamp); err != nil {
+			return err
+		}
+	}
+	if err := m.checkWriteRate(); err != nil {
+		return err
+	}
+	pending := make(map[string]struct{})
+	for _, entry := range entries {
+		if err := m.checkTenantWindows(ctx, entry.MinTimestamp, entry.MaxTimestamp, pending); err != nil {
+			return err
+		}
+	}
+
+	if err := m.initBuilder(); err != nil {
+		return err
+	}
+	m.acquireBuffer()
+	defer m.releaseBuffer()
+
+	if m.buffering() {
+		for _, entry := range entries {
+			if err := m.bufferEntry(ctx, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	m.metrics.observeBatchEntries(len(entries))
+	var err error
+	paths, windows := m.groupByWindow(entries)
+	for _, metastorePath := range paths {
+		if windowErr := m.updateWindow(ctx, metastorePath, windows[metastorePath]); windowErr != nil {
+			err = errors.Wrapf(windowErr, "updating %s", metastorePath)
+		}
+	}
+	return err
+}
 
-				m.buf.Reset()
-				_, err = m.metastoreBuilder.Flush(m.buf)
+// updateWindow adds entries to the metastore object at metastorePath in a single write, retrying on failure.
+func (m *Updater) updateWindow(ctx context.Context, metastorePath string, entries []PathEntry) error {
+	var err error
+	b := m.backoffFor(metastorePath)
+	var conflicted bool
+	streaming := m.streamingFlush && m.compression == compression.None && !requiresContentLength(m.bucket.Provider())
+	if m.tombstones {
+		if err := m.clearTombstones(ctx, metastorePath, entries); err != nil {
+			return errors.Wrap(err, "clearing tombstones of added dataobjs")
+		}
+	}
+	for b.Ongoing() {
+		var (
+			flush       *streamingFlush
+			flushStats  logsobj.FlushStats
+			callbackDur time.Duration
+			size        int64
+			created     bool
+		)
+		var speculative *speculativeWrite
+		if m.speculativeEncode {
+			if speculative, err = m.prepareSpeculativeWrite(ctx, metastorePath, entries); err != nil {
+				level.Warn(m.logger).Log("msg", "failed to prepare metastore write, encoding it during the update", "err", err, "metastore", metastorePath)
+			}
+		}
+
+		getAndReplaceStart := time.Now()
+		err = m.bucket.GetAndReplace(ctx, metastorePath, func(existing io.Reader) (io.Reader, error) {
+			callbackStart := time.Now()
+			defer func() { callbackDur += time.Since(callbackStart) }()
+
+			created = existing == nil
+			if existing != nil {
+				level.Debug(m.logger).Log("msg", "found existing metastore, updating", "path", metastorePath)
+				m.metrics.incOperations(operationUpdate)
+			} else {
+				level.Debug(m.logger).Log("msg", "no existing metastore found, creating new one", "path", metastorePath)
+				m.metrics.incOperations(operationCreate)
+			}
+
+			if speculative != nil {
+				matches, unchanged, err := speculative.matches(existing)
 				if err != nil {
-					return nil, errors.Wrap(err, "flushing metastore builder")
+					return nil, err
 				}
-				encodingDuration.ObserveDuration()
-				return m.buf, nil
-			})
-			if err == nil {
-				level.Info(m.logger).Log("msg", "successfully merged & updated metastore", "metastore", metastorePath)
-				m.metrics.incMetastoreWrites(statusSuccess)
-				break
+				m.metrics.incSpeculativeEncodes(matches)
+				if matches {
+					m.metrics.bytesRead.Add(float64(len(speculative.existing)))
+					flushStats = speculative.stats
+					return m.writeCompressed(ctx, metastorePath, speculative.object, &size)
+				}
+				existing = unchanged
+			}
+
+			encodingDuration, err := m.buildUpdate(ctx, existing, entries)
+			if err != nil {
+				return nil, err
+			}
+
+			if streaming {
+				flush = m.startStreamingFlush(encodingDuration)
+				return m.writeEncoded(ctx, metastorePath, flush, &size)
+			}
+
+			m.buf.Reset()
+			stats, err := m.metastoreBuilder.Flush(m.buf)
+			if err != nil {
+				return nil, errors.Wrap(err, "flushing metastore builder")
 			}
-			level.Error(m.logger).Log("msg", "failed to get and replace metastore object", "err", err, "metastore", metastorePath)
-			m.metrics.incMetastoreWrites(statusFailure)
-			m.backoff.Wait()
+			flushStats = stats
+			encodingDuration.ObserveDuration()
+			return m.writeEncoded(ctx, metastorePath, m.buf, &size)
+		})
+		m.metrics.observeGetAndReplaceCallback(callbackDur)
+		m.metrics.observeGetAndReplace(time.Since(getAndReplaceStart) - callbackDur)
+		if errors.Is(err, errStagedWrite) {
+			err = nil
+		}
+		if flush != nil {
+			flush.close()
+			flushStats = flush.stats
 		}
-		// Reset at the end too so we don't leave our memory hanging around between calls.
-		m.metastoreBuilder.Reset()
+		if err == nil {
+			m.observeFlush(flushStats)
+		}
+		if err == nil && m.verifyAfterWrite {
+			if err = m.verifyWrite(ctx, metastorePath, entryPaths(entries)...); err != nil {
+				level.Warn(m.logger).Log("msg", "failed to verify metastore write, retrying", "err", err, "metastore", metastorePath)
+				m.metrics.incVerificationFailures()
+				conflicted = true
+				b.Wait()
+				continue
+			}
+		}
+		if err == nil {
+			level.Info(m.logger).Log("msg", "successfully merged & updated metastore", "metastore", metastorePath, "entries", len(entries))
+			m.metrics.incMetastoreWrites(statusSuccess)
+			m.trackTenantWindow(metastorePath)
+			if m.manifest {
+				m.updateManifest(ctx, metastorePath, created)
+			}
+			m.recordJournal(ctx, m.addRecords(metastorePath, entries, size))
+			m.notifyUpdate(metastorePath, entries)
+			break
+		}
+		level.Error(m.logger).Log("msg", "failed to get and replace metastore object", "err", err, "metastore", metastorePath)
+		m.metrics.incMetastoreWrites(statusFailure)
+		conflicted = true
+		b.Wait()
+	}
+	if m.windowBackoff != nil {
+		m.windowBackoff.observe(metastorePath, conflicted, time.Now())
 	}
+	// Reset at the end too so we don't leave our memory hanging around between calls.
+	m.metastoreBuilder.Reset()
 	return err
 }
 
+// buildUpdate replays the existing metastore object, if any, into the
+// metastore builder and appends entries to it. The returned timer measures
+// the encoding of the updated object and is observed once it is flushed.
+func (m *Updater) buildUpdate(ctx context.Context, existing io.Reader, entries []PathEntry) (*prometheus.Timer, error) {
+	if _, _, err := m.replayExisting(ctx, existing, nil); err != nil {
+		return nil, err
+	}
+
+	encodingDuration := prometheus.NewTimer(m.metrics.metastoreEncodingTime)
+
+	for _, entry := range entries {
+		ls := labels.New(entry.Stats.appendLabels([]labels.Label{
+			{Name: labelNameStart, Value: strconv.FormatInt(entry.MinTimestamp.UnixNano(), 10)},
+			{Name: labelNameEnd, Value: strconv.FormatInt(entry.MaxTimestamp.UnixNano(), 10)},
+			{Name: labelNamePath, Value: entry.Path},
+		})...)
+		err := m.appendStream(logproto.Stream{
+			Labels:  ls.String(),
+			Entries: []logproto.Entry{{Line: ""}},
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "appending internal metadata stream")
+		}
+	}
+	return encodingDuration, nil
+}
+
+// replayExisting resets the metastore builder and replays the existing
+// metastore object, if any, into it. Records for which drop returns true are
+// dropped, if it is set. It returns the number of records kept and dropped.
+func (m *Updater) replayExisting(ctx context.Context, existing io.Reader, drop func(labels.Labels) bool) (kept, removed int, err error) {
+	object, err := m.loadExisting(existing)
+	if err != nil {
+		return 0, 0, err
+	}
+	return m.replayObject(ctx, object, drop)
+}
+
+// loadExisting decodes the existing metastore object, if any, into the buffer
+// of m and opens it. Missing objects open without sections.
+func (m *Updater) loadExisting(existing io.Reader) (*dataobj.Object, error) {
+	m.buf.Reset()
+	if existing == nil {
+		return &dataobj.Object{}, nil
+	}
+	existing, err := m.decode(existing)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(m.buf, existing); err != nil {
+		return nil, errors.Wrap(err, "copying to local buffer")
+	}
+	return openObject(m.buf)
+}
+
+// replayObject resets the metastore builder and replays object into it like
+// [Updater.replayExisting].
+func (m *Updater) replayObject(ctx context.Context, object *dataobj.Object, drop func(labels.Labels) bool) (kept, removed int, err error) {
+	m.metastoreBuilder.Reset()
+	if len(object.Sections()) == 0 {
+		return 0, 0, nil
+	}
+
+	replayDuration := prometheus.NewTimer(m.metrics.metastoreReplayTime)
+	kept, removed, err = m.readFromExistingExcept(ctx, object, drop)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "reading existing metastore version")
+	}
+	replayDuration.ObserveDuration()
+	return kept, removed, nil
+}
+
+// addRecords returns the journal records of entries added to the metastore
+// object at metastorePath, which is size bytes after the update.
+func (m *Updater) addRecords(metastorePath string, entries []PathEntry, size int64) []JournalRecord {
+	records := make([]JournalRecord, 0, len(entries))
+	for _, entry := range entries {
+		record := m.journalRecord(JournalOperationAdd, metastorePath, size)
+		record.Path = entry.Path
+		record.MinTimestamp = entry.MinTimestamp.UTC()
+		record.MaxTimestamp = entry.MaxTimestamp.UTC()
+		records = append(records, record)
+	}
+	return records
+}
+
+// updateManifest adds the window of metastorePath to the manifest if the write created it, and
+// otherwise refreshes its last modification at most every manifestRefreshInterval, so writes of
+// existing windows don't rewrite the manifest every time. Failures only delay discovering the
+// window until the manifest is reconciled, so they don't fail the update. They are counted by
+// [Updater.ManifestUpdateFailures], and the window is updated again on its next write.
+func (m *Updater) updateManifest(ctx context.Context, metastorePath string, created bool) {
+	window, err := m.layout.parseWindow(m.tenantID, metastorePath)
+	if err != nil {
+		m.manifestUpdateFailed(metastorePath, err)
+		return
+	}
+	now := time.Now()
+	if refreshed, ok := m.manifestRefreshed[window]; ok && !created && now.Sub(refreshed) < manifestRefreshInterval {
+		return
+	}
+	if err := m.addToManifest(ctx, window, now); err != nil {
+		delete(m.manifestRefreshed, window)
+		m.manifestUpdateFailed(metastorePath, err)
+		return
+	}
+	if m.manifestRefreshed == nil {
+		m.manifestRefreshed = make(map[time.Time]time.Time)
+	}
+	m.manifestRefreshed[window] = now
+}
+
+func (m *Updater) manifestUpdateFailed(metastorePath string, err error) {
+	level.Warn(m.logger).Log("msg", "failed to update metastore manifest", "err", err, "metastore", metastorePath)
+	m.metrics.incManifestUpdateFailures()
+	m.manifestFailures++
+}
+
+// validateDataobjPath checks that dataobjPath is a clean relative path under the directory of the tenant.
+// Readers fetch objects by the paths stored in the metastore, so any other path could be used to read
+// objects of other tenants.
+func validateDataobjPath(tenantID, dataobjPath string) error {
+	switch {
+	case dataobjPath == "":
+		return errors.New("invalid dataobj path: path is empty")
+	case path.IsAbs(dataobjPath):
+		return errors.Errorf("invalid dataobj path %q: path must be relative", dataobjPath)
+	case path.Clean(dataobjPath) != dataobjPath:
+		return errors.Errorf("invalid dataobj path %q: path must be clean", dataobjPath)
+	case slices.Contains(strings.Split(dataobjPath, "/"), ".."):
+		return errors.Errorf("invalid dataobj path %q: path must not contain '..'", dataobjPath)
+	case !strings.HasPrefix(dataobjPath, tenantDir(tenantID)):
+		return errors.Errorf("invalid dataobj path %q: path must be under %q", dataobjPath, tenantDir(tenantID))
+	}
+	return nil
+}
+
+// backoffFor returns the reset backoff to retry updates of the metastore object at metastorePath with.
+func (m *Updater) backoffFor(metastorePath string) *backoff.Backoff {
+	if m.windowBackoff == nil {
+		m.backoff.Reset()
+		return m.backoff
+	}
+
+	limit := m.windowBackoff.limit(metastorePath)
+	m.metrics.observeBackoffCap(limit)
+	return backoff.New(context.TODO(), backoff.Config{
+		MinBackoff: 50 * time.Millisecond,
+		MaxBackoff: limit,
+	})
+}
+
+// verifyWrite reads back the metastore object at metastorePath and checks it contains an entry for each of dataobjPaths.
+func (m *Updater) verifyWrite(ctx context.Context, metastorePath string, dataobjPaths ...string) error {
+	reader, err := m.bucket.Get(ctx, metastorePath)
+	if err != nil {
+		return errors.Wrap(err, "reading back metastore object")
+	}
+	defer reader.Close()
+
+	decoded, err := m.decode(reader)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(decoded); err != nil {
+		return errors.Wrap(err, "reading back metastore object")
+	}
+	object, err := openObject(&buf)
+	if err != nil {
+		return err
+	}
+
+	missing := make(map[string]struct{}, len(dataobjPaths))
+	for _, dataobjPath := range dataobjPaths {
+		missing[dataobjPath] = struct{}{}
+	}
+	err = replayStreams(ctx, object, m.replayParallelism, func(stream streams.Stream) error {
+		delete(missing, stream.Labels.Get(labelNamePath))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for dataobjPath := range missing {
+		return errors.Errorf("entry for %s not found in metastore object", dataobjPath)
+	}
+	return nil
+}
+
 // readFromExisting reads the provided metastore object and appends the streams to the builder so it can be later modified.
 func (m *Updater) readFromExisting(ctx context.Context, object *dataobj.Object) error {
+	_, _, err := m.readFromExistingExcept(ctx, object, nil)
+	return err
+}
+
+// readFromExistingExcept is like readFromExisting, but drops the records for
+// which drop returns true if it is set. It returns the number of records
+// appended to the builder and the number of records dropped.
+func (m *Updater) readFromExistingExcept(ctx context.Context, object *dataobj.Object, drop func(labels.Labels) bool) (kept, removed int, err error) {
+	m.metrics.observeSectionsPerObject(len(streamsSections(object)))
+	err = replayStreams(ctx, object, m.replayParallelism, func(stream streams.Stream) error {
+		if drop != nil && drop(stream.Labels) {
+			removed++
+			return nil
+		}
+		if m.validateLabels {
+			if err := validateLabels(stream.Labels); err != nil {
+				level.Warn(m.logger).Log("msg", "skipping metastore record with invalid labels", "err", err)
+				m.metrics.incInvalidLabels()
+				return nil
+			}
+		}
+		if err := validateSchema(stream.Labels); err != nil {
+			m.metrics.incInvalidRecords()
+			if m.dropInvalidRecords {
+				level.Warn(m.logger).Log("msg", "dropping invalid metastore record", "err", err, "labels", stream.Labels.String())
+				return nil
+			}
+		}
+		// The labels are passed through parsed, so they aren't formatted and
+		// parsed again. The builder retains them, but the reader reuses them
+		// between reads.
+		kept++
+		return m.metastoreBuilder.AppendLabels(stream.Labels.Copy(), replayedEntries)
+	})
+	return kept, removed, err
+}
+
+// replayedEntries are the entries of every stream replayed from an existing
+// metastore object or merged by [Merge]. The builder doesn't retain them, so
+// they are shared.
+var replayedEntries = []logproto.Entry{{Line: ""}}
+
+// appendStream appends stream to the metastore builder, truncating it to maxStreamEntries entries.
+func (m *Updater) appendStream(stream logproto.Stream) error {
+	stream, truncated := capStreamEntries(stream)
+	if truncated > 0 {
+		level.Warn(m.logger).Log("msg", "truncated metastore stream", "labels", stream.Labels, "truncated_entries", truncated)
+		m.metrics.addTruncatedEntries(truncated)
+	}
+	return m.metastoreBuilder.Append(stream)
+}
+
+// capStreamEntries truncates stream to maxStreamEntries entries and returns the number of entries removed.
+func capStreamEntries(stream logproto.Stream) (logproto.Stream, int) {
+	if len(stream.Entries) <= maxStreamEntries {
+		return stream, 0
+	}
+	truncated := len(stream.Entries) - maxStreamEntries
+	stream.Entries = stream.Entries[:maxStreamEntries]
+	return stream, truncated
+}
+
+// validateLabels checks that no label name of a metastore record is empty and that all names and values are valid UTF-8.
+func validateLabels(lbs labels.Labels) error {
+	return lbs.Validate(func(l labels.Label) error {
+		if l.Name == "" {
+			return errors.New("empty label name")
+		}
+		if !utf8.ValidString(l.Name) {
+			return errors.Errorf("label name %q is not valid UTF-8", l.Name)
+		}
+		if !utf8.ValidString(l.Value) {
+			return errors.Errorf("value of label %s is not valid UTF-8", l.Name)
+		}
+		return nil
+	})
+}
+
+// validateSchema checks that a metastore record has parseable start and end timestamps and a dataobj path.
+func validateSchema(lbs labels.Labels) error {
+	for _, name := range []string{labelNameStart, labelNameEnd} {
+		value := lbs.Get(name)
+		if value == "" {
+			return errors.Errorf("missing %s label", name)
+		}
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return errors.Wrapf(err, "parsing %s label", name)
+		}
+	}
+	if lbs.Get(labelNamePath) == "" {
+		return errors.Errorf("missing %s label", labelNamePath)
+	}
+	return nil
+}
+
+// replayStreams calls f for every stream in the streams sections of a metastore object.
+// Only the labels of the streams are decoded.
+// Up to parallelism sections are decoded concurrently; f is always called from the
+// calling goroutine and in the order of the streams in the object.
+func replayStreams(ctx context.Context, object *dataobj.Object, parallelism int, f func(streams.Stream) error) error {
+	sections := streamsSections(object)
+	if parallelism <= 1 || len(sections) <= 1 {
+		for _, section := range sections {
+			if err := readStreamsSection(ctx, section, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Decode each section into its own slice and append them in order afterwards.
+	results := make([][]streams.Stream, len(sections))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(parallelism)
+	for i, section := range sections {
+		g.Go(func() error {
+			return readStreamsSection(gctx, section, func(stream streams.Stream) error {
+				// The reader reuses the labels of its buffer between reads.
+				stream.Labels = stream.Labels.Copy()
+				results[i] = append(results[i], stream)
+				return nil
+			})
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		for _, stream := range result {
+			if err := f(stream); err != nil {
+				return errors.Wrap(err, "appending streams")
+			}
+		}
+	}
+	return nil
+}
+
+// streamsSections returns the streams sections of object.
+func streamsSections(object *dataobj.Object) []*dataobj.Section {
+	var sections []*dataobj.Section
+	for _, section := range object.Sections() {
+		if streams.CheckSection(section) {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+// readStreamsSection calls f for every stream in a streams section.
+func readStreamsSection(ctx context.Context, section *dataobj.Section, f func(streams.Stream) error) error {
 	var streamsReader streams.RowReader
 	defer streamsReader.Close()
 
+	sec, err := streams.Open(ctx, section)
+	if err != nil {
+		return errors.Wrap(err, "opening section")
+	}
+
 	// Read streams from existing metastore object and write them to the builder for the new object
 	buf := make([]streams.Stream, 100)
 
-	for _, section := range object.Sections() {
-		if !streams.CheckSection(section) {
-			continue
+	streamsReader.Reset(sec)
+	// Metastore records are entirely described by their labels.
+	if err := streamsReader.SetLabelsOnly(true); err != nil {
+		return errors.Wrap(err, "projecting label columns")
+	}
+	for {
+		n, err := streamsReader.Read(ctx, buf)
+		// Stop promptly if the deadline passes while the object store is slow.
+		// This is checked even if nothing was read, as a failed read must not
+		// be mistaken for the end of the section.
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return errors.Wrap(ctxErr, "reading streams")
 		}
-		sec, err := streams.Open(ctx, section)
-		if err != nil {
-			return errors.Wrap(err, "opening section")
+		if err != nil && err != io.EOF {
+			return errors.Wrap(err, "reading streams")
 		}
-
-		streamsReader.Reset(sec)
-		for n, err := streamsReader.Read(ctx, buf); n > 0; n, err = streamsReader.Read(ctx, buf) {
-			if err != nil && err != io.EOF {
-				return errors.Wrap(err, "reading streams")
-			}
-			for _, stream := range buf[:n] {
-				err = m.metastoreBuilder.Append(logproto.Stream{
-					Labels:  stream.Labels.String(),
-					Entries: []logproto.Entry{{Line: ""}},
-				})
-				if err != nil {
-					return errors.Wrap(err, "appending streams")
-				}
+		for _, stream := range buf[:n] {
+			if err := f(stream); err != nil {
+				return errors.Wrap(err, "appending streams")
 			}
 		}
+		if n == 0 || err == io.EOF {
+			return nil
+		}
 	}
-
-	return nil
 }
@@ -0,0 +1,118 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/loki/v3/pkg/dataobj"
+)
+
+// Upgrade rewrites the metastore object of the tenant for the window starting
+// at window with the current encoding, without changing its contents. This
+// allows migrating objects proactively instead of on their next update.
+// Objects which are already encoded with the current encoding are left as is.
+func (m *Updater) Upgrade(ctx context.Context, tenantID string, window time.Time) error {
+	if err := m.initBuilder(); err != nil {
+		return err
+	}
+	m.acquireBuffer()
+	defer m.releaseBuffer()
+	defer m.metastoreBuilder.Reset()
+
+	path := m.layout.path(tenantID, window.Truncate(m.windowSize).UTC())
+
+	// Check the object first so current objects aren't written at all.
+	reader, err := m.bucket.Get(ctx, path)
+	if err != nil {
+		return errors.Wrap(err, "reading metastore object")
+	}
+	existing, err := m.readDecoded(reader)
+	reader.Close()
+	if err != nil {
+		return errors.Wrap(err, "reading metastore object")
+	}
+	// Objects are compared decompressed, and are current if they are also
+	// compressed like new objects are.
+	codec := objectCompression(existing)
+	current := bytes.NewBuffer(existing)
+	if err := decompressObject(current); err != nil {
+		return errors.Wrap(err, "decompressing metastore object")
+	}
+	upgraded, err := m.reencode(ctx, current.Bytes())
+	if err != nil {
+		return err
+	}
+	if codec == m.compression && bytes.Equal(current.Bytes(), upgraded) {
+		level.Debug(m.logger).Log("msg", "metastore object already uses the current encoding", "metastore", path)
+		m.metrics.incUpgrades(upgradeStatusSkipped)
+		return nil
+	}
+
+	// Re-encode again from the latest version of the object, so that concurrent updates are not lost.
+	var size int64
+	err = m.bucket.GetAndReplace(ctx, path, func(existing io.Reader) (io.Reader, error) {
+		if existing == nil {
+			return nil, errors.New("metastore object no longer exists")
+		}
+		data, err := m.readDecoded(existing)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading metastore object")
+		}
+		upgraded, err := m.reencode(ctx, data)
+		if err != nil {
+			return nil, err
+		}
+		return m.writeEncoded(ctx, path, bytes.NewReader(upgraded), &size)
+	})
+	if errors.Is(err, errStagedWrite) {
+		err = nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "upgrading metastore object")
+	}
+
+	level.Info(m.logger).Log("msg", "upgraded metastore object", "metastore", path)
+	m.metrics.incUpgrades(upgradeStatusUpgraded)
+	m.recordJournal(ctx, []JournalRecord{m.journalRecord(JournalOperationUpgrade, path, size)})
+	return nil
+}
+
+// readDecoded reads a metastore object and applies the decode transform to it.
+// Objects are compared decoded, as encoding may not be deterministic.
+func (m *Updater) readDecoded(r io.Reader) ([]byte, error) {
+	decoded, err := m.decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(decoded)
+}
+
+// reencode returns the metastore object data encoded with the current encoding.
+// The returned slice is only valid until the next use of the buffer of m.
+func (m *Updater) reencode(ctx context.Context, data []byte) ([]byte, error) {
+	m.buf.Reset()
+	m.buf.Write(data)
+	if err := decompressObject(m.buf); err != nil {
+		return nil, errors.Wrap(err, "decompressing metastore object")
+	}
+
+	object, err := dataobj.FromReaderAt(bytes.NewReader(m.buf.Bytes()), int64(m.buf.Len()))
+	if err != nil {
+		return nil, errors.Wrap(err, "creating object from buffer")
+	}
+	m.metastoreBuilder.Reset()
+	if err := m.readFromExisting(ctx, object); err != nil {
+		return nil, errors.Wrap(err, "reading existing metastore version")
+	}
+
+	m.buf.Reset()
+	if _, err := m.metastoreBuilder.Flush(m.buf); err != nil {
+		return nil, errors.Wrap(err, "flushing metastore builder")
+	}
+	return m.buf.Bytes(), nil
+}
@@ -0,0 +1,63 @@
+package metastore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/loki/v3/pkg/compression"
+)
+
+func TestUpgrade(t *testing.T) {
+	ctx := context.Background()
+	bucket := objstore.NewInMemBucket()
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger())
+
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	path := metastorePath(tenantID, now.Truncate(metastoreWindowSize))
+	require.NoError(t, m.Update(ctx, testObjectPath("first"), now, now))
+	require.NoError(t, m.Update(ctx, testObjectPath("second"), now, now))
+	current := bucket.Objects()[path]
+
+	// Objects written by the updater are already current.
+	require.NoError(t, m.Upgrade(ctx, tenantID, now))
+	require.Equal(t, current, bucket.Objects()[path])
+	require.Equal(t, float64(1), testutil.ToFloat64(m.metrics.upgrades.WithLabelValues(string(upgradeStatusSkipped))))
+
+	// Replace the object with an outdated encoding.
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	_, err := gw.Write(current)
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	require.NoError(t, bucket.Upload(ctx, path, &compressed))
+
+	require.NoError(t, m.Upgrade(ctx, tenantID, now))
+	require.Equal(t, current, bucket.Objects()[path])
+	require.Equal(t, float64(1), testutil.ToFloat64(m.metrics.upgrades.WithLabelValues(string(upgradeStatusUpgraded))))
+
+	// Objects compressed by an updater with compression are current too, and
+	// uncompressed objects are upgraded to be compressed.
+	compressing := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithCompression(compression.GZIP))
+	require.NoError(t, compressing.Update(ctx, testObjectPath("third"), now, now))
+	compressedCurrent := bucket.Objects()[path]
+	require.NoError(t, compressing.Upgrade(ctx, tenantID, now))
+	require.Equal(t, compressedCurrent, bucket.Objects()[path])
+	require.Equal(t, float64(1), testutil.ToFloat64(compressing.metrics.upgrades.WithLabelValues(string(upgradeStatusSkipped))))
+	require.Zero(t, testutil.ToFloat64(compressing.metrics.upgrades.WithLabelValues(string(upgradeStatusUpgraded))))
+
+	require.NoError(t, m.Update(ctx, testObjectPath("fourth"), now, now))
+	require.NoError(t, compressing.Upgrade(ctx, tenantID, now))
+	require.Equal(t, gzipMagic, bucket.Objects()[path][:len(gzipMagic)])
+	require.Equal(t, float64(1), testutil.ToFloat64(compressing.metrics.upgrades.WithLabelValues(string(upgradeStatusUpgraded))))
+
+	// Missing objects can't be upgraded.
+	require.Error(t, m.Upgrade(ctx, tenantID, now.Add(-metastoreWindowSize)))
+}
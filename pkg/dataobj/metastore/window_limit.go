@@ -0,0 +1,55 @@
+package metastore
+
+import (
+	"fmt"
+	"time"
+)
+
+// ErrTooManyWindows is returned by [Updater.Update] with [WithMaxWindows] for
+// a dataobj whose time range overlaps more metastore windows than allowed.
+//
+// A dataobj spanning many windows is added to every one of them, which
+// amplifies metastore writes and is usually a sign the dataobj covers too much
+// time. Callers should flush data objects before they span more than Max
+// windows, or split the streams of the dataobj by time into several smaller
+// objects and update the metastore with each of them, rather than retrying the
+// same update.
+type ErrTooManyWindows struct {
+	Windows int // Number of windows overlapped by the dataobj.
+	Max     int // Maximum number of windows allowed.
+}
+
+func (e *ErrTooManyWindows) Error() string {
+	return fmt.Sprintf("dataobj spans %d metastore windows, more than the maximum of %d", e.Windows, e.Max)
+}
+
+// WithMaxWindows makes [Updater.Update] reject data objects spanning more than
+// maxWindows metastore windows with [ErrTooManyWindows] instead of adding them
+// to every window. [Updater.Run] logs and drops such data objects. A maxWindows
+// of 0 disables the limit.
+func WithMaxWindows(maxWindows int) UpdaterOption {
+	return func(u *Updater) {
+		u.maxWindows = maxWindows
+	}
+}
+
+// checkWindows returns an [ErrTooManyWindows] if the time range from start to end spans more windows than allowed.
+func (m *Updater) checkWindows(start, end time.Time) error {
+	if m.maxWindows <= 0 {
+		return nil
+	}
+	if windows := countWindows(start, end, m.windowSize); windows > m.maxWindows {
+		return &ErrTooManyWindows{Windows: windows, Max: m.maxWindows}
+	}
+	return nil
+}
+
+// countWindows returns the number of metastore windows of windowSize iterStorePaths yields for the time range from start to end.
+func countWindows(start, end time.Time, windowSize time.Duration) int {
+	minWindow, _ := windowFor(start, windowSize)
+	maxWindow, _ := windowFor(end, windowSize)
+	if maxWindow.Before(minWindow) {
+		return 0
+	}
+	return int(maxWindow.Sub(minWindow)/windowSize) + 1
+}
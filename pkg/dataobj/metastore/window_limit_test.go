@@ -0,0 +1,52 @@
+package metastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestUpdateWithMaxWindows(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+
+	bucket := objstore.NewInMemBucket()
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithMaxWindows(2))
+
+	require.NoError(t, m.Update(ctx, testObjectPath("a"), start, start.Add(metastoreWindowSize)))
+	require.Len(t, bucket.Objects(), 2)
+
+	err := m.Update(ctx, testObjectPath("b"), start, start.Add(7*24*time.Hour))
+	var tooMany *ErrTooManyWindows
+	require.True(t, errors.As(err, &tooMany))
+	require.Equal(t, countWindows(start, start.Add(7*24*time.Hour), metastoreWindowSize), tooMany.Windows)
+	require.Equal(t, 2, tooMany.Max)
+	require.Len(t, bucket.Objects(), 2, "expected no windows to be written")
+}
+
+func TestCountWindows(t *testing.T) {
+	start := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name     string
+		end      time.Time
+		expected int
+	}{
+		{name: "same window", end: start, expected: 1},
+		{name: "end before start", end: start.Add(-2 * metastoreWindowSize), expected: 0},
+		{name: "one week", end: start.Add(7 * 24 * time.Hour), expected: int(7*24*time.Hour/metastoreWindowSize) + 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var windows int
+			for range iterStorePaths(FlatPathLayout, tenantID, start, tc.end, metastoreWindowSize) {
+				windows++
+			}
+			require.Equal(t, tc.expected, windows)
+			require.Equal(t, tc.expected, countWindows(start, tc.end, metastoreWindowSize))
+		})
+	}
+}
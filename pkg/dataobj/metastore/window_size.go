@@ -0,0 +1,44 @@
+package metastore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log/level"
+)
+
+// ValidateWindowSize returns an error if size can't be used as the window
+// size of the metastore. Windows must be positive, and whole seconds as
+// metastore paths encode the start of their window with second precision.
+// Configurations taking the window size must call it from their Validate
+// method, as the window size options ignore invalid sizes.
+func ValidateWindowSize(size time.Duration) error {
+	if size <= 0 {
+		return fmt.Errorf("metastore window size %s must be positive", size)
+	}
+	if size%time.Second != 0 {
+		return fmt.Errorf("metastore window size %s must be a whole number of seconds", size)
+	}
+	return nil
+}
+
+// WithWindowSize makes the [Updater] shard metastore objects by windows of
+// size instead of 12h. Tenants with high ingest can use shorter windows to
+// keep their metastore objects small, and tenants with low ingest longer
+// windows to have fewer objects. Invalid sizes, see [ValidateWindowSize], are
+// logged and ignored.
+//
+// Readers only find records in the windows of their own window size, so all
+// updaters, readers and queriers of a bucket must use the same size. Existing
+// metastore objects were written with the previous window size, so changing
+// it requires migrating them, e.g. by re-adding their dataobjs with the new
+// size and deleting the old objects.
+func WithWindowSize(size time.Duration) UpdaterOption {
+	return func(u *Updater) {
+		if err := ValidateWindowSize(size); err != nil {
+			level.Warn(u.logger).Log("msg", "ignoring invalid metastore window size", "err", err)
+			return
+		}
+		u.windowSize = size
+	}
+}
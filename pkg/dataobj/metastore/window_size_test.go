@@ -0,0 +1,65 @@
+package metastore
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestUpdateWithWindowSize(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 30, 0, 0, time.UTC)
+	windowSize := time.Hour
+
+	bucket := objstore.NewInMemBucket()
+	m := NewUpdater(bucket, tenantID, log.NewNopLogger(), WithWindowSize(windowSize), WithMaxWindows(3))
+	reg := prometheus.NewRegistry()
+	require.NoError(t, m.RegisterMetrics(reg))
+	require.Equal(t, windowSize.Seconds(), testutil.ToFloat64(m.metrics.windowSize))
+
+	require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now.Add(90*time.Minute)))
+	window := now.Truncate(windowSize)
+	require.Len(t, bucket.Objects(), 3)
+	for i := range 3 {
+		require.Contains(t, bucket.Objects(), metastorePath(tenantID, window.Add(time.Duration(i)*windowSize)))
+	}
+
+	// The window limit counts windows of the configured size.
+	var tooMany *ErrTooManyWindows
+	require.ErrorAs(t, m.Update(ctx, testObjectPath("b"), now, now.Add(4*time.Hour)), &tooMany)
+
+	// Readers only find the records with the same window size.
+	q := NewQuerier(bucket, log.NewNopLogger(), WithQuerierWindowSize(windowSize))
+	paths, err := q.Paths(ctx, tenantID, now.Add(time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []string{testObjectPath("a")}, paths)
+
+	paths, err = NewQuerier(bucket, log.NewNopLogger()).Paths(ctx, tenantID, now.Add(time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, paths)
+
+	require.NoError(t, bucket.Upload(ctx, testObjectPath("a"), bytes.NewReader(nil)))
+	report, err := SelfTest(ctx, bucket, tenantID, WithSelfTestWindowSize(windowSize))
+	require.NoError(t, err)
+	require.True(t, report.Healthy(), report.Samples)
+	require.Equal(t, 3, report.Objects)
+}
+
+func TestValidateWindowSize(t *testing.T) {
+	require.NoError(t, ValidateWindowSize(time.Hour))
+	require.NoError(t, ValidateWindowSize(90*time.Second))
+	require.Error(t, ValidateWindowSize(0))
+	require.Error(t, ValidateWindowSize(-time.Hour))
+	require.Error(t, ValidateWindowSize(1500*time.Millisecond))
+
+	// Invalid sizes are ignored rather than failing the caller.
+	require.Equal(t, metastoreWindowSize, NewUpdater(objstore.NewInMemBucket(), tenantID, log.NewNopLogger(), WithWindowSize(0)).windowSize)
+	require.Equal(t, metastoreWindowSize, NewQuerier(objstore.NewInMemBucket(), log.NewNopLogger(), WithQuerierWindowSize(-time.Hour)).windowSize)
+}
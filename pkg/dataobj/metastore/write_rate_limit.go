@@ -0,0 +1,43 @@
+package metastore
+
+import (
+	"github.com/pkg/errors"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is returned by [Updater.Update] with [WithWriteRateLimit] if
+// the tenant exceeded its rate of metastore writes. The update can be retried
+// later, or buffered by the caller in the meantime.
+var ErrRateLimited = errors.New("metastore write rate limit exceeded")
+
+// WithWriteRateLimit limits the rate of metastore writes of the tenant of the
+// [Updater] with a token bucket refilled with writesPerSecond tokens per second
+// and holding up to burst tokens. Each [Updater.Update] which writes takes one
+// token, regardless of the number of windows it updates, and is rejected with
+// [ErrRateLimited] if there are none left.
+//
+// Updates buffered with [WithBufferedUpdates] and batches written by
+// [Updater.Run] aren't limited, as they are already coalesced. Rejected
+// updates are counted in a metric. A writesPerSecond of 0 disables the limit.
+func WithWriteRateLimit(writesPerSecond float64, burst int) UpdaterOption {
+	return func(u *Updater) {
+		if writesPerSecond <= 0 {
+			u.writeLimiter = nil
+			return
+		}
+		u.writeLimiter = rate.NewLimiter(rate.Limit(writesPerSecond), burst)
+	}
+}
+
+// checkWriteRate returns [ErrRateLimited] if an unbuffered update exceeds the write rate of the tenant.
+func (m *Updater) checkWriteRate() error {
+	if m.writeLimiter == nil || m.buffering() {
+		return nil
+	}
+	if !m.writeLimiter.Allow() {
+		m.metrics.incWriteRateLimited()
+		return ErrRateLimited
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package metastore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestUpdateWithWriteRateLimit(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+
+	t.Run("rejects writes beyond the burst", func(t *testing.T) {
+		m := NewUpdater(objstore.NewInMemBucket(), tenantID, log.NewNopLogger(), WithWriteRateLimit(0.001, 2))
+
+		// Updates spanning several windows take a single token.
+		require.NoError(t, m.Update(ctx, testObjectPath("a"), now, now.Add(metastoreWindowSize)))
+		require.NoError(t, m.Update(ctx, testObjectPath("b"), now, now))
+		require.ErrorIs(t, m.Update(ctx, testObjectPath("c"), now, now), ErrRateLimited)
+		require.Equal(t, float64(1), testutil.ToFloat64(m.metrics.writeRateLimited))
+		require.NoError(t, m.verifyWrite(ctx, WindowPath(tenantID, now), testObjectPath("a"), testObjectPath("b")))
+	})
+
+	t.Run("buffered updates aren't limited", func(t *testing.T) {
+		m := NewUpdater(objstore.NewInMemBucket(), tenantID, log.NewNopLogger(), WithWriteRateLimit(0.001, 1), WithBufferedUpdates(100, time.Hour))
+
+		for _, name := range []string{"a", "b", "c"} {
+			require.NoError(t, m.Update(ctx, testObjectPath(name), now, now))
+		}
+		require.Zero(t, testutil.ToFloat64(m.metrics.writeRateLimited))
+	})
+
+	t.Run("disabled with a rate of 0", func(t *testing.T) {
+		m := NewUpdater(objstore.NewInMemBucket(), tenantID, log.NewNopLogger(), WithWriteRateLimit(0, 0))
+
+		for _, name := range []string{"a", "b", "c"} {
+			require.NoError(t, m.Update(ctx, testObjectPath(name), now, now))
+		}
+	})
+}
@@ -97,6 +97,9 @@ func (b *Builder) TimeRange() (time.Time, time.Time) {
 	return b.globalMinTimestamp, b.globalMaxTimestamp
 }
 
+// StreamCount returns the number of streams recorded since the last reset.
+func (b *Builder) StreamCount() int { return len(b.ordered) }
+
 // Record a stream record within the section. The provided timestamp is used to
 // track the minimum and maximum timestamp of a stream. The number of calls to
 // Record is used to track the number of rows for a stream. The recordSize is
@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"time"
 	"unsafe"
 
+	"github.com/prometheus/prometheus/model/labels"
+
 	"github.com/grafana/loki/v3/pkg/dataobj"
 	"github.com/grafana/loki/v3/pkg/dataobj/internal/dataset"
 	"github.com/grafana/loki/v3/pkg/dataobj/internal/metadata/datasetmd"
@@ -88,6 +91,80 @@ func IterSection(ctx context.Context, section *Section) result.Seq[Stream] {
 	})
 }
 
+// LabelIter iterates over the labels of the streams in section, one stream at
+// a time. Only the label columns of the section are read, so scanning a
+// section for its labels doesn't decode any other columns or build a
+// [Stream] per row. Iteration stops after the first error.
+func LabelIter(ctx context.Context, section *Section) iter.Seq2[labels.Labels, error] {
+	return func(yield func(labels.Labels, error) bool) {
+		dec := newDecoder(section.reader)
+
+		streamsColumns, err := dec.Columns(ctx)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		dset := wrapDataset(dec)
+
+		allColumns, err := result.Collect(dset.ListColumns(ctx))
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		var (
+			names   []string
+			columns []dataset.Column
+		)
+		for i, column := range streamsColumns {
+			if column.Type != streamsmd.COLUMN_TYPE_LABEL {
+				continue
+			}
+			names = append(names, column.Info.Name)
+			columns = append(columns, allColumns[i])
+		}
+		if len(columns) == 0 {
+			return
+		}
+
+		r := dataset.NewReader(dataset.ReaderOptions{
+			Dataset: dset,
+			Columns: columns,
+		})
+		defer r.Close()
+
+		var rows [1]dataset.Row
+		for {
+			n, err := r.Read(ctx, rows[:])
+			if err != nil && !errors.Is(err, io.EOF) {
+				yield(nil, err)
+				return
+			} else if n == 0 && errors.Is(err, io.EOF) {
+				return
+			}
+
+			for _, row := range rows[:n] {
+				lbls := make(labels.Labels, 0, len(row.Values))
+				for i, value := range row.Values {
+					if value.IsNil() || value.IsZero() {
+						continue
+					}
+					if ty := value.Type(); ty != datasetmd.VALUE_TYPE_BYTE_ARRAY {
+						yield(nil, fmt.Errorf("invalid type %s for %s", ty, streamsmd.COLUMN_TYPE_LABEL))
+						return
+					}
+					lbls = append(lbls, labels.Label{Name: names[i], Value: string(value.ByteArray())})
+				}
+
+				if !yield(lbls, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
 // decodeRow decodes a stream from a [dataset.Row], using the provided columns to
 // determine the column type. The list of columns must match the columns used
 // to create the row.
@@ -0,0 +1,48 @@
+package streams_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/dataobj/sections/streams"
+)
+
+func TestLabelIter(t *testing.T) {
+	expect := []labels.Labels{
+		labels.FromStrings("cluster", "test", "app", "foo"),
+		labels.FromStrings("cluster", "test", "app", "bar"),
+		labels.FromStrings("cluster", "test", "app", "baz"),
+	}
+
+	sec := buildStreamsDecoder(t, 1) // Many pages
+
+	var actual []labels.Labels
+	for lbls, err := range streams.LabelIter(context.Background(), sec) {
+		require.NoError(t, err)
+		actual = append(actual, lbls)
+	}
+	require.Equal(t, expect, actual)
+
+	t.Run("stops early", func(t *testing.T) {
+		var count int
+		for _, err := range streams.LabelIter(context.Background(), sec) {
+			require.NoError(t, err)
+			count++
+			break
+		}
+		require.Equal(t, 1, count)
+	})
+
+	t.Run("matches IterSection", func(t *testing.T) {
+		var fromStreams []labels.Labels
+		for result := range streams.IterSection(context.Background(), sec) {
+			stream, err := result.Value()
+			require.NoError(t, err)
+			fromStreams = append(fromStreams, stream.Labels)
+		}
+		require.Equal(t, fromStreams, actual)
+	})
+}
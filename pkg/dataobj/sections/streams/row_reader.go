@@ -20,7 +20,8 @@ type RowReader struct {
 	sec   *Section
 	ready bool
 
-	predicate RowPredicate
+	predicate  RowPredicate
+	labelsOnly bool
 
 	buf []dataset.Row
 
@@ -56,6 +57,22 @@ func (r *RowReader) SetPredicate(p RowPredicate) error {
 	return nil
 }
 
+// SetLabelsOnly sets whether only the labels of streams are read. When set,
+// the other columns of the section aren't decoded, unless the predicate needs
+// them, and only the Labels field of the streams returned by
+// [RowReader.Read] is set.
+//
+// SetLabelsOnly may only be called before reading begins or after a call to
+// [RowReader.Reset].
+func (r *RowReader) SetLabelsOnly(labelsOnly bool) error {
+	if r.ready {
+		return fmt.Errorf("cannot change columns after reading has started")
+	}
+
+	r.labelsOnly = labelsOnly
+	return nil
+}
+
 // Read reads up to the next len(s) streams from the reader and stores them
 // into s. It returns the number of streams read and any error encountered. At
 // the end of the stream section, Read returns 0, io.EOF.
@@ -84,6 +101,10 @@ func (r *RowReader) Read(ctx context.Context, s []Stream) (int, error) {
 		if err := decodeRow(r.columnDesc, r.buf[i], &s[i], r.symbols); err != nil {
 			return i, fmt.Errorf("decoding stream: %w", err)
 		}
+		if r.labelsOnly {
+			// Drop fields left over from previous reads or decoded for the predicate.
+			s[i] = Stream{Labels: s[i].Labels}
+		}
 	}
 
 	return n, nil
@@ -108,6 +129,10 @@ func (r *RowReader) initReader(ctx context.Context) error {
 		predicates = append(predicates, p)
 	}
 
+	if r.labelsOnly {
+		columns, columnDescs = projectLabelColumns(columns, columnDescs, predicates)
+	}
+
 	readerOpts := dataset.ReaderOptions{
 		Dataset:    dset,
 		Columns:    columns,
@@ -137,13 +162,14 @@ func (r *RowReader) initReader(ctx context.Context) error {
 // Reset resets the RowReader with a new decoder to read from. Reset allows
 // reusing a RowReader without allocating a new one.
 //
-// Any set predicate is cleared when Reset is called.
+// Any set predicate and labels-only mode are cleared when Reset is called.
 //
 // Reset may be called with a nil object and a negative section index to clear
 // the RowReader without needing a new object.
 func (r *RowReader) Reset(sec *Section) {
 	r.sec = sec
 	r.predicate = nil
+	r.labelsOnly = false
 	r.ready = false
 	r.columns = nil
 	r.columnDesc = nil
@@ -165,6 +191,43 @@ func (r *RowReader) Close() error {
 	return nil
 }
 
+// projectLabelColumns returns the label columns and the columns referenced by
+// predicates, along with their descriptions.
+func projectLabelColumns(columns []dataset.Column, columnDescs []*streamsmd.ColumnDesc, predicates []dataset.Predicate) ([]dataset.Column, []*streamsmd.ColumnDesc) {
+	referenced := make(map[dataset.Column]struct{})
+	for _, p := range predicates {
+		dataset.WalkPredicate(p, func(p dataset.Predicate) bool {
+			switch p := p.(type) {
+			case dataset.EqualPredicate:
+				referenced[p.Column] = struct{}{}
+			case dataset.InPredicate:
+				referenced[p.Column] = struct{}{}
+			case dataset.GreaterThanPredicate:
+				referenced[p.Column] = struct{}{}
+			case dataset.LessThanPredicate:
+				referenced[p.Column] = struct{}{}
+			case dataset.FuncPredicate:
+				referenced[p.Column] = struct{}{}
+			}
+			return true
+		})
+	}
+
+	var (
+		projected      = make([]dataset.Column, 0, len(columns))
+		projectedDescs = make([]*streamsmd.ColumnDesc, 0, len(columnDescs))
+	)
+	for i, column := range columns {
+		_, ok := referenced[column]
+		if !ok && columnDescs[i].Type != streamsmd.COLUMN_TYPE_LABEL {
+			continue
+		}
+		projected = append(projected, column)
+		projectedDescs = append(projectedDescs, columnDescs[i])
+	}
+	return projected, projectedDescs
+}
+
 func translateStreamsPredicate(p RowPredicate, columns []dataset.Column, columnDesc []*streamsmd.ColumnDesc) dataset.Predicate {
 	if p == nil {
 		return nil
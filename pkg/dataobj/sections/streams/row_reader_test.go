@@ -79,6 +79,44 @@ func TestRowReader_AddLabelFilter(t *testing.T) {
 	require.Equal(t, expect, actual)
 }
 
+func TestRowReader_SetLabelsOnly(t *testing.T) {
+	t.Run("labels only", func(t *testing.T) {
+		expect := []streams.Stream{
+			{Labels: labels.FromStrings("cluster", "test", "app", "foo")},
+			{Labels: labels.FromStrings("cluster", "test", "app", "bar")},
+			{Labels: labels.FromStrings("cluster", "test", "app", "baz")},
+		}
+
+		dec := buildStreamsDecoder(t, 1) // Many pages
+		r := streams.NewRowReader(dec)
+		require.NoError(t, r.SetLabelsOnly(true))
+
+		actual, err := readAllStreams(context.Background(), r)
+		require.NoError(t, err)
+		require.Equal(t, expect, actual)
+	})
+
+	t.Run("with time range predicate", func(t *testing.T) {
+		expect := []streams.Stream{
+			{Labels: labels.FromStrings("cluster", "test", "app", "baz")},
+		}
+
+		dec := buildStreamsDecoder(t, 1) // Many pages
+		r := streams.NewRowReader(dec)
+		require.NoError(t, r.SetLabelsOnly(true))
+		require.NoError(t, r.SetPredicate(streams.TimeRangeRowPredicate{
+			StartTime:    unixTime(21),
+			EndTime:      unixTime(40),
+			IncludeStart: true,
+			IncludeEnd:   true,
+		}))
+
+		actual, err := readAllStreams(context.Background(), r)
+		require.NoError(t, err)
+		require.Equal(t, expect, actual)
+	})
+}
+
 func unixTime(sec int64) time.Time { return time.Unix(sec, 0) }
 
 func buildStreamsDecoder(t *testing.T, pageSize int) *streams.Section {
@@ -142,3 +142,24 @@ func ReadStats(ctx context.Context, section *Section) (Stats, error) {
 
 	return stats, nil
 }
+
+// LabelNames returns the names of the label columns of the streams section,
+// in the order the columns are stored in. Only the section metadata is read,
+// which lists a column for every label name of the section's streams.
+// LabelNames returns an error if the section metadata couldn't be read or if
+// the provided ctx is canceled.
+func LabelNames(ctx context.Context, section *Section) ([]string, error) {
+	dec := newDecoder(section.reader)
+	cols, err := dec.Columns(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading columns: %w", err)
+	}
+
+	var names []string
+	for _, col := range cols {
+		if col.Type == streamsmd.COLUMN_TYPE_LABEL {
+			names = append(names, col.Info.Name)
+		}
+	}
+	return names, nil
+}
@@ -31,3 +31,14 @@ func Open(_ context.Context, section *dataobj.Section) (*Section, error) {
 	// TODO(rfratto): pre-load metadata to expose column information to callers.
 	return &Section{reader: section.Reader}, nil
 }
+
+// OpenAt opens the section at index i of object, as numbered by
+// [dataobj.Object.Sections]. OpenAt returns an error if i is out of range or
+// the section is not a streams section.
+func OpenAt(ctx context.Context, object *dataobj.Object, i int) (*Section, error) {
+	section, err := object.SectionAt(i)
+	if err != nil {
+		return nil, err
+	}
+	return Open(ctx, section)
+}
@@ -37,6 +37,8 @@ type ClosableHealthAndIngesterClient struct {
 	logproto.StreamDataClient
 	grpc_health_v1.HealthClient
 	io.Closer
+
+	inFlight *inFlight
 }
 
 // Config for an ingester client.
@@ -44,6 +46,7 @@ type Config struct {
 	PoolConfig                   clientpool.PoolConfig          `yaml:"pool_config,omitempty" doc:"description=Configures how connections are pooled."`
 	RemoteTimeout                time.Duration                  `yaml:"remote_timeout,omitempty"`
 	GRPCClientConfig             grpcclient.Config              `yaml:"grpc_client_config" doc:"description=Configures how the gRPC connection to ingesters work as a client."`
+	RetryConfig                  RetryConfig                    `yaml:"retry_config" doc:"description=Configures retries of failed requests to ingesters."`
 	GRPCUnaryClientInterceptors  []grpc.UnaryClientInterceptor  `yaml:"-"`
 	GRCPStreamClientInterceptors []grpc.StreamClientInterceptor `yaml:"-"`
 
@@ -57,6 +60,7 @@ type Config struct {
 func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	cfg.GRPCClientConfig.RegisterFlagsWithPrefix("ingester.client", f)
 	cfg.PoolConfig.RegisterFlagsWithPrefix("distributor.", f)
+	cfg.RetryConfig.RegisterFlagsWithPrefix("ingester.client.retry", f)
 
 	f.DurationVar(&cfg.PoolConfig.RemoteTimeout, "ingester.client.healthcheck-timeout", 1*time.Second, "How quickly a dead client will be removed after it has been detected to disappear. Set this to a value to allow time for a secondary health check to recover the missing client.")
 	f.DurationVar(&cfg.RemoteTimeout, "ingester.client.timeout", 5*time.Second, "The remote request timeout on the client side.")
@@ -68,7 +72,10 @@ func New(cfg Config, addr string) (HealthAndIngesterClient, error) {
 		grpc.WithDefaultCallOptions(cfg.GRPCClientConfig.CallOptions()...),
 	}
 
+	inFlight := &inFlight{}
 	unaryInterceptors, streamInterceptors := instrumentation(&cfg)
+	unaryInterceptors = append(unaryInterceptors, inFlight.unaryClientInterceptor)
+	streamInterceptors = append(streamInterceptors, inFlight.streamClientInterceptor)
 	dialOpts, err := cfg.GRPCClientConfig.DialOption(unaryInterceptors, streamInterceptors, middleware.NoOpInvalidClusterValidationReporter)
 	if err != nil {
 		return nil, err
@@ -88,6 +95,7 @@ func New(cfg Config, addr string) (HealthAndIngesterClient, error) {
 		StreamDataClient: logproto.NewStreamDataClient(conn),
 		HealthClient:     grpc_health_v1.NewHealthClient(conn),
 		Closer:           conn,
+		inFlight:         inFlight,
 	}, nil
 }
 
@@ -99,6 +107,10 @@ func instrumentation(cfg *Config) ([]grpc.UnaryClientInterceptor, []grpc.StreamC
 	if !cfg.Internal {
 		unaryInterceptors = append(unaryInterceptors, middleware.ClientUserHeaderInterceptor)
 	}
+	if cfg.RetryConfig.MaxRetries > 0 {
+		// Retry before instrumenting so every attempt is observed.
+		unaryInterceptors = append(unaryInterceptors, RetryUnaryClientInterceptor(cfg.RetryConfig))
+	}
 	unaryInterceptors = append(unaryInterceptors, middleware.UnaryClientInstrumentInterceptor(ingesterClientRequestDuration))
 
 	var streamInterceptors []grpc.StreamClientInterceptor
@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+
+	"go.uber.org/atomic"
+	"google.golang.org/grpc"
+)
+
+// inFlight counts the requests of a client which haven't completed yet.
+type inFlight struct {
+	unary  atomic.Int64
+	stream atomic.Int64
+}
+
+// unaryClientInterceptor counts unary requests while they are in flight.
+func (f *inFlight) unaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	f.unary.Inc()
+	defer f.unary.Dec()
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// streamClientInterceptor counts streams from when they are opened until they
+// finish, which cancels their context.
+func (f *inFlight) streamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	f.stream.Inc()
+	context.AfterFunc(stream.Context(), func() { f.stream.Dec() })
+	return stream, nil
+}
+
+// InFlight returns the number of unary requests and streams of the client
+// which haven't completed yet, e.g. to prefer less loaded clients.
+func (c ClosableHealthAndIngesterClient) InFlight() (unary, stream int) {
+	if c.inFlight == nil {
+		return 0, 0
+	}
+	return int(c.inFlight.unary.Load()), int(c.inFlight.stream.Load())
+}
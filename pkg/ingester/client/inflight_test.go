@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+type fakeClientStream struct {
+	grpc.ClientStream
+	ctx context.Context
+}
+
+func (s fakeClientStream) Context() context.Context { return s.ctx }
+
+func TestInFlight(t *testing.T) {
+	f := &inFlight{}
+	c := ClosableHealthAndIngesterClient{inFlight: f}
+
+	// Unary requests are counted while the invoker runs.
+	err := f.unaryClientInterceptor(context.Background(), "method", nil, nil, nil, func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+		unary, stream := c.InFlight()
+		require.Equal(t, 1, unary)
+		require.Equal(t, 0, stream)
+		return nil
+	})
+	require.NoError(t, err)
+	unary, _ := c.InFlight()
+	require.Equal(t, 0, unary)
+
+	// Streams are counted until their context is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = f.streamClientInterceptor(ctx, &grpc.StreamDesc{}, nil, "method", func(ctx context.Context, _ *grpc.StreamDesc, _ *grpc.ClientConn, _ string, _ ...grpc.CallOption) (grpc.ClientStream, error) {
+		return fakeClientStream{ctx: ctx}, nil
+	})
+	require.NoError(t, err)
+	_, stream := c.InFlight()
+	require.Equal(t, 1, stream)
+
+	cancel()
+	require.Eventually(t, func() bool {
+		_, stream := c.InFlight()
+		return stream == 0
+	}, time.Second, time.Millisecond)
+
+	// Clients not created by New have nothing in flight.
+	unary, stream = ClosableHealthAndIngesterClient{}.InFlight()
+	require.Zero(t, unary)
+	require.Zero(t, stream)
+}
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"flag"
+	"strconv"
+	"time"
+
+	"github.com/grafana/dskit/backoff"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// retryAfterTrailer is the trailer an overloaded ingester may send with a
+	// ResourceExhausted response, holding the seconds to wait before retrying.
+	retryAfterTrailer = "retry-after"
+
+	// maxRetryAfter caps the delay requested by a retry-after trailer.
+	maxRetryAfter = 30 * time.Second
+)
+
+var (
+	ingesterClientResourceExhausted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "loki_ingester_client_resource_exhausted_total",
+		Help: "Total number of requests rejected by ingesters because they were out of resources.",
+	})
+	ingesterClientResourceExhaustedBackoff = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "loki_ingester_client_resource_exhausted_backoff_seconds_total",
+		Help: "Total time waited before retrying requests rejected by ingesters because they were out of resources.",
+	})
+)
+
+// RetryClassifier decides whether a failed request should be retried. attempt
+// is the number of attempts made so far, starting at 1 for the first failure.
+type RetryClassifier func(err error, attempt int) bool
+
+// DefaultRetryClassifier retries requests which failed because the ingester
+// was unavailable or out of resources; all other errors are returned as-is.
+func DefaultRetryClassifier(err error, _ int) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return true
+	default:
+		return false
+	}
+}
+
+// RetryConfig configures retries of failed unary ingester requests.
+type RetryConfig struct {
+	MaxRetries int           `yaml:"max_retries"`
+	MinBackoff time.Duration `yaml:"min_backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+
+	ResourceExhaustedBackoff time.Duration `yaml:"resource_exhausted_backoff"`
+	HonorRetryAfter          bool          `yaml:"honor_retry_after"`
+
+	// Classifier decides which errors are retried. DefaultRetryClassifier is
+	// used when unset.
+	Classifier RetryClassifier `yaml:"-"`
+}
+
+// RegisterFlagsWithPrefix registers flags.
+func (cfg *RetryConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.IntVar(&cfg.MaxRetries, prefix+".max-retries", 0, "Maximum number of times a failed unary request to an ingester is retried. 0 disables retries.")
+	f.DurationVar(&cfg.MinBackoff, prefix+".min-backoff", 100*time.Millisecond, "Minimum delay before retrying a failed request.")
+	f.DurationVar(&cfg.MaxBackoff, prefix+".max-backoff", time.Second, "Maximum delay before retrying a failed request.")
+	f.DurationVar(&cfg.ResourceExhaustedBackoff, prefix+".resource-exhausted-backoff", time.Second, "Minimum delay before retrying a request rejected because the ingester is out of resources, so overloaded ingesters get time to recover.")
+	f.BoolVar(&cfg.HonorRetryAfter, prefix+".honor-retry-after", false, "Wait for the delay sent by an ingester in a retry-after trailer before retrying a request it rejected because it is out of resources, if it is longer than the backoff. The delay is capped at 30s.")
+}
+
+// RetryUnaryClientInterceptor retries failed unary requests for which the
+// configured classifier returns true, up to cfg.MaxRetries times. Requests
+// rejected with ResourceExhausted wait at least cfg.ResourceExhaustedBackoff,
+// or the delay of the retry-after trailer if cfg.HonorRetryAfter is set,
+// before they are retried.
+func RetryUnaryClientInterceptor(cfg RetryConfig) grpc.UnaryClientInterceptor {
+	classify := cfg.Classifier
+	if classify == nil {
+		classify = DefaultRetryClassifier
+	}
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		b := backoff.New(ctx, backoff.Config{
+			MinBackoff: cfg.MinBackoff,
+			MaxBackoff: cfg.MaxBackoff,
+		})
+
+		for attempt := 1; ; attempt++ {
+			var trailer metadata.MD
+			err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Trailer(&trailer))...)
+			exhausted := status.Code(err) == codes.ResourceExhausted
+			if exhausted {
+				ingesterClientResourceExhausted.Inc()
+			}
+			if err == nil || attempt > cfg.MaxRetries || !classify(err, attempt) {
+				return err
+			}
+
+			delay := b.NextDelay()
+			if exhausted {
+				delay = max(delay, cfg.ResourceExhaustedBackoff)
+				if retryAfter, ok := parseRetryAfter(trailer); ok && cfg.HonorRetryAfter {
+					delay = max(delay, retryAfter)
+				}
+				ingesterClientResourceExhaustedBackoff.Add(delay.Seconds())
+			}
+			if !sleep(ctx, delay) {
+				// Return the request error rather than the context error, as
+				// it's more useful to the caller.
+				return err
+			}
+		}
+	}
+}
+
+// parseRetryAfter returns the delay of the retry-after trailer, capped at maxRetryAfter.
+func parseRetryAfter(trailer metadata.MD) (time.Duration, bool) {
+	values := trailer.Get(retryAfterTrailer)
+	if len(values) == 0 {
+		return 0, false
+	}
+	seconds, err := strconv.ParseFloat(values[0], 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return min(time.Duration(seconds*float64(time.Second)), maxRetryAfter), true
+}
+
+// sleep waits for d and returns false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryUnaryClientInterceptor(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	invalid := status.Error(codes.InvalidArgument, "invalid")
+
+	for _, tc := range []struct {
+		name         string
+		cfg          RetryConfig
+		errs         []error
+		expectErr    error
+		expectCalled int
+	}{
+		{
+			name:         "succeeds without retries",
+			cfg:          RetryConfig{MaxRetries: 3},
+			errs:         []error{nil},
+			expectCalled: 1,
+		},
+		{
+			name:         "retries retryable errors",
+			cfg:          RetryConfig{MaxRetries: 3},
+			errs:         []error{unavailable, unavailable, nil},
+			expectCalled: 3,
+		},
+		{
+			name:         "does not retry non-retryable errors",
+			cfg:          RetryConfig{MaxRetries: 3},
+			errs:         []error{invalid, nil},
+			expectErr:    invalid,
+			expectCalled: 1,
+		},
+		{
+			name:         "gives up after max retries",
+			cfg:          RetryConfig{MaxRetries: 2},
+			errs:         []error{unavailable, unavailable, unavailable, nil},
+			expectErr:    unavailable,
+			expectCalled: 3,
+		},
+		{
+			name: "custom classifier",
+			cfg: RetryConfig{MaxRetries: 3, Classifier: func(err error, attempt int) bool {
+				return status.Code(err) == codes.Unavailable && attempt == 1
+			}},
+			errs:         []error{unavailable, unavailable, nil},
+			expectErr:    unavailable,
+			expectCalled: 2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.MinBackoff = time.Millisecond
+			tc.cfg.MaxBackoff = time.Millisecond
+
+			var called int
+			invoker := func(_ context.Context, _ string, _, _ interface{}, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+				err := tc.errs[called]
+				called++
+				return err
+			}
+
+			err := RetryUnaryClientInterceptor(tc.cfg)(context.Background(), "/test", nil, nil, nil, invoker)
+			require.Equal(t, tc.expectErr, err)
+			require.Equal(t, tc.expectCalled, called)
+		})
+	}
+}
+
+func TestRetryUnaryClientInterceptorResourceExhausted(t *testing.T) {
+	exhausted := status.Error(codes.ResourceExhausted, "exhausted")
+
+	for _, tc := range []struct {
+		name        string
+		cfg         RetryConfig
+		retryAfter  string
+		expectDelay time.Duration
+	}{
+		{
+			name:        "backs off at least the resource exhausted backoff",
+			cfg:         RetryConfig{ResourceExhaustedBackoff: 20 * time.Millisecond},
+			expectDelay: 20 * time.Millisecond,
+		},
+		{
+			name:        "ignores retry-after unless honored",
+			cfg:         RetryConfig{ResourceExhaustedBackoff: 20 * time.Millisecond},
+			retryAfter:  "0.05",
+			expectDelay: 20 * time.Millisecond,
+		},
+		{
+			name:        "honors retry-after",
+			cfg:         RetryConfig{ResourceExhaustedBackoff: 20 * time.Millisecond, HonorRetryAfter: true},
+			retryAfter:  "0.05",
+			expectDelay: 50 * time.Millisecond,
+		},
+		{
+			name:        "ignores invalid retry-after",
+			cfg:         RetryConfig{ResourceExhaustedBackoff: 20 * time.Millisecond, HonorRetryAfter: true},
+			retryAfter:  "soon",
+			expectDelay: 20 * time.Millisecond,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.MaxRetries = 1
+			tc.cfg.MinBackoff = time.Millisecond
+			tc.cfg.MaxBackoff = time.Millisecond
+
+			var called int
+			invoker := func(_ context.Context, _ string, _, _ interface{}, _ *grpc.ClientConn, opts ...grpc.CallOption) error {
+				called++
+				if called > 1 {
+					return nil
+				}
+				for _, opt := range opts {
+					if trailer, ok := opt.(grpc.TrailerCallOption); ok && tc.retryAfter != "" {
+						*trailer.TrailerAddr = metadata.Pairs(retryAfterTrailer, tc.retryAfter)
+					}
+				}
+				return exhausted
+			}
+
+			exhaustedBefore := testutil.ToFloat64(ingesterClientResourceExhausted)
+			backoffBefore := testutil.ToFloat64(ingesterClientResourceExhaustedBackoff)
+
+			start := time.Now()
+			require.NoError(t, RetryUnaryClientInterceptor(tc.cfg)(context.Background(), "/test", nil, nil, nil, invoker))
+			require.GreaterOrEqual(t, time.Since(start), tc.expectDelay)
+			require.Equal(t, 2, called)
+
+			require.Equal(t, float64(1), testutil.ToFloat64(ingesterClientResourceExhausted)-exhaustedBefore)
+			require.InDelta(t, tc.expectDelay.Seconds(), testutil.ToFloat64(ingesterClientResourceExhaustedBackoff)-backoffBefore, 1e-9)
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	_, ok := parseRetryAfter(nil)
+	require.False(t, ok)
+
+	d, ok := parseRetryAfter(metadata.Pairs(retryAfterTrailer, "2"))
+	require.True(t, ok)
+	require.Equal(t, 2*time.Second, d)
+
+	d, ok = parseRetryAfter(metadata.Pairs(retryAfterTrailer, "3600"))
+	require.True(t, ok)
+	require.Equal(t, maxRetryAfter, d)
+
+	_, ok = parseRetryAfter(metadata.Pairs(retryAfterTrailer, "-1"))
+	require.False(t, ok)
+}
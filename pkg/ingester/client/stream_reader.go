@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ingesterClientStreamReceivedBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "loki_ingester_client_stream_received_bytes_total",
+		Help: "Total number of bytes received from ingesters on streaming reads.",
+	}, []string{"operation"})
+	ingesterClientStreamReceivedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "loki_ingester_client_stream_received_messages_total",
+		Help: "Total number of messages received from ingesters on streaming reads.",
+	}, []string{"operation"})
+)
+
+// StreamStats holds statistics about the messages received on a stream.
+type StreamStats struct {
+	Bytes    int64
+	Messages int64
+
+	// FirstMessage and LastMessage are the times the first and last messages were received.
+	FirstMessage time.Time
+	LastMessage  time.Time
+
+	// Duration is the time it took to drain the stream. It is only set by [CollectStream].
+	Duration time.Duration
+}
+
+// StreamReader wraps the Recv function of a gRPC client stream and
+// accumulates statistics about the messages received from it. The statistics
+// are added to the metrics for the operation once the stream ends.
+type StreamReader[T any] struct {
+	operation string
+	recv      func() (T, error)
+
+	stats StreamStats
+	done  bool
+}
+
+// NewStreamReader returns a StreamReader for the stream receive function recv, e.g.
+//
+//	NewStreamReader("query", stream.Recv)
+func NewStreamReader[T any](operation string, recv func() (T, error)) *StreamReader[T] {
+	return &StreamReader[T]{
+		operation: operation,
+		recv:      recv,
+	}
+}
+
+// Recv receives the next message from the stream. Any error, including
+// io.EOF, ends the stream.
+func (r *StreamReader[T]) Recv() (T, error) {
+	msg, err := r.recv()
+	if err != nil {
+		r.finish()
+		return msg, err
+	}
+
+	now := time.Now()
+	if r.stats.Messages == 0 {
+		r.stats.FirstMessage = now
+	}
+	r.stats.LastMessage = now
+	r.stats.Messages++
+	if sizer, ok := any(msg).(interface{ Size() int }); ok {
+		r.stats.Bytes += int64(sizer.Size())
+	}
+	return msg, nil
+}
+
+// Stats returns the statistics accumulated so far.
+func (r *StreamReader[T]) Stats() StreamStats {
+	return r.stats
+}
+
+func (r *StreamReader[T]) finish() {
+	if r.done {
+		return
+	}
+	r.done = true
+	ingesterClientStreamReceivedBytes.WithLabelValues(r.operation).Add(float64(r.stats.Bytes))
+	ingesterClientStreamReceivedMessages.WithLabelValues(r.operation).Add(float64(r.stats.Messages))
+}
+
+// CollectStream drains the stream receive function recv, e.g. stream.Recv of
+// a query, and returns all messages received along with the statistics of the
+// stream. It stops early if ctx is canceled, and returns the messages received
+// so far along with the error which ended the stream, if it wasn't io.EOF.
+func CollectStream[T any](ctx context.Context, operation string, recv func() (T, error)) ([]T, StreamStats, error) {
+	var (
+		start = time.Now()
+		r     = NewStreamReader(operation, recv)
+		msgs  []T
+	)
+	stats := func() StreamStats {
+		stats := r.Stats()
+		stats.Duration = time.Since(start)
+		return stats
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			r.finish()
+			return msgs, stats(), err
+		}
+		msg, err := r.Recv()
+		if err == io.EOF {
+			return msgs, stats(), nil
+		} else if err != nil {
+			return msgs, stats(), err
+		}
+		msgs = append(msgs, msg)
+	}
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/logproto"
+)
+
+func TestStreamReader(t *testing.T) {
+	responses := []*logproto.QueryResponse{
+		{Streams: []logproto.Stream{{Labels: `{app="foo"}`}}},
+		{Streams: []logproto.Stream{{Labels: `{app="bar"}`}, {Labels: `{app="baz"}`}}},
+	}
+	expectedBytes := int64(responses[0].Size() + responses[1].Size())
+
+	var i int
+	r := NewStreamReader("test", func() (*logproto.QueryResponse, error) {
+		if i == len(responses) {
+			return nil, io.EOF
+		}
+		i++
+		return responses[i-1], nil
+	})
+
+	for {
+		_, err := r.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+	}
+	// Receiving again after the end of the stream must not count twice.
+	_, err := r.Recv()
+	require.Equal(t, io.EOF, err)
+
+	stats := r.Stats()
+	require.Equal(t, int64(2), stats.Messages)
+	require.Equal(t, expectedBytes, stats.Bytes)
+	require.False(t, stats.FirstMessage.IsZero())
+	require.False(t, stats.LastMessage.Before(stats.FirstMessage))
+
+	require.Equal(t, float64(2), testutil.ToFloat64(ingesterClientStreamReceivedMessages.WithLabelValues("test")))
+	require.Equal(t, float64(expectedBytes), testutil.ToFloat64(ingesterClientStreamReceivedBytes.WithLabelValues("test")))
+}
+
+func TestCollectStream(t *testing.T) {
+	responses := []*logproto.QueryResponse{
+		{Streams: []logproto.Stream{{Labels: `{app="foo"}`}}},
+		{Streams: []logproto.Stream{{Labels: `{app="bar"}`}}},
+	}
+
+	// recv returns responses followed by err.
+	recv := func(err error) func() (*logproto.QueryResponse, error) {
+		var i int
+		return func() (*logproto.QueryResponse, error) {
+			if i == len(responses) {
+				return nil, err
+			}
+			i++
+			return responses[i-1], nil
+		}
+	}
+
+	t.Run("drains the stream", func(t *testing.T) {
+		msgs, stats, err := CollectStream(context.Background(), "collect", recv(io.EOF))
+		require.NoError(t, err)
+		require.Equal(t, responses, msgs)
+		require.Equal(t, int64(2), stats.Messages)
+		require.Equal(t, int64(responses[0].Size()+responses[1].Size()), stats.Bytes)
+		require.Positive(t, stats.Duration)
+		require.Equal(t, float64(2), testutil.ToFloat64(ingesterClientStreamReceivedMessages.WithLabelValues("collect")))
+	})
+
+	t.Run("propagates stream errors", func(t *testing.T) {
+		streamErr := errors.New("stream failed")
+		msgs, stats, err := CollectStream(context.Background(), "collect-error", recv(streamErr))
+		require.ErrorIs(t, err, streamErr)
+		require.Equal(t, responses, msgs)
+		require.Equal(t, int64(2), stats.Messages)
+	})
+
+	t.Run("stops on context cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		msgs, stats, err := CollectStream(ctx, "collect-canceled", recv(io.EOF))
+		require.ErrorIs(t, err, context.Canceled)
+		require.Empty(t, msgs)
+		require.Zero(t, stats.Messages)
+	})
+}
@@ -9,6 +9,8 @@ type Metrics struct {
 	tailsActive         prometheus.Gauge
 	tailedStreamsActive prometheus.Gauge
 	tailedBytesTotal    prometheus.Counter
+	reconnectsTotal     prometheus.Counter
+	resumeGap           prometheus.Histogram
 }
 
 func NewMetrics(r prometheus.Registerer) *Metrics {
@@ -25,5 +27,15 @@ func NewMetrics(r prometheus.Registerer) *Metrics {
 			Name: "loki_querier_tail_bytes_total",
 			Help: "total bytes tailed",
 		}),
+		reconnectsTotal: promauto.With(r).NewCounter(prometheus.CounterOpts{
+			Name: "loki_querier_tail_reconnects_total",
+			Help: "Total number of tail connections to ingesters re-established after they were dropped",
+		}),
+		resumeGap: promauto.With(r).NewHistogram(prometheus.HistogramOpts{
+			Name: "loki_querier_tail_resume_gap_seconds",
+			Help: "Time between a tail connection to an ingester being dropped and re-established, during which entries pushed to the ingester are not tailed",
+			// 100ms -> ~7min
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 13),
+		}),
 	}
 }
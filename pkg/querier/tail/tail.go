@@ -51,6 +51,7 @@ type Tailer struct {
 	tailDisconnectedIngesters func([]string) (map[string]logproto.Querier_TailClient, error)
 
 	querierTailClients    map[string]logproto.Querier_TailClient // addr -> grpc clients for tailing logs from ingesters
+	droppedTailClients    map[string]time.Time                   // addr -> time the grpc client for tailing logs from the ingester was dropped
 	querierTailClientsMtx sync.RWMutex
 
 	stopped          atomic.Bool
@@ -193,6 +194,13 @@ func (t *Tailer) checkIngesterConnections() error {
 
 	if len(newConnections) != 0 {
 		for addr, tailClient := range newConnections {
+			if dropped, ok := t.droppedTailClients[addr]; ok {
+				// Ingesters only tail entries pushed after a connection is
+				// established, so entries pushed in between are missed.
+				t.metrics.reconnectsTotal.Inc()
+				t.metrics.resumeGap.Observe(time.Since(dropped).Seconds())
+				delete(t.droppedTailClients, addr)
+			}
 			t.querierTailClients[addr] = tailClient
 			go t.readTailClient(addr, tailClient)
 		}
@@ -206,6 +214,9 @@ func (t *Tailer) dropTailClient(addr string) {
 	defer t.querierTailClientsMtx.Unlock()
 
 	delete(t.querierTailClients, addr)
+	if !t.stopped.Load() {
+		t.droppedTailClients[addr] = time.Now()
+	}
 }
 
 // keeps reading streams from grpc connection with ingesters
@@ -329,6 +340,7 @@ func newTailer(
 	t := Tailer{
 		openStreamIterator:        iter.NewMergeEntryIterator(context.Background(), []iter.EntryIterator{historicEntriesIter}, logproto.FORWARD),
 		querierTailClients:        querierTailClients,
+		droppedTailClients:        make(map[string]time.Time),
 		delayFor:                  delayFor,
 		responseChan:              make(chan *loghttp.TailResponse, maxBufferedTailResponses),
 		closeErrChan:              make(chan error),
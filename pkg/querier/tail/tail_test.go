@@ -1,11 +1,14 @@
 package tail
 
 import (
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/pkg/errors"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/stretchr/testify/require"
 	"gotest.tools/assert"
@@ -172,6 +175,39 @@ func TestTailer(t *testing.T) {
 	}
 }
 
+func TestTailerReconnect(t *testing.T) {
+	dropped := newTailClientMock()
+	dropped.On("Recv").Return((*logproto.TailResponse)(nil), errors.New("ingester shutting down"))
+
+	reconnected := newTailClientMock().mockRecvWithTrigger(mockTailResponse(logproto.Stream{
+		Labels:  `{type="test"}`,
+		Entries: []logproto.Entry{{Timestamp: time.Unix(0, 1), Line: "line"}},
+	}))
+	tailDisconnectedIngesters := func(connected []string) (map[string]logproto.Querier_TailClient, error) {
+		if slices.Contains(connected, "test") {
+			return map[string]logproto.Querier_TailClient{}, nil
+		}
+		return map[string]logproto.Querier_TailClient{"test": reconnected}, nil
+	}
+
+	metrics := NewMetrics(nil)
+	tailer := newTailer(0, map[string]logproto.Querier_TailClient{"test": dropped}, iter.NoopEntryIterator, tailDisconnectedIngesters, timeout, throttle, false, metrics, log.NewNopLogger())
+	defer tailer.close()
+
+	require.Eventually(t, func() bool {
+		return promtestutil.ToFloat64(metrics.reconnectsTotal) == 1
+	}, timeout, throttle)
+	var gap dto.Metric
+	require.NoError(t, metrics.resumeGap.Write(&gap))
+	require.Equal(t, uint64(1), gap.GetHistogram().GetSampleCount())
+
+	// The tailer keeps tailing from the reconnected ingester.
+	reconnected.triggerRecv()
+	responses, err := readFromTailer(tailer, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, countEntriesInStreams(responses[0].Streams))
+}
+
 func TestCategorizedLabels(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/loki/v3/pkg/util/constants"
+)
+
+type bestEffortCache struct {
+	Cache
+	logger log.Logger
+
+	suppressed *prometheus.CounterVec
+}
+
+// NewBestEffort makes a new cache which never fails its callers: errors of
+// cache are logged and counted, fetches which fail return all keys as missing
+// and stores which fail return nil. This suits callers which treat the cache
+// as strictly best-effort, so an outage of the backend can't fail queries.
+//
+// StoreIfAbsent still returns [ErrUnsupported], as it reports a capability of
+// cache rather than a failure.
+func NewBestEffort(name string, cache Cache, logger log.Logger, reg prometheus.Registerer) Cache {
+	return &bestEffortCache{
+		Cache:  cache,
+		logger: logger,
+
+		suppressed: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace:   constants.Loki,
+			Name:        "cache_errors_suppressed_total",
+			Help:        "Total count of cache errors which were suppressed instead of returned to the caller.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}, []string{"method"}),
+	}
+}
+
+// suppress logs and counts err.
+func (c *bestEffortCache) suppress(method string, err error) {
+	level.Warn(c.logger).Log("msg", "suppressed cache error", "method", method, "err", err)
+	c.suppressed.WithLabelValues(method).Inc()
+}
+
+func (c *bestEffortCache) Store(ctx context.Context, keys []string, bufs [][]byte) error {
+	if err := c.Cache.Store(ctx, keys, bufs); err != nil {
+		c.suppress("store", err)
+	}
+	return nil
+}
+
+func (c *bestEffortCache) StoreIfAbsent(ctx context.Context, key string, value []byte) (bool, error) {
+	stored, err := c.Cache.StoreIfAbsent(ctx, key, value)
+	if err != nil && !errors.Is(err, ErrUnsupported) {
+		c.suppress("store_if_absent", err)
+		return false, nil
+	}
+	return stored, err
+}
+
+func (c *bestEffortCache) Fetch(ctx context.Context, keys []string) ([]string, [][]byte, []string, error) {
+	found, bufs, missing, err := c.Cache.Fetch(ctx, keys)
+	if err != nil {
+		c.suppress("fetch", err)
+		return nil, nil, keys, nil
+	}
+	return found, bufs, missing, nil
+}
+
+func (c *bestEffortCache) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	value, err := c.Cache.FetchRange(ctx, key, offset, length)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		c.suppress("fetch_range", err)
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (c *bestEffortCache) Exists(ctx context.Context, keys []string) ([]string, []string, error) {
+	present, missing, err := c.Cache.Exists(ctx, keys)
+	if err != nil {
+		c.suppress("exists", err)
+		return nil, keys, nil
+	}
+	return present, missing, nil
+}
@@ -0,0 +1,62 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/storage/chunk/cache"
+)
+
+func TestBestEffort(t *testing.T) {
+	ctx := context.Background()
+	backend := cache.NewMockCache()
+	reg := prometheus.NewRegistry()
+	c := cache.NewBestEffort("test", backend, log.NewNopLogger(), reg)
+
+	// Without errors, calls are passed through.
+	require.NoError(t, c.Store(ctx, []string{"a"}, [][]byte{[]byte("value")}))
+	found, _, missing, err := c.Fetch(ctx, []string{"a", "b"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, found)
+	require.Equal(t, []string{"b"}, missing)
+
+	outage := errors.New("cache unavailable")
+	backend.SetErr(outage, outage)
+
+	require.NoError(t, c.Store(ctx, []string{"c"}, [][]byte{[]byte("value")}))
+	stored, err := c.StoreIfAbsent(ctx, "c", []byte("value"))
+	require.NoError(t, err)
+	require.False(t, stored)
+
+	found, bufs, missing, err := c.Fetch(ctx, []string{"a", "b"})
+	require.NoError(t, err)
+	require.Empty(t, found)
+	require.Empty(t, bufs)
+	require.Equal(t, []string{"a", "b"}, missing)
+
+	present, missing, err := c.Exists(ctx, []string{"a"})
+	require.NoError(t, err)
+	require.Empty(t, present)
+	require.Equal(t, []string{"a"}, missing)
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP loki_cache_errors_suppressed_total Total count of cache errors which were suppressed instead of returned to the caller.
+# TYPE loki_cache_errors_suppressed_total counter
+loki_cache_errors_suppressed_total{method="exists",name="test"} 1
+loki_cache_errors_suppressed_total{method="fetch",name="test"} 1
+loki_cache_errors_suppressed_total{method="store",name="test"} 1
+loki_cache_errors_suppressed_total{method="store_if_absent",name="test"} 1
+`), "loki_cache_errors_suppressed_total"))
+
+	// Unsupported conditional stores are reported, not suppressed.
+	tiered := cache.NewTiered([]cache.Cache{cache.NewMockCache(), cache.NewMockCache()})
+	_, err = cache.NewBestEffort("tiered", tiered, log.NewNopLogger(), prometheus.NewRegistry()).StoreIfAbsent(ctx, "key", nil)
+	require.ErrorIs(t, err, cache.ErrUnsupported)
+}
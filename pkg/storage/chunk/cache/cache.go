@@ -9,6 +9,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/grafana/loki/v3/pkg/logqlmodel/stats"
@@ -18,20 +19,87 @@ import (
 type Cache interface {
 	Store(ctx context.Context, key []string, buf [][]byte) error
 	Fetch(ctx context.Context, keys []string) (found []string, bufs [][]byte, missing []string, err error)
+	// Exists reports which of the given keys are present in the cache without
+	// returning their values. Backends that cannot check for existence natively
+	// fall back to a fetch which discards the values, so Exists isn't cheaper
+	// than Fetch for them. This includes memcached: its client has no key-only
+	// lookup, so every value is still read and sent over the network.
+	Exists(ctx context.Context, keys []string) (present []string, missing []string, err error)
+	// StoreIfAbsent stores the value under key only if the key isn't present in
+	// the cache yet, and reports whether it was stored. Backends without an
+	// atomic conditional store return ErrUnsupported.
+	StoreIfAbsent(ctx context.Context, key string, value []byte) (stored bool, err error)
+	// FetchRange returns length bytes of the value of key starting at offset,
+	// or fewer if the value ends before, and ErrNotFound if key isn't present.
+	// Backends that cannot read ranges natively fetch the whole value and
+	// slice it.
+	FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error)
 	Stop()
 	// GetCacheType returns a string indicating the cache "type" for the purpose of grouping cache usage statistics
 	GetCacheType() stats.CacheType
 }
 
+// ErrUnsupported is returned by StoreIfAbsent of caches which cannot store
+// keys conditionally.
+var ErrUnsupported = errors.New("conditional store is not supported by this cache")
+
+// ErrNotFound is returned by FetchRange for keys which aren't in the cache.
+var ErrNotFound = errors.New("key not found in cache")
+
+// existsViaFetch implements Exists for caches that have no native existence
+// check by fetching the keys and discarding the returned values.
+func existsViaFetch(ctx context.Context, c Cache, keys []string) ([]string, []string, error) {
+	found, _, missing, err := c.Fetch(ctx, keys)
+	return found, missing, err
+}
+
+// fetchRangeViaFetch implements FetchRange for caches that have no native
+// ranged reads by fetching the whole value and slicing it.
+func fetchRangeViaFetch(ctx context.Context, c Cache, key string, offset, length int64) ([]byte, error) {
+	if err := validateRange(offset, length); err != nil {
+		return nil, err
+	}
+	found, bufs, _, err := c.Fetch(ctx, []string{key})
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, ErrNotFound
+	}
+	return sliceRange(bufs[0], offset, length), nil
+}
+
+// validateRange returns an error for ranges with a negative offset or length.
+func validateRange(offset, length int64) error {
+	if offset < 0 || length < 0 {
+		return fmt.Errorf("invalid range: offset %d, length %d", offset, length)
+	}
+	return nil
+}
+
+// sliceRange returns the range of value starting at offset of up to length bytes.
+func sliceRange(value []byte, offset, length int64) []byte {
+	size := int64(len(value))
+	if offset >= size {
+		return []byte{}
+	}
+	return value[offset : offset+min(length, size-offset)]
+}
+
 // Config for building Caches.
 type Config struct {
 	DefaultValidity time.Duration `yaml:"default_validity"`
+	MinValueBytes   int           `yaml:"min_value_bytes"`
 
-	Background     BackgroundConfig      `yaml:"background"`
-	Memcache       MemcachedConfig       `yaml:"memcached"`
-	MemcacheClient MemcachedClientConfig `yaml:"memcached_client"`
-	Redis          RedisConfig           `yaml:"redis"`
-	EmbeddedCache  EmbeddedCacheConfig   `yaml:"embedded_cache"`
+	TenantBytesAllowList flagext.StringSliceCSV `yaml:"tenant_bytes_allow_list"`
+
+	Background       BackgroundConfig       `yaml:"background"`
+	ConcurrencyLimit ConcurrencyLimitConfig `yaml:"concurrency_limit"`
+	HotKeys          HotKeysConfig          `yaml:"hot_keys"`
+	Memcache         MemcachedConfig        `yaml:"memcached"`
+	MemcacheClient   MemcachedClientConfig  `yaml:"memcached_client"`
+	Redis            RedisConfig            `yaml:"redis"`
+	EmbeddedCache    EmbeddedCacheConfig    `yaml:"embedded_cache"`
 
 	// This is to name the cache metrics properly.
 	Prefix string `yaml:"prefix" doc:"hidden"`
@@ -43,11 +111,15 @@ type Config struct {
 // RegisterFlagsWithPrefix adds the flags required to config this to the given FlagSet
 func (cfg *Config) RegisterFlagsWithPrefix(prefix string, description string, f *flag.FlagSet) {
 	cfg.Background.RegisterFlagsWithPrefix(prefix, description, f)
+	cfg.ConcurrencyLimit.RegisterFlagsWithPrefix(prefix, description, f)
+	cfg.HotKeys.RegisterFlagsWithPrefix(prefix, description, f)
 	cfg.Memcache.RegisterFlagsWithPrefix(prefix, description, f)
 	cfg.MemcacheClient.RegisterFlagsWithPrefix(prefix, description, f)
 	cfg.Redis.RegisterFlagsWithPrefix(prefix, description, f)
 	cfg.EmbeddedCache.RegisterFlagsWithPrefix(prefix+"embedded-cache.", description, f)
 	f.DurationVar(&cfg.DefaultValidity, prefix+"default-validity", time.Hour, description+"The default validity of entries for caches unless overridden.")
+	f.IntVar(&cfg.MinValueBytes, prefix+"min-value-bytes", 0, description+"Values smaller than this size in bytes are not stored in the cache. 0 stores all values.")
+	f.Var(&cfg.TenantBytesAllowList, prefix+"tenant-bytes-allow-list", description+"Comma-separated list of tenants whose bytes stored in and fetched from the cache are counted by tenant. The bytes of all other tenants are counted as 'other'. Empty disables counting bytes by tenant.")
 
 	cfg.Prefix = prefix
 }
@@ -93,6 +165,11 @@ func New(cfg Config, reg prometheus.Registerer, logger log.Logger, cacheType sta
 		return cfg.Cache, nil
 	}
 
+	var instrumentOpts []InstrumentOption
+	if len(cfg.TenantBytesAllowList) > 0 {
+		instrumentOpts = append(instrumentOpts, WithTenantBytes(cfg.TenantBytesAllowList))
+	}
+
 	var caches []Cache
 	if cfg.EmbeddedCache.IsEnabled() {
 		if cfg.EmbeddedCache.TTL == 0 && cfg.DefaultValidity != 0 {
@@ -100,7 +177,7 @@ func New(cfg Config, reg prometheus.Registerer, logger log.Logger, cacheType sta
 		}
 
 		if cache := NewEmbeddedCache(cfg.Prefix+"embedded-cache", cfg.EmbeddedCache, reg, logger, cacheType); cache != nil {
-			caches = append(caches, CollectStats(Instrument(cfg.Prefix+"embedded-cache", cache, reg)))
+			caches = append(caches, CollectStats(InstrumentWithHotKeys(cfg.Prefix+"embedded-cache", cache, HotKeysConfig{}, reg, instrumentOpts...)))
 		}
 	}
 
@@ -117,7 +194,8 @@ func New(cfg Config, reg prometheus.Registerer, logger log.Logger, cacheType sta
 		cache := NewMemcached(cfg.Memcache, client, cfg.Prefix, reg, logger, cacheType)
 
 		cacheName := cfg.Prefix + "memcache"
-		caches = append(caches, CollectStats(NewBackground(cacheName, cfg.Background, Instrument(cacheName, cache, reg), reg)))
+		limited := NewConcurrencyLimited(cacheName, cfg.ConcurrencyLimit, InstrumentWithHotKeys(cacheName, cache, cfg.HotKeys, reg, instrumentOpts...), reg)
+		caches = append(caches, CollectStats(NewBackground(cacheName, cfg.Background, limited, reg)))
 	}
 
 	if IsRedisSet(cfg) {
@@ -130,12 +208,16 @@ func New(cfg Config, reg prometheus.Registerer, logger log.Logger, cacheType sta
 			return nil, fmt.Errorf("redis client setup failed: %w", err)
 		}
 		cache := NewRedisCache(cacheName, client, logger, cacheType)
-		caches = append(caches, CollectStats(NewBackground(cacheName, cfg.Background, Instrument(cacheName, cache, reg), reg)))
+		limited := NewConcurrencyLimited(cacheName, cfg.ConcurrencyLimit, InstrumentWithHotKeys(cacheName, cache, cfg.HotKeys, reg, instrumentOpts...), reg)
+		caches = append(caches, CollectStats(NewBackground(cacheName, cfg.Background, limited, reg)))
 	}
 
 	cache := NewTiered(caches)
 	if len(caches) > 1 {
 		cache = Instrument(cfg.Prefix+"tiered", cache, reg)
 	}
+	if len(caches) > 0 {
+		cache = NewMinValueSize(cfg.Prefix, cfg.MinValueBytes, cache, reg)
+	}
 	return cache, nil
 }
@@ -41,6 +41,29 @@ func (c GenNumMiddleware) Fetch(ctx context.Context, keys []string) (found []str
 	return
 }
 
+// Exists adds cache gen number to keys before calling Exists method of downstream cache.
+// It also removes gen number from the present and missing keys before responding.
+func (c GenNumMiddleware) Exists(ctx context.Context, keys []string) (present []string, missing []string, err error) {
+	keys = addCacheGenNumToCacheKeys(ctx, keys)
+
+	present, missing, err = c.downstreamCache.Exists(ctx, keys)
+
+	present = removeCacheGenNumFromKeys(ctx, present)
+	missing = removeCacheGenNumFromKeys(ctx, missing)
+
+	return
+}
+
+// StoreIfAbsent adds cache gen number to the key before calling StoreIfAbsent method of downstream cache.
+func (c GenNumMiddleware) StoreIfAbsent(ctx context.Context, key string, value []byte) (bool, error) {
+	return c.downstreamCache.StoreIfAbsent(ctx, addCacheGenNumToCacheKeys(ctx, []string{key})[0], value)
+}
+
+// FetchRange adds cache gen number to the key before calling FetchRange method of downstream cache.
+func (c GenNumMiddleware) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	return c.downstreamCache.FetchRange(ctx, addCacheGenNumToCacheKeys(ctx, []string{key})[0], offset, length)
+}
+
 // Stop calls Stop method of downstream cache.
 func (c GenNumMiddleware) Stop() {
 	c.downstreamCache.Stop()
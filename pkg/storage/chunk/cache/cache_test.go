@@ -2,6 +2,7 @@ package cache_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"sort"
@@ -19,6 +20,7 @@ import (
 	"github.com/grafana/loki/v3/pkg/logproto"
 	"github.com/grafana/loki/v3/pkg/storage/chunk"
 	"github.com/grafana/loki/v3/pkg/storage/chunk/cache"
+	"github.com/grafana/loki/v3/pkg/storage/chunk/cache/cachetest"
 	"github.com/grafana/loki/v3/pkg/storage/chunk/fetcher"
 	"github.com/grafana/loki/v3/pkg/storage/config"
 )
@@ -164,6 +166,60 @@ func testCacheMiss(t *testing.T, cache cache.Cache) {
 	}
 }
 
+func testCacheExists(t *testing.T, cache cache.Cache, keys []string) {
+	missingKey := strconv.Itoa(rand.Int())
+	present, missing, err := cache.Exists(context.Background(), append([]string{missingKey}, keys...))
+	require.NoError(t, err)
+	require.Equal(t, keys, present)
+	require.Equal(t, []string{missingKey}, missing)
+}
+
+func testCacheStoreIfAbsent(t *testing.T, c cache.Cache) {
+	ctx := context.Background()
+	key := strconv.Itoa(rand.Int())
+
+	stored, err := c.StoreIfAbsent(ctx, key, []byte("first"))
+	if errors.Is(err, cache.ErrUnsupported) {
+		t.Skip("conditional store not supported")
+	}
+	require.NoError(t, err)
+	require.True(t, stored)
+
+	stored, err = c.StoreIfAbsent(ctx, key, []byte("second"))
+	require.NoError(t, err)
+	require.False(t, stored)
+
+	found, bufs, _, err := c.Fetch(ctx, []string{key})
+	require.NoError(t, err)
+	require.Equal(t, []string{key}, found)
+	require.Equal(t, [][]byte{[]byte("first")}, bufs)
+}
+
+func testCacheFetchRange(t *testing.T, c cache.Cache) {
+	ctx := context.Background()
+	key := strconv.Itoa(rand.Int())
+	require.NoError(t, c.Store(ctx, []string{key}, [][]byte{[]byte("0123456789")}))
+
+	for _, tc := range []struct {
+		offset, length int64
+		expected       string
+	}{
+		{offset: 0, length: 4, expected: "0123"},
+		{offset: 6, length: 10, expected: "6789"},
+		{offset: 3, length: 0, expected: ""},
+		{offset: 20, length: 4, expected: ""},
+	} {
+		value, err := c.FetchRange(ctx, key, tc.offset, tc.length)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, string(value), "offset %d, length %d", tc.offset, tc.length)
+	}
+
+	_, err := c.FetchRange(ctx, key, -1, 4)
+	require.Error(t, err)
+	_, err = c.FetchRange(ctx, strconv.Itoa(rand.Int()), 0, 4)
+	require.ErrorIs(t, err, cache.ErrNotFound)
+}
+
 func testCache(t *testing.T, cache cache.Cache) {
 	s := config.SchemaConfig{
 		Configs: []config.PeriodConfig{
@@ -184,6 +240,15 @@ func testCache(t *testing.T, cache cache.Cache) {
 	t.Run("Miss", func(t *testing.T) {
 		testCacheMiss(t, cache)
 	})
+	t.Run("Exists", func(t *testing.T) {
+		testCacheExists(t, cache, keys)
+	})
+	t.Run("StoreIfAbsent", func(t *testing.T) {
+		testCacheStoreIfAbsent(t, cache)
+	})
+	t.Run("FetchRange", func(t *testing.T) {
+		testCacheFetchRange(t, cache)
+	})
 	t.Run("Fetcher", func(t *testing.T) {
 		testChunkFetcher(t, cache, chunks)
 	})
@@ -215,3 +280,47 @@ func TestSnappyCache(t *testing.T) {
 	cache := cache.NewSnappy(cache.NewMockCache(), log.NewNopLogger())
 	testCache(t, cache)
 }
+
+func TestCacheSuite(t *testing.T) {
+	for name, factory := range map[string]func() cache.Cache{
+		"mock": func() cache.Cache { return cache.NewMockCache() },
+		"embedded": func() cache.Cache {
+			return cache.NewEmbeddedCache("test", cache.EmbeddedCacheConfig{MaxSizeItems: 1e3, TTL: time.Hour}, nil, log.NewNopLogger(), "test")
+		},
+		"memcached": func() cache.Cache {
+			return cache.NewMemcached(cache.MemcachedConfig{BatchSize: 2, Parallelism: 2}, newMockMemcache(), "test", nil, log.NewNopLogger(), "test")
+		},
+		"snappy":        func() cache.Cache { return cache.NewSnappy(cache.NewMockCache(), log.NewNopLogger()) },
+		"latency stats": func() cache.Cache { return cache.LatencyStats(cache.NewMockCache()) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			cachetest.TestSuite(t, factory)
+		})
+	}
+}
+
+func TestSnappyCacheFetchLazy(t *testing.T) {
+	ctx := context.Background()
+	backend := cache.NewMockCache()
+	c := cache.NewSnappy(backend, log.NewNopLogger())
+
+	require.NoError(t, c.Store(ctx, []string{"a", "b"}, [][]byte{[]byte("hello"), []byte("world")}))
+	// Corrupt b in the backend; it must only fail once accessed.
+	require.NoError(t, backend.Store(ctx, []string{"b"}, [][]byte{[]byte("not snappy")}))
+
+	lazy, ok := c.(cache.LazyFetcher)
+	require.True(t, ok)
+
+	found, values, missing, err := lazy.FetchLazy(ctx, []string{"a", "b", "c"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, found)
+	require.Equal(t, []string{"c"}, missing)
+	require.Len(t, values, 2)
+
+	value, err := values[0]()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), value)
+
+	_, err = values[1]()
+	require.Error(t, err)
+}
@@ -0,0 +1,237 @@
+// Package cachetest provides a test suite for implementations of [cache.Cache].
+package cachetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/storage/chunk/cache"
+)
+
+// keyID makes keys unique across the subtests of a suite.
+var keyID atomic.Int64
+
+// key returns a key which hasn't been used by the suite before.
+func key(name string) string {
+	return fmt.Sprintf("cachetest-%s-%d", name, keyID.Add(1))
+}
+
+// TestSuite exercises the contract of [cache.Cache] against the caches
+// returned by factory. Every subtest uses a new cache, which is stopped once
+// the subtest is done. Stored values must be visible to subsequent fetches,
+// so caches storing asynchronously aren't supported, and caches evicting
+// values need to be configured with enough capacity.
+//
+// Caches which can't store conditionally may return [cache.ErrUnsupported]
+// from StoreIfAbsent, in which case its subtest is skipped.
+func TestSuite(t *testing.T, factory func() cache.Cache) {
+	for _, tc := range []struct {
+		name string
+		test func(t *testing.T, c cache.Cache)
+	}{
+		{name: "StoreAndFetch", test: testStoreAndFetch},
+		{name: "PartialMiss", test: testPartialMiss},
+		{name: "Overwrite", test: testOverwrite},
+		{name: "EmptyBatches", test: testEmptyBatches},
+		{name: "DuplicateKeys", test: testDuplicateKeys},
+		{name: "Exists", test: testExists},
+		{name: "StoreIfAbsent", test: testStoreIfAbsent},
+		{name: "FetchRange", test: testFetchRange},
+		{name: "CanceledContext", test: testCanceledContext},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := factory()
+			defer c.Stop()
+			tc.test(t, c)
+		})
+	}
+
+	t.Run("Stop", func(t *testing.T) {
+		c := factory()
+		require.NoError(t, c.Store(context.Background(), []string{key("stop")}, [][]byte{[]byte("value")}))
+		c.Stop()
+	})
+}
+
+func testStoreAndFetch(t *testing.T, c cache.Cache) {
+	ctx := context.Background()
+
+	var (
+		keys []string
+		bufs [][]byte
+	)
+	for i := 0; i < 10; i++ {
+		keys = append(keys, key("store"))
+		bufs = append(bufs, []byte("value-"+strconv.Itoa(i)))
+	}
+	require.NoError(t, c.Store(ctx, keys, bufs))
+
+	found, fetched, missing, err := c.Fetch(ctx, keys)
+	require.NoError(t, err)
+	require.Equal(t, keys, found)
+	require.Equal(t, bufs, fetched)
+	require.Empty(t, missing)
+}
+
+func testPartialMiss(t *testing.T, c cache.Cache) {
+	ctx := context.Background()
+
+	present := []string{key("present"), key("present"), key("present")}
+	absent := []string{key("absent"), key("absent")}
+	require.NoError(t, c.Store(ctx, present, [][]byte{[]byte("a"), []byte("b"), []byte("c")}))
+
+	// Found and missing keys are returned in the order they were requested.
+	found, bufs, missing, err := c.Fetch(ctx, []string{absent[0], present[0], present[1], absent[1], present[2]})
+	require.NoError(t, err)
+	require.Equal(t, present, found)
+	require.Equal(t, [][]byte{[]byte("a"), []byte("b"), []byte("c")}, bufs)
+	require.Equal(t, absent, missing)
+
+	found, bufs, missing, err = c.Fetch(ctx, absent)
+	require.NoError(t, err)
+	require.Empty(t, found)
+	require.Empty(t, bufs)
+	require.Equal(t, absent, missing)
+}
+
+func testOverwrite(t *testing.T, c cache.Cache) {
+	ctx := context.Background()
+	k := key("overwrite")
+
+	require.NoError(t, c.Store(ctx, []string{k}, [][]byte{[]byte("first")}))
+	require.NoError(t, c.Store(ctx, []string{k}, [][]byte{[]byte("second")}))
+
+	found, bufs, _, err := c.Fetch(ctx, []string{k})
+	require.NoError(t, err)
+	require.Equal(t, []string{k}, found)
+	require.Equal(t, [][]byte{[]byte("second")}, bufs)
+}
+
+func testEmptyBatches(t *testing.T, c cache.Cache) {
+	ctx := context.Background()
+
+	require.NoError(t, c.Store(ctx, nil, nil))
+	require.NoError(t, c.Store(ctx, []string{}, [][]byte{}))
+
+	found, bufs, missing, err := c.Fetch(ctx, nil)
+	require.NoError(t, err)
+	require.Empty(t, found)
+	require.Empty(t, bufs)
+	require.Empty(t, missing)
+
+	present, missing, err := c.Exists(ctx, nil)
+	require.NoError(t, err)
+	require.Empty(t, present)
+	require.Empty(t, missing)
+}
+
+func testDuplicateKeys(t *testing.T, c cache.Cache) {
+	ctx := context.Background()
+	k := key("duplicate")
+
+	// The last value of a key stored more than once in a batch wins.
+	require.NoError(t, c.Store(ctx, []string{k, k}, [][]byte{[]byte("first"), []byte("second")}))
+
+	// Backends may return a key requested more than once either once or for
+	// every request, but always with its value and never as missing.
+	found, bufs, missing, err := c.Fetch(ctx, []string{k, k})
+	require.NoError(t, err)
+	require.NotEmpty(t, found)
+	require.Len(t, bufs, len(found))
+	for i := range found {
+		require.Equal(t, k, found[i])
+		require.Equal(t, []byte("second"), bufs[i])
+	}
+	require.Empty(t, missing)
+}
+
+func testExists(t *testing.T, c cache.Cache) {
+	ctx := context.Background()
+
+	present := []string{key("exists"), key("exists")}
+	absent := key("absent")
+	require.NoError(t, c.Store(ctx, present, [][]byte{[]byte("a"), []byte("b")}))
+
+	found, missing, err := c.Exists(ctx, []string{present[0], absent, present[1]})
+	require.NoError(t, err)
+	require.Equal(t, present, found)
+	require.Equal(t, []string{absent}, missing)
+}
+
+func testStoreIfAbsent(t *testing.T, c cache.Cache) {
+	ctx := context.Background()
+	k := key("if-absent")
+
+	stored, err := c.StoreIfAbsent(ctx, k, []byte("first"))
+	if errors.Is(err, cache.ErrUnsupported) {
+		t.Skip("conditional store not supported")
+	}
+	require.NoError(t, err)
+	require.True(t, stored)
+
+	stored, err = c.StoreIfAbsent(ctx, k, []byte("second"))
+	require.NoError(t, err)
+	require.False(t, stored)
+
+	found, bufs, _, err := c.Fetch(ctx, []string{k})
+	require.NoError(t, err)
+	require.Equal(t, []string{k}, found)
+	require.Equal(t, [][]byte{[]byte("first")}, bufs)
+}
+
+func testFetchRange(t *testing.T, c cache.Cache) {
+	ctx := context.Background()
+	k := key("range")
+	require.NoError(t, c.Store(ctx, []string{k}, [][]byte{[]byte("0123456789")}))
+
+	for _, tc := range []struct {
+		offset, length int64
+		expected       string
+	}{
+		{offset: 0, length: 4, expected: "0123"},
+		{offset: 6, length: 10, expected: "6789"},
+		{offset: 3, length: 0, expected: ""},
+		{offset: 20, length: 4, expected: ""},
+	} {
+		value, err := c.FetchRange(ctx, k, tc.offset, tc.length)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, string(value), "offset %d, length %d", tc.offset, tc.length)
+	}
+
+	_, err := c.FetchRange(ctx, k, -1, 4)
+	require.Error(t, err)
+	_, err = c.FetchRange(ctx, key("absent"), 0, 4)
+	require.ErrorIs(t, err, cache.ErrNotFound)
+}
+
+// testCanceledContext checks that caches either fail operations with a
+// canceled context or complete them correctly, but never return wrong results.
+func testCanceledContext(t *testing.T, c cache.Cache) {
+	k := key("canceled")
+	require.NoError(t, c.Store(context.Background(), []string{k}, [][]byte{[]byte("value")}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := c.Store(ctx, []string{k}, [][]byte{[]byte("canceled")}); err == nil {
+		found, bufs, _, err := c.Fetch(context.Background(), []string{k})
+		require.NoError(t, err)
+		require.Equal(t, []string{k}, found)
+		require.Equal(t, [][]byte{[]byte("canceled")}, bufs)
+	}
+
+	found, bufs, missing, err := c.Fetch(ctx, []string{k})
+	if err == nil {
+		require.Len(t, bufs, len(found))
+		for _, f := range found {
+			require.Equal(t, k, f)
+		}
+		require.Len(t, append(found, missing...), 1)
+	}
+}
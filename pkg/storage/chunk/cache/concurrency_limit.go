@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/loki/v3/pkg/util/constants"
+)
+
+// ConcurrencyLimitConfig is config for a concurrency limited Cache.
+type ConcurrencyLimitConfig struct {
+	MaxConcurrentStores  int `yaml:"max_concurrent_stores"`
+	MaxConcurrentFetches int `yaml:"max_concurrent_fetches"`
+}
+
+// RegisterFlagsWithPrefix adds the flags required to config this to the given FlagSet
+func (cfg *ConcurrencyLimitConfig) RegisterFlagsWithPrefix(prefix string, description string, f *flag.FlagSet) {
+	f.IntVar(&cfg.MaxConcurrentStores, prefix+"concurrency-limit.max-concurrent-stores", 0, description+"Maximum number of concurrent store requests to the cache. 0 means unlimited.")
+	f.IntVar(&cfg.MaxConcurrentFetches, prefix+"concurrency-limit.max-concurrent-fetches", 0, description+"Maximum number of concurrent fetch and exists requests to the cache. 0 means unlimited.")
+}
+
+type concurrencyLimitedCache struct {
+	Cache
+
+	stores  chan struct{}
+	fetches chan struct{}
+
+	inflightStores, inflightFetches prometheus.Gauge
+	storeWait, fetchWait            prometheus.Observer
+}
+
+// NewConcurrencyLimited returns a new Cache that limits the number of
+// concurrent store and fetch requests to cache independently, so that bursts
+// of one can't starve the other.
+func NewConcurrencyLimited(name string, cfg ConcurrencyLimitConfig, cache Cache, reg prometheus.Registerer) Cache {
+	if cfg.MaxConcurrentStores <= 0 && cfg.MaxConcurrentFetches <= 0 {
+		return cache
+	}
+
+	inflight := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   constants.Loki,
+		Name:        "cache_concurrency_limit_inflight_requests",
+		Help:        "Current number of in-flight cache requests admitted by the concurrency limiter.",
+		ConstLabels: prometheus.Labels{"name": name},
+	}, []string{"method"})
+	wait := promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   constants.Loki,
+		Name:        "cache_concurrency_limit_wait_duration_seconds",
+		Help:        "Time spent in seconds waiting for the cache concurrency limiter.",
+		Buckets:     prometheus.ExponentialBuckets(0.000016, 4, 8),
+		ConstLabels: prometheus.Labels{"name": name},
+	}, []string{"method"})
+
+	c := &concurrencyLimitedCache{
+		Cache: cache,
+
+		inflightStores:  inflight.WithLabelValues("store"),
+		inflightFetches: inflight.WithLabelValues("fetch"),
+		storeWait:       wait.WithLabelValues("store"),
+		fetchWait:       wait.WithLabelValues("fetch"),
+	}
+	if cfg.MaxConcurrentStores > 0 {
+		c.stores = make(chan struct{}, cfg.MaxConcurrentStores)
+	}
+	if cfg.MaxConcurrentFetches > 0 {
+		c.fetches = make(chan struct{}, cfg.MaxConcurrentFetches)
+	}
+	return c
+}
+
+// acquire waits for a slot in sem, returning a func to release it. A nil sem is unlimited.
+func acquire(ctx context.Context, sem chan struct{}, inflight prometheus.Gauge, wait prometheus.Observer) (func(), error) {
+	if sem != nil {
+		start := time.Now()
+		select {
+		case sem <- struct{}{}:
+			wait.Observe(time.Since(start).Seconds())
+		case <-ctx.Done():
+			wait.Observe(time.Since(start).Seconds())
+			return nil, ctx.Err()
+		}
+	}
+
+	inflight.Inc()
+	return func() {
+		inflight.Dec()
+		if sem != nil {
+			<-sem
+		}
+	}, nil
+}
+
+func (c *concurrencyLimitedCache) Store(ctx context.Context, keys []string, bufs [][]byte) error {
+	release, err := acquire(ctx, c.stores, c.inflightStores, c.storeWait)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return c.Cache.Store(ctx, keys, bufs)
+}
+
+func (c *concurrencyLimitedCache) Fetch(ctx context.Context, keys []string) ([]string, [][]byte, []string, error) {
+	release, err := acquire(ctx, c.fetches, c.inflightFetches, c.fetchWait)
+	if err != nil {
+		return nil, nil, keys, err
+	}
+	defer release()
+
+	return c.Cache.Fetch(ctx, keys)
+}
+
+func (c *concurrencyLimitedCache) Exists(ctx context.Context, keys []string) ([]string, []string, error) {
+	release, err := acquire(ctx, c.fetches, c.inflightFetches, c.fetchWait)
+	if err != nil {
+		return nil, keys, err
+	}
+	defer release()
+
+	return c.Cache.Exists(ctx, keys)
+}
+
+func (c *concurrencyLimitedCache) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	release, err := acquire(ctx, c.fetches, c.inflightFetches, c.fetchWait)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return c.Cache.FetchRange(ctx, key, offset, length)
+}
+
+func (c *concurrencyLimitedCache) StoreIfAbsent(ctx context.Context, key string, value []byte) (bool, error) {
+	release, err := acquire(ctx, c.stores, c.inflightStores, c.storeWait)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	return c.Cache.StoreIfAbsent(ctx, key, value)
+}
@@ -0,0 +1,70 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/storage/chunk/cache"
+)
+
+// blockingStoreCache blocks every store until unblock is closed.
+type blockingStoreCache struct {
+	cache.Cache
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (b *blockingStoreCache) Store(ctx context.Context, keys []string, bufs [][]byte) error {
+	b.started <- struct{}{}
+	<-b.unblock
+	return b.Cache.Store(ctx, keys, bufs)
+}
+
+func TestConcurrencyLimitedSimple(t *testing.T) {
+	c := cache.NewConcurrencyLimited("test", cache.ConcurrencyLimitConfig{MaxConcurrentStores: 1, MaxConcurrentFetches: 1}, cache.NewMockCache(), prometheus.NewRegistry())
+	testCache(t, c)
+}
+
+func TestConcurrencyLimited(t *testing.T) {
+	ctx := context.Background()
+	backend := &blockingStoreCache{Cache: cache.NewMockCache(), started: make(chan struct{}, 2), unblock: make(chan struct{})}
+	c := cache.NewConcurrencyLimited("test", cache.ConcurrencyLimitConfig{MaxConcurrentStores: 1}, backend, prometheus.NewRegistry())
+
+	storeErrs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			storeErrs <- c.Store(ctx, []string{"key"}, [][]byte{[]byte("value")})
+		}()
+	}
+
+	// Only one store is admitted while the first one is blocked.
+	<-backend.started
+	select {
+	case <-backend.started:
+		t.Fatal("expected the second store to wait for the limiter")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Fetches are limited independently and are not blocked by stores.
+	_, _, missing, err := c.Fetch(ctx, []string{"key"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"key"}, missing)
+
+	// Waiting for the limiter respects context cancellation.
+	cancelCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, c.Store(cancelCtx, []string{"key"}, [][]byte{[]byte("value")}), context.DeadlineExceeded)
+
+	close(backend.unblock)
+	require.NoError(t, <-storeErrs)
+	require.NoError(t, <-storeErrs)
+}
+
+func TestConcurrencyLimitedUnlimited(t *testing.T) {
+	mock := cache.NewMockCache()
+	require.Equal(t, cache.Cache(mock), cache.NewConcurrencyLimited("test", cache.ConcurrencyLimitConfig{}, mock, prometheus.NewRegistry()))
+}
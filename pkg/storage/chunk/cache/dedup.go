@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/atomic"
+
+	"github.com/grafana/loki/v3/pkg/logqlmodel/stats"
+	"github.com/grafana/loki/v3/pkg/util/constants"
+)
+
+const (
+	// dedupContentPrefix is the key prefix of the values stored by their content hash.
+	dedupContentPrefix = "dedup:"
+	// dedupRecentHashes is the number of recently stored content hashes used to estimate the dedup ratio.
+	dedupRecentHashes = 10000
+
+	// Stored values start with a tag telling whether they are inline or a pointer to a content hash.
+	dedupTagInline  byte = 0
+	dedupTagPointer byte = 1
+)
+
+type dedupCache struct {
+	Cache
+
+	// recent are the content hashes stored recently, to estimate how many values are duplicates.
+	recent                     *lru.Cache[[sha256.Size]byte, struct{}]
+	logicalBytes, uniqueBytes  atomic.Int64
+	dedupedValues, totalValues prometheus.Counter
+}
+
+// NewDedup makes a new cache which stores byte-identical values only once.
+// Each value is stored under its content hash and keys only store a pointer to
+// it, which Fetch resolves transparently at the cost of a second request to
+// cache. Values no larger than a pointer are stored inline.
+//
+// The ratio of stored to unique bytes is exposed as a metric, estimated from
+// the recently stored values.
+func NewDedup(name string, cache Cache, reg prometheus.Registerer) Cache {
+	recent, _ := lru.New[[sha256.Size]byte, struct{}](dedupRecentHashes)
+	c := &dedupCache{
+		Cache:  cache,
+		recent: recent,
+
+		dedupedValues: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace:   constants.Loki,
+			Name:        "cache_dedup_duplicate_values_total",
+			Help:        "Total count of stored values which were identical to a recently stored value.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+		totalValues: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace:   constants.Loki,
+			Name:        "cache_dedup_values_total",
+			Help:        "Total count of values stored by their content hash.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+	}
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   constants.Loki,
+		Name:        "cache_dedup_ratio",
+		Help:        "Ratio of bytes of stored values to bytes of unique values, estimated from recently stored values.",
+		ConstLabels: prometheus.Labels{"name": name},
+	}, c.ratio)
+	return c
+}
+
+func (c *dedupCache) ratio() float64 {
+	unique := c.uniqueBytes.Load()
+	if unique == 0 {
+		return 1
+	}
+	return float64(c.logicalBytes.Load()) / float64(unique)
+}
+
+func dedupContentKey(hash [sha256.Size]byte) string {
+	return dedupContentPrefix + hex.EncodeToString(hash[:])
+}
+
+func (c *dedupCache) Store(ctx context.Context, keys []string, bufs [][]byte) error {
+	storeKeys := make([]string, 0, 2*len(keys))
+	storeBufs := make([][]byte, 0, 2*len(keys))
+	contents := make(map[[sha256.Size]byte]struct{}, len(keys))
+
+	for i, key := range keys {
+		buf := bufs[i]
+		if len(buf) <= sha256.Size {
+			storeKeys = append(storeKeys, key)
+			storeBufs = append(storeBufs, append([]byte{dedupTagInline}, buf...))
+			continue
+		}
+
+		hash := sha256.Sum256(buf)
+		storeKeys = append(storeKeys, key)
+		storeBufs = append(storeBufs, append([]byte{dedupTagPointer}, hash[:]...))
+
+		c.observe(hash, len(buf))
+		if _, ok := contents[hash]; ok {
+			continue
+		}
+		contents[hash] = struct{}{}
+		// The content is stored again even if it was stored recently to refresh its expiry.
+		storeKeys = append(storeKeys, dedupContentKey(hash))
+		storeBufs = append(storeBufs, buf)
+	}
+
+	return c.Cache.Store(ctx, storeKeys, storeBufs)
+}
+
+// StoreIfAbsent stores the value inline, as storing it by its content hash
+// would take a second conditional store.
+func (c *dedupCache) StoreIfAbsent(ctx context.Context, key string, value []byte) (bool, error) {
+	return c.Cache.StoreIfAbsent(ctx, key, append([]byte{dedupTagInline}, value...))
+}
+
+// FetchRange reads the range from the fetched value, as values stored by
+// their content hash have to be resolved first.
+func (c *dedupCache) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	return fetchRangeViaFetch(ctx, c, key, offset, length)
+}
+
+// observe records a value with the content hash for the dedup ratio.
+func (c *dedupCache) observe(hash [sha256.Size]byte, size int) {
+	c.totalValues.Inc()
+	c.logicalBytes.Add(int64(size))
+	if found, _ := c.recent.ContainsOrAdd(hash, struct{}{}); found {
+		c.dedupedValues.Inc()
+		return
+	}
+	c.uniqueBytes.Add(int64(size))
+}
+
+func (c *dedupCache) Fetch(ctx context.Context, keys []string) ([]string, [][]byte, []string, error) {
+	found, bufs, missing, err := c.Cache.Fetch(ctx, keys)
+	if err != nil {
+		return found, bufs, missing, err
+	}
+
+	values := make(map[string][]byte, len(found))
+	pointers := make(map[string]string)
+	var contentKeys []string
+	for i, key := range found {
+		buf := bufs[i]
+		switch {
+		case len(buf) > 0 && buf[0] == dedupTagInline:
+			values[key] = buf[1:]
+		case len(buf) == 1+sha256.Size && buf[0] == dedupTagPointer:
+			contentKey := dedupContentPrefix + hex.EncodeToString(buf[1:])
+			if !slices.Contains(contentKeys, contentKey) {
+				contentKeys = append(contentKeys, contentKey)
+			}
+			pointers[key] = contentKey
+		}
+		// Values in any other format weren't stored by this cache and are treated as misses.
+	}
+
+	if len(contentKeys) > 0 {
+		contentFound, contentBufs, _, err := c.Cache.Fetch(ctx, contentKeys)
+		if err != nil {
+			return nil, nil, keys, err
+		}
+		contents := make(map[string][]byte, len(contentFound))
+		for i, contentKey := range contentFound {
+			contents[contentKey] = contentBufs[i]
+		}
+		for key, contentKey := range pointers {
+			if buf, ok := contents[contentKey]; ok {
+				values[key] = buf
+			}
+		}
+	}
+
+	resultKeys := make([]string, 0, len(values))
+	resultBufs := make([][]byte, 0, len(values))
+	var resultMissing []string
+	for _, key := range keys {
+		if buf, ok := values[key]; ok {
+			resultKeys = append(resultKeys, key)
+			resultBufs = append(resultBufs, buf)
+		} else {
+			resultMissing = append(resultMissing, key)
+		}
+	}
+	return resultKeys, resultBufs, resultMissing, nil
+}
+
+func (c *dedupCache) Stop() {
+	c.Cache.Stop()
+}
+
+func (c *dedupCache) GetCacheType() stats.CacheType {
+	return c.Cache.GetCacheType()
+}
@@ -0,0 +1,74 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/storage/chunk/cache"
+)
+
+func TestDedupSimple(t *testing.T) {
+	c := cache.NewDedup("test", cache.NewMockCache(), prometheus.NewRegistry())
+	testCache(t, c)
+}
+
+func TestDedup(t *testing.T) {
+	ctx := context.Background()
+	backend := cache.NewMockCache()
+	reg := prometheus.NewRegistry()
+	c := cache.NewDedup("test", backend, reg)
+
+	large := bytes.Repeat([]byte("a"), 1024)
+	other := bytes.Repeat([]byte("b"), 1024)
+	small := []byte("small")
+	require.NoError(t, c.Store(ctx, []string{"a1", "a2", "b", "s"}, [][]byte{large, large, other, small}))
+	require.NoError(t, c.Store(ctx, []string{"a3"}, [][]byte{large}))
+
+	// The large value is stored once, with a pointer for each of its keys.
+	var largeCopies int
+	for _, buf := range backend.GetInternal() {
+		if bytes.Equal(buf, large) {
+			largeCopies++
+		}
+	}
+	require.Equal(t, 1, largeCopies)
+
+	found, bufs, missing, err := c.Fetch(ctx, []string{"a1", "missing", "a2", "a3", "b", "s"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a1", "a2", "a3", "b", "s"}, found)
+	require.Equal(t, [][]byte{large, large, large, other, small}, bufs)
+	require.Equal(t, []string{"missing"}, missing)
+
+	require.Equal(t, float64(2), counterValue(t, reg, "loki_cache_dedup_duplicate_values_total"))
+	require.NoError(t, testutil.GatherAndCompare(reg, bytes.NewBufferString(`
+# HELP loki_cache_dedup_ratio Ratio of bytes of stored values to bytes of unique values, estimated from recently stored values.
+# TYPE loki_cache_dedup_ratio gauge
+loki_cache_dedup_ratio{name="test"} 2
+`), "loki_cache_dedup_ratio"))
+}
+
+func TestDedupMissingContent(t *testing.T) {
+	ctx := context.Background()
+	backend := cache.NewMockCache()
+	c := cache.NewDedup("test", backend, prometheus.NewRegistry())
+
+	large := bytes.Repeat([]byte("a"), 1024)
+	require.NoError(t, c.Store(ctx, []string{"a"}, [][]byte{large}))
+
+	// Evict the content but keep the pointer.
+	for key, buf := range backend.GetInternal() {
+		if bytes.Equal(buf, large) {
+			delete(backend.GetInternal(), key)
+		}
+	}
+
+	found, _, missing, err := c.Fetch(ctx, []string{"a"})
+	require.NoError(t, err)
+	require.Empty(t, found)
+	require.Equal(t, []string{"a"}, missing)
+}
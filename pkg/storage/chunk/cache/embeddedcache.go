@@ -4,6 +4,7 @@ import (
 	"container/list"
 	"context"
 	"flag"
+	"fmt"
 	"sync"
 	"time"
 	"unsafe"
@@ -64,6 +65,7 @@ type EmbeddedCache[K comparable, V any] struct {
 
 	entriesAddedNew prometheus.Counter
 	entriesEvicted  *prometheus.CounterVec
+	evictedItemAge  *prometheus.HistogramVec
 	entriesCurrent  prometheus.Gauge
 	memoryBytes     prometheus.Gauge
 }
@@ -161,6 +163,16 @@ func NewTypedEmbeddedCache[K comparable, V any](
 			ConstLabels: prometheus.Labels{"cache": name},
 		}, []string{"reason"}),
 
+		evictedItemAge: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: constants.Loki,
+			Subsystem: "embeddedcache",
+			Name:      "evicted_item_age_seconds",
+			Help:      "The time since entries were stored when they were evicted because the cache was full or they expired",
+			// 1s -> ~3d
+			Buckets:     prometheus.ExponentialBuckets(1, 4, 10),
+			ConstLabels: prometheus.Labels{"cache": name},
+		}, []string{"reason"}),
+
 		entriesCurrent: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
 			Namespace:   constants.Loki,
 			Subsystem:   "embeddedcache",
@@ -228,6 +240,40 @@ func (c *EmbeddedCache[K, V]) Fetch(ctx context.Context, keys []K) (foundKeys []
 	return
 }
 
+// Exists implements Cache.
+func (c *EmbeddedCache[K, V]) Exists(_ context.Context, keys []K) (presentKeys []K, missingKeys []K, err error) {
+	presentKeys, missingKeys = make([]K, 0, len(keys)), make([]K, 0, len(keys))
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	for _, key := range keys {
+		if _, ok := c.entries[key]; ok {
+			presentKeys = append(presentKeys, key)
+		} else {
+			missingKeys = append(missingKeys, key)
+		}
+	}
+	return
+}
+
+// FetchRange implements Cache. The range is sliced from the cached value
+// without copying it, which requires values to be byte slices.
+func (c *EmbeddedCache[K, V]) FetchRange(ctx context.Context, key K, offset, length int64) ([]byte, error) {
+	if err := validateRange(offset, length); err != nil {
+		return nil, err
+	}
+	val, ok := c.Get(ctx, key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	value, ok := any(val).([]byte)
+	if !ok {
+		return nil, fmt.Errorf("cannot read a range of %T values", val)
+	}
+	return sliceRange(value, offset, length), nil
+}
+
 // Store implements Cache.
 func (c *EmbeddedCache[K, V]) Store(_ context.Context, keys []K, values []V) error {
 	c.lock.Lock()
@@ -239,6 +285,18 @@ func (c *EmbeddedCache[K, V]) Store(_ context.Context, keys []K, values []V) err
 	return nil
 }
 
+// StoreIfAbsent implements Cache.
+func (c *EmbeddedCache[K, V]) StoreIfAbsent(_ context.Context, key K, value V) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.entries[key]; ok {
+		return false, nil
+	}
+	c.put(key, value)
+	return true, nil
+}
+
 // Stop implements Cache.
 func (c *EmbeddedCache[K, V]) Stop() {
 	c.lock.Lock()
@@ -267,6 +325,11 @@ func (c *EmbeddedCache[K, V]) remove(key K, element *list.Element, reason string
 	c.currSizeBytes -= sz
 	c.entriesCurrent.Dec()
 	c.entriesEvicted.WithLabelValues(reason).Inc()
+	// Ages of entries evicted for capacity tell if the cache is too small,
+	// which replaced entries don't.
+	if reason == fullReason || reason == expiredReason {
+		c.evictedItemAge.WithLabelValues(reason).Observe(time.Since(entry.updated).Seconds())
+	}
 }
 
 func (c *EmbeddedCache[K, V]) put(key K, value V) {
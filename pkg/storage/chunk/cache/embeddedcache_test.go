@@ -9,7 +9,9 @@ import (
 	"go.uber.org/atomic"
 
 	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -207,6 +209,8 @@ func TestEmbeddedCacheExpiry(t *testing.T) {
 	assert.Equal(t, float64(4), testutil.ToFloat64(c.entriesAddedNew))
 	assert.Equal(t, float64(0), testutil.ToFloat64(c.entriesEvicted.WithLabelValues(expiredReason)))
 	assert.Equal(t, float64(1), testutil.ToFloat64(c.entriesEvicted.WithLabelValues(fullReason)))
+	assert.Equal(t, uint64(0), evictedItemAgeSamples(t, c, expiredReason))
+	assert.Equal(t, uint64(1), evictedItemAgeSamples(t, c, fullReason))
 	assert.Equal(t, float64(3), testutil.ToFloat64(c.entriesCurrent))
 	assert.Equal(t, float64(len(c.entries)), testutil.ToFloat64(c.entriesCurrent))
 	assert.Equal(t, float64(c.lru.Len()), testutil.ToFloat64(c.entriesCurrent))
@@ -223,6 +227,8 @@ func TestEmbeddedCacheExpiry(t *testing.T) {
 	assert.Equal(t, float64(4), testutil.ToFloat64(c.entriesAddedNew))
 	assert.Equal(t, float64(3), testutil.ToFloat64(c.entriesEvicted.WithLabelValues(expiredReason)))
 	assert.Equal(t, float64(1), testutil.ToFloat64(c.entriesEvicted.WithLabelValues(fullReason)))
+	assert.Equal(t, uint64(3), evictedItemAgeSamples(t, c, expiredReason))
+	assert.Equal(t, uint64(1), evictedItemAgeSamples(t, c, fullReason))
 	assert.Equal(t, float64(0), testutil.ToFloat64(c.entriesCurrent))
 	assert.Equal(t, float64(len(c.entries)), testutil.ToFloat64(c.entriesCurrent))
 	assert.Equal(t, float64(c.lru.Len()), testutil.ToFloat64(c.entriesCurrent))
@@ -233,6 +239,13 @@ func TestEmbeddedCacheExpiry(t *testing.T) {
 	c.Stop()
 }
 
+// evictedItemAgeSamples returns the number of entries evicted for reason whose age was observed.
+func evictedItemAgeSamples(t *testing.T, c *EmbeddedCache[string, []byte], reason string) uint64 {
+	var m dto.Metric
+	require.NoError(t, c.evictedItemAge.WithLabelValues(reason).(prometheus.Histogram).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
 func genBytes(n uint8) []byte {
 	arr := make([]byte, n)
 	for i := range arr {
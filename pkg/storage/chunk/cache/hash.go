@@ -0,0 +1,12 @@
+package cache
+
+import "github.com/cespare/xxhash/v2"
+
+// HashFunc hashes a cache key, e.g. to choose the pools a key is routed to.
+// Implementations must be deterministic, so keys are always routed the same
+// way, and should distribute keys evenly.
+type HashFunc func(key string) uint64
+
+// DefaultHashFunc is the HashFunc of caches routing keys by their hash unless
+// configured otherwise. It uses xxhash, which is fast and well-distributed.
+var DefaultHashFunc HashFunc = xxhash.Sum64String
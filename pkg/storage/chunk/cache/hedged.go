@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/atomic"
+
+	"github.com/grafana/loki/v3/pkg/util/constants"
+)
+
+type hedgedCache struct {
+	Cache
+	after    time.Duration
+	replicas []Cache
+	next     atomic.Uint64
+
+	hedgedRequests prometheus.Counter
+	hedgeWins      prometheus.Counter
+}
+
+type hedgedFetchResult struct {
+	found   []string
+	bufs    [][]byte
+	missing []string
+	err     error
+	hedge   bool
+}
+
+// NewHedged makes a new cache which hedges fetches against slow backends. If a
+// fetch from cache hasn't returned within after, the same fetch is issued to one
+// of the replicas and the first successful response wins; the other request is
+// cancelled. Stores are written to the cache and all of its replicas.
+func NewHedged(name string, cache Cache, after time.Duration, replicas []Cache, reg prometheus.Registerer) Cache {
+	if len(replicas) == 0 {
+		return cache
+	}
+
+	return &hedgedCache{
+		Cache:    cache,
+		after:    after,
+		replicas: replicas,
+
+		hedgedRequests: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace:   constants.Loki,
+			Name:        "cache_hedged_requests_total",
+			Help:        "Total count of fetches which were hedged against a replica.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+		hedgeWins: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace:   constants.Loki,
+			Name:        "cache_hedge_wins_total",
+			Help:        "Total count of hedged fetches where the replica responded first.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+	}
+}
+
+func (h *hedgedCache) Store(ctx context.Context, keys []string, bufs [][]byte) error {
+	err := h.Cache.Store(ctx, keys, bufs)
+	for _, c := range h.replicas {
+		if replicaErr := c.Store(ctx, keys, bufs); replicaErr != nil {
+			err = replicaErr
+		}
+	}
+	return err
+}
+
+// StoreIfAbsent stores the value conditionally in the primary cache, which
+// decides whether the key was absent, and then in the replicas.
+func (h *hedgedCache) StoreIfAbsent(ctx context.Context, key string, value []byte) (bool, error) {
+	stored, err := h.Cache.StoreIfAbsent(ctx, key, value)
+	if err != nil || !stored {
+		return stored, err
+	}
+	for _, c := range h.replicas {
+		if replicaErr := c.Store(ctx, []string{key}, [][]byte{value}); replicaErr != nil {
+			err = replicaErr
+		}
+	}
+	return stored, err
+}
+
+// FetchRange reads the range from a hedged fetch of the whole value.
+func (h *hedgedCache) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	return fetchRangeViaFetch(ctx, h, key, offset, length)
+}
+
+func (h *hedgedCache) Fetch(ctx context.Context, keys []string) ([]string, [][]byte, []string, error) {
+	// Cancels whichever request is still in flight once we have a response.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgedFetchResult, 2)
+	fetch := func(c Cache, hedge bool) {
+		found, bufs, missing, err := c.Fetch(ctx, keys)
+		results <- hedgedFetchResult{found: found, bufs: bufs, missing: missing, err: err, hedge: hedge}
+	}
+	go fetch(h.Cache, false)
+
+	timer := time.NewTimer(h.after)
+	defer timer.Stop()
+
+	inflight := 1
+	for {
+		select {
+		case <-timer.C:
+			h.hedgedRequests.Inc()
+			inflight++
+			go fetch(h.replica(), true)
+		case res := <-results:
+			inflight--
+			// Wait for the other request if this one failed.
+			if res.err != nil && inflight > 0 {
+				continue
+			}
+			if res.err == nil && res.hedge {
+				h.hedgeWins.Inc()
+			}
+			return res.found, res.bufs, res.missing, res.err
+		}
+	}
+}
+
+// replica returns the replica to send the next hedged request to.
+func (h *hedgedCache) replica() Cache {
+	return h.replicas[(h.next.Inc()-1)%uint64(len(h.replicas))]
+}
+
+func (h *hedgedCache) Stop() {
+	h.Cache.Stop()
+	for _, c := range h.replicas {
+		c.Stop()
+	}
+}
@@ -0,0 +1,83 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/storage/chunk/cache"
+)
+
+// slowCache delays every fetch until the delay elapses or the context is cancelled.
+type slowCache struct {
+	cache.Cache
+	delay     time.Duration
+	cancelled chan struct{}
+}
+
+func (s *slowCache) Fetch(ctx context.Context, keys []string) ([]string, [][]byte, []string, error) {
+	select {
+	case <-time.After(s.delay):
+		return s.Cache.Fetch(ctx, keys)
+	case <-ctx.Done():
+		close(s.cancelled)
+		return nil, nil, keys, ctx.Err()
+	}
+}
+
+func TestHedgedSimple(t *testing.T) {
+	c := cache.NewHedged("test", cache.NewMockCache(), time.Second, []cache.Cache{cache.NewMockCache()}, prometheus.NewRegistry())
+	testCache(t, c)
+}
+
+func TestHedged(t *testing.T) {
+	ctx := context.Background()
+	keys, bufs := []string{"key1", "key2"}, [][]byte{[]byte("hello"), []byte("world")}
+
+	t.Run("fast primary is not hedged", func(t *testing.T) {
+		primary, replica := cache.NewMockCache(), cache.NewMockCache()
+		c := cache.NewHedged("test", primary, time.Second, []cache.Cache{replica}, prometheus.NewRegistry())
+		require.NoError(t, c.Store(ctx, keys, bufs))
+		require.Equal(t, 2, primary.NumKeyUpdates())
+		require.Equal(t, 2, replica.NumKeyUpdates())
+
+		found, foundBufs, missing, err := c.Fetch(ctx, []string{"key1", "key2", "key3"})
+		require.NoError(t, err)
+		require.Equal(t, keys, found)
+		require.Equal(t, bufs, foundBufs)
+		require.Equal(t, []string{"key3"}, missing)
+	})
+
+	t.Run("slow primary is hedged and cancelled", func(t *testing.T) {
+		primary := &slowCache{Cache: cache.NewMockCache(), delay: time.Minute, cancelled: make(chan struct{})}
+		replica := cache.NewMockCache()
+		reg := prometheus.NewRegistry()
+		c := cache.NewHedged("test", primary, 10*time.Millisecond, []cache.Cache{replica}, reg)
+		require.NoError(t, c.Store(ctx, keys, bufs))
+
+		found, foundBufs, missing, err := c.Fetch(ctx, keys)
+		require.NoError(t, err)
+		require.Equal(t, keys, found)
+		require.Equal(t, bufs, foundBufs)
+		require.Empty(t, missing)
+
+		select {
+		case <-primary.cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("expected the primary fetch to be cancelled")
+		}
+
+		count, err := testutil.GatherAndCount(reg, "loki_cache_hedged_requests_total", "loki_cache_hedge_wins_total")
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+		metrics, err := reg.Gather()
+		require.NoError(t, err)
+		for _, mf := range metrics {
+			require.Equal(t, float64(1), mf.GetMetric()[0].GetCounter().GetValue(), mf.GetName())
+		}
+	})
+}
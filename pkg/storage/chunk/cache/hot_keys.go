@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"container/heap"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/loki/v3/pkg/util/constants"
+)
+
+// hotKeysWindow is the window over which the request rates of hot keys are estimated.
+const hotKeysWindow = time.Minute
+
+// HotKeysConfig is config for detecting hot keys of a Cache.
+type HotKeysConfig struct {
+	SampleRate float64 `yaml:"sample_rate"`
+	TopK       int     `yaml:"top_k"`
+}
+
+// RegisterFlagsWithPrefix adds the flags required to config this to the given FlagSet
+func (cfg *HotKeysConfig) RegisterFlagsWithPrefix(prefix string, description string, f *flag.FlagSet) {
+	f.Float64Var(&cfg.SampleRate, prefix+"hot-keys.sample-rate", 0, description+"Fraction of fetched keys to sample for detecting hot keys, between 0 and 1. 0 disables hot key detection.")
+	f.IntVar(&cfg.TopK, prefix+"hot-keys.top-k", 10, description+"Number of hottest keys to track when hot key detection is enabled.")
+}
+
+// HotKey is a frequently fetched key, identified by its hash so keys aren't exposed.
+type HotKey struct {
+	Hash string `json:"hash"`
+	// RequestsPerSecond is the estimated rate of requests for the key.
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	// MaxOverestimation is the maximum the rate may be overestimated by.
+	MaxOverestimation float64 `json:"max_overestimation"`
+}
+
+type hotKeyCounter struct {
+	hash  uint64
+	count float64
+	// overestimation is the count of the key this counter replaced.
+	overestimation float64
+}
+
+// hotKeyCounters is a min-heap of counters by count, indexed by key hash, so
+// both incrementing a key and replacing the key with the lowest count take
+// O(log K).
+type hotKeyCounters struct {
+	counters []hotKeyCounter
+	index    map[uint64]int
+}
+
+func (h *hotKeyCounters) Len() int           { return len(h.counters) }
+func (h *hotKeyCounters) Less(i, j int) bool { return h.counters[i].count < h.counters[j].count }
+
+func (h *hotKeyCounters) Swap(i, j int) {
+	h.counters[i], h.counters[j] = h.counters[j], h.counters[i]
+	h.index[h.counters[i].hash] = i
+	h.index[h.counters[j].hash] = j
+}
+
+func (h *hotKeyCounters) Push(x any) {
+	c := x.(hotKeyCounter)
+	h.index[c.hash] = len(h.counters)
+	h.counters = append(h.counters, c)
+}
+
+func (h *hotKeyCounters) Pop() any {
+	c := h.counters[len(h.counters)-1]
+	h.counters = h.counters[:len(h.counters)-1]
+	delete(h.index, c.hash)
+	return c
+}
+
+// hotKeyDetector maintains an approximate top-K of sampled keys with the
+// space-saving algorithm, which tracks the counts of at most K keys and
+// guarantees to contain every key which makes up more than 1/K of requests.
+type hotKeyDetector struct {
+	sampleRate float64
+	topK       int
+
+	mtx         sync.Mutex
+	counters    hotKeyCounters
+	windowStart time.Time
+	// hottest are the hot keys of the last complete window.
+	hottest []HotKey
+}
+
+var hotKeyDetectors sync.Map // name -> *hotKeyDetector
+
+func newHotKeyDetector(name string, cfg HotKeysConfig, reg prometheus.Registerer) *hotKeyDetector {
+	if cfg.SampleRate <= 0 || cfg.TopK <= 0 {
+		return nil
+	}
+
+	d := &hotKeyDetector{
+		sampleRate:  min(cfg.SampleRate, 1),
+		topK:        cfg.TopK,
+		counters:    hotKeyCounters{index: make(map[uint64]int, cfg.TopK)},
+		windowStart: time.Now(),
+	}
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   constants.Loki,
+		Name:        "cache_hottest_key_requests_per_second",
+		Help:        "Estimated request rate of the most frequently fetched key of the cache.",
+		ConstLabels: prometheus.Labels{"name": name},
+	}, func() float64 {
+		if hottest := d.hotKeys(time.Now()); len(hottest) > 0 {
+			return hottest[0].RequestsPerSecond
+		}
+		return 0
+	})
+	hotKeyDetectors.Store(name, d)
+	return d
+}
+
+func (d *hotKeyDetector) observe(keys []string) {
+	// Keys are sampled and hashed before locking, so fetches which sample no
+	// keys don't contend on the lock.
+	var sampled []uint64
+	for _, key := range keys {
+		if d.sampleRate < 1 && rand.Float64() >= d.sampleRate {
+			continue
+		}
+		sampled = append(sampled, xxhash.Sum64String(key))
+	}
+	if len(sampled) == 0 {
+		return
+	}
+	now := time.Now()
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.rotate(now)
+	for _, hash := range sampled {
+		d.record(hash)
+	}
+}
+
+func (d *hotKeyDetector) record(hash uint64) {
+	h := &d.counters
+	if i, ok := h.index[hash]; ok {
+		h.counters[i].count++
+		heap.Fix(h, i)
+		return
+	}
+	if h.Len() < d.topK {
+		heap.Push(h, hotKeyCounter{hash: hash, count: 1})
+		return
+	}
+
+	// Replace the key with the lowest count, inheriting its count as the possible overestimation.
+	replaced := h.counters[0]
+	delete(h.index, replaced.hash)
+	h.index[hash] = 0
+	h.counters[0] = hotKeyCounter{hash: hash, count: replaced.count + 1, overestimation: replaced.count}
+	heap.Fix(h, 0)
+}
+
+// rotate starts a new window if the current one is complete, keeping the hot keys of the completed one.
+func (d *hotKeyDetector) rotate(now time.Time) {
+	elapsed := now.Sub(d.windowStart)
+	if elapsed < hotKeysWindow {
+		return
+	}
+
+	// Sampled counts are scaled up to estimate the actual request rates.
+	scale := 1 / d.sampleRate / elapsed.Seconds()
+	d.hottest = d.hottest[:0]
+	for _, c := range d.counters.counters {
+		d.hottest = append(d.hottest, HotKey{
+			Hash:              fmt.Sprintf("%016x", c.hash),
+			RequestsPerSecond: c.count * scale,
+			MaxOverestimation: c.overestimation * scale,
+		})
+	}
+	slices.SortFunc(d.hottest, func(a, b HotKey) int {
+		switch {
+		case a.RequestsPerSecond > b.RequestsPerSecond:
+			return -1
+		case a.RequestsPerSecond < b.RequestsPerSecond:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	d.counters.counters = d.counters.counters[:0]
+	clear(d.counters.index)
+	d.windowStart = now
+}
+
+// hotKeys returns the hot keys of the last complete window, hottest first.
+func (d *hotKeyDetector) hotKeys(now time.Time) []HotKey {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.rotate(now)
+	return slices.Clone(d.hottest)
+}
+
+// HotKeysHandler serves the hot keys of all caches with hot key detection enabled as JSON, by cache name.
+func HotKeysHandler(w http.ResponseWriter, _ *http.Request) {
+	now := time.Now()
+	result := make(map[string][]HotKey)
+	hotKeyDetectors.Range(func(name, d any) bool {
+		result[name.(string)] = d.(*hotKeyDetector).hotKeys(now)
+		return true
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHotKeyDetector(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	d := newHotKeyDetector("test-hot-keys", HotKeysConfig{SampleRate: 1, TopK: 3}, reg)
+	require.NotNil(t, d)
+
+	// The hot key makes up half of all requests, the rest are spread over many cold keys.
+	for i := 0; i < 1000; i++ {
+		d.observe([]string{"hot", fmt.Sprintf("cold-%d", i)})
+	}
+	require.Empty(t, d.hotKeys(time.Now()), "hot keys are only reported for complete windows")
+
+	start := d.windowStart
+	hottest := d.hotKeys(start.Add(hotKeysWindow))
+	require.Len(t, hottest, 3)
+	require.Equal(t, fmt.Sprintf("%016x", xxhash.Sum64String("hot")), hottest[0].Hash)
+	require.InDelta(t, 1000/hotKeysWindow.Seconds(), hottest[0].RequestsPerSecond, 0.001)
+	require.Zero(t, hottest[0].MaxOverestimation)
+
+	// The gauge reports the hottest key of the last complete window.
+	require.InDelta(t, 1000/hotKeysWindow.Seconds(), testutil.ToFloat64(reg), 0.001)
+
+	rec := httptest.NewRecorder()
+	HotKeysHandler(rec, httptest.NewRequest("GET", "/debug/cache/hot_keys", nil))
+	var served map[string][]HotKey
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&served))
+	require.Equal(t, hottest, served["test-hot-keys"])
+}
+
+func TestHotKeyDetectorReplacesColdestKey(t *testing.T) {
+	d := newHotKeyDetector("test-replace-hot-keys", HotKeysConfig{SampleRate: 1, TopK: 2}, prometheus.NewRegistry())
+	d.observe([]string{"a", "b", "b", "b", "c", "a", "a"})
+
+	hottest := d.hotKeys(d.windowStart.Add(hotKeysWindow))
+	require.Len(t, hottest, 2)
+	scale := 1 / hotKeysWindow.Seconds()
+	// c replaced a, which had the lowest count, and was then replaced by a.
+	require.Equal(t, fmt.Sprintf("%016x", xxhash.Sum64String("a")), hottest[0].Hash)
+	require.InDelta(t, 4*scale, hottest[0].RequestsPerSecond, 0.001)
+	require.InDelta(t, 2*scale, hottest[0].MaxOverestimation, 0.001)
+	require.Equal(t, fmt.Sprintf("%016x", xxhash.Sum64String("b")), hottest[1].Hash)
+	require.InDelta(t, 3*scale, hottest[1].RequestsPerSecond, 0.001)
+	require.Zero(t, hottest[1].MaxOverestimation)
+}
+
+func TestHotKeyDetectorDisabled(t *testing.T) {
+	require.Nil(t, newHotKeyDetector("test", HotKeysConfig{}, prometheus.NewRegistry()))
+}
@@ -2,8 +2,12 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"slices"
+	"time"
 
 	instr "github.com/grafana/dskit/instrument"
+	"github.com/grafana/dskit/tenant"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	attribute "go.opentelemetry.io/otel/attribute"
@@ -15,6 +19,43 @@ import (
 
 // Instrument returns an instrumented cache.
 func Instrument(name string, cache Cache, reg prometheus.Registerer) Cache {
+	return InstrumentWithHotKeys(name, cache, HotKeysConfig{}, reg)
+}
+
+// InstrumentOption configures optional behaviour of an instrumented cache.
+type InstrumentOption func(*instrumentedCache)
+
+// WithValueValidation makes Fetch check every fetched value with validate and
+// treat values failing it as misses, so values torn by a concurrent rewrite in
+// the backend don't reach callers. If refetchDelay is positive, keys with invalid
+// values are fetched once more after refetchDelay, which smooths over brief
+// inconsistency windows. Validation failures are counted in a metric.
+func WithValueValidation(validate func([]byte) bool, refetchDelay time.Duration) InstrumentOption {
+	return func(i *instrumentedCache) {
+		i.validate = validate
+		i.refetchDelay = refetchDelay
+	}
+}
+
+// otherTenant is the tenant label of the bytes of tenants which aren't allow-listed.
+const otherTenant = "other"
+
+// WithTenantBytes makes the cache count the bytes of the values stored and
+// fetched on behalf of each tenant, read from the request context, so the
+// cache bandwidth of tenants can be compared. To bound the cardinality of the
+// metric, only the tenants of allowList get their own label; the bytes of all
+// other tenants and of multi-tenant requests are counted as "other". Requests
+// without a tenant aren't counted.
+func WithTenantBytes(allowList []string) InstrumentOption {
+	return func(i *instrumentedCache) {
+		i.tenantAllowList = allowList
+	}
+}
+
+// InstrumentWithHotKeys returns an instrumented cache which also samples fetched
+// keys to detect hot keys according to hotKeys. The hot keys are exposed by
+// [HotKeysHandler] and the request rate of the hottest one as a metric.
+func InstrumentWithHotKeys(name string, cache Cache, hotKeys HotKeysConfig, reg prometheus.Registerer, opts ...InstrumentOption) Cache {
 	valueSize := promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: constants.Loki,
 		Name:      "cache_value_size_bytes",
@@ -25,8 +66,24 @@ func Instrument(name string, cache Cache, reg prometheus.Registerer) Cache {
 		Buckets:     prometheus.ExponentialBuckets(1024, 4, 7),
 		ConstLabels: prometheus.Labels{"name": name},
 	}, []string{"method"})
+	keyLength := promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: constants.Loki,
+		Name:      "cache_key_length_bytes",
+		Help:      "Length of keys stored in and fetched from the cache.",
+		// Keys are usually hashes or short identifiers, so keys longer than a
+		// few hundred bytes point at a key-construction bug.
+		// 8 * 2^(7-1) = 512B
+		Buckets:     prometheus.ExponentialBuckets(8, 2, 7),
+		ConstLabels: prometheus.Labels{"name": name},
+	}, []string{"method"})
+	storeIfAbsent := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Namespace:   constants.Loki,
+		Name:        "cache_store_if_absent_total",
+		Help:        "Total count of conditional stores by whether the key was stored or already existed.",
+		ConstLabels: prometheus.Labels{"name": name},
+	}, []string{"outcome"})
 
-	return &instrumentedCache{
+	c := &instrumentedCache{
 		name:  name,
 		Cache: cache,
 
@@ -55,7 +112,38 @@ func Instrument(name string, cache Cache, reg prometheus.Registerer) Cache {
 
 		storedValueSize:  valueSize.WithLabelValues("store"),
 		fetchedValueSize: valueSize.WithLabelValues("fetch"),
+		rangeValueSize:   valueSize.WithLabelValues("fetch_range"),
+
+		storedKeyLength:  keyLength.WithLabelValues("store"),
+		fetchedKeyLength: keyLength.WithLabelValues("fetch"),
+		rangeKeyLength:   keyLength.WithLabelValues("fetch_range"),
+
+		storedIfAbsent:  storeIfAbsent.WithLabelValues("stored"),
+		existedIfAbsent: storeIfAbsent.WithLabelValues("existed"),
+
+		hotKeys: newHotKeyDetector(name, hotKeys, reg),
 	}
+
+	for _, o := range opts {
+		o(c)
+	}
+	if c.validate != nil {
+		c.validationFailures = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace:   constants.Loki,
+			Name:        "cache_validation_failures_total",
+			Help:        "Total count of fetched values which failed validation and were treated as misses.",
+			ConstLabels: prometheus.Labels{"name": name},
+		})
+	}
+	if c.tenantAllowList != nil {
+		c.tenantBytes = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace:   constants.Loki,
+			Name:        "cache_tenant_bytes_total",
+			Help:        "Total bytes of values stored in and fetched from the cache by tenant.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}, []string{"method", "tenant"})
+	}
+	return c
 }
 
 type instrumentedCache struct {
@@ -64,13 +152,55 @@ type instrumentedCache struct {
 
 	fetchedKeys, hits                 prometheus.Counter
 	storedValueSize, fetchedValueSize prometheus.Observer
+	rangeValueSize                    prometheus.Observer
+	storedKeyLength, fetchedKeyLength prometheus.Observer
+	rangeKeyLength                    prometheus.Observer
+	storedIfAbsent, existedIfAbsent   prometheus.Counter
 	requestDuration                   *instr.HistogramCollector
+	hotKeys                           *hotKeyDetector
+
+	validate           func([]byte) bool
+	refetchDelay       time.Duration
+	validationFailures prometheus.Counter
+
+	tenantAllowList []string
+	tenantBytes     *prometheus.CounterVec
+}
+
+// addTenantBytes attributes the bytes of values to the tenant of ctx, if tenant bytes are counted.
+func (i *instrumentedCache) addTenantBytes(ctx context.Context, method string, bufs ...[]byte) {
+	if i.tenantBytes == nil || len(bufs) == 0 {
+		return
+	}
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return
+	}
+
+	label := otherTenant
+	if len(tenantIDs) == 1 && slices.Contains(i.tenantAllowList, tenantIDs[0]) {
+		label = tenantIDs[0]
+	}
+	var size int
+	for _, buf := range bufs {
+		size += len(buf)
+	}
+	i.tenantBytes.WithLabelValues(method, label).Add(float64(size))
+}
+
+// observeKeyLengths observes the length of every key in keys with observer.
+func observeKeyLengths(observer prometheus.Observer, keys ...string) {
+	for _, key := range keys {
+		observer.Observe(float64(len(key)))
+	}
 }
 
 func (i *instrumentedCache) Store(ctx context.Context, keys []string, bufs [][]byte) error {
 	for j := range bufs {
 		i.storedValueSize.Observe(float64(len(bufs[j])))
 	}
+	observeKeyLengths(i.storedKeyLength, keys...)
+	i.addTenantBytes(ctx, "store", bufs...)
 
 	method := i.name + ".store"
 	return instr.CollectedRequest(ctx, method, i.requestDuration, instr.ErrorCode, func(ctx context.Context) error {
@@ -85,6 +215,40 @@ func (i *instrumentedCache) Store(ctx context.Context, keys []string, bufs [][]b
 	})
 }
 
+func (i *instrumentedCache) StoreIfAbsent(ctx context.Context, key string, value []byte) (bool, error) {
+	i.storedValueSize.Observe(float64(len(value)))
+	observeKeyLengths(i.storedKeyLength, key)
+	i.addTenantBytes(ctx, "store", value)
+
+	var (
+		stored bool
+		method = i.name + ".store_if_absent"
+	)
+	err := instr.CollectedRequest(ctx, method, i.requestDuration, instr.ErrorCode, func(ctx context.Context) error {
+		sp := trace.SpanFromContext(ctx)
+		var storeErr error
+		stored, storeErr = i.Cache.StoreIfAbsent(ctx, key, value)
+		if storeErr != nil {
+			sp.SetStatus(codes.Error, storeErr.Error())
+			sp.RecordError(storeErr)
+			return storeErr
+		}
+
+		sp.SetAttributes(attribute.Bool("stored", stored))
+		return nil
+	})
+	if err != nil {
+		return stored, err
+	}
+
+	if stored {
+		i.storedIfAbsent.Inc()
+	} else {
+		i.existedIfAbsent.Inc()
+	}
+	return stored, nil
+}
+
 func (i *instrumentedCache) Fetch(ctx context.Context, keys []string) ([]string, [][]byte, []string, error) {
 	var (
 		found    []string
@@ -111,15 +275,132 @@ func (i *instrumentedCache) Fetch(ctx context.Context, keys []string) ([]string,
 		return nil
 	})
 
+	if i.validate != nil && err == nil {
+		found, bufs, missing = i.validateFetched(ctx, found, bufs, missing)
+	}
+
 	i.fetchedKeys.Add(float64(len(keys)))
 	i.hits.Add(float64(len(found)))
+	observeKeyLengths(i.fetchedKeyLength, keys...)
+	if i.hotKeys != nil {
+		i.hotKeys.observe(keys)
+	}
 	for j := range bufs {
 		i.fetchedValueSize.Observe(float64(len(bufs[j])))
 	}
+	i.addTenantBytes(ctx, "fetch", bufs...)
 
 	return found, bufs, missing, err
 }
 
+// FetchRange records the request under the fetch_range method and observes
+// the size of the returned range. Missing keys are counted as misses rather
+// than errors. Ranges aren't validated, as validators expect whole values.
+func (i *instrumentedCache) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	var (
+		value    []byte
+		fetchErr error
+		method   = i.name + ".fetch_range"
+	)
+
+	err := instr.CollectedRequest(ctx, method, i.requestDuration, instr.ErrorCode, func(ctx context.Context) error {
+		sp := trace.SpanFromContext(ctx)
+		sp.SetAttributes(attribute.Int64("offset", offset), attribute.Int64("length", length))
+		value, fetchErr = i.Cache.FetchRange(ctx, key, offset, length)
+		if fetchErr != nil && !errors.Is(fetchErr, ErrNotFound) {
+			sp.SetStatus(codes.Error, fetchErr.Error())
+			sp.RecordError(fetchErr)
+			return fetchErr
+		}
+
+		sp.SetAttributes(attribute.Bool("found", fetchErr == nil))
+		return nil
+	})
+	if err == nil {
+		err = fetchErr
+	}
+
+	i.fetchedKeys.Inc()
+	observeKeyLengths(i.rangeKeyLength, key)
+	if i.hotKeys != nil {
+		i.hotKeys.observe([]string{key})
+	}
+	if err == nil {
+		i.hits.Inc()
+		i.rangeValueSize.Observe(float64(len(value)))
+		i.addTenantBytes(ctx, "fetch", value)
+	}
+	return value, err
+}
+
+// validateFetched moves keys with values failing validation from found to
+// missing, after re-fetching them once if a refetch delay is configured.
+func (i *instrumentedCache) validateFetched(ctx context.Context, found []string, bufs [][]byte, missing []string) ([]string, [][]byte, []string) {
+	valid, validBufs, invalid := i.splitInvalid(found, bufs)
+	if len(invalid) == 0 || i.refetchDelay <= 0 {
+		return valid, validBufs, append(missing, invalid...)
+	}
+
+	select {
+	case <-ctx.Done():
+		return valid, validBufs, append(missing, invalid...)
+	case <-time.After(i.refetchDelay):
+	}
+
+	refetched, refetchedBufs, stillMissing, err := i.Cache.Fetch(ctx, invalid)
+	if err != nil {
+		return valid, validBufs, append(missing, invalid...)
+	}
+	refetched, refetchedBufs, stillInvalid := i.splitInvalid(refetched, refetchedBufs)
+	missing = append(append(missing, stillMissing...), stillInvalid...)
+	return append(valid, refetched...), append(validBufs, refetchedBufs...), missing
+}
+
+// splitInvalid splits keys into those with valid values and those without, counting the invalid ones.
+func (i *instrumentedCache) splitInvalid(keys []string, bufs [][]byte) ([]string, [][]byte, []string) {
+	valid := make([]string, 0, len(keys))
+	validBufs := make([][]byte, 0, len(bufs))
+	var invalid []string
+	for j, key := range keys {
+		if i.validate(bufs[j]) {
+			valid = append(valid, key)
+			validBufs = append(validBufs, bufs[j])
+			continue
+		}
+		invalid = append(invalid, key)
+	}
+	i.validationFailures.Add(float64(len(invalid)))
+	return valid, validBufs, invalid
+}
+
+func (i *instrumentedCache) Exists(ctx context.Context, keys []string) ([]string, []string, error) {
+	var (
+		present   []string
+		missing   []string
+		existsErr error
+		method    = i.name + ".peek"
+	)
+
+	err := instr.CollectedRequest(ctx, method, i.requestDuration, instr.ErrorCode, func(ctx context.Context) error {
+		sp := trace.SpanFromContext(ctx)
+		sp.SetAttributes(attribute.Int("keys requested", len(keys)))
+		present, missing, existsErr = i.Cache.Exists(ctx, keys)
+		if existsErr != nil {
+			sp.SetStatus(codes.Error, existsErr.Error())
+			sp.RecordError(existsErr)
+			return existsErr
+		}
+
+		sp.SetAttributes(
+			attribute.Int("keys found", len(present)),
+			attribute.Int("keys missing", len(missing)),
+		)
+		return nil
+	})
+
+	return present, missing, err
+}
+
 func (i *instrumentedCache) Stop() {
 	i.Cache.Stop()
 }
@@ -0,0 +1,189 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/dskit/user"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/storage/chunk/cache"
+)
+
+// rewritingCache returns a torn value for key "torn" on the first fetch only.
+type rewritingCache struct {
+	cache.Cache
+	fetches int
+}
+
+func (c *rewritingCache) Fetch(ctx context.Context, keys []string) ([]string, [][]byte, []string, error) {
+	c.fetches++
+	found, bufs, missing, err := c.Cache.Fetch(ctx, keys)
+	for i, key := range found {
+		if key == "torn" && c.fetches == 1 {
+			bufs[i] = bufs[i][:1]
+		}
+	}
+	return found, bufs, missing, err
+}
+
+func TestInstrumentWithValueValidation(t *testing.T) {
+	ctx := context.Background()
+	value := []byte("complete")
+	validate := func(buf []byte) bool { return bytes.Equal(buf, value) }
+
+	for _, tc := range []struct {
+		name            string
+		refetchDelay    time.Duration
+		expectedFound   []string
+		expectedMissing []string
+	}{
+		{name: "treated as miss", expectedFound: []string{"ok"}, expectedMissing: []string{"absent", "torn"}},
+		{name: "refetched", refetchDelay: time.Millisecond, expectedFound: []string{"ok", "torn"}, expectedMissing: []string{"absent"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			backend := &rewritingCache{Cache: cache.NewMockCache()}
+			require.NoError(t, backend.Store(ctx, []string{"ok", "torn"}, [][]byte{value, value}))
+
+			reg := prometheus.NewRegistry()
+			c := cache.InstrumentWithHotKeys("test", backend, cache.HotKeysConfig{}, reg, cache.WithValueValidation(validate, tc.refetchDelay))
+
+			found, bufs, missing, err := c.Fetch(ctx, []string{"ok", "torn", "absent"})
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedFound, found)
+			for _, buf := range bufs {
+				require.Equal(t, value, buf)
+			}
+			require.Equal(t, tc.expectedMissing, missing)
+			require.Equal(t, float64(1), counterValue(t, reg, "loki_cache_validation_failures_total"))
+		})
+	}
+}
+
+func TestInstrumentStoreIfAbsent(t *testing.T) {
+	ctx := context.Background()
+	reg := prometheus.NewRegistry()
+	c := cache.Instrument("test", cache.NewMockCache(), reg)
+
+	stored, err := c.StoreIfAbsent(ctx, "key", []byte("first"))
+	require.NoError(t, err)
+	require.True(t, stored)
+	stored, err = c.StoreIfAbsent(ctx, "key", []byte("second"))
+	require.NoError(t, err)
+	require.False(t, stored)
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP loki_cache_store_if_absent_total Total count of conditional stores by whether the key was stored or already existed.
+# TYPE loki_cache_store_if_absent_total counter
+loki_cache_store_if_absent_total{name="test",outcome="existed"} 1
+loki_cache_store_if_absent_total{name="test",outcome="stored"} 1
+`), "loki_cache_store_if_absent_total"))
+
+	_, err = cache.NewTiered([]cache.Cache{cache.NewMockCache(), cache.NewMockCache()}).StoreIfAbsent(ctx, "key", nil)
+	require.ErrorIs(t, err, cache.ErrUnsupported)
+}
+
+func TestInstrumentWithTenantBytes(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := cache.InstrumentWithHotKeys("test", cache.NewMockCache(), cache.HotKeysConfig{}, reg, cache.WithTenantBytes([]string{"allowed"}))
+
+	allowed := user.InjectOrgID(context.Background(), "allowed")
+	other := user.InjectOrgID(context.Background(), "other-tenant")
+
+	require.NoError(t, c.Store(allowed, []string{"a", "b"}, [][]byte{[]byte("1234"), []byte("56")}))
+	require.NoError(t, c.Store(other, []string{"c"}, [][]byte{[]byte("789")}))
+	// Requests without a tenant aren't attributed.
+	require.NoError(t, c.Store(context.Background(), []string{"d"}, [][]byte{[]byte("0")}))
+	_, _, _, err := c.Fetch(allowed, []string{"a", "c", "missing"})
+	require.NoError(t, err)
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP loki_cache_tenant_bytes_total Total bytes of values stored in and fetched from the cache by tenant.
+# TYPE loki_cache_tenant_bytes_total counter
+loki_cache_tenant_bytes_total{method="fetch",name="test",tenant="allowed"} 7
+loki_cache_tenant_bytes_total{method="store",name="test",tenant="allowed"} 6
+loki_cache_tenant_bytes_total{method="store",name="test",tenant="other"} 3
+`), "loki_cache_tenant_bytes_total"))
+}
+
+func TestInstrumentFetchRange(t *testing.T) {
+	ctx := context.Background()
+	reg := prometheus.NewRegistry()
+	c := cache.Instrument("test", cache.NewMockCache(), reg)
+	require.NoError(t, c.Store(ctx, []string{"key"}, [][]byte{[]byte("0123456789")}))
+
+	value, err := c.FetchRange(ctx, "key", 2, 4)
+	require.NoError(t, err)
+	require.Equal(t, []byte("2345"), value)
+	_, err = c.FetchRange(ctx, "missing", 2, 4)
+	require.ErrorIs(t, err, cache.ErrNotFound)
+
+	metrics, err := reg.Gather()
+	require.NoError(t, err)
+	var rangeSizes, rangeRequests uint64
+	for _, family := range metrics {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				switch {
+				case family.GetName() == "loki_cache_value_size_bytes" && label.GetName() == "method" && label.GetValue() == "fetch_range":
+					rangeSizes = metric.GetHistogram().GetSampleCount()
+					require.Equal(t, float64(4), metric.GetHistogram().GetSampleSum())
+				case family.GetName() == "loki_cache_request_duration_seconds" && label.GetName() == "method" && label.GetValue() == "test.fetch_range":
+					rangeRequests += metric.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	require.Equal(t, uint64(1), rangeSizes)
+	require.Equal(t, uint64(2), rangeRequests, "expected misses to be recorded as successful requests")
+}
+
+func TestInstrumentKeyLength(t *testing.T) {
+	ctx := context.Background()
+	reg := prometheus.NewRegistry()
+	c := cache.Instrument("test", cache.NewMockCache(), reg)
+
+	require.NoError(t, c.Store(ctx, []string{"a", strings.Repeat("k", 100)}, [][]byte{[]byte("1"), []byte("2")}))
+	_, _, _, err := c.Fetch(ctx, []string{"a", "missing"})
+	require.NoError(t, err)
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP loki_cache_key_length_bytes Length of keys stored in and fetched from the cache.
+# TYPE loki_cache_key_length_bytes histogram
+loki_cache_key_length_bytes_bucket{method="fetch",name="test",le="8"} 2
+loki_cache_key_length_bytes_bucket{method="fetch",name="test",le="16"} 2
+loki_cache_key_length_bytes_bucket{method="fetch",name="test",le="32"} 2
+loki_cache_key_length_bytes_bucket{method="fetch",name="test",le="64"} 2
+loki_cache_key_length_bytes_bucket{method="fetch",name="test",le="128"} 2
+loki_cache_key_length_bytes_bucket{method="fetch",name="test",le="256"} 2
+loki_cache_key_length_bytes_bucket{method="fetch",name="test",le="512"} 2
+loki_cache_key_length_bytes_bucket{method="fetch",name="test",le="+Inf"} 2
+loki_cache_key_length_bytes_sum{method="fetch",name="test"} 8
+loki_cache_key_length_bytes_count{method="fetch",name="test"} 2
+loki_cache_key_length_bytes_bucket{method="fetch_range",name="test",le="8"} 0
+loki_cache_key_length_bytes_bucket{method="fetch_range",name="test",le="16"} 0
+loki_cache_key_length_bytes_bucket{method="fetch_range",name="test",le="32"} 0
+loki_cache_key_length_bytes_bucket{method="fetch_range",name="test",le="64"} 0
+loki_cache_key_length_bytes_bucket{method="fetch_range",name="test",le="128"} 0
+loki_cache_key_length_bytes_bucket{method="fetch_range",name="test",le="256"} 0
+loki_cache_key_length_bytes_bucket{method="fetch_range",name="test",le="512"} 0
+loki_cache_key_length_bytes_bucket{method="fetch_range",name="test",le="+Inf"} 0
+loki_cache_key_length_bytes_sum{method="fetch_range",name="test"} 0
+loki_cache_key_length_bytes_count{method="fetch_range",name="test"} 0
+loki_cache_key_length_bytes_bucket{method="store",name="test",le="8"} 1
+loki_cache_key_length_bytes_bucket{method="store",name="test",le="16"} 1
+loki_cache_key_length_bytes_bucket{method="store",name="test",le="32"} 1
+loki_cache_key_length_bytes_bucket{method="store",name="test",le="64"} 1
+loki_cache_key_length_bytes_bucket{method="store",name="test",le="128"} 2
+loki_cache_key_length_bytes_bucket{method="store",name="test",le="256"} 2
+loki_cache_key_length_bytes_bucket{method="store",name="test",le="512"} 2
+loki_cache_key_length_bytes_bucket{method="store",name="test",le="+Inf"} 2
+loki_cache_key_length_bytes_sum{method="store",name="test"} 101
+loki_cache_key_length_bytes_count{method="store",name="test"} 2
+`), "loki_cache_key_length_bytes"))
+}
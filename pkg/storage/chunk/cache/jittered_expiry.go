@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/loki/v3/pkg/util/constants"
+)
+
+type jitteredExpiryCache struct {
+	Cache
+	ttl    time.Duration
+	jitter float64
+
+	expired prometheus.Counter
+}
+
+// NewJitteredExpiry returns a new Cache which spreads the expiry of values
+// stored at the same time, so keys written together don't all expire at once
+// and cause a spike of misses. Every value is prefixed with an expiry of ttl
+// shortened by a random fraction of up to jitter, and treated as a miss once
+// it has expired. The backend must store values for at least ttl.
+//
+// Values stored without the wrapper are returned unchanged. A jitter of 0 or
+// less returns cache unchanged and a jitter above 1 is treated as 1.
+func NewJitteredExpiry(name string, cache Cache, ttl time.Duration, jitter float64, reg prometheus.Registerer) Cache {
+	if jitter <= 0 {
+		return cache
+	}
+
+	return &jitteredExpiryCache{
+		Cache:  cache,
+		ttl:    ttl,
+		jitter: min(jitter, 1),
+
+		expired: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace:   constants.Loki,
+			Name:        "cache_jittered_expiry_expired_total",
+			Help:        "Total count of values fetched from cache after their jittered expiry, which were treated as misses.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+	}
+}
+
+func (j *jitteredExpiryCache) Store(ctx context.Context, keys []string, bufs [][]byte) error {
+	now := time.Now()
+
+	withExpiry := make([][]byte, len(bufs))
+	for i, buf := range bufs {
+		ttl := time.Duration(float64(j.ttl) * (1 - j.jitter*rand.Float64()))
+		withExpiry[i] = prefixExpiry(buf, now.Add(ttl))
+	}
+	return j.Cache.Store(ctx, keys, withExpiry)
+}
+
+// StoreIfAbsent stores the value with a jittered expiry. Values past their
+// expiry are still present until the backend evicts them.
+func (j *jitteredExpiryCache) StoreIfAbsent(ctx context.Context, key string, value []byte) (bool, error) {
+	ttl := time.Duration(float64(j.ttl) * (1 - j.jitter*rand.Float64()))
+	return j.Cache.StoreIfAbsent(ctx, key, prefixExpiry(value, time.Now().Add(ttl)))
+}
+
+// FetchRange reads the range from the fetched value, as the stored value
+// is prefixed with its expiry.
+func (j *jitteredExpiryCache) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	return fetchRangeViaFetch(ctx, j, key, offset, length)
+}
+
+func (j *jitteredExpiryCache) Fetch(ctx context.Context, keys []string) ([]string, [][]byte, []string, error) {
+	found, bufs, missing, err := j.Cache.Fetch(ctx, keys)
+	if err != nil {
+		return found, bufs, missing, err
+	}
+
+	now := time.Now()
+	resultKeys := found[:0]
+	resultBufs := bufs[:0]
+	for i, buf := range bufs {
+		expiry, value, ok := splitExpiry(buf)
+		switch {
+		case !ok:
+			value = buf
+		case !now.Before(expiry):
+			j.expired.Inc()
+			missing = append(missing, found[i])
+			continue
+		}
+		resultKeys = append(resultKeys, found[i])
+		resultBufs = append(resultBufs, value)
+	}
+	return resultKeys, resultBufs, missing, nil
+}
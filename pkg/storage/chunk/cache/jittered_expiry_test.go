@@ -0,0 +1,76 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/storage/chunk/cache"
+)
+
+func TestJitteredExpirySimple(t *testing.T) {
+	testCache(t, cache.NewJitteredExpiry("test", cache.NewMockCache(), time.Hour, 0.1, prometheus.NewRegistry()))
+}
+
+func TestJitteredExpiry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("spreads expiry", func(t *testing.T) {
+		backend := cache.NewMockCache()
+		c := cache.NewJitteredExpiry("test", backend, time.Hour, 0.5, prometheus.NewRegistry())
+
+		keys := make([]string, 100)
+		bufs := make([][]byte, len(keys))
+		for i := range keys {
+			keys[i] = string(rune('a' + i))
+			bufs[i] = []byte("value")
+		}
+		require.NoError(t, c.Store(ctx, keys, bufs))
+
+		// Observe the expiry prefixed by the wrapper.
+		reg := prometheus.NewRegistry()
+		observer := cache.NewTTLObserver("observer", backend, time.Hour, reg)
+		_, _, _, err := observer.Fetch(ctx, keys)
+		require.NoError(t, err)
+
+		metrics, err := reg.Gather()
+		require.NoError(t, err)
+		histogram := metrics[0].GetMetric()[0].GetHistogram()
+		require.Equal(t, uint64(len(keys)), histogram.GetSampleCount())
+		mean := histogram.GetSampleSum() / float64(len(keys))
+		require.Less(t, mean, time.Hour.Seconds())
+		require.Greater(t, mean, (time.Hour / 2).Seconds())
+
+		found, fetched, missing, err := c.Fetch(ctx, keys)
+		require.NoError(t, err)
+		require.Equal(t, keys, found)
+		require.Equal(t, bufs, fetched)
+		require.Empty(t, missing)
+	})
+
+	t.Run("expired values are misses", func(t *testing.T) {
+		backend := cache.NewMockCache()
+		reg := prometheus.NewRegistry()
+		c := cache.NewJitteredExpiry("test", backend, time.Nanosecond, 1, reg)
+
+		require.NoError(t, c.Store(ctx, []string{"expired"}, [][]byte{[]byte("old")}))
+		// Values stored without the wrapper have no expiry.
+		require.NoError(t, backend.Store(ctx, []string{"plain"}, [][]byte{[]byte("value")}))
+		time.Sleep(time.Millisecond)
+
+		found, bufs, missing, err := c.Fetch(ctx, []string{"expired", "plain", "absent"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"plain"}, found)
+		require.Equal(t, [][]byte{[]byte("value")}, bufs)
+		require.ElementsMatch(t, []string{"expired", "absent"}, missing)
+		require.Equal(t, float64(1), counterValue(t, reg, "loki_cache_jittered_expiry_expired_total"))
+	})
+
+	t.Run("no jitter", func(t *testing.T) {
+		backend := cache.NewMockCache()
+		require.Same(t, backend, cache.NewJitteredExpiry("test", backend, time.Hour, 0, prometheus.NewRegistry()))
+	})
+}
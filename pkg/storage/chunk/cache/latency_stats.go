@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// latencyShards is the number of independently locked reservoirs per
+	// method, so concurrent requests rarely contend on the same lock.
+	latencyShards = 16
+	// latencyReservoirSize is the number of latencies sampled per shard.
+	latencyReservoirSize = 256
+)
+
+// LatencySummary summarizes the latencies of the requests to a method of a
+// [LatencyStatsCache].
+type LatencySummary struct {
+	Count int64 // Number of requests observed.
+	P50   time.Duration
+	P99   time.Duration
+}
+
+// LatencyStatsCache is a Cache which keeps latency statistics of the requests
+// to each method of the wrapped cache in memory, for uses without a
+// Prometheus registry.
+type LatencyStatsCache struct {
+	Cache
+	methods map[string]*latencySampler
+}
+
+// LatencyStats returns a new Cache which passes all requests through to
+// cache and samples their latencies. [LatencyStatsCache.Stats] reports the
+// latency quantiles of each method, estimated from a uniform sample of all
+// requests since the cache was created.
+func LatencyStats(cache Cache) *LatencyStatsCache {
+	methods := make(map[string]*latencySampler)
+	for _, method := range []string{"store", "store_if_absent", "fetch", "fetch_range", "exists"} {
+		methods[method] = &latencySampler{}
+	}
+	return &LatencyStatsCache{Cache: cache, methods: methods}
+}
+
+// Stats returns the latency summary of every method by name: store,
+// store_if_absent, fetch, fetch_range and exists. Methods without requests
+// have a zero summary.
+func (l *LatencyStatsCache) Stats() map[string]LatencySummary {
+	stats := make(map[string]LatencySummary, len(l.methods))
+	for method, sampler := range l.methods {
+		stats[method] = sampler.summary()
+	}
+	return stats
+}
+
+func (l *LatencyStatsCache) Store(ctx context.Context, keys []string, bufs [][]byte) error {
+	defer l.methods["store"].observeSince(time.Now())
+	return l.Cache.Store(ctx, keys, bufs)
+}
+
+func (l *LatencyStatsCache) StoreIfAbsent(ctx context.Context, key string, value []byte) (bool, error) {
+	defer l.methods["store_if_absent"].observeSince(time.Now())
+	return l.Cache.StoreIfAbsent(ctx, key, value)
+}
+
+func (l *LatencyStatsCache) Fetch(ctx context.Context, keys []string) ([]string, [][]byte, []string, error) {
+	defer l.methods["fetch"].observeSince(time.Now())
+	return l.Cache.Fetch(ctx, keys)
+}
+
+func (l *LatencyStatsCache) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	defer l.methods["fetch_range"].observeSince(time.Now())
+	return l.Cache.FetchRange(ctx, key, offset, length)
+}
+
+func (l *LatencyStatsCache) Exists(ctx context.Context, keys []string) ([]string, []string, error) {
+	defer l.methods["exists"].observeSince(time.Now())
+	return l.Cache.Exists(ctx, keys)
+}
+
+// latencySampler keeps a uniform sample of latencies. Each latency is added
+// to the reservoir of a random shard, so every shard samples about the same
+// number of requests and their samples can be merged as is.
+type latencySampler struct {
+	shards [latencyShards]latencyReservoir
+}
+
+type latencyReservoir struct {
+	mtx     sync.Mutex
+	count   int64
+	samples []time.Duration
+}
+
+func (s *latencySampler) observeSince(start time.Time) {
+	s.shards[rand.IntN(latencyShards)].observe(time.Since(start))
+}
+
+// observe adds d to the reservoir with reservoir sampling, so that the
+// reservoir remains a uniform sample of all latencies observed.
+func (r *latencyReservoir) observe(d time.Duration) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.count++
+	if len(r.samples) < latencyReservoirSize {
+		r.samples = append(r.samples, d)
+		return
+	}
+	if i := rand.Int64N(r.count); i < latencyReservoirSize {
+		r.samples[i] = d
+	}
+}
+
+func (s *latencySampler) summary() LatencySummary {
+	var (
+		summary LatencySummary
+		samples []time.Duration
+	)
+	for i := range s.shards {
+		r := &s.shards[i]
+		r.mtx.Lock()
+		summary.Count += r.count
+		samples = append(samples, r.samples...)
+		r.mtx.Unlock()
+	}
+	if len(samples) == 0 {
+		return summary
+	}
+
+	slices.Sort(samples)
+	summary.P50 = samples[(len(samples)-1)*50/100]
+	summary.P99 = samples[(len(samples)-1)*99/100]
+	return summary
+}
@@ -0,0 +1,62 @@
+package cache_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/storage/chunk/cache"
+)
+
+func TestLatencyStatsSimple(t *testing.T) {
+	testCache(t, cache.LatencyStats(cache.NewMockCache()))
+}
+
+func TestLatencyStats(t *testing.T) {
+	ctx := context.Background()
+	c := cache.LatencyStats(&slowCache{Cache: cache.NewMockCache(), delay: 10 * time.Millisecond})
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 5 {
+				_, _, _, err := c.Fetch(ctx, []string{"key"})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, c.Store(ctx, []string{"key"}, [][]byte{[]byte("value")}))
+
+	stats := c.Stats()
+	require.Len(t, stats, 5)
+
+	fetch := stats["fetch"]
+	require.Equal(t, int64(50), fetch.Count)
+	require.GreaterOrEqual(t, fetch.P50, 10*time.Millisecond)
+	require.GreaterOrEqual(t, fetch.P99, fetch.P50)
+
+	store := stats["store"]
+	require.Equal(t, int64(1), store.Count)
+	require.Less(t, store.P99, 10*time.Millisecond)
+
+	require.Equal(t, cache.LatencySummary{}, stats["exists"])
+}
+
+func TestLatencyStatsSampling(t *testing.T) {
+	ctx := context.Background()
+	c := cache.LatencyStats(cache.NewMockCache())
+
+	// Many more requests than are sampled are still all counted.
+	for range 10000 {
+		_, _, err := c.Exists(ctx, []string{"key"})
+		require.NoError(t, err)
+	}
+	require.Equal(t, int64(10000), c.Stats()["exists"].Count)
+}
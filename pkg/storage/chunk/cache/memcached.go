@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"encoding/hex"
+	"errors"
 	"flag"
 	"hash/fnv"
 	"sync"
@@ -224,6 +225,19 @@ func (c *Memcached) fetchKeysBatched(ctx context.Context, keys []string) (found
 	return
 }
 
+// Exists checks which keys are present in the cache. The memcached client
+// doesn't expose a key-only lookup such as the meta get command without the v
+// flag, so this fetches and discards the values and costs as much as Fetch.
+func (c *Memcached) Exists(ctx context.Context, keys []string) ([]string, []string, error) {
+	return existsViaFetch(ctx, c, keys)
+}
+
+// FetchRange reads a range of the value of key. Memcached has no ranged
+// reads, so this fetches the whole value and slices it.
+func (c *Memcached) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	return fetchRangeViaFetch(ctx, c, key, offset, length)
+}
+
 // Store stores the key in the cache.
 func (c *Memcached) Store(ctx context.Context, keys []string, bufs [][]byte) error {
 	var err error
@@ -243,6 +257,26 @@ func (c *Memcached) Store(ctx context.Context, keys []string, bufs [][]byte) err
 	return err
 }
 
+// StoreIfAbsent stores the key in the cache using memcached's add command,
+// which only stores keys which aren't present yet.
+func (c *Memcached) StoreIfAbsent(ctx context.Context, key string, value []byte) (bool, error) {
+	var stored bool
+	err := instr.CollectedRequest(ctx, "Memcache.Add", c.requestDuration, memcacheStatusCode, func(_ context.Context) error {
+		item := memcache.Item{
+			Key:        key,
+			Value:      value,
+			Expiration: int32(c.cfg.Expiration.Seconds()),
+		}
+		err := c.memcache.Add(&item)
+		if errors.Is(err, memcache.ErrNotStored) {
+			return nil
+		}
+		stored = err == nil
+		return err
+	})
+	return stored, err
+}
+
 func (c *Memcached) Stop() {
 	if c.inputCh == nil {
 		return
@@ -29,6 +29,7 @@ import (
 type MemcachedClient interface {
 	GetMulti(keys []string, opts ...memcache.Option) (map[string]*memcache.Item, error)
 	Set(item *memcache.Item) error
+	Add(item *memcache.Item) error
 }
 
 type serverSelector interface {
@@ -251,6 +252,22 @@ func (c *memcachedClient) Set(item *memcache.Item) error {
 	return errors.Wrapf(err, "server=%s", addr)
 }
 
+// Add stores the item only if its key isn't present yet, returning
+// memcache.ErrNotStored otherwise.
+func (c *memcachedClient) Add(item *memcache.Item) error {
+	err := c.Client.Add(item)
+	if err == nil || errors.Is(err, memcache.ErrNotStored) {
+		return err
+	}
+
+	addr, addrErr := c.serverList.PickServer(item.Key)
+	if addrErr != nil {
+		return err
+	}
+
+	return errors.Wrapf(err, "server=%s", addr)
+}
+
 func (c *memcachedClient) updateLoop(updateInterval time.Duration) {
 	defer c.wait.Done()
 	ticker := time.NewTicker(updateInterval)
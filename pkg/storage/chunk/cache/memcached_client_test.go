@@ -37,3 +37,13 @@ func (m *mockMemcache) Set(item *memcache.Item) error {
 	m.contents[item.Key] = item.Value
 	return nil
 }
+
+func (m *mockMemcache) Add(item *memcache.Item) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.contents[item.Key]; ok {
+		return memcache.ErrNotStored
+	}
+	m.contents[item.Key] = item.Value
+	return nil
+}
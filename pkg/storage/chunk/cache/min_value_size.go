@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/loki/v3/pkg/util/constants"
+)
+
+type minValueSizeCache struct {
+	Cache
+	minValueBytes int
+
+	skippedStores prometheus.Counter
+}
+
+// NewMinValueSize returns a new Cache which doesn't store values smaller than
+// minValueBytes, as the per-item overhead of the backend outweighs the benefit
+// of caching them. Fetches are passed through unchanged.
+func NewMinValueSize(name string, minValueBytes int, cache Cache, reg prometheus.Registerer) Cache {
+	if minValueBytes <= 0 {
+		return cache
+	}
+
+	return &minValueSizeCache{
+		Cache:         cache,
+		minValueBytes: minValueBytes,
+
+		skippedStores: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace:   constants.Loki,
+			Name:        "cache_min_value_size_skipped_stores_total",
+			Help:        "Total count of values not stored in cache because they were smaller than the minimum value size.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+	}
+}
+
+func (m *minValueSizeCache) Store(ctx context.Context, keys []string, bufs [][]byte) error {
+	var (
+		storeKeys = make([]string, 0, len(keys))
+		storeBufs = make([][]byte, 0, len(bufs))
+	)
+	for i := range keys {
+		if len(bufs[i]) < m.minValueBytes {
+			m.skippedStores.Inc()
+			continue
+		}
+		storeKeys = append(storeKeys, keys[i])
+		storeBufs = append(storeBufs, bufs[i])
+	}
+
+	if len(storeKeys) == 0 {
+		return nil
+	}
+	return m.Cache.Store(ctx, storeKeys, storeBufs)
+}
+
+func (m *minValueSizeCache) StoreIfAbsent(ctx context.Context, key string, value []byte) (bool, error) {
+	if len(value) < m.minValueBytes {
+		m.skippedStores.Inc()
+		return false, nil
+	}
+	return m.Cache.StoreIfAbsent(ctx, key, value)
+}
@@ -0,0 +1,43 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/storage/chunk/cache"
+)
+
+func TestMinValueSize(t *testing.T) {
+	ctx := context.Background()
+	backend := cache.NewMockCache()
+	reg := prometheus.NewRegistry()
+	c := cache.NewMinValueSize("test", 4, backend, reg)
+
+	require.NoError(t, c.Store(ctx, []string{"tiny", "exact", "large"}, [][]byte{[]byte("abc"), []byte("abcd"), []byte("abcdefgh")}))
+	require.ElementsMatch(t, []string{"exact", "large"}, backend.GetKeys())
+
+	found, _, missing, err := c.Fetch(ctx, []string{"tiny", "exact", "large"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"exact", "large"}, found)
+	require.Equal(t, []string{"tiny"}, missing)
+
+	// Batches with only small values don't reach the backend at all.
+	require.NoError(t, c.Store(ctx, []string{"tiny2"}, [][]byte{[]byte("a")}))
+	require.Equal(t, 2, backend.NumKeyUpdates())
+
+	count, err := testutil.GatherAndCount(reg, "loki_cache_min_value_size_skipped_stores_total")
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	metrics, err := reg.Gather()
+	require.NoError(t, err)
+	require.Equal(t, float64(2), metrics[0].GetMetric()[0].GetCounter().GetValue())
+}
+
+func TestMinValueSizeDisabled(t *testing.T) {
+	backend := cache.NewMockCache()
+	require.Equal(t, cache.Cache(backend), cache.NewMinValueSize("test", 0, backend, prometheus.NewRegistry()))
+}
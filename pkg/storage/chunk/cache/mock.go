@@ -63,6 +63,57 @@ func (m *mockCache) Fetch(_ context.Context, keys []string) (found []string, buf
 	return
 }
 
+func (m *mockCache) Exists(_ context.Context, keys []string) (present []string, missing []string, err error) {
+	if m.fetchErr != nil {
+		return nil, nil, m.fetchErr
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	for _, key := range keys {
+		m.keysRequested++
+		if _, ok := m.cache[key]; ok {
+			present = append(present, key)
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	return
+}
+
+func (m *mockCache) FetchRange(_ context.Context, key string, offset, length int64) ([]byte, error) {
+	if m.fetchErr != nil {
+		return nil, m.fetchErr
+	}
+	if err := validateRange(offset, length); err != nil {
+		return nil, err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	m.keysRequested++
+	buf, ok := m.cache[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return sliceRange(buf, offset, length), nil
+}
+
+func (m *mockCache) StoreIfAbsent(_ context.Context, key string, value []byte) (bool, error) {
+	if m.storeErr != nil {
+		return false, m.storeErr
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.cache[key]; ok {
+		return false, nil
+	}
+	m.cache[key] = value
+	m.numKeyUpdates++
+	return true, nil
+}
+
 func (m *mockCache) Stop() {
 }
 
@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/grafana/loki/v3/pkg/logqlmodel/stats"
+)
+
+type prefixRouter struct {
+	// prefixes are the route prefixes, longest first, and caches their caches
+	// followed by the fallback.
+	prefixes []string
+	caches   []Cache
+}
+
+// NewPrefixRouter makes a new cache which routes every key to the cache of
+// the longest prefix in routes it starts with, or to fallback if it doesn't
+// start with any of them. This allows a single cache to multiplex distinct
+// backends by key namespace. Requests with keys of several routes are split by
+// route and their results merged. If fallback is nil, keys without a route
+// are never stored and always missing. Stopping the router stops all routes
+// and the fallback.
+func NewPrefixRouter(routes map[string]Cache, fallback Cache) Cache {
+	prefixes := make([]string, 0, len(routes))
+	for prefix := range routes {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return len(prefixes[i]) > len(prefixes[j])
+	})
+
+	caches := make([]Cache, 0, len(prefixes)+1)
+	for _, prefix := range prefixes {
+		caches = append(caches, routes[prefix])
+	}
+	caches = append(caches, fallback)
+
+	return &prefixRouter{
+		prefixes: prefixes,
+		caches:   caches,
+	}
+}
+
+// route returns the index of the cache for key.
+func (r *prefixRouter) route(key string) int {
+	for i, prefix := range r.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return i
+		}
+	}
+	return len(r.prefixes)
+}
+
+// split groups the indexes of keys by the index of the cache they are routed to.
+// Keys without a cache are left out.
+func (r *prefixRouter) split(keys []string) map[int][]int {
+	indexes := make(map[int][]int)
+	for i, key := range keys {
+		route := r.route(key)
+		if r.caches[route] == nil {
+			continue
+		}
+		indexes[route] = append(indexes[route], i)
+	}
+	return indexes
+}
+
+// routeKeys returns the keys at indexes.
+func routeKeys(keys []string, indexes []int) []string {
+	result := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		result = append(result, keys[i])
+	}
+	return result
+}
+
+func (r *prefixRouter) Store(ctx context.Context, keys []string, bufs [][]byte) error {
+	var err error
+	for route, indexes := range r.split(keys) {
+		routeBufs := make([][]byte, 0, len(indexes))
+		for _, i := range indexes {
+			routeBufs = append(routeBufs, bufs[i])
+		}
+		if cacheErr := r.caches[route].Store(ctx, routeKeys(keys, indexes), routeBufs); cacheErr != nil {
+			err = cacheErr
+		}
+	}
+	return err
+}
+
+func (r *prefixRouter) Fetch(ctx context.Context, keys []string) ([]string, [][]byte, []string, error) {
+	found := make(map[string][]byte, len(keys))
+	var err error
+	for route, indexes := range r.split(keys) {
+		passKeys, passBufs, _, cacheErr := r.caches[route].Fetch(ctx, routeKeys(keys, indexes))
+		if cacheErr != nil {
+			err = cacheErr
+		}
+		for i, key := range passKeys {
+			found[key] = passBufs[i]
+		}
+	}
+
+	resultKeys := make([]string, 0, len(found))
+	resultBufs := make([][]byte, 0, len(found))
+	var missing []string
+	for _, key := range keys {
+		if buf, ok := found[key]; ok {
+			resultKeys = append(resultKeys, key)
+			resultBufs = append(resultBufs, buf)
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	return resultKeys, resultBufs, missing, err
+}
+
+func (r *prefixRouter) Exists(ctx context.Context, keys []string) ([]string, []string, error) {
+	present := make(map[string]struct{}, len(keys))
+	var err error
+	for route, indexes := range r.split(keys) {
+		passKeys, _, cacheErr := r.caches[route].Exists(ctx, routeKeys(keys, indexes))
+		if cacheErr != nil {
+			err = cacheErr
+		}
+		for _, key := range passKeys {
+			present[key] = struct{}{}
+		}
+	}
+
+	resultKeys := make([]string, 0, len(present))
+	var missing []string
+	for _, key := range keys {
+		if _, ok := present[key]; ok {
+			resultKeys = append(resultKeys, key)
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	return resultKeys, missing, err
+}
+
+func (r *prefixRouter) StoreIfAbsent(ctx context.Context, key string, value []byte) (bool, error) {
+	c := r.caches[r.route(key)]
+	if c == nil {
+		return false, nil
+	}
+	return c.StoreIfAbsent(ctx, key, value)
+}
+
+func (r *prefixRouter) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	c := r.caches[r.route(key)]
+	if c == nil {
+		return nil, ErrNotFound
+	}
+	return c.FetchRange(ctx, key, offset, length)
+}
+
+func (r *prefixRouter) Stop() {
+	for _, c := range r.caches {
+		if c != nil {
+			c.Stop()
+		}
+	}
+}
+
+func (r *prefixRouter) GetCacheType() stats.CacheType {
+	return "prefix-router"
+}
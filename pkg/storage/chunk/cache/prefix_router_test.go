@@ -0,0 +1,61 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/storage/chunk/cache"
+)
+
+func TestPrefixRouterSimple(t *testing.T) {
+	c := cache.NewPrefixRouter(map[string]cache.Cache{"chunk/": cache.NewMockCache()}, cache.NewMockCache())
+	testCache(t, c)
+}
+
+func TestPrefixRouter(t *testing.T) {
+	ctx := context.Background()
+	chunks, index, indexStats, fallback := cache.NewMockCache(), cache.NewMockCache(), cache.NewMockCache(), cache.NewMockCache()
+	c := cache.NewPrefixRouter(map[string]cache.Cache{
+		"chunk/":       chunks,
+		"index/":       index,
+		"index/stats/": indexStats,
+	}, fallback)
+
+	keys := []string{"chunk/1", "index/1", "other/1", "index/stats/1", "chunk/2"}
+	bufs := [][]byte{[]byte("c1"), []byte("i1"), []byte("o1"), []byte("s1"), []byte("c2")}
+	require.NoError(t, c.Store(ctx, keys, bufs))
+
+	// Keys are routed by their longest prefix.
+	require.Equal(t, map[string][]byte{"chunk/1": []byte("c1"), "chunk/2": []byte("c2")}, chunks.GetInternal())
+	require.Equal(t, map[string][]byte{"index/1": []byte("i1")}, index.GetInternal())
+	require.Equal(t, map[string][]byte{"index/stats/1": []byte("s1")}, indexStats.GetInternal())
+	require.Equal(t, map[string][]byte{"other/1": []byte("o1")}, fallback.GetInternal())
+
+	// Results of all routes are merged in the order of the requested keys.
+	found, foundBufs, missing, err := c.Fetch(ctx, []string{"index/stats/1", "chunk/3", "other/1", "chunk/1"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"index/stats/1", "other/1", "chunk/1"}, found)
+	require.Equal(t, [][]byte{[]byte("s1"), []byte("o1"), []byte("c1")}, foundBufs)
+	require.Equal(t, []string{"chunk/3"}, missing)
+
+	present, missing, err := c.Exists(ctx, []string{"chunk/3", "index/1", "chunk/2"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"index/1", "chunk/2"}, present)
+	require.Equal(t, []string{"chunk/3"}, missing)
+}
+
+func TestPrefixRouterWithoutFallback(t *testing.T) {
+	ctx := context.Background()
+	chunks := cache.NewMockCache()
+	c := cache.NewPrefixRouter(map[string]cache.Cache{"chunk/": chunks}, nil)
+
+	require.NoError(t, c.Store(ctx, []string{"chunk/1", "other/1"}, [][]byte{[]byte("c1"), []byte("o1")}))
+	require.Equal(t, 1, chunks.NumKeyUpdates())
+
+	found, _, missing, err := c.Fetch(ctx, []string{"chunk/1", "other/1"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"chunk/1"}, found)
+	require.Equal(t, []string{"other/1"}, missing)
+}
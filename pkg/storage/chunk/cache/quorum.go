@@ -0,0 +1,343 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/loki/v3/pkg/logqlmodel/stats"
+	"github.com/grafana/loki/v3/pkg/util/constants"
+)
+
+type quorumCache struct {
+	pools       []Cache
+	writeCopies int
+	readQuorum  int
+	hash        HashFunc
+
+	quorumFailures prometheus.Counter
+	repairs        prometheus.Counter
+}
+
+// quorumResponse is the response of a single pool for a single key.
+type quorumResponse struct {
+	pool  int
+	found bool
+	buf   []byte
+	err   error
+}
+
+// NewQuorum makes a new cache which writes each value to writeCopies of pools
+// and reads it back with a quorum of readQuorum, so that the outage of a
+// single pool doesn't cause misses. The pools of a key are chosen by its hash,
+// see [WithQuorumHashFunc].
+//
+// Fetches first query readQuorum of the pools of each key and only fall back
+// to its remaining pools if those don't agree on a value. A key is a hit once
+// readQuorum pools returned the same value; pools which reported a miss for
+// it are repaired by writing the value back to them.
+//
+// writeCopies is capped to the number of pools and readQuorum to writeCopies.
+func NewQuorum(name string, pools []Cache, writeCopies, readQuorum int, reg prometheus.Registerer, opts ...QuorumOption) Cache {
+	if len(pools) <= 1 {
+		return NewTiered(pools)
+	}
+	writeCopies = min(max(writeCopies, 1), len(pools))
+	readQuorum = min(max(readQuorum, 1), writeCopies)
+
+	q := &quorumCache{
+		pools:       pools,
+		writeCopies: writeCopies,
+		readQuorum:  readQuorum,
+		hash:        DefaultHashFunc,
+
+		quorumFailures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace:   constants.Loki,
+			Name:        "cache_quorum_failures_total",
+			Help:        "Total count of keys which were found in some pools but not returned because the read quorum couldn't be reached.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+		repairs: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace:   constants.Loki,
+			Name:        "cache_quorum_repairs_total",
+			Help:        "Total count of values written back to pools which were missing them on a quorum read.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+	}
+	for _, o := range opts {
+		o(q)
+	}
+	return q
+}
+
+// QuorumOption configures optional behaviour of a quorum cache.
+type QuorumOption func(*quorumCache)
+
+// WithQuorumHashFunc makes the quorum cache choose the pools of a key by its
+// hash with hash instead of [DefaultHashFunc], e.g. to pin keys to pools in
+// tests.
+func WithQuorumHashFunc(hash HashFunc) QuorumOption {
+	return func(q *quorumCache) {
+		q.hash = hash
+	}
+}
+
+// replicas returns the indexes of the pools key is written to.
+func (q *quorumCache) replicas(key string) []int {
+	start := int(q.hash(key) % uint64(len(q.pools)))
+	replicas := make([]int, 0, q.writeCopies)
+	for i := 0; i < q.writeCopies; i++ {
+		replicas = append(replicas, (start+i)%len(q.pools))
+	}
+	return replicas
+}
+
+func (q *quorumCache) Store(ctx context.Context, keys []string, bufs [][]byte) error {
+	poolKeys := make(map[int][]string)
+	poolBufs := make(map[int][][]byte)
+	for i, key := range keys {
+		for _, pool := range q.replicas(key) {
+			poolKeys[pool] = append(poolKeys[pool], key)
+			poolBufs[pool] = append(poolBufs[pool], bufs[i])
+		}
+	}
+
+	var (
+		wg  sync.WaitGroup
+		mtx sync.Mutex
+		err error
+	)
+	for pool, keys := range poolKeys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if poolErr := q.pools[pool].Store(ctx, keys, poolBufs[pool]); poolErr != nil {
+				mtx.Lock()
+				err = poolErr
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return err
+}
+
+func (q *quorumCache) Fetch(ctx context.Context, keys []string) ([]string, [][]byte, []string, error) {
+	values, err := q.read(keys, func(c Cache, keys []string) ([]string, [][]byte, error) {
+		found, bufs, _, err := c.Fetch(ctx, keys)
+		return found, bufs, err
+	})
+
+	var (
+		found   []string
+		bufs    [][]byte
+		missing []string
+		repairs = make(map[int][]int)
+	)
+	for i, key := range keys {
+		value, ok := values[i]
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+		found = append(found, key)
+		bufs = append(bufs, value.buf)
+		for _, pool := range value.repair {
+			repairs[pool] = append(repairs[pool], i)
+		}
+	}
+	q.repair(ctx, keys, values, repairs)
+
+	if len(missing) == 0 {
+		err = nil
+	}
+	return found, bufs, missing, err
+}
+
+func (q *quorumCache) Exists(ctx context.Context, keys []string) ([]string, []string, error) {
+	values, err := q.read(keys, func(c Cache, keys []string) ([]string, [][]byte, error) {
+		present, _, err := c.Exists(ctx, keys)
+		// All present keys have the same nil value, so they always agree.
+		return present, make([][]byte, len(present)), err
+	})
+
+	var present, missing []string
+	for i, key := range keys {
+		if _, ok := values[i]; ok {
+			present = append(present, key)
+		} else {
+			missing = append(missing, key)
+		}
+	}
+
+	if len(missing) == 0 {
+		err = nil
+	}
+	return present, missing, err
+}
+
+// FetchRange reads the range from the value which reached the read quorum.
+func (q *quorumCache) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	return fetchRangeViaFetch(ctx, q, key, offset, length)
+}
+
+// quorumValue is a value which reached the read quorum.
+type quorumValue struct {
+	buf []byte
+	// repair are the pools which reported a miss for the value.
+	repair []int
+}
+
+// read queries the pools of every key with f until the read quorum is reached,
+// returning the values by key index. It returns the last error of any pool.
+func (q *quorumCache) read(keys []string, f func(Cache, []string) ([]string, [][]byte, error)) (map[int]quorumValue, error) {
+	replicas := make([][]int, len(keys))
+	responses := make([][]quorumResponse, len(keys))
+	pending := make([]int, len(keys))
+	for i, key := range keys {
+		replicas[i] = q.replicas(key)
+		pending[i] = i
+	}
+
+	var err error
+	values := make(map[int]quorumValue, len(keys))
+
+	// The first round queries just enough pools for a quorum, the second round the remaining pools.
+	rounds := [][2]int{{0, q.readQuorum}, {q.readQuorum, q.writeCopies}}
+	for _, round := range rounds {
+		if len(pending) == 0 || round[0] == round[1] {
+			break
+		}
+
+		poolKeys := make(map[int][]int)
+		for _, i := range pending {
+			for _, pool := range replicas[i][round[0]:round[1]] {
+				poolKeys[pool] = append(poolKeys[pool], i)
+			}
+		}
+		if roundErr := q.query(keys, poolKeys, responses, f); roundErr != nil {
+			err = roundErr
+		}
+
+		remaining := pending[:0]
+		for _, i := range pending {
+			if value, ok := q.quorum(responses[i]); ok {
+				values[i] = value
+			} else {
+				remaining = append(remaining, i)
+			}
+		}
+		pending = remaining
+	}
+
+	for _, i := range pending {
+		for _, resp := range responses[i] {
+			if resp.found {
+				q.quorumFailures.Inc()
+				break
+			}
+		}
+	}
+	return values, err
+}
+
+// query sends the keys of poolKeys to their pools concurrently and appends the responses by key index.
+func (q *quorumCache) query(keys []string, poolKeys map[int][]int, responses [][]quorumResponse, f func(Cache, []string) ([]string, [][]byte, error)) error {
+	var (
+		wg  sync.WaitGroup
+		mtx sync.Mutex
+		err error
+	)
+	for pool, indexes := range poolKeys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			poolKeys := make([]string, 0, len(indexes))
+			for _, i := range indexes {
+				poolKeys = append(poolKeys, keys[i])
+			}
+			found, bufs, poolErr := f(q.pools[pool], poolKeys)
+
+			// Map the responses back to the key indexes, which may contain duplicate keys.
+			byKey := make(map[string][]byte, len(found))
+			for j, key := range found {
+				byKey[key] = bufs[j]
+			}
+
+			mtx.Lock()
+			defer mtx.Unlock()
+			if poolErr != nil {
+				err = poolErr
+			}
+			for _, i := range indexes {
+				buf, ok := byKey[keys[i]]
+				responses[i] = append(responses[i], quorumResponse{pool: pool, found: ok, buf: buf, err: poolErr})
+			}
+		}()
+	}
+	wg.Wait()
+	return err
+}
+
+// quorum returns the first value of responses which at least readQuorum pools agree on.
+func (q *quorumCache) quorum(responses []quorumResponse) (quorumValue, bool) {
+	for _, candidate := range responses {
+		if !candidate.found {
+			continue
+		}
+		var votes int
+		for _, resp := range responses {
+			if resp.found && bytes.Equal(resp.buf, candidate.buf) {
+				votes++
+			}
+		}
+		if votes < q.readQuorum {
+			continue
+		}
+
+		value := quorumValue{buf: candidate.buf}
+		for _, resp := range responses {
+			if !resp.found && resp.err == nil {
+				value.repair = append(value.repair, resp.pool)
+			}
+		}
+		return value, true
+	}
+	return quorumValue{}, false
+}
+
+// repair writes values back to the pools which reported them missing on read.
+func (q *quorumCache) repair(ctx context.Context, keys []string, values map[int]quorumValue, repairs map[int][]int) {
+	for pool, indexes := range repairs {
+		repairKeys := make([]string, 0, len(indexes))
+		repairBufs := make([][]byte, 0, len(indexes))
+		for _, i := range indexes {
+			repairKeys = append(repairKeys, keys[i])
+			repairBufs = append(repairBufs, values[i].buf)
+		}
+		// Repairs are best effort, a failed one is retried on the next read.
+		if err := q.pools[pool].Store(ctx, repairKeys, repairBufs); err == nil {
+			q.repairs.Add(float64(len(repairKeys)))
+		}
+	}
+}
+
+// StoreIfAbsent isn't supported, as the copies of a key can't be stored
+// conditionally in all of its pools at once.
+func (q *quorumCache) StoreIfAbsent(context.Context, string, []byte) (bool, error) {
+	return false, ErrUnsupported
+}
+
+func (q *quorumCache) Stop() {
+	for _, c := range q.pools {
+		c.Stop()
+	}
+}
+
+func (q *quorumCache) GetCacheType() stats.CacheType {
+	return q.pools[0].GetCacheType()
+}
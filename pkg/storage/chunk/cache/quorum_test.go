@@ -0,0 +1,122 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/storage/chunk/cache"
+)
+
+func TestQuorumSimple(t *testing.T) {
+	pools := []cache.Cache{cache.NewMockCache(), cache.NewMockCache(), cache.NewMockCache()}
+	c := cache.NewQuorum("test", pools, 2, 1, prometheus.NewRegistry())
+	testCache(t, c)
+}
+
+func TestQuorum(t *testing.T) {
+	ctx := context.Background()
+
+	keys := make([]string, 0, 20)
+	bufs := make([][]byte, 0, 20)
+	for i := 0; i < 20; i++ {
+		keys = append(keys, fmt.Sprintf("key%d", i))
+		bufs = append(bufs, []byte(fmt.Sprintf("value%d", i)))
+	}
+
+	t.Run("pools are chosen with the hash func", func(t *testing.T) {
+		pools := []cache.MockCache{cache.NewMockCache(), cache.NewMockCache(), cache.NewMockCache()}
+		hash := func(string) uint64 { return 1 }
+		c := cache.NewQuorum("test", []cache.Cache{pools[0], pools[1], pools[2]}, 2, 1, prometheus.NewRegistry(), cache.WithQuorumHashFunc(hash))
+		require.NoError(t, c.Store(ctx, keys, bufs))
+
+		require.Zero(t, pools[0].NumKeyUpdates())
+		require.Equal(t, len(keys), pools[1].NumKeyUpdates())
+		require.Equal(t, len(keys), pools[2].NumKeyUpdates())
+	})
+
+	t.Run("values are written to writeCopies pools", func(t *testing.T) {
+		pools := []cache.MockCache{cache.NewMockCache(), cache.NewMockCache(), cache.NewMockCache()}
+		c := cache.NewQuorum("test", []cache.Cache{pools[0], pools[1], pools[2]}, 2, 1, prometheus.NewRegistry())
+		require.NoError(t, c.Store(ctx, keys, bufs))
+
+		var updates int
+		for _, pool := range pools {
+			updates += pool.NumKeyUpdates()
+		}
+		require.Equal(t, 2*len(keys), updates)
+	})
+
+	t.Run("single pool outage doesn't cause misses", func(t *testing.T) {
+		pools := []cache.MockCache{cache.NewMockCache(), cache.NewMockCache(), cache.NewMockCache()}
+		c := cache.NewQuorum("test", []cache.Cache{pools[0], pools[1], pools[2]}, 2, 1, prometheus.NewRegistry())
+		require.NoError(t, c.Store(ctx, keys, bufs))
+
+		pools[1].SetErr(nil, errors.New("pool unavailable"))
+		found, foundBufs, missing, err := c.Fetch(ctx, keys)
+		require.NoError(t, err)
+		require.Equal(t, keys, found)
+		require.Equal(t, bufs, foundBufs)
+		require.Empty(t, missing)
+
+		present, missing, err := c.Exists(ctx, keys)
+		require.NoError(t, err)
+		require.Equal(t, keys, present)
+		require.Empty(t, missing)
+	})
+
+	t.Run("pools missing a value are repaired", func(t *testing.T) {
+		// Store the value in only one of the pools of the key. Only when that's
+		// the second pool of the key, the first one is queried, misses and is repaired.
+		var repairs float64
+		for _, stored := range []int{0, 1} {
+			pools := []cache.MockCache{cache.NewMockCache(), cache.NewMockCache()}
+			reg := prometheus.NewRegistry()
+			c := cache.NewQuorum("test", []cache.Cache{pools[0], pools[1]}, 2, 1, reg)
+			require.NoError(t, pools[stored].Store(ctx, []string{"key"}, [][]byte{[]byte("value")}))
+
+			found, foundBufs, _, err := c.Fetch(ctx, []string{"key"})
+			require.NoError(t, err)
+			require.Equal(t, []string{"key"}, found)
+			require.Equal(t, [][]byte{[]byte("value")}, foundBufs)
+
+			repaired := counterValue(t, reg, "loki_cache_quorum_repairs_total")
+			if repaired > 0 {
+				require.Equal(t, []byte("value"), pools[1-stored].GetInternal()["key"])
+			}
+			repairs += repaired
+		}
+		require.Equal(t, float64(1), repairs)
+	})
+
+	t.Run("values without quorum are missing", func(t *testing.T) {
+		pools := []cache.MockCache{cache.NewMockCache(), cache.NewMockCache()}
+		reg := prometheus.NewRegistry()
+		c := cache.NewQuorum("test", []cache.Cache{pools[0], pools[1]}, 2, 2, reg)
+		require.NoError(t, pools[0].Store(ctx, []string{"key1", "key2"}, [][]byte{[]byte("a"), []byte("a")}))
+		require.NoError(t, pools[1].Store(ctx, []string{"key1"}, [][]byte{[]byte("b")}))
+
+		found, _, missing, err := c.Fetch(ctx, []string{"key1", "key2", "key3"})
+		require.NoError(t, err)
+		require.Empty(t, found)
+		require.Equal(t, []string{"key1", "key2", "key3"}, missing)
+		// key3 isn't in any pool, so it's a regular miss.
+		require.Equal(t, float64(2), counterValue(t, reg, "loki_cache_quorum_failures_total"))
+	})
+}
+
+// counterValue returns the value of the counter with the given name in reg.
+func counterValue(t *testing.T, reg *prometheus.Registry, name string) float64 {
+	metrics, err := reg.Gather()
+	require.NoError(t, err)
+	for _, mf := range metrics {
+		if mf.GetName() == name {
+			return mf.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	return 0
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/loki/v3/pkg/util/constants"
+)
+
+// Loader loads the values of keys missing from a cache, e.g. from object
+// storage. It returns the values of the keys it could load; keys without a
+// value are reported as missing.
+type Loader func(ctx context.Context, keys []string) (map[string][]byte, error)
+
+type readThroughCache struct {
+	Cache
+	loader Loader
+
+	loadDuration prometheus.Histogram
+	loadErrors   prometheus.Counter
+	storeErrors  prometheus.Counter
+}
+
+// NewReadThrough makes a new cache whose Fetch loads the keys missing from
+// cache with loader and stores them in cache before returning them, so
+// callers get the values of all keys it can load. Errors fetching from cache
+// are treated as misses. If loading fails, the keys found in cache are
+// returned along with the error of the loader.
+//
+// The loader is instrumented separately from cache, which should be
+// instrumented itself.
+func NewReadThrough(name string, cache Cache, loader Loader, reg prometheus.Registerer) Cache {
+	return &readThroughCache{
+		Cache:  cache,
+		loader: loader,
+
+		loadDuration: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Namespace: constants.Loki,
+			Name:      "cache_read_through_load_duration_seconds",
+			Help:      "Time spent loading keys missing from the cache in seconds.",
+			// 1ms -> 4.096s
+			Buckets:     prometheus.ExponentialBuckets(0.001, 2, 13),
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+		loadErrors: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace:   constants.Loki,
+			Name:        "cache_read_through_load_errors_total",
+			Help:        "Total count of errors loading keys missing from the cache.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+		storeErrors: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace:   constants.Loki,
+			Name:        "cache_read_through_store_errors_total",
+			Help:        "Total count of errors storing loaded keys in the cache.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+	}
+}
+
+func (c *readThroughCache) Fetch(ctx context.Context, keys []string) ([]string, [][]byte, []string, error) {
+	found, bufs, missing, err := c.Cache.Fetch(ctx, keys)
+	if err != nil {
+		found, bufs, missing = nil, nil, keys
+	}
+	if len(missing) == 0 {
+		return found, bufs, nil, nil
+	}
+
+	start := time.Now()
+	loaded, err := c.loader(ctx, missing)
+	c.loadDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		c.loadErrors.Inc()
+		return found, bufs, missing, err
+	}
+
+	var (
+		storeKeys    = make([]string, 0, len(loaded))
+		storeBufs    = make([][]byte, 0, len(loaded))
+		stillMissing []string
+	)
+	for _, key := range missing {
+		buf, ok := loaded[key]
+		if !ok {
+			stillMissing = append(stillMissing, key)
+			continue
+		}
+		storeKeys = append(storeKeys, key)
+		storeBufs = append(storeBufs, buf)
+	}
+	if len(storeKeys) > 0 {
+		// Failing to store only means the keys are loaded again next time.
+		if err := c.Cache.Store(ctx, storeKeys, storeBufs); err != nil {
+			c.storeErrors.Inc()
+		}
+	}
+
+	return append(found, storeKeys...), append(bufs, storeBufs...), stillMissing, nil
+}
@@ -0,0 +1,76 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/storage/chunk/cache"
+)
+
+func TestReadThrough(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("loads and stores misses", func(t *testing.T) {
+		backend := cache.NewMockCache()
+		require.NoError(t, backend.Store(ctx, []string{"cached"}, [][]byte{[]byte("cached value")}))
+
+		var loads [][]string
+		loader := func(_ context.Context, keys []string) (map[string][]byte, error) {
+			loads = append(loads, keys)
+			return map[string][]byte{"loaded": []byte("loaded value")}, nil
+		}
+		c := cache.NewReadThrough("test", backend, loader, prometheus.NewRegistry())
+
+		found, bufs, missing, err := c.Fetch(ctx, []string{"cached", "loaded", "absent"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"cached", "loaded"}, found)
+		require.Equal(t, [][]byte{[]byte("cached value"), []byte("loaded value")}, bufs)
+		require.Equal(t, []string{"absent"}, missing)
+		require.Equal(t, [][]string{{"loaded", "absent"}}, loads)
+
+		// Loaded keys are served from cache afterwards.
+		found, _, _, err = backend.Fetch(ctx, []string{"loaded"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"loaded"}, found)
+	})
+
+	t.Run("load errors", func(t *testing.T) {
+		backend := cache.NewMockCache()
+		require.NoError(t, backend.Store(ctx, []string{"cached"}, [][]byte{[]byte("cached value")}))
+
+		loadErr := errors.New("load failed")
+		loader := func(context.Context, []string) (map[string][]byte, error) { return nil, loadErr }
+		reg := prometheus.NewRegistry()
+		c := cache.NewReadThrough("test", backend, loader, reg)
+
+		found, _, missing, err := c.Fetch(ctx, []string{"cached", "loaded"})
+		require.ErrorIs(t, err, loadErr)
+		require.Equal(t, []string{"cached"}, found)
+		require.Equal(t, []string{"loaded"}, missing)
+		require.Equal(t, float64(1), counterValue(t, reg, "loki_cache_read_through_load_errors_total"))
+	})
+
+	t.Run("cache errors are misses", func(t *testing.T) {
+		backend := cache.NewMockCache()
+		backend.SetErr(nil, errors.New("cache down"))
+
+		loader := func(_ context.Context, keys []string) (map[string][]byte, error) {
+			values := make(map[string][]byte, len(keys))
+			for _, key := range keys {
+				values[key] = []byte(key)
+			}
+			return values, nil
+		}
+		c := cache.NewReadThrough("test", backend, loader, prometheus.NewRegistry())
+
+		found, bufs, missing, err := c.Fetch(ctx, []string{"a", "b"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b"}, found)
+		require.Equal(t, [][]byte{[]byte("a"), []byte("b")}, bufs)
+		require.Empty(t, missing)
+	})
+}
@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// recordOp is the type of operation in a recorded cache request.
+type recordOp byte
+
+const (
+	recordOpFetch recordOp = iota + 1
+	recordOpStore
+	recordOpExists
+)
+
+// A recorded cache request is encoded as:
+//
+//	op (1 byte) | timestamp (varint, unix nanoseconds) | number of keys (uvarint) |
+//	for each key: key hash (8 bytes, xxhash) | value size (uvarint, 0 unless op is store)
+//
+// Keys are only recorded as hashes and values only by their size, so recordings
+// don't contain any cached data.
+
+type recorder struct {
+	Cache
+	sampleRate float64
+
+	mtx  sync.Mutex
+	sink io.Writer
+	buf  []byte
+}
+
+// NewRecorder returns a new Cache which records a sample of the requests made
+// to cache into sink, passing all requests through unchanged. sampleRate is the
+// fraction of requests to record, between 0 and 1. Recordings can be replayed
+// with [Replay] to load test a cache with a realistic traffic pattern.
+func NewRecorder(cache Cache, sink io.Writer, sampleRate float64) Cache {
+	return &recorder{
+		Cache:      cache,
+		sampleRate: sampleRate,
+		sink:       sink,
+	}
+}
+
+func (r *recorder) Store(ctx context.Context, keys []string, bufs [][]byte) error {
+	r.record(recordOpStore, keys, bufs)
+	return r.Cache.Store(ctx, keys, bufs)
+}
+
+func (r *recorder) Fetch(ctx context.Context, keys []string) ([]string, [][]byte, []string, error) {
+	r.record(recordOpFetch, keys, nil)
+	return r.Cache.Fetch(ctx, keys)
+}
+
+func (r *recorder) Exists(ctx context.Context, keys []string) ([]string, []string, error) {
+	r.record(recordOpExists, keys, nil)
+	return r.Cache.Exists(ctx, keys)
+}
+
+// FetchRange is recorded as a fetch of key.
+func (r *recorder) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	r.record(recordOpFetch, []string{key}, nil)
+	return r.Cache.FetchRange(ctx, key, offset, length)
+}
+
+func (r *recorder) record(op recordOp, keys []string, bufs [][]byte) {
+	if r.sampleRate < 1 && rand.Float64() >= r.sampleRate {
+		return
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.buf = append(r.buf[:0], byte(op))
+	r.buf = binary.AppendVarint(r.buf, time.Now().UnixNano())
+	r.buf = binary.AppendUvarint(r.buf, uint64(len(keys)))
+	for i, key := range keys {
+		r.buf = binary.BigEndian.AppendUint64(r.buf, xxhash.Sum64String(key))
+		var size int
+		if i < len(bufs) {
+			size = len(bufs[i])
+		}
+		r.buf = binary.AppendUvarint(r.buf, uint64(size))
+	}
+
+	// Recording is best effort and must never fail the request.
+	_, _ = r.sink.Write(r.buf)
+}
+
+// Replay replays the requests recorded by [NewRecorder] from reader against
+// cache, in order and as fast as possible. Keys are derived from the recorded
+// key hashes and stored values are zeroed buffers of the recorded size. It
+// returns the number of replayed requests.
+func Replay(ctx context.Context, reader io.Reader, cache Cache) (int, error) {
+	br := bufio.NewReader(reader)
+
+	var replayed int
+	for {
+		if err := ctx.Err(); err != nil {
+			return replayed, err
+		}
+
+		op, keys, sizes, err := readRecord(br)
+		if errors.Is(err, io.EOF) {
+			return replayed, nil
+		} else if err != nil {
+			return replayed, fmt.Errorf("reading record %d: %w", replayed, err)
+		}
+
+		switch op {
+		case recordOpFetch:
+			_, _, _, err = cache.Fetch(ctx, keys)
+		case recordOpExists:
+			_, _, err = cache.Exists(ctx, keys)
+		case recordOpStore:
+			bufs := make([][]byte, len(sizes))
+			for i, size := range sizes {
+				bufs[i] = make([]byte, size)
+			}
+			err = cache.Store(ctx, keys, bufs)
+		}
+		if err != nil {
+			return replayed, fmt.Errorf("replaying record %d: %w", replayed, err)
+		}
+		replayed++
+	}
+}
+
+func readRecord(r *bufio.Reader) (recordOp, []string, []uint64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	op := recordOp(b)
+	if op < recordOpFetch || op > recordOpExists {
+		return 0, nil, nil, fmt.Errorf("unknown operation %d", op)
+	}
+
+	// The timestamp isn't used when replaying as fast as possible.
+	if _, err := binary.ReadVarint(r); err != nil {
+		return 0, nil, nil, unexpectedEOF(err)
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, nil, unexpectedEOF(err)
+	}
+
+	keys := make([]string, 0, n)
+	sizes := make([]uint64, 0, n)
+	var hash [8]byte
+	for i := uint64(0); i < n; i++ {
+		if _, err := io.ReadFull(r, hash[:]); err != nil {
+			return 0, nil, nil, unexpectedEOF(err)
+		}
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return 0, nil, nil, unexpectedEOF(err)
+		}
+		keys = append(keys, fmt.Sprintf("%016x", binary.BigEndian.Uint64(hash[:])))
+		sizes = append(sizes, size)
+	}
+	return op, keys, sizes, nil
+}
+
+// unexpectedEOF converts io.EOF into io.ErrUnexpectedEOF for reads in the middle of a record.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
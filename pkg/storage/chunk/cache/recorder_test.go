@@ -0,0 +1,58 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/storage/chunk/cache"
+)
+
+func TestRecorderSimple(t *testing.T) {
+	testCache(t, cache.NewRecorder(cache.NewMockCache(), io.Discard, 1))
+}
+
+func TestRecorderReplay(t *testing.T) {
+	ctx := context.Background()
+
+	var recording bytes.Buffer
+	c := cache.NewRecorder(cache.NewMockCache(), &recording, 1)
+	require.NoError(t, c.Store(ctx, []string{"key1", "key2"}, [][]byte{[]byte("hello"), []byte("world!")}))
+	_, _, _, err := c.Fetch(ctx, []string{"key1", "key3"})
+	require.NoError(t, err)
+	_, _, err = c.Exists(ctx, []string{"key2"})
+	require.NoError(t, err)
+
+	// Recordings contain neither keys nor values.
+	require.NotContains(t, recording.String(), "key1")
+	require.NotContains(t, recording.String(), "hello")
+
+	target := cache.NewMockCache()
+	replayed, err := cache.Replay(ctx, bytes.NewReader(recording.Bytes()), target)
+	require.NoError(t, err)
+	require.Equal(t, 3, replayed)
+	require.Equal(t, 2, target.NumKeyUpdates())
+
+	// Stored values have the recorded sizes.
+	var sizes []int
+	for _, v := range target.GetInternal() {
+		sizes = append(sizes, len(v))
+	}
+	require.ElementsMatch(t, []int{5, 6}, sizes)
+
+	// Truncated recordings are reported.
+	_, err = cache.Replay(ctx, bytes.NewReader(recording.Bytes()[:recording.Len()-1]), cache.NewMockCache())
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestRecorderSampling(t *testing.T) {
+	ctx := context.Background()
+
+	var recording bytes.Buffer
+	c := cache.NewRecorder(cache.NewMockCache(), &recording, 0)
+	require.NoError(t, c.Store(ctx, []string{"key1"}, [][]byte{[]byte("hello")}))
+	require.Zero(t, recording.Len())
+}
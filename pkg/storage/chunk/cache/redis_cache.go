@@ -54,6 +54,25 @@ func (c *RedisCache) Fetch(ctx context.Context, keys []string) (found []string,
 	return
 }
 
+// Exists checks which keys are present in the cache without transferring their values.
+func (c *RedisCache) Exists(ctx context.Context, keys []string) (present []string, missing []string, err error) {
+	exists, err := c.redis.MExists(ctx, keys)
+	if err != nil {
+		level.Error(c.logger).Log("msg", "failed to check existence in redis", "name", c.name, "err", err)
+		missing = make([]string, len(keys))
+		copy(missing, keys)
+		return
+	}
+	for i, key := range keys {
+		if exists[i] {
+			present = append(present, key)
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	return
+}
+
 // Store stores the key in the cache.
 func (c *RedisCache) Store(ctx context.Context, keys []string, bufs [][]byte) error {
 	err := c.redis.MSet(ctx, keys, bufs)
@@ -63,6 +82,33 @@ func (c *RedisCache) Store(ctx context.Context, keys []string, bufs [][]byte) er
 	return err
 }
 
+// StoreIfAbsent stores the key in the cache using SETNX, which only stores
+// keys which aren't present yet.
+func (c *RedisCache) StoreIfAbsent(ctx context.Context, key string, value []byte) (bool, error) {
+	stored, err := c.redis.SetNX(ctx, key, value)
+	if err != nil {
+		level.Error(c.logger).Log("msg", "failed to conditionally put to redis", "name", c.name, "err", err)
+	}
+	return stored, err
+}
+
+// FetchRange reads the range of the value of key using GETRANGE, so only the
+// range is transferred.
+func (c *RedisCache) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	if err := validateRange(offset, length); err != nil {
+		return nil, err
+	}
+	value, ok, err := c.redis.GetRange(ctx, key, offset, length)
+	if err != nil {
+		level.Error(c.logger).Log("msg", "failed to get range from redis", "name", c.name, "err", err)
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
 // Stop stops the redis client.
 func (c *RedisCache) Stop() {
 	_ = c.redis.Close()
@@ -49,6 +49,30 @@ func TestRedisCache(t *testing.T) {
 	for i := 0; i < nMiss; i++ {
 		require.Equal(t, miss[i], missed[i])
 	}
+
+	// test existence checks
+	present, missed, err := c.Exists(ctx, append(keys, miss...))
+	require.NoError(t, err)
+	require.Equal(t, keys, present)
+	require.Equal(t, miss, missed)
+
+	// test conditional stores
+	stored, err := c.StoreIfAbsent(ctx, keys[0], []byte("other"))
+	require.NoError(t, err)
+	require.False(t, stored)
+	stored, err = c.StoreIfAbsent(ctx, miss[0], []byte("other"))
+	require.NoError(t, err)
+	require.True(t, stored)
+
+	// test ranged reads
+	value, err := c.FetchRange(ctx, keys[0], 1, 3)
+	require.NoError(t, err)
+	require.Equal(t, []byte("ata"), value)
+	value, err = c.FetchRange(ctx, keys[0], 0, 0)
+	require.NoError(t, err)
+	require.Empty(t, value)
+	_, err = c.FetchRange(ctx, miss[1], 0, 3)
+	require.ErrorIs(t, err, ErrNotFound)
 }
 
 func mockRedisCache() (*RedisCache, error) {
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"flag"
 	"fmt"
+	"math"
 	"net"
 	"strings"
 	"time"
@@ -160,6 +161,17 @@ func (c *RedisClient) MSet(ctx context.Context, keys []string, values [][]byte)
 	return err
 }
 
+// SetNX sets the key only if it doesn't exist yet and reports whether it was set.
+func (c *RedisClient) SetNX(ctx context.Context, key string, value []byte) (bool, error) {
+	var cancel context.CancelFunc
+	if c.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	return c.rdb.SetNX(ctx, key, value, c.expiration).Result()
+}
+
 func (c *RedisClient) MGet(ctx context.Context, keys []string) ([][]byte, error) {
 	var cancel context.CancelFunc
 	if c.timeout > 0 {
@@ -202,6 +214,62 @@ func (c *RedisClient) MGet(ctx context.Context, keys []string) ([][]byte, error)
 	return ret, nil
 }
 
+// MExists reports for each key whether it exists, without transferring values.
+func (c *RedisClient) MExists(ctx context.Context, keys []string) ([]bool, error) {
+	var cancel context.CancelFunc
+	if c.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	// EXISTS with multiple keys only returns a count, so issue one command per
+	// key in a single pipeline to learn which keys are present.
+	pipe := c.rdb.Pipeline()
+	cmds := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Exists(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	ret := make([]bool, len(keys))
+	for i, cmd := range cmds {
+		ret[i] = cmd.Val() > 0
+	}
+	return ret, nil
+}
+
+// GetRange returns length bytes of the value of key starting at offset using
+// GETRANGE, and reports whether the key exists. GETRANGE can't tell missing
+// keys from empty ranges, so existence is checked in the same pipeline.
+func (c *RedisClient) GetRange(ctx context.Context, key string, offset, length int64) ([]byte, bool, error) {
+	var cancel context.CancelFunc
+	if c.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	pipe := c.rdb.Pipeline()
+	exists := pipe.Exists(ctx, key)
+	var value *redis.StringCmd
+	if length > 0 {
+		// The end of GETRANGE is inclusive.
+		value = pipe.GetRange(ctx, key, offset, offset+min(length, math.MaxInt64-offset)-1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, false, err
+	}
+
+	if exists.Val() == 0 {
+		return nil, false, nil
+	}
+	if value == nil {
+		return []byte{}, true, nil
+	}
+	return StringToBytes(value.Val()), true, nil
+}
+
 func (c *RedisClient) Close() error {
 	return c.rdb.Close()
 }
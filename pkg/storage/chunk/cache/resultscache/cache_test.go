@@ -886,6 +886,15 @@ func (m mockResultsCache) Store(context.Context, []string, [][]byte) error {
 func (m mockResultsCache) Fetch(context.Context, []string) ([]string, [][]byte, []string, error) {
 	panic("not implemented")
 }
+func (m mockResultsCache) Exists(context.Context, []string) ([]string, []string, error) {
+	panic("not implemented")
+}
+func (m mockResultsCache) StoreIfAbsent(context.Context, string, []byte) (bool, error) {
+	panic("not implemented")
+}
+func (m mockResultsCache) FetchRange(context.Context, string, int64, int64) ([]byte, error) {
+	panic("not implemented")
+}
 func (m mockResultsCache) Stop() {
 	panic("not implemented")
 }
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"sync"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -10,6 +11,16 @@ import (
 	"github.com/grafana/loki/v3/pkg/logqlmodel/stats"
 )
 
+// LazyValue returns a fetched cache value, decoding it on first access. The
+// result is memoized, so calling it more than once is cheap.
+type LazyValue func() ([]byte, error)
+
+// LazyFetcher is implemented by caches which can defer decoding of fetched
+// values until they are accessed.
+type LazyFetcher interface {
+	FetchLazy(ctx context.Context, keys []string) (found []string, values []LazyValue, missing []string, err error)
+}
+
 type snappyCache struct {
 	next   Cache
 	logger log.Logger
@@ -46,6 +57,39 @@ func (s *snappyCache) Fetch(ctx context.Context, keys []string) ([]string, [][]b
 	return found, ds, missing, err
 }
 
+// FetchLazy is like Fetch, but values are only decompressed when they are first
+// accessed. This avoids decompressing values the caller never reads.
+func (s *snappyCache) FetchLazy(ctx context.Context, keys []string) ([]string, []LazyValue, []string, error) {
+	found, bufs, missing, err := s.next.Fetch(ctx, keys)
+	values := make([]LazyValue, 0, len(bufs))
+	for _, buf := range bufs {
+		values = append(values, sync.OnceValues(func() ([]byte, error) {
+			d, err := snappy.Decode(nil, buf)
+			if err != nil {
+				level.Error(s.logger).Log("msg", "failed to decode cache entry", "err", err)
+				return nil, err
+			}
+			return d, nil
+		}))
+	}
+	return found, values, missing, err
+}
+
+// Exists doesn't need to decode values, so it is passed straight through.
+func (s *snappyCache) Exists(ctx context.Context, keys []string) ([]string, []string, error) {
+	return s.next.Exists(ctx, keys)
+}
+
+// FetchRange reads the range from the decoded value, as ranges of the
+// encoded value can't be decoded on their own.
+func (s *snappyCache) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	return fetchRangeViaFetch(ctx, s, key, offset, length)
+}
+
+func (s *snappyCache) StoreIfAbsent(ctx context.Context, key string, value []byte) (bool, error) {
+	return s.next.StoreIfAbsent(ctx, key, snappy.Encode(nil, value))
+}
+
 func (s *snappyCache) Stop() {
 	s.next.Stop()
 }
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/loki/v3/pkg/logqlmodel/stats"
+	"github.com/grafana/loki/v3/pkg/util/constants"
+)
+
+type snapshotFallback struct {
+	primary  Cache
+	snapshot Cache
+
+	fallbacks    prometheus.Counter
+	fallbackHits prometheus.Counter
+}
+
+// NewSnapshotFallback makes a new cache which serves reads from snapshot while
+// primary returns errors, e.g. during maintenance of its backend, instead of
+// missing every key. snapshot is read-only: all writes only target primary, so
+// snapshot must be populated separately, e.g. a disk cache populated earlier.
+// Stopping the cache stops both caches.
+func NewSnapshotFallback(name string, primary, snapshot Cache, reg prometheus.Registerer) Cache {
+	return &snapshotFallback{
+		primary:  primary,
+		snapshot: snapshot,
+
+		fallbacks: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace:   constants.Loki,
+			Name:        "cache_snapshot_fallbacks_total",
+			Help:        "Total count of requests served from the snapshot cache because the primary cache failed.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+		fallbackHits: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace:   constants.Loki,
+			Name:        "cache_snapshot_fallback_hits_total",
+			Help:        "Total count of keys found in the snapshot cache because the primary cache failed.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+	}
+}
+
+func (c *snapshotFallback) Store(ctx context.Context, keys []string, bufs [][]byte) error {
+	return c.primary.Store(ctx, keys, bufs)
+}
+
+func (c *snapshotFallback) Fetch(ctx context.Context, keys []string) ([]string, [][]byte, []string, error) {
+	found, bufs, missing, err := c.primary.Fetch(ctx, keys)
+	if err == nil {
+		return found, bufs, missing, nil
+	}
+
+	c.fallbacks.Inc()
+	snapshotFound, snapshotBufs, snapshotMissing, snapshotErr := c.snapshot.Fetch(ctx, keys)
+	if snapshotErr != nil {
+		// Report the primary's error, as that's what needs fixing.
+		return found, bufs, missing, err
+	}
+	c.fallbackHits.Add(float64(len(snapshotFound)))
+	return snapshotFound, snapshotBufs, snapshotMissing, nil
+}
+
+func (c *snapshotFallback) Exists(ctx context.Context, keys []string) ([]string, []string, error) {
+	present, missing, err := c.primary.Exists(ctx, keys)
+	if err == nil {
+		return present, missing, nil
+	}
+
+	c.fallbacks.Inc()
+	snapshotPresent, snapshotMissing, snapshotErr := c.snapshot.Exists(ctx, keys)
+	if snapshotErr != nil {
+		return present, missing, err
+	}
+	return snapshotPresent, snapshotMissing, nil
+}
+
+func (c *snapshotFallback) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	value, err := c.primary.FetchRange(ctx, key, offset, length)
+	if err == nil || errors.Is(err, ErrNotFound) {
+		return value, err
+	}
+
+	c.fallbacks.Inc()
+	snapshotValue, snapshotErr := c.snapshot.FetchRange(ctx, key, offset, length)
+	if snapshotErr != nil {
+		if errors.Is(snapshotErr, ErrNotFound) {
+			return nil, snapshotErr
+		}
+		return nil, err
+	}
+	c.fallbackHits.Inc()
+	return snapshotValue, nil
+}
+
+func (c *snapshotFallback) StoreIfAbsent(ctx context.Context, key string, value []byte) (bool, error) {
+	return c.primary.StoreIfAbsent(ctx, key, value)
+}
+
+func (c *snapshotFallback) Stop() {
+	c.primary.Stop()
+	c.snapshot.Stop()
+}
+
+func (c *snapshotFallback) GetCacheType() stats.CacheType {
+	return c.primary.GetCacheType()
+}
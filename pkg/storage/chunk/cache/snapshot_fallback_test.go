@@ -0,0 +1,51 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/storage/chunk/cache"
+)
+
+func TestSnapshotFallbackSimple(t *testing.T) {
+	c := cache.NewSnapshotFallback("test", cache.NewMockCache(), cache.NewMockCache(), prometheus.NewRegistry())
+	testCache(t, c)
+}
+
+func TestSnapshotFallback(t *testing.T) {
+	ctx := context.Background()
+	primary := cache.NewMockCache()
+	snapshot := cache.NewMockCache()
+	reg := prometheus.NewRegistry()
+	c := cache.NewSnapshotFallback("test", primary, snapshot, reg)
+
+	require.NoError(t, snapshot.Store(ctx, []string{"a"}, [][]byte{[]byte("snapshot")}))
+	require.NoError(t, c.Store(ctx, []string{"a", "b"}, [][]byte{[]byte("primary"), []byte("primary")}))
+	require.Len(t, snapshot.GetInternal(), 1, "stores must only target the primary")
+
+	found, bufs, missing, err := c.Fetch(ctx, []string{"a", "b"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, found)
+	require.Equal(t, [][]byte{[]byte("primary"), []byte("primary")}, bufs)
+	require.Empty(t, missing)
+	require.Zero(t, counterValue(t, reg, "loki_cache_snapshot_fallbacks_total"))
+
+	// Serve from the snapshot while the primary fails.
+	primary.SetErr(nil, errors.New("maintenance"))
+	found, bufs, missing, err = c.Fetch(ctx, []string{"a", "b"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, found)
+	require.Equal(t, [][]byte{[]byte("snapshot")}, bufs)
+	require.Equal(t, []string{"b"}, missing)
+	require.Equal(t, float64(1), counterValue(t, reg, "loki_cache_snapshot_fallbacks_total"))
+	require.Equal(t, float64(1), counterValue(t, reg, "loki_cache_snapshot_fallback_hits_total"))
+
+	// The primary's error is returned if the snapshot fails too.
+	snapshot.SetErr(nil, errors.New("snapshot unavailable"))
+	_, _, _, err = c.Fetch(ctx, []string{"a"})
+	require.EqualError(t, err, "maintenance")
+}
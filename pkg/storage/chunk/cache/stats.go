@@ -48,6 +48,33 @@ func (s statsCollector) Fetch(ctx context.Context, keys []string) (found []strin
 	return found, bufs, missing, err
 }
 
+func (s statsCollector) Exists(ctx context.Context, keys []string) (present []string, missing []string, err error) {
+	st := stats.FromContext(ctx)
+	st.AddCacheRequest(s.Cache.GetCacheType(), 1)
+
+	present, missing, err = s.Cache.Exists(ctx, keys)
+
+	st.AddCacheEntriesFound(s.Cache.GetCacheType(), len(present))
+	st.AddCacheEntriesRequested(s.Cache.GetCacheType(), len(keys))
+
+	return present, missing, err
+}
+
+func (s statsCollector) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	st := stats.FromContext(ctx)
+	st.AddCacheRequest(s.Cache.GetCacheType(), 1)
+
+	start := time.Now()
+	value, err := s.Cache.FetchRange(ctx, key, offset, length)
+	st.AddCacheDownloadTime(s.Cache.GetCacheType(), time.Since(start))
+	if err == nil {
+		st.AddCacheEntriesFound(s.Cache.GetCacheType(), 1)
+		st.AddCacheBytesRetrieved(s.Cache.GetCacheType(), len(value))
+	}
+	st.AddCacheEntriesRequested(s.Cache.GetCacheType(), 1)
+	return value, err
+}
+
 func (s statsCollector) Stop() {
 	s.Cache.Stop()
 }
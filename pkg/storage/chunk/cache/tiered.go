@@ -77,6 +77,51 @@ func (t tiered) Fetch(ctx context.Context, keys []string) ([]string, [][]byte, [
 	return resultKeys, resultBufs, missing, nil
 }
 
+func (t tiered) Exists(ctx context.Context, keys []string) ([]string, []string, error) {
+	present := make(map[string]struct{}, len(keys))
+	missing := keys
+
+	for _, c := range []Cache(t) {
+		var (
+			passKeys []string
+			err      error
+		)
+
+		passKeys, missing, err = c.Exists(ctx, missing)
+		if err != nil {
+			return passKeys, missing, err
+		}
+		for _, key := range passKeys {
+			present[key] = struct{}{}
+		}
+
+		if len(missing) == 0 {
+			break
+		}
+	}
+
+	resultKeys := make([]string, 0, len(present))
+	for _, key := range keys {
+		if _, ok := present[key]; ok {
+			resultKeys = append(resultKeys, key)
+		}
+	}
+
+	return resultKeys, missing, nil
+}
+
+// FetchRange reads the range from the fetched value, so the value is
+// backfilled to earlier tiers like on Fetch.
+func (t tiered) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	return fetchRangeViaFetch(ctx, t, key, offset, length)
+}
+
+// StoreIfAbsent isn't supported, as a key can't be stored conditionally in
+// all tiers at once.
+func (t tiered) StoreIfAbsent(context.Context, string, []byte) (bool, error) {
+	return false, ErrUnsupported
+}
+
 func (t tiered) Stop() {
 	for _, c := range []Cache(t) {
 		c.Stop()
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/loki/v3/pkg/util/constants"
+)
+
+// expiryMagic marks values which are prefixed with their expiry timestamp.
+var expiryMagic = []byte{0xca, 0xc4, 0xe7, 0x71}
+
+// expiryHeaderSize is the size of the magic and the expiry timestamp prefixed to values.
+var expiryHeaderSize = len(expiryMagic) + 8
+
+type ttlObserver struct {
+	Cache
+	ttl time.Duration
+
+	ttlRemaining prometheus.Histogram
+}
+
+// NewTTLObserver returns a new Cache which prefixes every stored value with
+// its expiry, assuming it is stored with the given ttl, and observes the time
+// remaining until expiry for each hit. This helps tell apart misses caused by
+// eviction from misses caused by expiry. Values stored without the wrapper are
+// returned unchanged and not observed.
+func NewTTLObserver(name string, cache Cache, ttl time.Duration, reg prometheus.Registerer) Cache {
+	return &ttlObserver{
+		Cache: cache,
+		ttl:   ttl,
+
+		ttlRemaining: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Namespace: constants.Loki,
+			Name:      "cache_item_ttl_remaining_seconds",
+			Help:      "Time remaining until expiry of items fetched from the cache in seconds.",
+			// From 1 minute to ~1 week.
+			Buckets:     prometheus.ExponentialBuckets(60, 4, 8),
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+	}
+}
+
+func (t *ttlObserver) Store(ctx context.Context, keys []string, bufs [][]byte) error {
+	expiry := time.Now().Add(t.ttl)
+
+	withExpiry := make([][]byte, len(bufs))
+	for i, buf := range bufs {
+		withExpiry[i] = prefixExpiry(buf, expiry)
+	}
+	return t.Cache.Store(ctx, keys, withExpiry)
+}
+
+func (t *ttlObserver) Fetch(ctx context.Context, keys []string) ([]string, [][]byte, []string, error) {
+	found, bufs, missing, err := t.Cache.Fetch(ctx, keys)
+
+	now := time.Now()
+	for i, buf := range bufs {
+		expiry, value, ok := splitExpiry(buf)
+		if !ok {
+			continue
+		}
+		t.ttlRemaining.Observe(max(expiry.Sub(now), 0).Seconds())
+		bufs[i] = value
+	}
+	return found, bufs, missing, err
+}
+
+// FetchRange reads the range from the fetched value, as the stored value
+// is prefixed with its expiry.
+func (t *ttlObserver) FetchRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	return fetchRangeViaFetch(ctx, t, key, offset, length)
+}
+
+func (t *ttlObserver) StoreIfAbsent(ctx context.Context, key string, value []byte) (bool, error) {
+	return t.Cache.StoreIfAbsent(ctx, key, prefixExpiry(value, time.Now().Add(t.ttl)))
+}
+
+// prefixExpiry returns a copy of buf prefixed with the expiry header.
+func prefixExpiry(buf []byte, expiry time.Time) []byte {
+	b := make([]byte, 0, expiryHeaderSize+len(buf))
+	b = append(b, expiryMagic...)
+	b = binary.BigEndian.AppendUint64(b, uint64(expiry.UnixNano()))
+	return append(b, buf...)
+}
+
+// splitExpiry splits a value prefixed by prefixExpiry into its expiry and the
+// original value. It returns false if buf isn't prefixed with an expiry.
+func splitExpiry(buf []byte) (time.Time, []byte, bool) {
+	if len(buf) < expiryHeaderSize || !bytes.HasPrefix(buf, expiryMagic) {
+		return time.Time{}, nil, false
+	}
+	expiry := time.Unix(0, int64(binary.BigEndian.Uint64(buf[len(expiryMagic):expiryHeaderSize])))
+	return expiry, buf[expiryHeaderSize:], true
+}
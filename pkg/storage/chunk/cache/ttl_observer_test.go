@@ -0,0 +1,41 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/v3/pkg/storage/chunk/cache"
+)
+
+func TestTTLObserverSimple(t *testing.T) {
+	testCache(t, cache.NewTTLObserver("test", cache.NewMockCache(), time.Hour, prometheus.NewRegistry()))
+}
+
+func TestTTLObserver(t *testing.T) {
+	ctx := context.Background()
+	backend := cache.NewMockCache()
+	reg := prometheus.NewRegistry()
+	c := cache.NewTTLObserver("test", backend, time.Hour, reg)
+
+	require.NoError(t, c.Store(ctx, []string{"key1"}, [][]byte{[]byte("hello")}))
+	// Values stored without the wrapper have no expiry.
+	require.NoError(t, backend.Store(ctx, []string{"key2"}, [][]byte{[]byte("world")}))
+
+	found, bufs, missing, err := c.Fetch(ctx, []string{"key1", "key2", "key3"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"key1", "key2"}, found)
+	require.Equal(t, [][]byte{[]byte("hello"), []byte("world")}, bufs)
+	require.Equal(t, []string{"key3"}, missing)
+
+	// Only the value with an expiry is observed, with close to an hour remaining.
+	metrics, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	histogram := metrics[0].GetMetric()[0].GetHistogram()
+	require.Equal(t, uint64(1), histogram.GetSampleCount())
+	require.InDelta(t, time.Hour.Seconds(), histogram.GetSampleSum(), 60)
+}
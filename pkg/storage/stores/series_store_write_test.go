@@ -26,6 +26,11 @@ func (m *mockCache) Store(_ context.Context, _ []string, _ [][]byte) error {
 	return nil
 }
 
+func (m *mockCache) StoreIfAbsent(_ context.Context, _ string, _ []byte) (bool, error) {
+	m.called++
+	return true, nil
+}
+
 func (m *mockCache) Fetch(_ context.Context, keys []string) (found []string, bufs [][]byte, missing []string, err error) {
 	for _, key := range keys {
 		val, ok := m.data[key]
@@ -40,6 +45,22 @@ func (m *mockCache) Fetch(_ context.Context, keys []string) (found []string, buf
 	return
 }
 
+func (m *mockCache) Exists(_ context.Context, keys []string) (present []string, missing []string, err error) {
+	for _, key := range keys {
+		if _, ok := m.data[key]; !ok {
+			missing = append(missing, key)
+			continue
+		}
+		present = append(present, key)
+	}
+
+	return
+}
+
+func (m *mockCache) FetchRange(_ context.Context, _ string, _, _ int64) ([]byte, error) {
+	panic("not implemented")
+}
+
 func (m *mockCache) Stop()                         {}
 func (m *mockCache) GetCacheType() stats.CacheType { return stats.ChunkCache }
 